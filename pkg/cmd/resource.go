@@ -0,0 +1,475 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	// Packages
+	server "github.com/mutablelogic/go-server"
+	httpclient "github.com/mutablelogic/go-server/pkg/provider/httpclient"
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+	tui "github.com/mutablelogic/go-server/pkg/tui"
+	yaml "gopkg.in/yaml.v3"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type ResourceCommands struct {
+	Providers ListProvidersCommand `cmd:"" name:"providers" help:"List the providers, such as plugins, whose resource types are registered." group:"RESOURCES"`
+	Resources ListResourcesCommand `cmd:"" name:"resources" help:"List resource types, or the instances of a resource type." group:"RESOURCES"`
+	Resource  ResourceCommand      `cmd:"" name:"resource" help:"Create, plan, apply and destroy resource instances." group:"RESOURCES"`
+}
+
+type ListProvidersCommand struct{}
+
+type ListResourcesCommand struct {
+	schema.ListResourcesRequest
+}
+
+type ResourceCommand struct {
+	Create  CreateResourceCommand  `cmd:"" name:"create" help:"Create a resource instance."`
+	Import  ImportResourceCommand  `cmd:"" name:"import" help:"Create a resource instance which manages an existing resource."`
+	Get     GetResourceCommand     `cmd:"" name:"get" help:"Get a resource instance and its state."`
+	Plan    PlanResourceCommand    `cmd:"" name:"plan" help:"Plan changes to the attributes of a resource instance."`
+	Apply   ApplyResourceCommand   `cmd:"" name:"apply" help:"Apply changes to the attributes of a resource instance."`
+	Destroy DestroyResourceCommand `cmd:"" name:"destroy" help:"Destroy a resource instance."`
+}
+
+type CreateResourceCommand struct {
+	schema.CreateResourceInstanceRequest
+}
+
+type ImportResourceCommand struct {
+	Name string `arg:"" help:"Instance name as resource.label (e.g. \"httpserver.main\")"`
+	schema.ImportResourceInstanceRequest
+}
+
+type GetResourceCommand struct {
+	Name string `arg:"" help:"Instance name as resource.label (e.g. \"httpserver.main\")"`
+}
+
+type PlanResourceCommand struct {
+	ResourceAttributes
+}
+
+type ApplyResourceCommand struct {
+	ResourceAttributes
+	PlanID string `name:"plan" help:"Apply a plan returned by \"resource plan\", rather than the attributes."`
+}
+
+type DestroyResourceCommand struct {
+	Name    string `arg:"" help:"Instance name as resource.label (e.g. \"httpserver.main\")"`
+	Cascade bool   `name:"cascade" help:"Also destroy the instances which depend on this one."`
+}
+
+// ResourceAttributes are the attribute values for plan and apply, as
+// key=value pairs or read from a JSON or YAML file. Pairs override values
+// from the file. The "lifecycle" key sets the lifecycle options rather
+// than an attribute.
+type ResourceAttributes struct {
+	Name       string   `arg:"" help:"Instance name as resource.label (e.g. \"httpserver.main\")"`
+	Attributes []string `arg:"" optional:"" name:"attribute" help:"Attribute values as key=value. Lists and objects are given as JSON (e.g. methods='[\"GET\"]')."`
+	File       string   `name:"file" short:"f" type:"existingfile" help:"Read attribute values from a JSON or YAML file."`
+	Replace    bool     `name:"replace" help:"Replace the instance with a new instance, rather than update it."`
+}
+
+// providerRow is a row in the table of providers.
+type providerRow struct {
+	schema.ProviderMeta
+}
+
+// resourceRow is a row in the table of resource types.
+type resourceRow struct {
+	schema.ResourceMeta
+}
+
+// instanceRow is a row in the table of resource instances.
+type instanceRow struct {
+	schema.InstanceMeta
+}
+
+// attributeRow is a row in the table of instance state.
+type attributeRow struct {
+	Name  string
+	Value any
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// COMMANDS
+
+func (cmd *ListProvidersCommand) Run(ctx server.Cmd) error {
+	client, err := resourceClient(ctx)
+	if err != nil {
+		return err
+	}
+	resp, err := client.ListProviders(ctx.Context())
+	if err != nil {
+		return err
+	}
+	if ctx.IsTerm() == 0 {
+		return writeJSON(resp)
+	}
+	table := tui.TableFor[providerRow](tui.SetWidth(ctx.IsTerm()))
+	for _, p := range resp.Providers {
+		table.Append(providerRow{p})
+	}
+	_, err = table.Write(os.Stdout)
+	return err
+}
+
+func (cmd *ListResourcesCommand) Run(ctx server.Cmd) error {
+	client, err := resourceClient(ctx)
+	if err != nil {
+		return err
+	}
+	resp, err := client.ListResources(ctx.Context(), cmd.ListResourcesRequest)
+	if err != nil {
+		return err
+	}
+	if ctx.IsTerm() == 0 {
+		return writeJSON(resp)
+	}
+
+	// When a type is given, list its instances
+	if cmd.Type != nil {
+		table := tui.TableFor[instanceRow](tui.SetWidth(ctx.IsTerm()))
+		for _, r := range resp.Resources {
+			for _, instance := range r.Instances {
+				table.Append(instanceRow{instance})
+			}
+		}
+		_, err = table.Write(os.Stdout)
+		return err
+	}
+
+	// Otherwise list the resource types
+	table := tui.TableFor[resourceRow](tui.SetWidth(ctx.IsTerm()))
+	for _, r := range resp.Resources {
+		table.Append(resourceRow{r})
+	}
+	_, err = table.Write(os.Stdout)
+	return err
+}
+
+func (cmd *CreateResourceCommand) Run(ctx server.Cmd) error {
+	client, err := resourceClient(ctx)
+	if err != nil {
+		return err
+	}
+	resp, err := client.CreateResourceInstance(ctx.Context(), cmd.CreateResourceInstanceRequest)
+	if err != nil {
+		return err
+	}
+	if ctx.IsTerm() == 0 {
+		return writeJSON(resp)
+	}
+	_, err = tui.TableFor[instanceRow](tui.SetWidth(ctx.IsTerm())).Write(os.Stdout, instanceRow{resp.Instance})
+	return err
+}
+
+func (cmd *ImportResourceCommand) Run(ctx server.Cmd) error {
+	client, err := resourceClient(ctx)
+	if err != nil {
+		return err
+	}
+	resp, err := client.ImportResourceInstance(ctx.Context(), cmd.Name, cmd.ImportResourceInstanceRequest)
+	if err != nil {
+		return err
+	}
+	if ctx.IsTerm() == 0 {
+		return writeJSON(resp)
+	}
+	_, err = tui.TableFor[instanceRow](tui.SetWidth(ctx.IsTerm())).Write(os.Stdout, instanceRow{resp.Instance})
+	return err
+}
+
+func (cmd *GetResourceCommand) Run(ctx server.Cmd) error {
+	client, err := resourceClient(ctx)
+	if err != nil {
+		return err
+	}
+	resp, err := client.GetResourceInstance(ctx.Context(), cmd.Name)
+	if err != nil {
+		return err
+	}
+	if ctx.IsTerm() == 0 {
+		return writeJSON(resp)
+	}
+
+	// Write the instance, then its state
+	if _, err := tui.TableFor[instanceRow](tui.SetWidth(ctx.IsTerm())).Write(os.Stdout, instanceRow{resp.Instance}); err != nil {
+		return err
+	}
+	table := tui.TableFor[attributeRow](tui.SetWidth(ctx.IsTerm()))
+	for _, name := range slices.Sorted(maps.Keys(resp.Instance.State)) {
+		table.Append(attributeRow{Name: name, Value: resp.Instance.State[name]})
+	}
+	_, err = table.Write(os.Stdout)
+	return err
+}
+
+func (cmd *PlanResourceCommand) Run(ctx server.Cmd) error {
+	attrs, lifecycle, err := cmd.state()
+	if err != nil {
+		return err
+	}
+	client, err := resourceClient(ctx)
+	if err != nil {
+		return err
+	}
+	resp, err := client.UpdateResourceInstance(ctx.Context(), cmd.Name, schema.UpdateResourceInstanceRequest{
+		Attributes: attrs,
+		Lifecycle:  lifecycle,
+		Replace:    cmd.Replace,
+	})
+	if err != nil {
+		return err
+	}
+	if ctx.IsTerm() == 0 {
+		return writeJSON(resp)
+	}
+	if err := writePlan(cmd.Name, resp.Plan); err != nil {
+		return err
+	}
+	if resp.PlanID != "" && resp.Plan.Action != schema.ActionNoop {
+		_, err = fmt.Printf("\nApply this plan with: %s resource apply %s --plan %s\n", ctx.Name(), cmd.Name, resp.PlanID)
+	}
+	return err
+}
+
+func (cmd *ApplyResourceCommand) Run(ctx server.Cmd) error {
+	attrs, lifecycle, err := cmd.state()
+	if err != nil {
+		return err
+	}
+	if cmd.PlanID != "" && (len(attrs) > 0 || lifecycle != nil) {
+		return fmt.Errorf("attributes cannot be set when applying a plan")
+	}
+	client, err := resourceClient(ctx)
+	if err != nil {
+		return err
+	}
+	resp, err := client.UpdateResourceInstance(ctx.Context(), cmd.Name, schema.UpdateResourceInstanceRequest{
+		Attributes: attrs,
+		Lifecycle:  lifecycle,
+		Apply:      true,
+		Replace:    cmd.Replace,
+		PlanID:     cmd.PlanID,
+	})
+	if err != nil {
+		return err
+	}
+	if ctx.IsTerm() == 0 {
+		return writeJSON(resp)
+	}
+	if err := writePlan(cmd.Name, resp.Plan); err != nil {
+		return err
+	}
+	_, err = fmt.Printf("\nApplied %s at generation %d\n", resp.Instance.Name, resp.Instance.Generation)
+	return err
+}
+
+func (cmd *DestroyResourceCommand) Run(ctx server.Cmd) error {
+	client, err := resourceClient(ctx)
+	if err != nil {
+		return err
+	}
+	resp, err := client.DestroyResourceInstance(ctx.Context(), cmd.Name, cmd.Cascade)
+	if err != nil {
+		return err
+	}
+	if ctx.IsTerm() == 0 {
+		return writeJSON(resp)
+	}
+	table := tui.TableFor[instanceRow](tui.SetWidth(ctx.IsTerm()))
+	for _, instance := range resp.Instances {
+		table.Append(instanceRow{instance})
+	}
+	_, err = table.Write(os.Stdout)
+	return err
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// TABLE ROWS
+
+func (r providerRow) Header() []string {
+	return []string{"Provider", "Version", "Description", "Resources"}
+}
+
+func (r providerRow) Cell(i int) string {
+	switch i {
+	case 0:
+		return r.Name
+	case 1:
+		return r.Version
+	case 2:
+		return r.Description
+	case 3:
+		return strings.Join(r.Resources, ", ")
+	default:
+		return ""
+	}
+}
+
+func (r providerRow) Width(i int) int {
+	return 0
+}
+
+func (r resourceRow) Header() []string {
+	return []string{"Resource", "Attributes", "Instances"}
+}
+
+func (r resourceRow) Cell(i int) string {
+	switch i {
+	case 0:
+		return r.Name
+	case 1:
+		names := make([]string, 0, len(r.Attributes))
+		for _, attr := range r.Attributes {
+			names = append(names, attr.Name)
+		}
+		return strings.Join(names, ", ")
+	case 2:
+		return fmt.Sprint(len(r.Instances))
+	default:
+		return ""
+	}
+}
+
+func (r resourceRow) Width(i int) int {
+	return 0
+}
+
+func (r instanceRow) Header() []string {
+	return []string{"Name", "Generation", "References"}
+}
+
+func (r instanceRow) Cell(i int) string {
+	switch i {
+	case 0:
+		if r.ReadOnly {
+			return r.Name + " (readonly)"
+		}
+		return r.Name
+	case 1:
+		return fmt.Sprint(r.Generation)
+	case 2:
+		return strings.Join(r.References, ", ")
+	default:
+		return ""
+	}
+}
+
+func (r instanceRow) Width(i int) int {
+	return 0
+}
+
+func (r attributeRow) Header() []string {
+	return []string{"Attribute", "Value"}
+}
+
+func (r attributeRow) Cell(i int) string {
+	switch i {
+	case 0:
+		return r.Name
+	case 1:
+		if s, ok := r.Value.(string); ok {
+			return s
+		}
+		if data, err := json.Marshal(r.Value); err == nil {
+			return string(data)
+		}
+		return fmt.Sprint(r.Value)
+	default:
+		return ""
+	}
+}
+
+func (r attributeRow) Width(i int) int {
+	return 0
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// resourceClient returns a client for the resource API of the server.
+func resourceClient(ctx server.Cmd) (*httpclient.Client, error) {
+	endpoint, opts, err := ctx.ClientEndpoint()
+	if err != nil {
+		return nil, err
+	}
+	return httpclient.New(endpoint, opts...)
+}
+
+// state returns the attribute values from the file and the key=value pairs,
+// and the lifecycle options when they are set. A value which starts like a
+// JSON list, object or string is decoded as JSON; other values are strings,
+// which the server converts to the type of the attribute.
+func (a *ResourceAttributes) state() (schema.State, *schema.Lifecycle, error) {
+	state := make(schema.State)
+
+	// Read the file. YAML is a superset of JSON, so either can be decoded
+	if a.File != "" {
+		data, err := os.ReadFile(a.File)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := yaml.Unmarshal(data, &state); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", a.File, err)
+		}
+	}
+
+	// Set the key=value pairs
+	for _, pair := range a.Attributes {
+		key, value, ok := strings.Cut(pair, "=")
+		if key = strings.TrimSpace(key); !ok || key == "" {
+			return nil, nil, fmt.Errorf("invalid attribute %q, expected key=value", pair)
+		}
+		if strings.HasPrefix(value, "[") || strings.HasPrefix(value, "{") || strings.HasPrefix(value, `"`) {
+			var v any
+			if err := json.Unmarshal([]byte(value), &v); err != nil {
+				return nil, nil, fmt.Errorf("attribute %q: %w", key, err)
+			}
+			state[key] = v
+		} else {
+			state[key] = value
+		}
+	}
+
+	// Separate the lifecycle options from the attributes
+	return schema.LifecycleOf(state)
+}
+
+// writePlan writes a plan to stdout as a diff.
+func writePlan(name string, plan schema.Plan) error {
+	op := tui.DiffNone
+	switch plan.Action {
+	case schema.ActionCreate:
+		op = tui.DiffAdd
+	case schema.ActionUpdate, schema.ActionReplace:
+		op = tui.DiffChange
+	case schema.ActionDestroy:
+		op = tui.DiffRemove
+	}
+	diff := tui.Diff(op, fmt.Sprintf("%s (%s)", name, plan.Action))
+	for _, change := range plan.Changes {
+		diff.Append(change.Field, change.Old, change.New)
+	}
+	_, err := diff.Write(os.Stdout)
+	return err
+}
+
+// writeJSON writes v to stdout as indented JSON.
+func writeJSON(v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(append(data, '\n'))
+	return err
+}
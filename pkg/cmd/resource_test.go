@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	// Packages
+	kong "github.com/alecthomas/kong"
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+)
+
+// Test_ResourceAttributes_Pairs verifies that key=value pairs are parsed as
+// strings, or as JSON when they look like JSON.
+func Test_ResourceAttributes_Pairs(t *testing.T) {
+	tests := []struct {
+		name    string
+		pairs   []string
+		want    schema.State
+		wantErr bool
+	}{
+		{"string", []string{"host=localhost", "port=8080"}, schema.State{"host": "localhost", "port": "8080"}, false},
+		{"value with equals", []string{"query=a=b"}, schema.State{"query": "a=b"}, false},
+		{"empty value", []string{"host="}, schema.State{"host": ""}, false},
+		{"json list", []string{`methods=["GET","POST"]`}, schema.State{"methods": []any{"GET", "POST"}}, false},
+		{"json object", []string{`tls={"cert":"a.pem"}`}, schema.State{"tls": map[string]any{"cert": "a.pem"}}, false},
+		{"json string", []string{`name="a b"`}, schema.State{"name": "a b"}, false},
+		{"missing equals", []string{"host"}, nil, true},
+		{"missing key", []string{"=localhost"}, nil, true},
+		{"invalid json", []string{"methods=[GET"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attrs := testAttributes(tt.pairs, "")
+			got, lifecycle, err := attrs.state()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("state() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("state() = %v, want %v", got, tt.want)
+			}
+			if lifecycle != nil {
+				t.Errorf("state() lifecycle = %v, want nil", lifecycle)
+			}
+		})
+	}
+}
+
+// Test_ResourceAttributes_File verifies that attributes are read from JSON
+// and YAML files, and that key=value pairs override them.
+func Test_ResourceAttributes_File(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"attrs.json": `{"host": "localhost", "port": 8080, "methods": ["GET"]}`,
+		"attrs.yaml": "host: localhost\nport: 8080\nmethods:\n  - GET\n",
+	}
+
+	for name, data := range files {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			attrs := testAttributes([]string{"host=example.com"}, path)
+			got, _, err := attrs.state()
+			if err != nil {
+				t.Fatalf("state() error = %v", err)
+			}
+			want := schema.State{"host": "example.com", "port": 8080, "methods": []any{"GET"}}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("state() = %v, want %v", got, want)
+			}
+		})
+	}
+
+	// Invalid and missing files are errors
+	invalid := filepath.Join(dir, "invalid.yaml")
+	if err := os.WriteFile(invalid, []byte("host: [localhost"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{invalid, filepath.Join(dir, "missing.json")} {
+		attrs := testAttributes(nil, path)
+		if _, _, err := attrs.state(); err == nil {
+			t.Errorf("state() with file %q: expected an error", filepath.Base(path))
+		}
+	}
+}
+
+// Test_ResourceAttributes_Lifecycle verifies that the lifecycle key sets the
+// lifecycle options rather than an attribute.
+func Test_ResourceAttributes_Lifecycle(t *testing.T) {
+	attrs := testAttributes([]string{"port=1", `lifecycle={"prevent_destroy":true}`}, "")
+	got, lifecycle, err := attrs.state()
+	if err != nil {
+		t.Fatalf("state() error = %v", err)
+	}
+	if want := (schema.State{"port": "1"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("state() = %v, want %v", got, want)
+	}
+	if lifecycle == nil || !lifecycle.PreventDestroy {
+		t.Errorf("state() lifecycle = %v, want prevent_destroy", lifecycle)
+	}
+}
+
+// Test_ResourceCommand_Flags verifies that the plan and apply commands parse
+// the attributes, --file, --replace and --plan options.
+func Test_ResourceCommand_Flags(t *testing.T) {
+	var cmds ResourceCommand
+	parser, err := kong.New(&cmds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := parser.Parse([]string{"plan", "secret.a", "port=1", "host=a", "--replace"}); err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if plan := cmds.Plan; plan.Name != "secret.a" || !plan.Replace || !reflect.DeepEqual(plan.Attributes, []string{"port=1", "host=a"}) {
+		t.Errorf("plan = %+v", plan)
+	}
+
+	if _, err := parser.Parse([]string{"apply", "secret.a", "--plan", "abc"}); err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if apply := cmds.Apply; apply.Name != "secret.a" || apply.PlanID != "abc" || apply.Replace || len(apply.Attributes) != 0 {
+		t.Errorf("apply = %+v", apply)
+	}
+}
+
+// Test_ResourceCommand_Run verifies the requests sent by the plan and apply
+// commands.
+func Test_ResourceCommand_Run(t *testing.T) {
+	var got schema.UpdateResourceInstanceRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPatch || r.URL.Path != "/api/resource/secret.a" {
+			http.NotFound(w, r)
+			return
+		}
+		got = schema.UpdateResourceInstanceRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(schema.UpdateResourceInstanceResponse{
+			Instance: schema.InstanceMeta{Name: "secret.a"},
+			Plan:     schema.Plan{Action: schema.ActionReplace},
+		})
+	}))
+	t.Cleanup(server.Close)
+	g := newTestGlobal(t, server.Listener.Addr().String())
+
+	// Plan a replacement
+	plan := PlanResourceCommand{ResourceAttributes: testAttributes([]string{"port=1"}, "")}
+	plan.Replace = true
+	if err := plan.Run(g); err != nil {
+		t.Fatalf("plan Run() error = %v", err)
+	}
+	if !got.Replace || got.Apply || !reflect.DeepEqual(got.Attributes, schema.State{"port": "1"}) {
+		t.Errorf("plan request = %+v", got)
+	}
+
+	// Apply a saved plan
+	apply := ApplyResourceCommand{ResourceAttributes: testAttributes(nil, ""), PlanID: "abc"}
+	if err := apply.Run(g); err != nil {
+		t.Fatalf("apply Run() error = %v", err)
+	}
+	if !got.Apply || got.PlanID != "abc" || got.Replace || len(got.Attributes) != 0 {
+		t.Errorf("apply request = %+v", got)
+	}
+
+	// A saved plan cannot be applied with attributes
+	apply = ApplyResourceCommand{ResourceAttributes: testAttributes([]string{"port=2"}, ""), PlanID: "abc"}
+	if err := apply.Run(g); err == nil {
+		t.Error("apply Run() with a plan and attributes: expected an error")
+	}
+}
+
+// testAttributes returns the attributes of the instance "secret.a"
+// with the key=value pairs and file.
+func testAttributes(pairs []string, file string) ResourceAttributes {
+	return ResourceAttributes{Name: "secret.a", Attributes: pairs, File: file}
+}
@@ -1,8 +1,11 @@
 package cmd
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
 	"net/url"
 	"os"
 
@@ -13,6 +16,9 @@ import (
 	openapihttphandler "github.com/mutablelogic/go-server/pkg/openapi/httphandler"
 	openapi "github.com/mutablelogic/go-server/pkg/openapi/schema"
 	otel "github.com/mutablelogic/go-server/pkg/otel"
+	plugin "github.com/mutablelogic/go-server/pkg/plugin"
+	provider "github.com/mutablelogic/go-server/pkg/provider"
+	providerhttphandler "github.com/mutablelogic/go-server/pkg/provider/httphandler"
 	types "github.com/mutablelogic/go-server/pkg/types"
 	errgroup "golang.org/x/sync/errgroup"
 )
@@ -27,7 +33,9 @@ type RegisterFunc func(*httprouter.Router) error
 // RunServer is a general-purpose "run" command. Embed it in your CLI's command
 // struct to get a fully functional HTTP server with logging and OTel middleware.
 type RunServer struct {
-	OpenAPI bool `name:"openapi" help:"Serve OpenAPI spec at {prefix}/openapi.{json,yaml,html}" default:"true" negatable:""`
+	OpenAPI          bool     `name:"openapi" help:"Serve OpenAPI spec at {prefix}/openapi.{json,yaml,html}" default:"true" negatable:""`
+	Plugins          []string `name:"plugin" help:"Load provider plugins from files matching a glob pattern (e.g. \"plugins/*.so\"). May be repeated."`
+	SkipIncompatible bool     `name:"plugin-skip-incompatible" help:"Skip plugins whose manifest is not compatible with the server, rather than failing to start"`
 
 	// TLS server options
 	TLS struct {
@@ -42,6 +50,7 @@ type RunServer struct {
 	} `embed:"" prefix:"http."`
 
 	register []RegisterFunc
+	manager  *provider.Manager
 }
 
 // Register appends fns to the list of functions called to wire up routes
@@ -51,6 +60,16 @@ func (s *RunServer) Register(fns ...RegisterFunc) *RunServer {
 	return s
 }
 
+// Provider sets the manager which plugins given with --plugin are registered
+// with, and whose providers and resources are served at {prefix}/provider
+// and {prefix}/resource. When plugins are given without a manager, one is
+// created. Returns the receiver for
+// chaining.
+func (s *RunServer) Provider(manager *provider.Manager) *RunServer {
+	s.manager = manager
+	return s
+}
+
 ///////////////////////////////////////////////////////////////////////////////
 // COMMANDS
 
@@ -122,6 +141,29 @@ func (s *RunServer) Run(ctx server.Cmd) error {
 	}
 	srv.SetHandler(router)
 
+	// Load plugins, and serve the providers and resources. Plugins which run
+	// as a subprocess are closed after the manager, which destroys their
+	// instances
+	var plugins []plugin.Plugin
+	defer func() {
+		closePlugins(plugins)
+	}()
+	manager := s.manager
+	if manager == nil && len(s.Plugins) > 0 {
+		if manager, err = provider.New(ctx.Name(), ctx.Description(), ctx.Version()); err != nil {
+			return fmt.Errorf("provider: %w", err)
+		}
+		defer manager.Close(context.Background())
+	}
+	if manager != nil {
+		if plugins, err = s.loadPlugins(ctx, manager); err != nil {
+			return fmt.Errorf("plugin: %w", err)
+		}
+		if err := providerhttphandler.RegisterHandlers(router, manager); err != nil {
+			return fmt.Errorf("provider: %w", err)
+		}
+	}
+
 	// Register routes
 	for _, fn := range s.register {
 		if err := fn(router); err != nil {
@@ -167,3 +209,38 @@ func (s *RunServer) Run(ctx server.Cmd) error {
 	ctx.Logger().InfoContext(ctx.Context(), "terminated gracefully")
 	return nil
 }
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// loadPlugins loads the plugins matching the --plugin patterns and registers
+// their resource types with the manager. It returns the plugins which were
+// loaded, and the errors of all the plugins which could not be loaded or
+// registered.
+func (s *RunServer) loadPlugins(ctx server.Cmd, manager *provider.Manager) ([]plugin.Plugin, error) {
+	if len(s.Plugins) == 0 {
+		return nil, nil
+	}
+	opts := []plugin.Opt{plugin.WithLogger(ctx.Logger())}
+	if s.SkipIncompatible {
+		opts = append(opts, plugin.WithSkipIncompatible())
+	}
+	plugins, result := plugin.PluginsForPatternEx(s.Plugins, opts...)
+	for _, p := range plugins {
+		if err := manager.RegisterProvider(p); err != nil {
+			result = errors.Join(result, fmt.Errorf("%s: %w", p.Name(), err))
+			continue
+		}
+		ctx.Logger().InfoContext(ctx.Context(), "plugin loaded", "provider", p.Name(), "description", p.Description())
+	}
+	return plugins, result
+}
+
+// closePlugins stops the plugins which run as a subprocess.
+func closePlugins(plugins []plugin.Plugin) {
+	for _, p := range plugins {
+		if closer, ok := p.(io.Closer); ok {
+			_ = closer.Close()
+		}
+	}
+}
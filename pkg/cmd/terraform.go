@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+
+	// Packages
+	server "github.com/mutablelogic/go-server"
+	httpclient "github.com/mutablelogic/go-server/pkg/provider/httpclient"
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+	terraform "github.com/mutablelogic/go-server/pkg/provider/terraform"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type TerraformCommands struct {
+	TerraformSchema TerraformSchemaCommand `cmd:"" name:"terraform-schema" help:"Output the Terraform provider schema for the resource types of a running server, as JSON." group:"PROVIDER"`
+}
+
+type TerraformSchemaCommand struct {
+	Source string `name:"source" help:"Terraform provider source address. The last element prefixes resource type names." default:"registry.terraform.io/mutablelogic/${EXECUTABLE_NAME}"`
+	Output string `name:"output" short:"o" help:"Write the schema to a file rather than stdout." type:"path"`
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// COMMANDS
+
+func (cmd *TerraformSchemaCommand) Run(ctx server.Cmd) error {
+	endpoint, opts, err := ctx.ClientEndpoint()
+	if err != nil {
+		return err
+	}
+	client, err := httpclient.New(endpoint, opts...)
+	if err != nil {
+		return err
+	}
+
+	// Read the resource types from the server
+	resp, err := client.ListResources(ctx.Context(), schema.ListResourcesRequest{})
+	if err != nil {
+		return err
+	}
+
+	// Convert to the Terraform provider schema
+	schemas, err := terraform.New(cmd.Source, resp)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(schemas, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	// Write the schema
+	if cmd.Output != "" {
+		return os.WriteFile(cmd.Output, data, 0o644)
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
@@ -15,6 +15,13 @@ import (
 // Err turns a HTTP status code into an error
 type Err int
 
+// ErrDetail is implemented by errors which carry additional detail for
+// the error response, such as the fields which failed validation.
+type ErrDetail interface {
+	error
+	Detail() any
+}
+
 // ErrResponse is the JSON error body returned by all error responses.
 // It is also used to generate the OpenAPI response schema.
 type ErrResponse struct {
@@ -31,6 +38,7 @@ const (
 	ErrBadRequest         = Err(http.StatusBadRequest)
 	ErrNotFound           = Err(http.StatusNotFound)
 	ErrConflict           = Err(http.StatusConflict)
+	ErrPreconditionFailed = Err(http.StatusPreconditionFailed)
 	ErrNotImplemented     = Err(http.StatusNotImplemented)
 	ErrInternalError      = Err(http.StatusInternalServerError)
 	ErrNotAuthorized      = Err(http.StatusUnauthorized)
@@ -57,11 +65,14 @@ func Error(w http.ResponseWriter, err error, detail ...any) error {
 		e.Code = int(code)
 	}
 
-	// Set the detail for the error
+	// Set the detail for the error, from the error itself when none is given
+	var d ErrDetail
 	if len(detail) == 1 {
 		e.Detail = detail[0]
 	} else if len(detail) > 1 {
 		e.Detail = detail
+	} else if errors.As(err, &d) {
+		e.Detail = d.Detail()
 	}
 
 	// Write the error response
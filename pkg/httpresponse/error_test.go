@@ -2,6 +2,7 @@ package httpresponse
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -98,3 +99,23 @@ func Test_Error_With(t *testing.T) {
 		assert.Contains(actual.Reason, "wrapped")
 	})
 }
+
+type detailErr struct{}
+
+func (detailErr) Error() string { return "invalid" }
+func (detailErr) Detail() any   { return []string{"field"} }
+
+func Test_Error_005(t *testing.T) {
+	assert := assert.New(t)
+
+	// The detail is taken from an error which carries it
+	recorder := httptest.NewRecorder()
+	err := Error(recorder, fmt.Errorf("%w: %w", ErrBadRequest, detailErr{}))
+	assert.NoError(err)
+	assert.Equal(http.StatusBadRequest, recorder.Code)
+
+	var actual ErrResponse
+	err = json.Unmarshal(recorder.Body.Bytes(), &actual)
+	assert.NoError(err)
+	assert.Equal([]any{"field"}, actual.Detail)
+}
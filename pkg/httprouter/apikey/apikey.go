@@ -0,0 +1,122 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	// Packages
+	httpresponse "github.com/mutablelogic/go-server/pkg/httpresponse"
+	httprouter "github.com/mutablelogic/go-server/pkg/httprouter"
+	openapi "github.com/mutablelogic/go-server/pkg/openapi/schema"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Scheme is a security scheme which authenticates requests with an API key
+// in a header, query parameter or cookie, looked up by its hash in a
+// [KeyStore]. Register it with [httprouter.Router.RegisterSecurityScheme],
+// and the key is available to handlers with [KeyFromContext].
+type Scheme struct {
+	*opt
+	store KeyStore
+}
+
+// keyKey is the context key for the API key of a request.
+type keyKey struct{}
+
+var _ httprouter.SecurityScheme = (*Scheme)(nil)
+
+///////////////////////////////////////////////////////////////////////////////
+// LIFECYCLE
+
+// New returns an API-key security scheme which looks up keys in the store.
+func New(store KeyStore, opts ...Opt) (*Scheme, error) {
+	if store == nil {
+		return nil, httpresponse.ErrBadRequest.With("no key store")
+	}
+	o, err := applyOpts(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Scheme{opt: o, store: store}, nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Spec returns the OpenAPI security scheme.
+func (s *Scheme) Spec() openapi.SecurityScheme {
+	return openapi.SecurityScheme{
+		Type:        openapi.SecuritySchemeAPIKey,
+		Description: s.description,
+		Name:        s.name,
+		In:          s.in,
+	}
+}
+
+// Wrap returns a handler which looks up the key of a request, and checks
+// that it has not expired and has all the scopes, before calling the
+// handler with the key in the context of the request. A request without a
+// valid key is rejected with a 401 status, and a request whose key does not
+// have the scopes with a 403 status.
+func (s *Scheme) Wrap(handler http.HandlerFunc, scopes []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, err := s.Authenticate(r)
+		if err != nil {
+			_ = httpresponse.Error(w, err)
+			return
+		}
+		if !key.HasScopes(scopes...) {
+			_ = httpresponse.Error(w, httpresponse.ErrForbidden.Withf("API key requires scopes %q", scopes))
+			return
+		}
+		handler(w, r.WithContext(context.WithValue(r.Context(), keyKey{}, key)))
+	}
+}
+
+// Authenticate returns the key of a request. It returns
+// [httpresponse.ErrNotAuthorized] if the request has no key, or the key is
+// unknown or has expired.
+func (s *Scheme) Authenticate(r *http.Request) (Key, error) {
+	secret := s.secret(r)
+	if secret == "" {
+		return Key{}, httpresponse.ErrNotAuthorized.With("missing API key")
+	}
+	key, err := s.store.Lookup(r.Context(), Hash(secret))
+	if errors.Is(err, httpresponse.ErrNotFound) {
+		return Key{}, httpresponse.ErrNotAuthorized.With("invalid API key")
+	} else if err != nil {
+		return Key{}, err
+	}
+	if key.Expired(s.now()) {
+		return Key{}, httpresponse.ErrNotAuthorized.With("API key has expired")
+	}
+	return key, nil
+}
+
+// KeyFromContext returns the API key of a request authenticated by a
+// [Scheme].
+func KeyFromContext(ctx context.Context) (Key, bool) {
+	key, ok := ctx.Value(keyKey{}).(Key)
+	return key, ok
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// secret returns the key secret of a request, or an empty string.
+func (s *Scheme) secret(r *http.Request) string {
+	switch s.in {
+	case openapi.ParameterInQuery:
+		return r.URL.Query().Get(s.name)
+	case openapi.ParameterInCookie:
+		if cookie, err := r.Cookie(s.name); err == nil {
+			return cookie.Value
+		}
+		return ""
+	default:
+		return r.Header.Get(s.name)
+	}
+}
@@ -0,0 +1,184 @@
+package apikey_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	// Packages
+	httpresponse "github.com/mutablelogic/go-server/pkg/httpresponse"
+	apikey "github.com/mutablelogic/go-server/pkg/httprouter/apikey"
+	openapi "github.com/mutablelogic/go-server/pkg/openapi/schema"
+	assert "github.com/stretchr/testify/assert"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TESTS
+
+func Test_KeyStore_001(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	store := apikey.NewMemory()
+	secret := apikey.Generate()
+	assert.NotEqual(secret, apikey.Generate())
+
+	// Keys are looked up by the hash of their secret
+	assert.NoError(store.Put(ctx, apikey.Key{ID: "b", Hash: apikey.Hash(secret), Scopes: []string{"read"}}))
+	key, err := store.Lookup(ctx, apikey.Hash(secret))
+	if assert.NoError(err) {
+		assert.Equal("b", key.ID)
+		assert.True(key.HasScopes("read"))
+		assert.False(key.HasScopes("read", "write"))
+	}
+	_, err = store.Lookup(ctx, apikey.Hash("other"))
+	assert.ErrorIs(err, httpresponse.ErrNotFound)
+
+	// Putting a key with the same ID replaces it, and keys are listed by ID
+	other := apikey.Generate()
+	assert.NoError(store.Put(ctx, apikey.Key{ID: "a", Hash: apikey.Hash("a")}))
+	assert.NoError(store.Put(ctx, apikey.Key{ID: "b", Hash: apikey.Hash(other)}))
+	_, err = store.Lookup(ctx, apikey.Hash(secret))
+	assert.ErrorIs(err, httpresponse.ErrNotFound)
+	keys, err := store.List(ctx)
+	if assert.NoError(err) && assert.Len(keys, 2) {
+		assert.Equal("a", keys[0].ID)
+		assert.Equal("b", keys[1].ID)
+	}
+
+	// Keys must have an ID and a hash, and the hash must be unique
+	assert.ErrorIs(store.Put(ctx, apikey.Key{Hash: apikey.Hash("c")}), httpresponse.ErrBadRequest)
+	assert.ErrorIs(store.Put(ctx, apikey.Key{ID: "c", Hash: "secret"}), httpresponse.ErrBadRequest)
+	assert.ErrorIs(store.Put(ctx, apikey.Key{ID: "c", Hash: apikey.Hash("a")}), httpresponse.ErrConflict)
+
+	// Deleting a key which does not exist is not an error
+	assert.NoError(store.Delete(ctx, "a"))
+	assert.NoError(store.Delete(ctx, "a"))
+	keys, _ = store.List(ctx)
+	assert.Len(keys, 1)
+}
+
+func Test_KeyStore_002(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "keys", "apikeys.json")
+	expires := time.Now().Add(time.Hour).Truncate(time.Second).UTC()
+
+	// A store which does not exist is empty
+	store, err := apikey.NewFile(path)
+	if !assert.NoError(err) {
+		return
+	}
+	keys, err := store.List(ctx)
+	assert.NoError(err)
+	assert.Empty(keys)
+
+	// Keys are written to the file and read back
+	assert.NoError(store.Put(ctx, apikey.Key{ID: "a", Hash: apikey.Hash("a"), Scopes: []string{"read"}, Expires: expires}))
+	assert.NoError(store.Put(ctx, apikey.Key{ID: "b", Hash: apikey.Hash("b")}))
+	assert.NoError(store.Delete(ctx, "b"))
+	store, err = apikey.NewFile(path)
+	if !assert.NoError(err) {
+		return
+	}
+	key, err := store.Lookup(ctx, apikey.Hash("a"))
+	if assert.NoError(err) {
+		assert.Equal(apikey.Key{ID: "a", Hash: apikey.Hash("a"), Scopes: []string{"read"}, Expires: expires}, key)
+	}
+	keys, _ = store.List(ctx)
+	assert.Len(keys, 1)
+
+	// A file with an invalid key is an error
+	assert.NoError(os.WriteFile(path, []byte(`{"keys":[{"id":"a","hash":"secret"}]}`), 0o600))
+	_, err = apikey.NewFile(path)
+	assert.ErrorIs(err, httpresponse.ErrBadRequest)
+}
+
+func Test_Scheme_001(t *testing.T) {
+	assert := assert.New(t)
+	_, err := apikey.New(nil)
+	assert.ErrorIs(err, httpresponse.ErrBadRequest)
+	_, err = apikey.New(apikey.NewMemory(), apikey.WithQuery(""))
+	assert.ErrorIs(err, httpresponse.ErrBadRequest)
+
+	// The key location is in the spec
+	for in, opt := range map[string]apikey.Opt{
+		openapi.ParameterInHeader: apikey.WithHeader("X-Key"),
+		openapi.ParameterInQuery:  apikey.WithQuery("X-Key"),
+		openapi.ParameterInCookie: apikey.WithCookie("X-Key"),
+	} {
+		scheme, err := apikey.New(apikey.NewMemory(), opt, apikey.WithDescription("API key"))
+		if assert.NoError(err) {
+			assert.Equal(openapi.SecurityScheme{Type: openapi.SecuritySchemeAPIKey, Description: "API key", Name: "X-Key", In: in}, scheme.Spec())
+		}
+	}
+	scheme, err := apikey.New(apikey.NewMemory())
+	if assert.NoError(err) {
+		assert.Equal("X-API-Key", scheme.Spec().Name)
+		assert.Equal(openapi.ParameterInHeader, scheme.Spec().In)
+	}
+}
+
+func Test_Scheme_002(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	store := apikey.NewMemory()
+	secrets := map[string]string{}
+	for _, key := range []apikey.Key{
+		{ID: "reader", Scopes: []string{"read"}},
+		{ID: "writer", Scopes: []string{"read", "write"}},
+		{ID: "expired", Scopes: []string{"read", "write"}, Expires: time.Now().Add(-time.Minute)},
+	} {
+		secrets[key.ID] = apikey.Generate()
+		key.Hash = apikey.Hash(secrets[key.ID])
+		if !assert.NoError(store.Put(ctx, key)) {
+			return
+		}
+	}
+
+	// The key is read from the header, query parameter or cookie
+	for _, location := range []struct {
+		opt apikey.Opt
+		set func(*http.Request, string)
+	}{
+		{apikey.WithHeader("X-Key"), func(r *http.Request, secret string) { r.Header.Set("X-Key", secret) }},
+		{apikey.WithQuery("key"), func(r *http.Request, secret string) { r.URL.RawQuery = "key=" + secret }},
+		{apikey.WithCookie("key"), func(r *http.Request, secret string) { r.AddCookie(&http.Cookie{Name: "key", Value: secret}) }},
+	} {
+		scheme, err := apikey.New(store, location.opt)
+		if !assert.NoError(err) {
+			return
+		}
+		handler := scheme.Wrap(func(w http.ResponseWriter, r *http.Request) {
+			key, ok := apikey.KeyFromContext(r.Context())
+			if assert.True(ok) {
+				_, _ = w.Write([]byte(key.ID))
+			}
+		}, []string{"write"})
+		request := func(secret string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if secret != "" {
+				location.set(req, secret)
+			}
+			rw := httptest.NewRecorder()
+			handler(rw, req)
+			return rw
+		}
+
+		// Requests with a key which has the scopes are authorized
+		rw := request(secrets["writer"])
+		assert.Equal(http.StatusOK, rw.Code)
+		assert.Equal("writer", rw.Body.String())
+
+		// Requests without a valid key are not authorized
+		for _, secret := range []string{"", "invalid", secrets["expired"]} {
+			assert.Equal(http.StatusUnauthorized, request(secret).Code, secret)
+		}
+
+		// Requests with a key without the scopes are forbidden
+		assert.Equal(http.StatusForbidden, request(secrets["reader"]).Code)
+	}
+}
@@ -0,0 +1,144 @@
+package apikey
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// File is a [KeyStore] backed by a JSON file on disk. Keys are held in
+// memory and the whole file is rewritten on every change.
+type File struct {
+	Memory
+	path string
+}
+
+// file is the on-disk format of a [File] store.
+type file struct {
+	Keys []Key `json:"keys"`
+}
+
+var _ KeyStore = (*File)(nil)
+
+///////////////////////////////////////////////////////////////////////////////
+// LIFECYCLE
+
+// NewFile returns a key store backed by the JSON file at path. If the file
+// exists its keys are loaded; otherwise the store starts empty and the file
+// is created on the first change. A file which cannot be decoded, or has an
+// invalid key, is an error rather than discarded.
+func NewFile(path string) (*File, error) {
+	self := &File{
+		Memory: *NewMemory(),
+		path:   path,
+	}
+
+	// Load existing file (ignore if it doesn't exist)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return self, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var contents file
+	if err := json.Unmarshal(data, &contents); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, key := range contents.Keys {
+		if err := key.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if err := self.put(key); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	// Return success
+	return self, nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Path returns the path of the JSON file.
+func (f *File) Path() string {
+	return f.path
+}
+
+// Put stores the key and writes the file.
+func (f *File) Put(ctx context.Context, key Key) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := key.Validate(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	prev, exists := f.keys[key.ID]
+	if err := f.put(key); err != nil {
+		return err
+	}
+	if err := f.save(); err != nil {
+		f.delete(key.ID)
+		if exists {
+			_ = f.put(prev)
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete removes the key with the ID and writes the file.
+func (f *File) Delete(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	prev, exists := f.keys[id]
+	if !exists {
+		return nil
+	}
+	f.delete(id)
+	if err := f.save(); err != nil {
+		_ = f.put(prev)
+		return err
+	}
+	return nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// save writes the store to disk as indented JSON, creating parent
+// directories as needed. The file is written to a temporary file and
+// renamed, so that a failed write does not corrupt the existing file. The
+// caller must hold f.mu.Lock().
+func (f *File) save() error {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(file{Keys: f.list()}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
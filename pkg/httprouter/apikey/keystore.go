@@ -0,0 +1,94 @@
+// Package apikey provides an API-key security scheme for httprouter, which
+// looks up the hashes of keys in a [KeyStore].
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"slices"
+	"time"
+
+	// Packages
+	httpresponse "github.com/mutablelogic/go-server/pkg/httpresponse"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// INTERFACES
+
+// KeyStore holds API keys by the hash of their secret, so that the secrets
+// themselves are never stored.
+type KeyStore interface {
+	// Lookup returns the key with the hash, or [httpresponse.ErrNotFound].
+	Lookup(context.Context, string) (Key, error)
+
+	// List returns every key, sorted by ID.
+	List(context.Context) ([]Key, error)
+
+	// Put stores the key, replacing any key with the same ID.
+	Put(context.Context, Key) error
+
+	// Delete removes the key with the ID. It is not an error if the key is
+	// not stored.
+	Delete(context.Context, string) error
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Key is an API key, identified by ID and looked up by the [Hash] of its
+// secret. A key without scopes can only be used for operations which
+// require none, and a key with an expiry time is rejected after it.
+type Key struct {
+	ID      string    `json:"id"`
+	Hash    string    `json:"hash"`
+	Scopes  []string  `json:"scopes,omitempty"`
+	Expires time.Time `json:"expires,omitzero"`
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Generate returns a new random secret for an API key, with 256 bits of
+// entropy.
+func Generate() string {
+	secret := make([]byte, 32)
+	_, _ = rand.Read(secret)
+	return base64.RawURLEncoding.EncodeToString(secret)
+}
+
+// Hash returns the hash of the secret of an API key, as stored in a
+// [KeyStore]. Secrets are random, so they are not salted.
+func Hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Validate returns an error if the key has no ID, or its hash is not a
+// hash returned by [Hash].
+func (k Key) Validate() error {
+	if k.ID == "" {
+		return httpresponse.ErrBadRequest.With("key ID is empty")
+	}
+	if data, err := hex.DecodeString(k.Hash); err != nil || len(data) != sha256.Size {
+		return httpresponse.ErrBadRequest.Withf("key %q: invalid hash", k.ID)
+	}
+	return nil
+}
+
+// Expired reports whether the key has expired at the time.
+func (k Key) Expired(now time.Time) bool {
+	return !k.Expires.IsZero() && !now.Before(k.Expires)
+}
+
+// HasScopes reports whether the key has all the scopes.
+func (k Key) HasScopes(scopes ...string) bool {
+	for _, scope := range scopes {
+		if !slices.Contains(k.Scopes, scope) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,130 @@
+package apikey
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+
+	// Packages
+	httpresponse "github.com/mutablelogic/go-server/pkg/httpresponse"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Memory is a [KeyStore] which holds keys in memory. It does not survive a
+// restart, and is intended for tests, for keys managed as resources, and
+// for embedding in other stores.
+type Memory struct {
+	mu     sync.RWMutex
+	keys   map[string]Key    // keys by ID
+	hashes map[string]string // key IDs by hash
+}
+
+var _ KeyStore = (*Memory)(nil)
+
+///////////////////////////////////////////////////////////////////////////////
+// LIFECYCLE
+
+// NewMemory returns an empty in-memory key store.
+func NewMemory() *Memory {
+	return &Memory{
+		keys:   make(map[string]Key),
+		hashes: make(map[string]string),
+	}
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Lookup returns the key with the hash.
+func (m *Memory) Lookup(ctx context.Context, hash string) (Key, error) {
+	if err := ctx.Err(); err != nil {
+		return Key{}, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	id, exists := m.hashes[hash]
+	if !exists {
+		return Key{}, httpresponse.ErrNotFound.With("key not found")
+	}
+	return clone(m.keys[id]), nil
+}
+
+// List returns every key, sorted by ID.
+func (m *Memory) List(ctx context.Context) ([]Key, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.list(), nil
+}
+
+// Put stores the key, replacing any key with the same ID. It returns
+// [httpresponse.ErrConflict] if another key has the same hash.
+func (m *Memory) Put(ctx context.Context, key Key) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := key.Validate(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.put(key)
+}
+
+// Delete removes the key with the ID.
+func (m *Memory) Delete(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.delete(id)
+	return nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// put stores the key. The caller must hold m.mu.Lock().
+func (m *Memory) put(key Key) error {
+	if id, exists := m.hashes[key.Hash]; exists && id != key.ID {
+		return httpresponse.ErrConflict.Withf("key %q has the same hash as key %q", key.ID, id)
+	}
+	m.delete(key.ID)
+	m.keys[key.ID] = clone(key)
+	m.hashes[key.Hash] = key.ID
+	return nil
+}
+
+// delete removes the key with the ID. The caller must hold m.mu.Lock().
+func (m *Memory) delete(id string) {
+	if prev, exists := m.keys[id]; exists {
+		delete(m.hashes, prev.Hash)
+		delete(m.keys, id)
+	}
+}
+
+// list returns a copy of every key, sorted by ID. The caller must hold at
+// least m.mu.RLock().
+func (m *Memory) list() []Key {
+	result := make([]Key, 0, len(m.keys))
+	for _, key := range m.keys {
+		result = append(result, clone(key))
+	}
+	slices.SortFunc(result, func(a, b Key) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return result
+}
+
+// clone returns a copy of the key which shares no scopes with it, so that
+// callers cannot modify stored keys.
+func clone(key Key) Key {
+	key.Scopes = slices.Clone(key.Scopes)
+	return key
+}
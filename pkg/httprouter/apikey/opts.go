@@ -0,0 +1,81 @@
+package apikey
+
+import (
+	"time"
+
+	// Packages
+	httpresponse "github.com/mutablelogic/go-server/pkg/httpresponse"
+	openapi "github.com/mutablelogic/go-server/pkg/openapi/schema"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type opt struct {
+	name        string
+	in          string
+	description string
+	now         func() time.Time
+}
+
+type Opt func(*opt) error
+
+///////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+const (
+	defaultHeader = "X-API-Key"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// LIFECYCLE
+
+func applyOpts(opts ...Opt) (*opt, error) {
+	o := &opt{name: defaultHeader, in: openapi.ParameterInHeader, now: time.Now}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// OPTIONS
+
+// Read the key from the header with the name, which is "X-API-Key" by
+// default.
+func WithHeader(name string) Opt {
+	return withLocation(openapi.ParameterInHeader, name)
+}
+
+// Read the key from the query parameter with the name.
+func WithQuery(name string) Opt {
+	return withLocation(openapi.ParameterInQuery, name)
+}
+
+// Read the key from the cookie with the name.
+func WithCookie(name string) Opt {
+	return withLocation(openapi.ParameterInCookie, name)
+}
+
+// Set the description of the security scheme in the OpenAPI specification.
+func WithDescription(description string) Opt {
+	return func(o *opt) error {
+		o.description = description
+		return nil
+	}
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+func withLocation(in, name string) Opt {
+	return func(o *opt) error {
+		if name == "" {
+			return httpresponse.ErrBadRequest.Withf("%s name is empty", in)
+		}
+		o.in, o.name = in, name
+		return nil
+	}
+}
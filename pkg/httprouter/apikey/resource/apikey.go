@@ -0,0 +1,115 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	// Packages
+	httpresponse "github.com/mutablelogic/go-server/pkg/httpresponse"
+	apikey "github.com/mutablelogic/go-server/pkg/httprouter/apikey"
+	provider "github.com/mutablelogic/go-server/pkg/provider"
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Resource describes the "apikey" resource type. Each instance puts an API
+// key into the [apikey.KeyStore] on Apply, with the instance name as its
+// ID, and deletes it on Destroy. Only the hash of the key is stored, so a
+// key is rotated by updating the instance with a new key.
+type Resource struct {
+	Key     string    `name:"key" sensitive:"" required:"" min:"16" help:"Secret of the API key, which clients send with requests"`
+	Scopes  []string  `name:"scopes" help:"Scopes which the key grants"`
+	Expires time.Time `name:"expires" help:"Time after which the key is rejected"`
+	store   apikey.KeyStore
+}
+
+// ResourceInstance is a live instance of an API key resource.
+type ResourceInstance struct {
+	provider.ResourceInstance[Resource]
+	store apikey.KeyStore
+}
+
+var _ schema.Resource = Resource{}
+var _ schema.ResourceInstance = (*ResourceInstance)(nil)
+
+///////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+const (
+	resourceName = "apikey"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// LIFECYCLE
+
+// NewResource creates an API key resource type which manages the keys in
+// the store.
+func NewResource(store apikey.KeyStore) Resource {
+	return Resource{store: store}
+}
+
+func (r Resource) New(name string) (schema.ResourceInstance, error) {
+	if r.store == nil {
+		return nil, httpresponse.ErrInternalError.With("apikey: no key store")
+	}
+	return &ResourceInstance{
+		ResourceInstance: provider.NewResourceInstance[Resource](r, name),
+		store:            r.store,
+	}, nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS - RESOURCE
+
+func (r Resource) Name() string {
+	return resourceName
+}
+
+func (r Resource) Schema() []schema.Attribute {
+	return schema.AttributesOf(Resource{})
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS - RESOURCE INSTANCE
+
+// Validate decodes the incoming state and returns the validated *Resource
+// configuration for use by Plan and Apply.
+func (r *ResourceInstance) Validate(ctx context.Context, state schema.State, resolve schema.Resolver) (any, error) {
+	return r.ResourceInstance.Validate(ctx, state, resolve)
+}
+
+// Apply puts the key into the store, replacing the previous key of the
+// instance.
+func (r *ResourceInstance) Apply(ctx context.Context, v any) error {
+	return r.ApplyConfig(ctx, v, func(ctx context.Context, c *Resource) error {
+		return r.store.Put(ctx, apikey.Key{
+			ID:      r.Name(),
+			Hash:    apikey.Hash(c.Key),
+			Scopes:  c.Scopes,
+			Expires: c.Expires,
+		})
+	})
+}
+
+// Destroy deletes the key from the store. A key with the same ID which was
+// put by another instance, such as a replacement created before this one
+// is destroyed, is left in place.
+func (r *ResourceInstance) Destroy(ctx context.Context) error {
+	c := r.State()
+	if c == nil {
+		return nil
+	}
+	key, err := r.store.Lookup(ctx, apikey.Hash(c.Key))
+	if errors.Is(err, httpresponse.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if key.ID != r.Name() {
+		return nil
+	}
+	return r.store.Delete(ctx, key.ID)
+}
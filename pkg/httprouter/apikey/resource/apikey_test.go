@@ -0,0 +1,96 @@
+package resource_test
+
+import (
+	"context"
+	"testing"
+
+	// Packages
+	httpresponse "github.com/mutablelogic/go-server/pkg/httpresponse"
+	apikey "github.com/mutablelogic/go-server/pkg/httprouter/apikey"
+	resource "github.com/mutablelogic/go-server/pkg/httprouter/apikey/resource"
+	provider "github.com/mutablelogic/go-server/pkg/provider"
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+	assert "github.com/stretchr/testify/assert"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// HELPERS
+
+// newTestManager returns a manager with an API key resource type which
+// manages the keys in the store.
+func newTestManager(t *testing.T, store apikey.KeyStore) *provider.Manager {
+	t.Helper()
+	mgr, err := provider.New("test", "test provider", "0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = mgr.Close(context.Background())
+	})
+	if err := mgr.RegisterResource(resource.NewResource(store)); err != nil {
+		t.Fatal(err)
+	}
+	return mgr
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// TESTS
+
+func Test_APIKey_001(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	store := apikey.NewMemory()
+	mgr := newTestManager(t, store)
+	_, err := mgr.CreateResourceInstance(ctx, schema.CreateResourceInstanceRequest{Name: "apikey.ci"})
+	if !assert.NoError(err) {
+		return
+	}
+
+	// Keys must be long enough
+	_, err = mgr.UpdateResourceInstance(ctx, "apikey.ci", schema.UpdateResourceInstanceRequest{
+		Attributes: schema.State{"key": "short"},
+		Apply:      true,
+	})
+	assert.Error(err)
+
+	// Applying the instance puts the key into the store
+	first := apikey.Generate()
+	_, err = mgr.UpdateResourceInstance(ctx, "apikey.ci", schema.UpdateResourceInstanceRequest{
+		Attributes: schema.State{"key": first, "scopes": []string{"read"}},
+		Apply:      true,
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	key, err := store.Lookup(ctx, apikey.Hash(first))
+	if assert.NoError(err) {
+		assert.Equal("apikey.ci", key.ID)
+		assert.Equal([]string{"read"}, key.Scopes)
+	}
+
+	// Updating the key rotates it
+	second := apikey.Generate()
+	_, err = mgr.UpdateResourceInstance(ctx, "apikey.ci", schema.UpdateResourceInstanceRequest{
+		Attributes: schema.State{"key": second, "scopes": []string{"read"}},
+		Apply:      true,
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	_, err = store.Lookup(ctx, apikey.Hash(first))
+	assert.ErrorIs(err, httpresponse.ErrNotFound)
+	_, err = store.Lookup(ctx, apikey.Hash(second))
+	assert.NoError(err)
+
+	// The key is redacted from the resource API
+	assert.Equal(schema.RedactedValue, schema.State{"key": second}.Redact(resource.Resource{}.Schema())["key"])
+
+	// Destroying the instance deletes the key
+	_, err = mgr.DestroyResourceInstance(ctx, schema.DestroyResourceInstanceRequest{Name: "apikey.ci"})
+	if !assert.NoError(err) {
+		return
+	}
+	keys, err := store.List(ctx)
+	assert.NoError(err)
+	assert.Empty(keys)
+}
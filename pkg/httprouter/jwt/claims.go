@@ -0,0 +1,109 @@
+package jwt
+
+import (
+	"context"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Claims are the claims of a verified token, decoded from JSON.
+type Claims map[string]any
+
+// claimsKey is the context key for the claims of a request.
+type claimsKey struct{}
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// ClaimsFromContext returns the claims of the token which authenticated a
+// request, from the context of a request handled by [Bearer.Wrap].
+func ClaimsFromContext(ctx context.Context) (Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(Claims)
+	return claims, ok
+}
+
+// Subject returns the "sub" claim.
+func (c Claims) Subject() string {
+	return c.string("sub")
+}
+
+// Issuer returns the "iss" claim.
+func (c Claims) Issuer() string {
+	return c.string("iss")
+}
+
+// Audience returns the "aud" claim, which is a string or a list of strings.
+func (c Claims) Audience() []string {
+	return c.strings("aud")
+}
+
+// ExpiresAt returns the "exp" claim, or the zero time if it is not set.
+func (c Claims) ExpiresAt() time.Time {
+	return c.time("exp")
+}
+
+// NotBefore returns the "nbf" claim, or the zero time if it is not set.
+func (c Claims) NotBefore() time.Time {
+	return c.time("nbf")
+}
+
+// Scopes returns the scopes of the "scope" claim, which is a space-separated
+// string, and the "scp" claim, which is a string or a list of strings.
+func (c Claims) Scopes() []string {
+	scopes := strings.Fields(c.string("scope"))
+	for _, scope := range c.strings("scp") {
+		scopes = append(scopes, strings.Fields(scope)...)
+	}
+	slices.Sort(scopes)
+	return slices.Compact(scopes)
+}
+
+// HasScopes reports whether the claims have all the scopes.
+func (c Claims) HasScopes(scopes ...string) bool {
+	granted := c.Scopes()
+	for _, scope := range scopes {
+		if !slices.Contains(granted, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+func (c Claims) string(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+func (c Claims) strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return []string{v}
+	case []any:
+		result := make([]string, 0, len(v))
+		for _, elem := range v {
+			if s, ok := elem.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	default:
+		return nil
+	}
+}
+
+func (c Claims) time(name string) time.Time {
+	v, ok := c[name].(float64)
+	if !ok {
+		return time.Time{}
+	}
+	sec, frac := math.Modf(v)
+	return time.Unix(int64(sec), int64(frac*float64(time.Second)))
+}
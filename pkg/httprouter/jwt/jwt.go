@@ -0,0 +1,194 @@
+package jwt
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	// Packages
+	httpresponse "github.com/mutablelogic/go-server/pkg/httpresponse"
+	httprouter "github.com/mutablelogic/go-server/pkg/httprouter"
+	openapi "github.com/mutablelogic/go-server/pkg/openapi/schema"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Bearer is a security scheme which authenticates requests with a JSON Web
+// Token in the Authorization header, signed with HS256, RS256 or ES256.
+// Register it with [httprouter.Router.RegisterSecurityScheme], and the
+// claims of the token are available to handlers with [ClaimsFromContext].
+type Bearer struct {
+	*opt
+}
+
+// header is the JOSE header of a token.
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+	Typ string `json:"typ,omitempty"`
+}
+
+var _ httprouter.SecurityScheme = (*Bearer)(nil)
+
+///////////////////////////////////////////////////////////////////////////////
+// LIFECYCLE
+
+// New returns a bearer security scheme which verifies tokens with the keys
+// set with [WithKey] and [WithJWKS], of which there must be at least one.
+func New(opts ...Opt) (*Bearer, error) {
+	o, err := applyOpts(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if len(o.keys) == 0 {
+		return nil, httpresponse.ErrBadRequest.With("no keys to verify tokens")
+	}
+	return &Bearer{opt: o}, nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Spec returns the OpenAPI security scheme.
+func (b *Bearer) Spec() openapi.SecurityScheme {
+	return openapi.SecurityScheme{
+		Type:         openapi.SecuritySchemeHTTP,
+		Description:  b.description,
+		Scheme:       "bearer",
+		BearerFormat: "JWT",
+	}
+}
+
+// Wrap returns a handler which verifies the token of a request, and that it
+// has all the scopes in its "scope" or "scp" claim, before calling the
+// handler with the claims in the context of the request. A request without
+// a valid token is rejected with a 401 status, and a request without the
+// scopes with a 403 status.
+func (b *Bearer) Wrap(handler http.HandlerFunc, scopes []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Read the token
+		token, ok := bearerToken(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer`)
+			_ = httpresponse.Error(w, httpresponse.ErrNotAuthorized.With("missing bearer token"))
+			return
+		}
+
+		// Verify the token
+		claims, err := b.Verify(token)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			_ = httpresponse.Error(w, err)
+			return
+		}
+
+		// Check the scopes
+		if !claims.HasScopes(scopes...) {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, strings.Join(scopes, " ")))
+			_ = httpresponse.Error(w, httpresponse.ErrForbidden.Withf("token requires scopes %q", scopes))
+			return
+		}
+
+		// Call the handler with the claims
+		handler(w, r.WithContext(context.WithValue(r.Context(), claimsKey{}, claims)))
+	}
+}
+
+// Verify verifies the signature and claims of a token, and returns its
+// claims. It returns [httpresponse.ErrNotAuthorized] if the token is not
+// valid.
+func (b *Bearer) Verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, httpresponse.ErrNotAuthorized.With("malformed token")
+	}
+
+	// Decode the header and signature
+	var hdr header
+	if err := decodeSegment(parts[0], &hdr); err != nil {
+		return nil, httpresponse.ErrNotAuthorized.Withf("malformed token header: %v", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, httpresponse.ErrNotAuthorized.Withf("malformed token signature: %v", err)
+	}
+
+	// Verify the signature with the key with the same ID, or any key for
+	// the algorithm when the token has no key ID
+	switch hdr.Alg {
+	case HS256, RS256, ES256:
+	default:
+		return nil, httpresponse.ErrNotAuthorized.Withf("unsupported token algorithm %q", hdr.Alg)
+	}
+	if !slices.ContainsFunc(b.keys, func(k key) bool {
+		return (hdr.Kid == "" || k.id == hdr.Kid) && k.verify(hdr.Alg, parts[0]+"."+parts[1], sig)
+	}) {
+		return nil, httpresponse.ErrNotAuthorized.With("invalid token signature")
+	}
+
+	// Decode and check the claims
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil || claims == nil {
+		return nil, httpresponse.ErrNotAuthorized.Withf("malformed token claims: %v", err)
+	}
+	if err := b.check(claims); err != nil {
+		return nil, err
+	}
+
+	// Return success
+	return claims, nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// check checks the time, issuer and audience claims.
+func (b *Bearer) check(claims Claims) error {
+	now := b.now()
+	for _, name := range []string{"exp", "nbf", "iat"} {
+		if v, exists := claims[name]; exists {
+			if _, ok := v.(float64); !ok {
+				return httpresponse.ErrNotAuthorized.Withf("invalid %q claim", name)
+			}
+		}
+	}
+	if exp := claims.ExpiresAt(); !exp.IsZero() && !now.Before(exp.Add(b.leeway)) {
+		return httpresponse.ErrNotAuthorized.With("token has expired")
+	}
+	if nbf := claims.NotBefore(); !nbf.IsZero() && now.Before(nbf.Add(-b.leeway)) {
+		return httpresponse.ErrNotAuthorized.With("token is not valid yet")
+	}
+	if b.issuer != "" && claims.Issuer() != b.issuer {
+		return httpresponse.ErrNotAuthorized.Withf("token issuer %q is not accepted", claims.Issuer())
+	}
+	if len(b.audience) > 0 && !slices.ContainsFunc(claims.Audience(), func(aud string) bool {
+		return slices.Contains(b.audience, aud)
+	}) {
+		return httpresponse.ErrNotAuthorized.With("token audience is not accepted")
+	}
+	return nil
+}
+
+// bearerToken returns the token of the Authorization header of a request.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// decodeSegment decodes a base64url-encoded JSON segment of a token.
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,251 @@
+package jwt_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	// Packages
+	httpresponse "github.com/mutablelogic/go-server/pkg/httpresponse"
+	jwt "github.com/mutablelogic/go-server/pkg/httprouter/jwt"
+	openapi "github.com/mutablelogic/go-server/pkg/openapi/schema"
+	assert "github.com/stretchr/testify/assert"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// HELPERS
+
+// sign returns a token with the claims, signed with the key.
+func sign(t *testing.T, alg, kid string, key any, claims map[string]any) string {
+	t.Helper()
+	header := map[string]any{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	data := segment(t, header) + "." + segment(t, claims)
+	hash := sha256.Sum256([]byte(data))
+	var sig []byte
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(data))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:]); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, hash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return data + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func segment(t *testing.T, v any) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func keys(t *testing.T) (*rsa.PrivateKey, *ecdsa.PrivateKey) {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rsaKey, ecKey
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// TESTS
+
+func Test_Bearer_001(t *testing.T) {
+	assert := assert.New(t)
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	rsaKey, ecKey := keys(t)
+	bearer, err := jwt.New(jwt.WithKey("hs", secret), jwt.WithKey("rs", &rsaKey.PublicKey), jwt.WithKey("es", &ecKey.PublicKey))
+	if !assert.NoError(err) {
+		return
+	}
+	claims := map[string]any{"sub": "user"}
+
+	// Tokens signed with each algorithm are verified, with or without a key ID
+	for _, token := range []string{
+		sign(t, jwt.HS256, "hs", secret, claims),
+		sign(t, jwt.RS256, "rs", rsaKey, claims),
+		sign(t, jwt.ES256, "es", ecKey, claims),
+		sign(t, jwt.ES256, "", ecKey, claims),
+	} {
+		verified, err := bearer.Verify(token)
+		if assert.NoError(err) {
+			assert.Equal("user", verified.Subject())
+		}
+	}
+
+	// Tokens signed with another key, with the key of another ID, with an
+	// algorithm which does not match the key type, or without a signature
+	// are not
+	otherKey, _ := keys(t)
+	for _, token := range []string{
+		sign(t, jwt.RS256, "rs", otherKey, claims),
+		sign(t, jwt.HS256, "rs", secret, claims),
+		sign(t, jwt.HS256, "", rsaKey.N.Bytes(), claims),
+		sign(t, "none", "", nil, claims),
+		"not.a.token",
+		"",
+	} {
+		_, err := bearer.Verify(token)
+		assert.ErrorIs(err, httpresponse.ErrNotAuthorized, token)
+	}
+
+	// There must be at least one key, of a supported type
+	_, err = jwt.New()
+	assert.ErrorIs(err, httpresponse.ErrBadRequest)
+	_, err = jwt.New(jwt.WithKey("x", 42))
+	assert.ErrorIs(err, httpresponse.ErrBadRequest)
+}
+
+func Test_Bearer_002(t *testing.T) {
+	assert := assert.New(t)
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	bearer, err := jwt.New(jwt.WithKey("", secret), jwt.WithIssuer("https://issuer"), jwt.WithAudience("api"), jwt.WithLeeway(0))
+	if !assert.NoError(err) {
+		return
+	}
+	now := time.Now()
+	valid := map[string]any{"iss": "https://issuer", "aud": []string{"other", "api"}, "exp": now.Add(time.Hour).Unix(), "nbf": now.Add(-time.Hour).Unix()}
+
+	// The time, issuer and audience claims are checked
+	_, err = bearer.Verify(sign(t, jwt.HS256, "", secret, valid))
+	assert.NoError(err)
+	for name, value := range map[string]any{
+		"exp": now.Add(-time.Second).Unix(),
+		"nbf": now.Add(time.Hour).Unix(),
+		"iss": "https://other",
+		"aud": "other",
+	} {
+		claims := map[string]any{}
+		for k, v := range valid {
+			claims[k] = v
+		}
+		claims[name] = value
+		_, err := bearer.Verify(sign(t, jwt.HS256, "", secret, claims))
+		assert.ErrorIs(err, httpresponse.ErrNotAuthorized, name)
+	}
+}
+
+func Test_Bearer_003(t *testing.T) {
+	assert := assert.New(t)
+	rsaKey, ecKey := keys(t)
+	secret := []byte("0123456789abcdef0123456789abcdef")
+
+	// Keys are read from a JWKS file, skipping encryption keys
+	point, err := ecKey.PublicKey.Bytes()
+	if !assert.NoError(err) {
+		return
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	data, err := json.Marshal(map[string]any{"keys": []map[string]any{
+		{"kty": "RSA", "kid": "rs", "alg": "RS256", "n": b64(rsaKey.N.Bytes()), "e": b64([]byte{1, 0, 1})},
+		{"kty": "EC", "kid": "es", "crv": "P-256", "x": b64(point[1:33]), "y": b64(point[33:])},
+		{"kty": "oct", "kid": "hs", "k": b64(secret)},
+		{"kty": "RSA", "kid": "enc", "use": "enc"},
+	}})
+	if !assert.NoError(err) || !assert.NoError(os.WriteFile(path, data, 0o600)) {
+		return
+	}
+	bearer, err := jwt.New(jwt.WithJWKS(path))
+	if !assert.NoError(err) {
+		return
+	}
+	for _, token := range []string{
+		sign(t, jwt.RS256, "rs", rsaKey, map[string]any{}),
+		sign(t, jwt.ES256, "es", ecKey, map[string]any{}),
+		sign(t, jwt.HS256, "hs", secret, map[string]any{}),
+	} {
+		_, err := bearer.Verify(token)
+		assert.NoError(err)
+	}
+
+	// A key whose algorithm does not match its type is an error
+	data, _ = json.Marshal(map[string]any{"keys": []map[string]any{
+		{"kty": "oct", "kid": "hs", "alg": "RS256", "k": b64(secret)},
+	}})
+	assert.NoError(os.WriteFile(path, data, 0o600))
+	_, err = jwt.New(jwt.WithJWKS(path))
+	assert.ErrorIs(err, httpresponse.ErrBadRequest)
+}
+
+func Test_Bearer_004(t *testing.T) {
+	assert := assert.New(t)
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	bearer, err := jwt.New(jwt.WithKey("", secret), jwt.WithDescription("JWT"))
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal(openapi.SecurityScheme{Type: openapi.SecuritySchemeHTTP, Description: "JWT", Scheme: "bearer", BearerFormat: "JWT"}, bearer.Spec())
+
+	// The claims are available to the handler
+	handler := bearer.Wrap(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := jwt.ClaimsFromContext(r.Context())
+		if assert.True(ok) {
+			_, _ = w.Write([]byte(claims.Subject()))
+		}
+	}, []string{"read", "write"})
+	request := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rw := httptest.NewRecorder()
+		handler(rw, req)
+		return rw
+	}
+
+	// Requests without a valid token are not authorized
+	rw := request("")
+	assert.Equal(http.StatusUnauthorized, rw.Code)
+	assert.Equal("Bearer", rw.Header().Get("WWW-Authenticate"))
+	rw = request("invalid")
+	assert.Equal(http.StatusUnauthorized, rw.Code)
+	assert.Contains(rw.Header().Get("WWW-Authenticate"), `error="invalid_token"`)
+
+	// Requests without the scopes are forbidden
+	rw = request(sign(t, jwt.HS256, "", secret, map[string]any{"sub": "user", "scope": "read"}))
+	assert.Equal(http.StatusForbidden, rw.Code)
+	assert.Contains(rw.Header().Get("WWW-Authenticate"), `error="insufficient_scope"`)
+
+	// Scopes are read from the "scope" and "scp" claims
+	rw = request(sign(t, jwt.HS256, "", secret, map[string]any{"sub": "user", "scope": "read write"}))
+	assert.Equal(http.StatusOK, rw.Code)
+	assert.Equal("user", rw.Body.String())
+	rw = request(sign(t, jwt.HS256, "", secret, map[string]any{"sub": "user", "scp": []string{"read", "write"}}))
+	assert.Equal(http.StatusOK, rw.Code)
+}
@@ -0,0 +1,214 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+
+	// Packages
+	httpresponse "github.com/mutablelogic/go-server/pkg/httpresponse"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// key verifies the signatures of tokens with one algorithm.
+type key struct {
+	id  string
+	alg string
+	key any // []byte, *rsa.PublicKey or *ecdsa.PublicKey
+}
+
+// jwk is a JSON Web Key, with the members used for the supported key types.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Use string `json:"use,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	K   string `json:"k,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+// Supported signing algorithms
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	ES256 = "ES256"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// LIFECYCLE
+
+// newKey returns a key for the algorithm of its type. When alg is not empty,
+// it must be the algorithm of the key type.
+func newKey(id, alg string, k any) (key, error) {
+	result := key{id: id}
+	switch k := k.(type) {
+	case []byte:
+		result.alg, result.key = HS256, k
+	case string:
+		result.alg, result.key = HS256, []byte(k)
+	case *rsa.PublicKey:
+		result.alg, result.key = RS256, k
+	case *rsa.PrivateKey:
+		result.alg, result.key = RS256, &k.PublicKey
+	case *ecdsa.PublicKey:
+		result.alg, result.key = ES256, k
+	case *ecdsa.PrivateKey:
+		result.alg, result.key = ES256, &k.PublicKey
+	default:
+		return key{}, httpresponse.ErrBadRequest.Withf("key %q: unsupported key type %T", id, k)
+	}
+
+	// Check the key
+	switch k := result.key.(type) {
+	case []byte:
+		if len(k) == 0 {
+			return key{}, httpresponse.ErrBadRequest.Withf("key %q: secret is empty", id)
+		}
+	case *rsa.PublicKey:
+		if k == nil || k.N == nil || k.N.BitLen() < 2048 {
+			return key{}, httpresponse.ErrBadRequest.Withf("key %q: RSA keys must be at least 2048 bits", id)
+		}
+	case *ecdsa.PublicKey:
+		if k == nil || k.Curve != elliptic.P256() {
+			return key{}, httpresponse.ErrBadRequest.Withf("key %q: ECDSA keys must use the P-256 curve", id)
+		}
+	}
+	if alg != "" && alg != result.alg {
+		return key{}, httpresponse.ErrBadRequest.Withf("key %q: algorithm %q does not match the key type", id, alg)
+	}
+
+	// Return success
+	return result, nil
+}
+
+// readJWKS returns the keys of a JSON Web Key Set file.
+func readJWKS(path string) ([]key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, httpresponse.ErrBadRequest.Withf("%s: %v", path, err)
+	}
+	keys := make([]key, 0, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use == "enc" {
+			continue
+		}
+		k, err := jwk.key()
+		if err != nil {
+			return nil, httpresponse.ErrBadRequest.Withf("%s: %v", path, err)
+		}
+		key, err := newKey(jwk.Kid, jwk.Alg, k)
+		if err != nil {
+			return nil, httpresponse.ErrBadRequest.Withf("%s: %v", path, err)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, httpresponse.ErrBadRequest.Withf("%s: no signing keys", path)
+	}
+	return keys, nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// verify reports whether sig is the signature of data with the algorithm.
+func (k key) verify(alg, data string, sig []byte) bool {
+	if alg != k.alg {
+		return false
+	}
+	hash := sha256.Sum256([]byte(data))
+	switch k := k.key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(data))
+		return hmac.Equal(sig, mac.Sum(nil))
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, hash[:], sig) == nil
+	case *ecdsa.PublicKey:
+		if len(sig) != 64 {
+			return false
+		}
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(k, hash[:], r, s)
+	default:
+		return false
+	}
+}
+
+// key returns the key of a JSON Web Key.
+func (j jwk) key() (any, error) {
+	switch j.Kty {
+	case "oct":
+		return decodeMember(j.Kid, "k", j.K)
+	case "RSA":
+		n, err := decodeMember(j.Kid, "n", j.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeMember(j.Kid, "e", j.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, httpresponse.ErrBadRequest.Withf("key %q: invalid RSA exponent", j.Kid)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		if j.Crv != "P-256" {
+			return nil, httpresponse.ErrBadRequest.Withf("key %q: unsupported curve %q", j.Kid, j.Crv)
+		}
+		x, err := decodeMember(j.Kid, "x", j.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeMember(j.Kid, "y", j.Y)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != 32 || len(y) != 32 {
+			return nil, httpresponse.ErrBadRequest.Withf("key %q: invalid P-256 coordinates", j.Kid)
+		}
+		k, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), append(append([]byte{4}, x...), y...))
+		if err != nil {
+			return nil, httpresponse.ErrBadRequest.Withf("key %q: %v", j.Kid, err)
+		}
+		return k, nil
+	default:
+		return nil, httpresponse.ErrBadRequest.Withf("key %q: unsupported key type %q", j.Kid, j.Kty)
+	}
+}
+
+// decodeMember decodes a base64url-encoded member of a JSON Web Key.
+func decodeMember(kid, name, value string) ([]byte, error) {
+	if value == "" {
+		return nil, httpresponse.ErrBadRequest.Withf("key %q: missing %q", kid, name)
+	}
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, httpresponse.ErrBadRequest.Withf("key %q: %q: %v", kid, name, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,108 @@
+package jwt
+
+import (
+	"time"
+
+	// Packages
+	httpresponse "github.com/mutablelogic/go-server/pkg/httpresponse"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type opt struct {
+	keys        []key
+	issuer      string
+	audience    []string
+	leeway      time.Duration
+	description string
+	now         func() time.Time
+}
+
+type Opt func(*opt) error
+
+///////////////////////////////////////////////////////////////////////////////
+// LIFECYCLE
+
+func applyOpts(opts ...Opt) (*opt, error) {
+	o := &opt{leeway: time.Minute, now: time.Now}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// OPTIONS
+
+// Add a key which verifies tokens. The key is an HMAC secret as a []byte or
+// string for HS256, an RSA public (or private) key for RS256, or a P-256
+// ECDSA public (or private) key for ES256. Tokens with a "kid" header are
+// only verified with the key with the same ID, and tokens without one with
+// any key for their algorithm.
+func WithKey(id string, k any) Opt {
+	return func(o *opt) error {
+		key, err := newKey(id, "", k)
+		if err != nil {
+			return err
+		}
+		o.keys = append(o.keys, key)
+		return nil
+	}
+}
+
+// Add the keys from a local JSON Web Key Set file, as published by an
+// identity provider. Keys with "oct", "RSA" and P-256 "EC" key types are
+// used, and keys for encryption are ignored.
+func WithJWKS(path string) Opt {
+	return func(o *opt) error {
+		keys, err := readJWKS(path)
+		if err != nil {
+			return err
+		}
+		o.keys = append(o.keys, keys...)
+		return nil
+	}
+}
+
+// Require the "iss" claim of tokens to be the issuer.
+func WithIssuer(issuer string) Opt {
+	return func(o *opt) error {
+		if issuer == "" {
+			return httpresponse.ErrBadRequest.With("issuer is empty")
+		}
+		o.issuer = issuer
+		return nil
+	}
+}
+
+// Require the "aud" claim of tokens to contain at least one of the
+// audiences.
+func WithAudience(audience ...string) Opt {
+	return func(o *opt) error {
+		o.audience = append(o.audience, audience...)
+		return nil
+	}
+}
+
+// Set the allowance for clock skew when checking the "exp" and "nbf"
+// claims of tokens, which is one minute by default.
+func WithLeeway(leeway time.Duration) Opt {
+	return func(o *opt) error {
+		if leeway < 0 {
+			return httpresponse.ErrBadRequest.With("leeway is negative")
+		}
+		o.leeway = leeway
+		return nil
+	}
+}
+
+// Set the description of the security scheme in the OpenAPI specification.
+func WithDescription(description string) Opt {
+	return func(o *opt) error {
+		o.description = description
+		return nil
+	}
+}
@@ -0,0 +1,277 @@
+package resource
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	// Packages
+	server "github.com/mutablelogic/go-server"
+	httpresponse "github.com/mutablelogic/go-server/pkg/httpresponse"
+	httprouter "github.com/mutablelogic/go-server/pkg/httprouter"
+	openapihttphandler "github.com/mutablelogic/go-server/pkg/openapi/httphandler"
+	openapi "github.com/mutablelogic/go-server/pkg/openapi/schema"
+	provider "github.com/mutablelogic/go-server/pkg/provider"
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+	types "github.com/mutablelogic/go-server/pkg/types"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Resource describes the "httprouter" resource type. Each instance builds
+// an [httprouter.Router] on Apply, registers the referenced handlers on it,
+// and attaches itself to the referenced server through the observer system.
+// Re-applying an instance builds a new router and swaps it in atomically,
+// so routes can be added or removed while the server is running.
+type Resource struct {
+	Server     schema.ResourceInstance   `name:"server" type:"httpserver" required:"" help:"Server which dispatches requests to the router"`
+	Prefix     string                    `name:"prefix" help:"Path prefix for all routes" default:"/api"`
+	Origin     string                    `name:"origin" help:"Cross-origin protection (CSRF) origin. Empty string for same-origin only, '*' to allow all cross-origin requests, or a specific origin in the form 'scheme://host[:port]'." default:""`
+	Handlers   []schema.ResourceInstance `name:"handlers" help:"Handlers to register on the router"`
+	Middleware []schema.ResourceInstance `name:"middleware" help:"Middleware which wraps the handlers, outermost first"`
+	OpenAPI    bool                      `name:"openapi" help:"Serve OpenAPI spec at {prefix}/openapi.{json,yaml,html}" default:"true"`
+	Endpoints  []string                  `name:"endpoints" readonly:"" help:"Full URL endpoints for this router"`
+	title      string
+	version    string
+	middleware []httprouter.HTTPMiddlewareFunc
+}
+
+// ResourceInstance is a live instance of an HTTP router resource.
+type ResourceInstance struct {
+	provider.ResourceInstance[Resource]
+	title      string
+	version    string
+	middleware []httprouter.HTTPMiddlewareFunc
+	router     atomic.Pointer[httprouter.Router]
+}
+
+var _ schema.Resource = Resource{}
+var _ schema.ResourceInstance = (*ResourceInstance)(nil)
+var _ server.HTTPRouter = (*ResourceInstance)(nil)
+
+///////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+const (
+	resourceName = "httprouter"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// LIFECYCLE
+
+// NewResource creates a router resource type. The title and version are
+// used for the OpenAPI spec of each router, and the middleware (for
+// example, telemetry) is applied outside any middleware referenced by the
+// instance configuration.
+func NewResource(title, version string, middleware ...httprouter.HTTPMiddlewareFunc) Resource {
+	return Resource{title: title, version: version, middleware: middleware}
+}
+
+func (r Resource) New(name string) (schema.ResourceInstance, error) {
+	return &ResourceInstance{
+		ResourceInstance: provider.NewResourceInstance[Resource](r, name),
+		title:            r.title,
+		version:          r.version,
+		middleware:       r.middleware,
+	}, nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS - RESOURCE
+
+func (r Resource) Name() string {
+	return resourceName
+}
+
+func (r Resource) Schema() []schema.Attribute {
+	return schema.AttributesOf(Resource{})
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS - RESOURCE INSTANCE
+
+// Validate decodes the incoming state, resolves references, and checks that
+// every handler and middleware reference implements the expected interface.
+func (r *ResourceInstance) Validate(ctx context.Context, state schema.State, resolve schema.Resolver) (any, error) {
+	v, err := r.ResourceInstance.Validate(ctx, state, resolve)
+	if err != nil {
+		return nil, err
+	}
+	c := v.(*Resource)
+	verr := new(schema.ValidationError)
+	if _, ok := c.Server.(server.HTTPServer); !ok {
+		verr.Add("server", schema.CodeReference, "%q is not an HTTP server", c.Server.Name())
+	}
+	for i, h := range c.Handlers {
+		switch h.(type) {
+		case server.HTTPFileServer, server.HTTPHandler:
+			continue
+		default:
+			verr.Add(fmt.Sprintf("handlers[%d]", i), schema.CodeReference, "%q is not an HTTP handler", h.Name())
+		}
+	}
+	for i, m := range c.Middleware {
+		if _, ok := m.(server.HTTPMiddleware); !ok {
+			verr.Add(fmt.Sprintf("middleware[%d]", i), schema.CodeReference, "%q is not HTTP middleware", m.Name())
+		}
+	}
+	if err := verr.Err(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Apply builds a new router from the configuration, registers each handler
+// and swaps the router in. Requests already in flight complete on the
+// previous router.
+func (r *ResourceInstance) Apply(ctx context.Context, v any) error {
+	return r.ApplyConfig(ctx, v, func(ctx context.Context, c *Resource) error {
+		router, err := r.newRouter(ctx, c)
+		if err != nil {
+			return err
+		}
+		r.router.Store(router)
+		return nil
+	})
+}
+
+// Destroy removes the router, so that any further requests return a
+// structured 404.
+func (r *ResourceInstance) Destroy(_ context.Context) error {
+	r.router.Store(nil)
+	return nil
+}
+
+// Read returns the live state of the router, computing the endpoints from
+// the referenced server's current URL and the router prefix.
+func (r *ResourceInstance) Read(ctx context.Context) (schema.State, error) {
+	state, err := r.ResourceInstance.Read(ctx)
+	if err != nil || state == nil {
+		return state, err
+	}
+	if endpoint := r.endpoint(); endpoint != "" {
+		state["endpoints"] = []string{endpoint}
+	}
+	return state, nil
+}
+
+// ServeHTTP dispatches the request to the current router, or returns a
+// structured 404 when the instance has not been applied.
+func (r *ResourceInstance) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if router := r.router.Load(); router != nil {
+		router.ServeHTTP(w, req)
+	} else {
+		_ = httpresponse.Error(w, httpresponse.ErrNotFound, req.RequestURI)
+	}
+}
+
+// Spec returns the OpenAPI specification for the current router, or nil
+// when the instance has not been applied.
+func (r *ResourceInstance) Spec() *openapi.Spec {
+	if router := r.router.Load(); router != nil {
+		return router.Spec()
+	}
+	return nil
+}
+
+// Prefix returns the path prefix which the server uses to dispatch
+// requests to this router.
+func (r *ResourceInstance) Prefix() string {
+	if router := r.router.Load(); router != nil {
+		return router.Prefix()
+	}
+	if c := r.State(); c != nil {
+		return types.NormalisePath(c.Prefix)
+	}
+	return "/"
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// newRouter creates a router for the configuration and registers the
+// handlers, the OpenAPI endpoints and a catch-all 404 handler on it.
+func (r *ResourceInstance) newRouter(ctx context.Context, c *Resource) (*httprouter.Router, error) {
+	// Build the middleware chain: built-in middleware is outermost
+	middleware := make([]httprouter.HTTPMiddlewareFunc, 0, len(r.middleware)+len(c.Middleware))
+	middleware = append(middleware, r.middleware...)
+	for _, m := range c.Middleware {
+		middleware = append(middleware, m.(server.HTTPMiddleware).WrapFunc)
+	}
+
+	// Create the router
+	router, err := httprouter.NewRouter(ctx, http.NewServeMux(), c.Prefix, c.Origin, r.title, r.version, middleware...)
+	if err != nil {
+		return nil, httpresponse.ErrBadRequest.Withf("router: %v", err)
+	}
+
+	// Register the handlers
+	for _, h := range c.Handlers {
+		switch h := h.(type) {
+		case server.HTTPFileServer:
+			err = router.RegisterFS(h.HandlerPath(), h.HandlerFS(), handlerMiddleware(h), h.Spec())
+		case server.HTTPHandler:
+			err = router.RegisterFunc(h.HandlerPath(), h.HandlerFunc(), handlerMiddleware(h), h.Spec())
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Register OpenAPI spec endpoints if enabled
+	if c.OpenAPI {
+		if err := openapihttphandler.RegisterHandler(router); err != nil {
+			return nil, err
+		}
+	}
+
+	// Always register a catch-all 404 handler at the prefix root
+	if err := router.RegisterCatchAll(c.Prefix, false); err != nil {
+		return nil, err
+	}
+
+	// Set the server URL in the OpenAPI spec
+	if srv, ok := c.Server.(server.HTTPServer); ok {
+		if spec := srv.Spec(); spec != nil {
+			router.Spec().SetServers([]openapi.Server{*spec})
+		}
+	}
+
+	// Return success
+	return router, nil
+}
+
+// endpoint returns the URL of the router on the referenced server, or an
+// empty string if the server is not running.
+func (r *ResourceInstance) endpoint() string {
+	c := r.State()
+	if c == nil {
+		return ""
+	}
+	srv, ok := c.Server.(server.HTTPServer)
+	if !ok {
+		return ""
+	}
+	spec := srv.Spec()
+	if spec == nil {
+		return ""
+	}
+	endpoint, err := url.JoinPath(spec.URL, r.Prefix())
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(endpoint, "/")
+}
+
+// handlerMiddleware reports whether the router middleware chain should wrap
+// the handler. Handlers which do not report a preference are wrapped.
+func handlerMiddleware(h any) bool {
+	if h, ok := h.(interface{ HandlerMiddleware() bool }); ok {
+		return h.HandlerMiddleware()
+	}
+	return true
+}
@@ -0,0 +1,190 @@
+package resource_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	// Packages
+	resource "github.com/mutablelogic/go-server/pkg/httprouter/resource"
+	httpserver "github.com/mutablelogic/go-server/pkg/httpserver/resource"
+	provider "github.com/mutablelogic/go-server/pkg/provider"
+	httphandler "github.com/mutablelogic/go-server/pkg/provider/httphandler/resource"
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+	assert "github.com/stretchr/testify/assert"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// HELPERS
+
+// newTestManager returns a manager with a running server, a router
+// resource type and a "ping" handler instance.
+func newTestManager(t *testing.T) *provider.Manager {
+	t.Helper()
+	ctx := context.Background()
+	mgr, err := provider.New("test", "test provider", "0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = mgr.Close(context.Background())
+	})
+
+	// Register resource types
+	ping := httphandler.NewResource("ping", "ping", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("pong"))
+	}, nil)
+	for _, r := range []schema.Resource{httpserver.Resource{}, resource.NewResource("Test API", "1.0.0"), ping} {
+		if err := mgr.RegisterResource(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Create and apply the server and the handler
+	for name, state := range map[string]schema.State{
+		"httpserver.main": {"listen": "localhost:0"},
+		"ping.main":       {},
+	} {
+		if _, err := mgr.CreateResourceInstance(ctx, schema.CreateResourceInstanceRequest{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := mgr.UpdateResourceInstance(ctx, name, schema.UpdateResourceInstanceRequest{Attributes: state, Apply: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := mgr.CreateResourceInstance(ctx, schema.CreateResourceInstanceRequest{Name: "httprouter.main"}); err != nil {
+		t.Fatal(err)
+	}
+
+	return mgr
+}
+
+func get(t *testing.T, url string) (int, string) {
+	t.Helper()
+	r, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Body.Close()
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r.StatusCode, string(body)
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// TESTS
+
+func Test_HTTPRouter_001(t *testing.T) {
+	assert := assert.New(t)
+	mgr := newTestManager(t)
+	ctx := context.Background()
+
+	// Apply the router with the handler
+	resp, err := mgr.UpdateResourceInstance(ctx, "httprouter.main", schema.UpdateResourceInstanceRequest{
+		Attributes: schema.State{"server": "httpserver.main", "handlers": []string{"ping.main"}},
+		Apply:      true,
+	})
+	if !assert.NoError(err) {
+		return
+	}
+
+	// The router reports its endpoint on the server
+	endpoints, ok := resp.Instance.State["endpoints"].([]string)
+	if !assert.True(ok) || !assert.Len(endpoints, 1) {
+		return
+	}
+	assert.Regexp(`^http://.+/api$`, endpoints[0])
+
+	// The handler reports its endpoint through the router
+	handler, err := mgr.GetResourceInstance(ctx, "ping.main")
+	assert.NoError(err)
+	assert.Equal([]string{endpoints[0] + "/ping"}, handler.Instance.State["endpoints"])
+
+	// The handler is served by the router
+	code, body := get(t, endpoints[0]+"/ping")
+	assert.Equal(http.StatusOK, code)
+	assert.Equal("pong", body)
+
+	// The OpenAPI spec is served by the router
+	code, _ = get(t, endpoints[0]+"/openapi.json")
+	assert.Equal(http.StatusOK, code)
+
+	// Unknown paths return a 404
+	code, _ = get(t, endpoints[0]+"/unknown")
+	assert.Equal(http.StatusNotFound, code)
+}
+
+func Test_HTTPRouter_002(t *testing.T) {
+	assert := assert.New(t)
+	mgr := newTestManager(t)
+	ctx := context.Background()
+
+	// Apply the router with the handler, then re-apply without it
+	resp, err := mgr.UpdateResourceInstance(ctx, "httprouter.main", schema.UpdateResourceInstanceRequest{
+		Attributes: schema.State{"server": "httpserver.main", "handlers": []string{"ping.main"}, "prefix": "/v1"},
+		Apply:      true,
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	endpoint := resp.Instance.State["endpoints"].([]string)[0]
+	code, _ := get(t, endpoint+"/ping")
+	assert.Equal(http.StatusOK, code)
+
+	_, err = mgr.UpdateResourceInstance(ctx, "httprouter.main", schema.UpdateResourceInstanceRequest{
+		Attributes: schema.State{"handlers": []string{}},
+		Apply:      true,
+	})
+	if !assert.NoError(err) {
+		return
+	}
+
+	// The route is removed while the server is running
+	code, _ = get(t, endpoint+"/ping")
+	assert.Equal(http.StatusNotFound, code)
+}
+
+func Test_HTTPRouter_003(t *testing.T) {
+	assert := assert.New(t)
+	mgr := newTestManager(t)
+	ctx := context.Background()
+
+	// Apply the router, then destroy it
+	resp, err := mgr.UpdateResourceInstance(ctx, "httprouter.main", schema.UpdateResourceInstanceRequest{
+		Attributes: schema.State{"server": "httpserver.main", "handlers": []string{"ping.main"}},
+		Apply:      true,
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	endpoint := resp.Instance.State["endpoints"].([]string)[0]
+	_, err = mgr.DestroyResourceInstance(ctx, schema.DestroyResourceInstanceRequest{Name: "httprouter.main"})
+	assert.NoError(err)
+
+	// The server no longer dispatches to the router
+	code, _ := get(t, endpoint+"/ping")
+	assert.Equal(http.StatusNotFound, code)
+}
+
+func Test_HTTPRouter_004(t *testing.T) {
+	assert := assert.New(t)
+	mgr := newTestManager(t)
+	ctx := context.Background()
+
+	// A handler cannot be used as the server
+	_, err := mgr.UpdateResourceInstance(ctx, "httprouter.main", schema.UpdateResourceInstanceRequest{
+		Attributes: schema.State{"server": "ping.main"},
+		Apply:      true,
+	})
+	assert.Error(err)
+
+	// The server cannot be used as a handler
+	_, err = mgr.UpdateResourceInstance(ctx, "httprouter.main", schema.UpdateResourceInstanceRequest{
+		Attributes: schema.State{"server": "httpserver.main", "handlers": []string{"httpserver.main"}},
+		Apply:      true,
+	})
+	assert.Error(err)
+}
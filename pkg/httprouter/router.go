@@ -10,6 +10,8 @@ import (
 	"io/fs"
 	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	// Packages
@@ -27,14 +29,18 @@ import (
 
 // Router is an HTTP request multiplexer that wraps [http.ServeMux] with
 // cross-origin protection, an optional middleware chain and an [openapi.Spec]
-// that is populated as routes are registered.
+// that is populated as routes are registered. The route table can be
+// changed while the router is serving requests, using [Router.Unregister]
+// and [Router.Replace].
 type Router struct {
-	mux        *http.ServeMux
+	mu         sync.Mutex
+	table      atomic.Pointer[table]
+	staged     *table // non-nil for the staging router passed to Replace
 	prefix     string
 	origin     string
 	middleware middlewareFuncs
 	handler    http.Handler
-	spec       *openapi.Spec
+	spec       *atomic.Pointer[openapi.Spec] // shared with the staging router
 	security   map[string]SecurityScheme
 }
 
@@ -52,20 +58,30 @@ var _ http.Handler = (*Router)(nil)
 //     enabled, with the origin added as a trusted CSRF origin)
 //
 // The title and version are used to create the OpenAPI spec for the router.
+// Routes are registered on mux until the route table is first replaced by
+// [Router.Unregister] or [Router.Replace]; after that the router serves
+// from a new ServeMux which only contains routes registered through it.
 func NewRouter(ctx context.Context, mux *http.ServeMux, prefix, origin, title, version string, middleware ...HTTPMiddlewareFunc) (*Router, error) {
 	if mux == nil {
 		return nil, httpresponse.ErrBadRequest.With("mux is nil")
 	}
 
 	router := new(Router)
-	router.mux = mux
+	router.table.Store(newTable(mux))
 	router.prefix = types.NormalisePath(prefix)
 	router.origin = origin
 	router.middleware = middlewareFuncs(middleware)
 	router.security = make(map[string]SecurityScheme)
 
 	// Create a new OpenAPI spec
-	router.spec = openapi.NewSpec(title, version)
+	router.spec = new(atomic.Pointer[openapi.Spec])
+	router.spec.Store(openapi.NewSpec(title, version))
+
+	// Dispatch to the current route table. Requests already in flight
+	// complete on the table they started with when the table is replaced.
+	tableHandler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		router.table.Load().mux.ServeHTTP(w, req)
+	})
 
 	// Build the handler chain depending on the origin policy.
 	// When origin is "*" CSRF is bypassed entirely because there is no
@@ -73,17 +89,17 @@ func NewRouter(ctx context.Context, mux *http.ServeMux, prefix, origin, title, v
 	switch {
 	case origin == "*":
 		// All origins trusted – CORS only, no CSRF
-		router.handler = Cors(origin)(router.mux.ServeHTTP)
+		router.handler = Cors(origin)(tableHandler)
 	case origin != "":
 		// Specific origin – CSRF with trusted origin, wrapped by CORS
 		crf := http.NewCrossOriginProtection()
 		if err := crf.AddTrustedOrigin(origin); err != nil {
 			return nil, err
 		}
-		router.handler = Cors(origin)(crf.Handler(router.mux).ServeHTTP)
+		router.handler = Cors(origin)(crf.Handler(tableHandler).ServeHTTP)
 	default:
 		// Empty origin – same-origin only, CSRF with no trusted origins
-		router.handler = http.NewCrossOriginProtection().Handler(router.mux)
+		router.handler = http.NewCrossOriginProtection().Handler(tableHandler)
 	}
 
 	// Return success
@@ -117,8 +133,11 @@ func (r *Router) Prefix() string {
 
 // Spec returns the OpenAPI 3.1 specification for this router. The spec is
 // built incrementally as routes are registered via [router.RegisterFunc].
+// When routes are registered or removed, the router publishes a new copy
+// of the spec rather than modifying it, so that a spec which is being
+// served is not changed underneath; call Spec again to get the paths.
 func (r *Router) Spec() *openapi.Spec {
-	return r.spec
+	return r.spec.Load()
 }
 
 // ServeHTTP dispatches the request to the matching registered handler after
@@ -136,15 +155,21 @@ func (r *Router) resolvePath(path string) string {
 	return types.JoinPath(r.prefix, path)
 }
 
-// safeHandle registers a handler with the router's ServeMux, recovering from
-// panics caused by duplicate patterns. Returns an error instead of panicking.
-func (r *Router) safeHandle(pattern string, handler http.HandlerFunc) (err error) {
-	defer func() {
-		if v := recover(); v != nil {
-			err = httpresponse.ErrConflict.Withf("%v", v)
-		}
-	}()
-	r.mux.HandleFunc(pattern, handler)
+// handle registers a handler with the router's current route table,
+// recovering from panics caused by duplicate patterns. Returns an error
+// instead of panicking. When spec is non-nil it is added to the router's
+// OpenAPI specification under path once the handler is registered.
+func (r *Router) handle(pattern, path string, handler http.HandlerFunc, spec *openapi.PathItem) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.current().handle(route{pattern: pattern, path: path, handler: handler, spec: spec}); err != nil {
+		return err
+	}
+	if spec != nil && r.staged == nil {
+		r.updatePaths(func(paths map[string]openapi.PathItem) {
+			paths[path] = *spec
+		})
+	}
 	return nil
 }
 
@@ -159,7 +184,8 @@ func (r *Router) RegisterCatchAll(path string, middleware bool) error {
 	if middleware {
 		handler = r.middleware.Wrap(handler)
 	}
-	if err := r.safeHandle(types.NormalisePath(path), handler); err != nil {
+	path = types.NormalisePath(path)
+	if err := r.handle(path, path, handler, nil); err != nil {
 		if errors.Is(err, httpresponse.ErrConflict) {
 			return nil
 		}
@@ -177,7 +203,7 @@ func (r *Router) RegisterOpenAPI(path string, middleware bool) error {
 	handler := func(w http.ResponseWriter, req *http.Request) {
 		switch req.Method {
 		case http.MethodGet:
-			_ = httpresponse.JSON(w, http.StatusOK, httprequest.Indent(req), r.spec)
+			_ = httpresponse.JSON(w, http.StatusOK, httprequest.Indent(req), r.Spec())
 		default:
 			_ = httpresponse.Error(w, httpresponse.Err(http.StatusMethodNotAllowed), req.Method)
 		}
@@ -185,7 +211,8 @@ func (r *Router) RegisterOpenAPI(path string, middleware bool) error {
 	if middleware {
 		handler = r.middleware.Wrap(handler)
 	}
-	return r.safeHandle(r.resolvePath(path), handler)
+	path = r.resolvePath(path)
+	return r.handle(path, path, handler, nil)
 }
 
 // RegisterFS registers a file server at path that serves static assets from
@@ -199,18 +226,62 @@ func (r *Router) RegisterOpenAPI(path string, middleware bool) error {
 // router's OpenAPI specification under the resolved path. When middleware is
 // true the handler is wrapped by the router's middleware chain.
 func (r *Router) RegisterFS(path string, fs fs.FS, middleware bool, spec *openapi.PathItem) error {
-	prefix := r.resolvePath(path)
+	path = r.resolvePath(path)
+	prefix := path
 	if prefix != "/" {
 		prefix += "/"
 	}
-	if spec != nil {
-		r.spec.AddPath(r.resolvePath(path), spec)
-	}
 	handler := withLastModified(version.BuildTime(), http.StripPrefix(prefix, http.FileServer(http.FS(fs)))).ServeHTTP
 	if middleware {
 		handler = r.middleware.Wrap(handler)
 	}
-	return r.safeHandle(prefix, handler)
+	return r.handle(prefix, path, handler, spec)
+}
+
+// RegisterFunc registers a handler function at path. If path is relative
+// (does not start with "/") the router prefix is prepended; if path is
+// absolute it is used as-is.
+//
+// When spec is non-nil the corresponding [openapi.PathItem] is added to the
+// router's OpenAPI specification under the resolved path, and requests for
+// operations with security requirements are wrapped with the matching
+// registered security schemes. When middleware is true the handler is
+// wrapped by the router's middleware chain.
+func (r *Router) RegisterFunc(path string, fn http.HandlerFunc, middleware bool, spec *openapi.PathItem) error {
+	if fn == nil {
+		return httpresponse.ErrBadRequest.Withf("handler for %q is nil", path)
+	}
+
+	// Resolve the path with the router prefix
+	path = r.resolvePath(path)
+
+	// Wrap per-method handlers with their security requirements
+	handler := fn
+	secured := make(map[string]http.HandlerFunc)
+	if err := r.wrapSecurity(spec, path, func(method string, wrap func(http.HandlerFunc) http.HandlerFunc) {
+		next, ok := secured[method]
+		if !ok {
+			next = fn
+		}
+		secured[method] = wrap(next)
+	}); err != nil {
+		return err
+	}
+	if len(secured) > 0 {
+		handler = func(w http.ResponseWriter, req *http.Request) {
+			if next, ok := secured[strings.ToUpper(req.Method)]; ok {
+				next(w, req)
+			} else {
+				fn(w, req)
+			}
+		}
+	}
+
+	// Register the handler
+	if middleware {
+		handler = r.middleware.Wrap(handler)
+	}
+	return r.handle(path, path, handler, spec)
 }
 
 // Register registers a [PathItem] handler at path. If path is relative
@@ -242,32 +313,8 @@ func (r *Router) RegisterPath(path string, params *jsonschema.Schema, pathitem h
 	// OpenAPI spec is optional, but if provided, add the path to the spec
 	// and wrap per-method handlers with their security requirements
 	spec := pathitem.Spec(path, params)
-	if spec != nil {
-		var registerErr error
-
-		// Look at security requirements for each operation and apply any
-		// corresponding middleware to the per-method handler
-		openapi_ops.Operations(spec, func(method string, op *openapi.Operation) {
-			if registerErr != nil {
-				return
-			}
-			for _, requirement := range op.Security {
-				for name, scopes := range requirement {
-					scheme, ok := r.security[name]
-					if !ok {
-						registerErr = httpresponse.ErrNotImplemented.Withf("security scheme %q not registered for %s %s", name, method, path)
-						return
-					}
-					pathitem.WrapHandler(method, func(next http.HandlerFunc) http.HandlerFunc {
-						return scheme.Wrap(next, scopes)
-					})
-				}
-			}
-		})
-		if registerErr != nil {
-			return registerErr
-		}
-		r.spec.AddPath(path, spec)
+	if err := r.wrapSecurity(spec, path, pathitem.WrapHandler); err != nil {
+		return err
 	}
 
 	// Get handler or fall back to method-not-allowed
@@ -277,12 +324,41 @@ func (r *Router) RegisterPath(path string, params *jsonschema.Schema, pathitem h
 	}
 
 	// Register the handler
-	return r.safeHandle(path, r.middleware.Wrap(handler))
+	return r.handle(path, path, r.middleware.Wrap(handler), spec)
 }
 
 ////////////////////////////////////////////////////////////////////////////////
 // PRIVATE METHODS
 
+// wrapSecurity calls wrap for each security scheme required by each
+// operation in spec, with the method and a function which wraps a handler
+// with the scheme and its scopes. It returns an error if a scheme is not
+// registered on the router. A nil spec has no requirements.
+func (r *Router) wrapSecurity(spec *openapi.PathItem, path string, wrap func(method string, fn func(http.HandlerFunc) http.HandlerFunc)) error {
+	if spec == nil {
+		return nil
+	}
+	var result error
+	openapi_ops.Operations(spec, func(method string, op *openapi.Operation) {
+		if result != nil {
+			return
+		}
+		for _, requirement := range op.Security {
+			for name, scopes := range requirement {
+				scheme, ok := r.security[name]
+				if !ok {
+					result = httpresponse.ErrNotImplemented.Withf("security scheme %q not registered for %s %s", name, method, path)
+					return
+				}
+				wrap(method, func(next http.HandlerFunc) http.HandlerFunc {
+					return scheme.Wrap(next, scopes)
+				})
+			}
+		}
+	})
+	return result
+}
+
 func withLastModified(modified time.Time, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 		if !modified.IsZero() && (req.Method == http.MethodGet || req.Method == http.MethodHead) {
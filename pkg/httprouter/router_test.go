@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 	"testing/fstest"
 	"time"
@@ -14,7 +15,6 @@ import (
 	// Packages
 	httprequest "github.com/mutablelogic/go-server/pkg/httprequest"
 	jsonschema "github.com/mutablelogic/go-server/pkg/jsonschema"
-	openapi_op "github.com/mutablelogic/go-server/pkg/openapi"
 	openapi "github.com/mutablelogic/go-server/pkg/openapi/schema"
 	assert "github.com/stretchr/testify/assert"
 )
@@ -174,7 +174,7 @@ func Test_RegisterPath_UsingGet_001(t *testing.T) {
 	item.Get(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("hello world"))
-	}, "Get hello")
+	}, func(op httprequest.PathOperation) { op.Summary("Get hello") })
 	assert.NoError(router.RegisterPath("/hello", nil, item))
 
 	// Request the handler
@@ -202,7 +202,7 @@ func Test_RegisterPath_UsingGet_002(t *testing.T) {
 	item := httprequest.NewPathItem("Hello", "Hello route")
 	item.Get(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
-	}, "Get hello")
+	}, func(op httprequest.PathOperation) { op.Summary("Get hello") })
 	assert.NoError(router.RegisterPath("/hello", nil, item))
 
 	req := httptest.NewRequest(http.MethodGet, "/hello", nil)
@@ -224,7 +224,7 @@ func Test_RegisterPath_UsingGet_003(t *testing.T) {
 	item.Get(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("items"))
-	}, "Get items")
+	}, func(op httprequest.PathOperation) { op.Summary("Get items") })
 	assert.NoError(router.RegisterPath("items", nil, item))
 
 	// Request using the full prefixed path
@@ -247,7 +247,7 @@ func Test_RegisterPath_UsingGet_004(t *testing.T) {
 	item.Get(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("ok"))
-	}, "Get health")
+	}, func(op httprequest.PathOperation) { op.Summary("Get health") })
 	assert.NoError(router.RegisterPath("/health", nil, item))
 
 	// Request at the absolute path, not under the prefix
@@ -268,6 +268,50 @@ type mockPathItem struct {
 
 type testSecurityScheme struct{}
 
+// newSecurePathItem returns a path item with a GET handler which requires
+// the named security scheme with the given scopes.
+func newSecurePathItem(name string, scopes ...string) *mockPathItem {
+	return &mockPathItem{
+		handlers: map[string]http.HandlerFunc{
+			http.MethodGet: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			},
+		},
+		spec: &openapi.PathItem{
+			Get: &openapi.Operation{
+				Summary:  "Get secure route",
+				Security: []openapi.SecurityRequirement{{name: scopes}},
+			},
+		},
+	}
+}
+
+func (m *mockPathItem) Tag(...string) httprequest.PathItem { return m }
+func (m *mockPathItem) Get(http.HandlerFunc, func(httprequest.PathOperation)) httprequest.PathItem {
+	return m
+}
+func (m *mockPathItem) Put(http.HandlerFunc, func(httprequest.PathOperation)) httprequest.PathItem {
+	return m
+}
+func (m *mockPathItem) Post(http.HandlerFunc, func(httprequest.PathOperation)) httprequest.PathItem {
+	return m
+}
+func (m *mockPathItem) Delete(http.HandlerFunc, func(httprequest.PathOperation)) httprequest.PathItem {
+	return m
+}
+func (m *mockPathItem) Patch(http.HandlerFunc, func(httprequest.PathOperation)) httprequest.PathItem {
+	return m
+}
+func (m *mockPathItem) Options(http.HandlerFunc, func(httprequest.PathOperation)) httprequest.PathItem {
+	return m
+}
+func (m *mockPathItem) Head(http.HandlerFunc, func(httprequest.PathOperation)) httprequest.PathItem {
+	return m
+}
+func (m *mockPathItem) Trace(http.HandlerFunc, func(httprequest.PathOperation)) httprequest.PathItem {
+	return m
+}
+
 func (m *mockPathItem) Handler() http.HandlerFunc {
 	if len(m.handlers) == 0 {
 		return m.handler
@@ -425,10 +469,7 @@ func Test_RegisterPath_006(t *testing.T) {
 	router := newTestRouter(t, "/", "")
 	assert.NoError(router.RegisterSecurityScheme("bearerAuth", testSecurityScheme{}))
 
-	item := httprequest.NewPathItem("Secure", "Secure route")
-	item.Get(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusNoContent)
-	}, "Get secure route", openapi_op.WithSecurity("bearerAuth", "read"))
+	item := newSecurePathItem("bearerAuth", "read")
 
 	assert.NoError(router.RegisterPath("secure", nil, item))
 
@@ -445,10 +486,7 @@ func Test_RegisterPath_007(t *testing.T) {
 
 	router := newTestRouter(t, "/", "")
 
-	item := httprequest.NewPathItem("Secure", "Secure route")
-	item.Get(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusNoContent)
-	}, "Get secure route", openapi_op.WithSecurity("missingAuth", "read"))
+	item := newSecurePathItem("missingAuth", "read")
 
 	err := router.RegisterPath("secure", nil, item)
 	assert.Error(err)
@@ -460,10 +498,7 @@ func Test_RegisterPath_008(t *testing.T) {
 
 	router := newTestRouter(t, "/", "")
 
-	item := httprequest.NewPathItem("Secure", "Secure route")
-	item.Get(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusNoContent)
-	}, "Get secure route", openapi_op.WithSecurity("missingAuth", "read"))
+	item := newSecurePathItem("missingAuth", "read")
 
 	err := router.RegisterPath("secure", nil, item)
 	assert.Error(err)
@@ -521,3 +556,192 @@ func Test_mockPathItem_WrapHandler_001(t *testing.T) {
 	assert.Equal(http.StatusNoContent, rec.Code)
 	assert.Equal("true", rec.Header().Get("X-Wrapped"))
 }
+
+func Test_RegisterFunc_001(t *testing.T) {
+	assert := assert.New(t)
+
+	// RegisterFunc adds the handler and its spec under the prefix
+	router := newTestRouter(t, "/api", "")
+	assert.NoError(router.RegisterFunc("items", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}, false, &openapi.PathItem{Get: &openapi.Operation{Summary: "Get items"}}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/items", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Contains(router.Spec().Paths.MapOfPathItemValues, "/api/items")
+
+	// Registering the same path again is a conflict
+	err := router.RegisterFunc("items", func(w http.ResponseWriter, r *http.Request) {}, false, nil)
+	assert.Error(err)
+}
+
+func Test_Unregister_001(t *testing.T) {
+	assert := assert.New(t)
+
+	// Unregister removes the route and its spec, leaving other routes
+	router := newTestRouter(t, "/api", "")
+	for _, path := range []string{"a", "b"} {
+		assert.NoError(router.RegisterFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}, false, &openapi.PathItem{Summary: path}))
+	}
+	assert.NoError(router.Unregister("a"))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/a", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(http.StatusNotFound, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/b", nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(http.StatusOK, rec.Code)
+
+	assert.NotContains(router.Spec().Paths.MapOfPathItemValues, "/api/a")
+	assert.Contains(router.Spec().Paths.MapOfPathItemValues, "/api/b")
+
+	// The path can be registered again
+	assert.NoError(router.RegisterFunc("a", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}, false, nil))
+	req = httptest.NewRequest(http.MethodGet, "/api/a", nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(http.StatusAccepted, rec.Code)
+}
+
+func Test_Unregister_002(t *testing.T) {
+	assert := assert.New(t)
+
+	// Unregister removes a filesystem subtree
+	router := newTestRouter(t, "/", "")
+	fsys := fstest.MapFS{"test.txt": &fstest.MapFile{Data: []byte("Hello")}}
+	assert.NoError(router.RegisterFS("/static", fs.FS(fsys), false, &openapi.PathItem{Summary: "Static"}))
+	assert.NoError(router.Unregister("/static"))
+
+	req := httptest.NewRequest(http.MethodGet, "/static/test.txt", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(http.StatusNotFound, rec.Code)
+	assert.NotContains(router.Spec().Paths.MapOfPathItemValues, "/static")
+
+	// Unregistering an unknown path is an error
+	assert.Error(router.Unregister("/static"))
+}
+
+func Test_Unregister_003(t *testing.T) {
+	assert := assert.New(t)
+
+	// A request in flight completes on the table it started with
+	router := newTestRouter(t, "/", "")
+	started, release := make(chan struct{}), make(chan struct{})
+	assert.NoError(router.RegisterFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}, false, nil))
+
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	}()
+	<-started
+	assert.NoError(router.Unregister("/slow"))
+	close(release)
+	<-done
+	assert.Equal(http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	assert.Equal(http.StatusNotFound, rec.Code)
+}
+
+func Test_Replace_001(t *testing.T) {
+	assert := assert.New(t)
+
+	// Replace swaps in a table with only the routes registered by fn
+	router := newTestRouter(t, "/api", "")
+	assert.NoError(router.RegisterFunc("a", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}, false, &openapi.PathItem{Summary: "a"}))
+	assert.NoError(router.Replace(func(router *Router) error {
+		return router.RegisterFunc("b", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}, false, &openapi.PathItem{Summary: "b"})
+	}))
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/a", nil))
+	assert.Equal(http.StatusNotFound, rec.Code)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/b", nil))
+	assert.Equal(http.StatusOK, rec.Code)
+
+	assert.NotContains(router.Spec().Paths.MapOfPathItemValues, "/api/a")
+	assert.Contains(router.Spec().Paths.MapOfPathItemValues, "/api/b")
+}
+
+func Test_Replace_002(t *testing.T) {
+	assert := assert.New(t)
+
+	// When fn fails the current table is left untouched
+	router := newTestRouter(t, "/api", "")
+	assert.NoError(router.RegisterFunc("a", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}, false, &openapi.PathItem{Summary: "a"}))
+	err := router.Replace(func(router *Router) error {
+		if err := router.RegisterFunc("b", func(w http.ResponseWriter, r *http.Request) {}, false, &openapi.PathItem{Summary: "b"}); err != nil {
+			return err
+		}
+		return router.RegisterFunc("b", func(w http.ResponseWriter, r *http.Request) {}, false, nil)
+	})
+	assert.Error(err)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/a", nil))
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Contains(router.Spec().Paths.MapOfPathItemValues, "/api/a")
+	assert.NotContains(router.Spec().Paths.MapOfPathItemValues, "/api/b")
+}
+
+func Test_Replace_003(t *testing.T) {
+	assert := assert.New(t)
+
+	// The OpenAPI spec is served while the table is replaced
+	router := newTestRouter(t, "/api", "")
+	register := func(router *Router, path string) error {
+		if err := router.RegisterOpenAPI("openapi.json", false); err != nil {
+			return err
+		}
+		return router.RegisterFunc(path, func(w http.ResponseWriter, r *http.Request) {}, false, &openapi.PathItem{Summary: path})
+	}
+	assert.NoError(register(router, "a"))
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 50 {
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+				var spec openapi.Spec
+				assert.Equal(http.StatusOK, rec.Code)
+				assert.NoError(json.Unmarshal(rec.Body.Bytes(), &spec))
+				assert.Len(spec.Paths.MapOfPathItemValues, 1)
+				_, _ = json.Marshal(router.Spec())
+			}
+		}()
+	}
+	for i := range 50 {
+		path := []string{"a", "b"}[i%2]
+		assert.NoError(router.Replace(func(router *Router) error {
+			return register(router, path)
+		}))
+	}
+	wg.Wait()
+}
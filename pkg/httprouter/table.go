@@ -0,0 +1,169 @@
+package httprouter
+
+import (
+	"maps"
+	"net/http"
+
+	// Packages
+	httpresponse "github.com/mutablelogic/go-server/pkg/httpresponse"
+	openapi "github.com/mutablelogic/go-server/pkg/openapi/schema"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// table is a route table: a ServeMux together with the routes registered on
+// it, so that the ServeMux can be rebuilt without some of them. A table
+// which is being served is never modified except to add routes; removing
+// routes builds a new table which replaces it.
+type table struct {
+	mux    *http.ServeMux
+	routes []route
+}
+
+// route is a single pattern registered on a table. The path is the
+// resolved path the route was registered with, which is also the key for
+// the spec in the OpenAPI paths.
+type route struct {
+	pattern string
+	path    string
+	handler http.HandlerFunc
+	spec    *openapi.PathItem
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// LIFECYCLE
+
+func newTable(mux *http.ServeMux) *table {
+	return &table{mux: mux}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Unregister removes all routes registered at path, including the subtree
+// registered by [Router.RegisterFS], and drops the path from the OpenAPI
+// spec. If path is relative the router prefix is prepended. The routes are
+// removed by building a new route table and swapping it in atomically, so
+// requests already in flight complete on the previous table. Returns
+// [httpresponse.ErrNotFound] if no routes are registered at path.
+func (r *Router) Unregister(path string) error {
+	path = r.resolvePath(path)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Build a table without the routes at path
+	current := r.current()
+	next := newTable(http.NewServeMux())
+	for _, route := range current.routes {
+		if route.path == path || route.pattern == path {
+			continue
+		}
+		if err := next.handle(route); err != nil {
+			return err
+		}
+	}
+	if len(next.routes) == len(current.routes) {
+		return httpresponse.ErrNotFound.Withf("no routes registered at %q", path)
+	}
+
+	// Swap the table
+	r.commit(next)
+
+	// Return success
+	return nil
+}
+
+// Replace builds a new route table by calling fn with a staging router,
+// and when fn returns without error, atomically swaps it for the current
+// table. The staging router shares the prefix, origin, middleware, security
+// schemes and OpenAPI spec with r, but registers routes on an empty table,
+// so fn must register every route which should be served afterwards. If fn
+// returns an error the current table is left untouched. Requests already in
+// flight complete on the previous table, and paths which are no longer
+// registered are dropped from the OpenAPI spec.
+func (r *Router) Replace(fn func(*Router) error) error {
+	staging := &Router{
+		staged:     newTable(http.NewServeMux()),
+		prefix:     r.prefix,
+		origin:     r.origin,
+		middleware: r.middleware,
+		handler:    r.handler,
+		spec:       r.spec,
+		security:   r.security,
+	}
+	if err := fn(staging); err != nil {
+		return err
+	}
+
+	// Swap the table
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commit(staging.staged)
+
+	// Return success
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// current returns the table which routes are registered on: the staged
+// table for a staging router, otherwise the table being served. The caller
+// must hold the router lock.
+func (r *Router) current() *table {
+	if r.staged != nil {
+		return r.staged
+	}
+	return r.table.Load()
+}
+
+// commit swaps next in as the table being served and updates the OpenAPI
+// paths, removing those of the previous table and adding those of next.
+// Paths added to the spec other than through the router are kept. The
+// caller must hold the router lock.
+func (r *Router) commit(next *table) {
+	prev := r.table.Swap(next)
+
+	// Rebuild the OpenAPI paths
+	r.updatePaths(func(paths map[string]openapi.PathItem) {
+		for _, route := range prev.routes {
+			if route.spec != nil {
+				delete(paths, route.path)
+			}
+		}
+		for _, route := range next.routes {
+			if route.spec != nil {
+				paths[route.path] = *route.spec
+			}
+		}
+	})
+}
+
+// updatePaths calls fn with a copy of the OpenAPI paths, and publishes a
+// copy of the spec with the paths fn leaves, so that the spec being read
+// or served is never modified. The caller must hold the router lock.
+func (r *Router) updatePaths(fn func(map[string]openapi.PathItem)) {
+	spec := *r.spec.Load()
+	paths := make(map[string]openapi.PathItem)
+	if spec.Paths != nil {
+		maps.Copy(paths, spec.Paths.MapOfPathItemValues)
+	}
+	fn(paths)
+	spec.Paths = &openapi.Paths{MapOfPathItemValues: paths}
+	r.spec.Store(&spec)
+}
+
+// handle registers the route on the table's ServeMux, recovering from
+// panics caused by duplicate or invalid patterns.
+func (t *table) handle(route route) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = httpresponse.ErrConflict.Withf("%v", v)
+		}
+	}()
+	t.mux.HandleFunc(route.pattern, route.handler)
+	t.routes = append(t.routes, route)
+	return nil
+}
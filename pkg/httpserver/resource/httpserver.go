@@ -0,0 +1,334 @@
+package resource
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	// Packages
+	server "github.com/mutablelogic/go-server"
+	httpresponse "github.com/mutablelogic/go-server/pkg/httpresponse"
+	httpserver "github.com/mutablelogic/go-server/pkg/httpserver"
+	openapi "github.com/mutablelogic/go-server/pkg/openapi/schema"
+	provider "github.com/mutablelogic/go-server/pkg/provider"
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Resource describes the "httpserver" resource type. Each instance binds a
+// listener and serves requests through the routers that reference it. The
+// routers attach themselves through the observer system, so the server
+// itself has no reference attributes.
+type Resource struct {
+	Listen  string        `name:"listen" help:"Listen address (e.g. \"localhost:8080\", or \":0\" for an ephemeral port)" default:"localhost:8080"`
+	Timeout time.Duration `name:"timeout" help:"Read and write timeout for requests" default:"15m"`
+	TLS     struct {
+		Name string `name:"name" help:"TLS server name, used as the public hostname when set"`
+		Cert string `name:"cert" help:"PEM-encoded TLS certificate" sensitive:""`
+		Key  string `name:"key" help:"PEM-encoded TLS private key" sensitive:""`
+	} `embed:"" prefix:"tls."`
+	Addr string `name:"addr" readonly:"" help:"Bound listen address"`
+	URL  string `name:"url" readonly:"" help:"Advertised server URL"`
+}
+
+// ResourceInstance is a live instance of an HTTP server resource.
+type ResourceInstance struct {
+	provider.ResourceInstance[Resource]
+	mu      sync.RWMutex
+	running *running
+	routers map[string]server.HTTPRouter // keyed by router instance name
+}
+
+// running is a server which is serving requests in the background.
+type running struct {
+	listen string // configured listen address
+	server httpServer
+	cancel context.CancelFunc
+}
+
+// httpServer is the subset of the server returned by [httpserver.New]
+// which is used by the resource instance.
+type httpServer interface {
+	Listen() error
+	Run(context.Context) error
+	Addr() string
+	URL() *url.URL
+	SetHandler(http.Handler)
+}
+
+var _ schema.Resource = Resource{}
+var _ schema.ResourceInstance = (*ResourceInstance)(nil)
+var _ server.HTTPServer = (*ResourceInstance)(nil)
+
+///////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+const (
+	resourceName = "httpserver"
+
+	// rebindTimeout is how long to wait for a previous server to release
+	// the listen address when rebinding to the same address.
+	rebindTimeout = 5 * time.Second
+	rebindDelay   = 50 * time.Millisecond
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// LIFECYCLE
+
+func (r Resource) New(name string) (schema.ResourceInstance, error) {
+	return &ResourceInstance{
+		ResourceInstance: provider.NewResourceInstance[Resource](r, name),
+	}, nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS - RESOURCE
+
+func (r Resource) Name() string {
+	return resourceName
+}
+
+func (r Resource) Schema() []schema.Attribute {
+	return schema.AttributesOf(Resource{})
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS - RESOURCE INSTANCE
+
+// Validate decodes the incoming state and checks that the TLS certificate
+// and key, when provided, form a valid and unexpired key pair.
+func (r *ResourceInstance) Validate(ctx context.Context, state schema.State, resolve schema.Resolver) (any, error) {
+	v, err := r.ResourceInstance.Validate(ctx, state, resolve)
+	if err != nil {
+		return nil, err
+	}
+	c := v.(*Resource)
+	verr := new(schema.ValidationError)
+	if c.TLS.Cert != "" || c.TLS.Key != "" {
+		if err := httpserver.ValidateCert([]byte(c.TLS.Cert), []byte(c.TLS.Key)); err != nil {
+			verr.Add("tls.cert", schema.CodeInvalid, "%v", err)
+		}
+	}
+	if c.Timeout < 0 {
+		verr.Add("timeout", schema.CodeInvalid, "must not be negative")
+	}
+	if err := verr.Err(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Apply binds the listener for the configuration and starts serving
+// requests. When the instance is already running, the new listener is
+// bound before the old server is shut down, so that a failed rebind
+// leaves the existing server untouched unless both use the same address.
+func (r *ResourceInstance) Apply(ctx context.Context, v any) error {
+	return r.ApplyConfig(ctx, v, func(ctx context.Context, c *Resource) error {
+		return r.listen(ctx, c)
+	})
+}
+
+// Destroy shuts down the server and releases the listener. The graceful
+// shutdown continues in the background, so that requests in flight
+// (including the one which may have triggered the destroy) can complete.
+func (r *ResourceInstance) Destroy(_ context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.running.stop()
+	r.running = nil
+	return nil
+}
+
+// Read returns the live state of the server, including the bound
+// address and the advertised URL when the server is running.
+func (r *ResourceInstance) Read(ctx context.Context) (schema.State, error) {
+	state, err := r.ResourceInstance.Read(ctx)
+	if err != nil || state == nil {
+		return state, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.running != nil {
+		state["addr"] = r.running.server.Addr()
+		state["url"] = r.running.server.URL().String()
+	}
+	return state, nil
+}
+
+// Spec returns the OpenAPI server entry for this instance, or nil if
+// the server is not running.
+func (r *ResourceInstance) Spec() *openapi.Server {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.running == nil {
+		return nil
+	}
+	return &openapi.Server{URL: r.running.server.URL().String()}
+}
+
+// OnStateChange is called by the observer system when an instance that
+// references this server has its state changed. If the source is a
+// router, requests under its prefix are dispatched to it.
+func (r *ResourceInstance) OnStateChange(source schema.ResourceInstance) {
+	if router, ok := source.(server.HTTPRouter); ok {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.routers == nil {
+			r.routers = make(map[string]server.HTTPRouter)
+		}
+		r.routers[source.Name()] = router
+	}
+}
+
+// OnStateRemove is called by the observer system when an instance that
+// references this server is being destroyed. If the source is a router,
+// it no longer receives requests.
+func (r *ResourceInstance) OnStateRemove(source schema.ResourceInstance) {
+	if _, ok := source.(server.HTTPRouter); ok {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.routers, source.Name())
+	}
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// listen creates a new server for the configuration, binds it and starts
+// serving in the background, replacing any existing server.
+func (r *ResourceInstance) listen(ctx context.Context, c *Resource) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Create TLS config when a certificate or server name is provided
+	var tlsCfg *tls.Config
+	if c.TLS.Cert != "" || c.TLS.Key != "" {
+		var err error
+		if tlsCfg, err = httpserver.TLSConfig(c.TLS.Name, false, []byte(c.TLS.Cert), []byte(c.TLS.Key)); err != nil {
+			return httpresponse.ErrBadRequest.Withf("tls: %v", err)
+		}
+	} else if c.TLS.Name != "" {
+		tlsCfg = &tls.Config{ServerName: c.TLS.Name}
+	}
+
+	// Create the server, which dispatches requests to the attached routers
+	srv, err := httpserver.New(c.Listen, tlsCfg, httpserver.WithReadTimeout(c.Timeout), httpserver.WithWriteTimeout(c.Timeout))
+	if err != nil {
+		return err
+	}
+	srv.SetHandler(http.HandlerFunc(r.serve))
+
+	// Bind the new listener. If the address is held by the running server,
+	// shut that down first and retry until the address is released. Any
+	// other error leaves the running server untouched.
+	if err := srv.Listen(); err != nil {
+		if !r.running.holds(c.Listen) || !errors.Is(err, syscall.EADDRINUSE) {
+			return err
+		}
+		r.running.stop()
+		r.running = nil
+		if err := rebind(ctx, srv); err != nil {
+			return err
+		}
+	}
+
+	// Serve requests in the background until the server is stopped
+	runCtx, cancel := context.WithCancel(context.Background())
+	go srv.Run(runCtx)
+
+	// Replace the running server
+	r.running.stop()
+	r.running = &running{listen: c.Listen, server: srv, cancel: cancel}
+
+	// Return success
+	return nil
+}
+
+// rebind retries binding the listener until it succeeds, the context is
+// done or the rebind timeout expires.
+func rebind(ctx context.Context, srv httpServer) error {
+	ctx, cancel := context.WithTimeout(ctx, rebindTimeout)
+	defer cancel()
+	for {
+		err := srv.Listen()
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(rebindDelay):
+		}
+	}
+}
+
+// holds reports whether the server is bound to the listen address, either
+// as configured or as bound. It is safe to call on a nil receiver.
+func (r *running) holds(listen string) bool {
+	return r != nil && (listen == r.listen || listen == r.server.Addr())
+}
+
+// stop begins a graceful shutdown of the server. It is safe to call on a
+// nil receiver.
+func (r *running) stop() {
+	if r != nil {
+		r.cancel()
+	}
+}
+
+// serve dispatches the request to the attached router with the longest
+// matching prefix, or returns a structured 404 when none matches.
+func (r *ResourceInstance) serve(w http.ResponseWriter, req *http.Request) {
+	if router := r.match(req.URL.Path); router != nil {
+		router.ServeHTTP(w, req)
+	} else {
+		_ = httpresponse.Error(w, httpresponse.ErrNotFound, req.RequestURI)
+	}
+}
+
+// match returns the router whose prefix is the longest match for path.
+// Routers that do not report a prefix match every path.
+func (r *ResourceInstance) match(path string) server.HTTPRouter {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// Sort router names so that matching is deterministic
+	names := make([]string, 0, len(r.routers))
+	for name := range r.routers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var result server.HTTPRouter
+	var length = -1
+	for _, name := range names {
+		router := r.routers[name]
+		prefix := "/"
+		if p, ok := router.(interface{ Prefix() string }); ok {
+			prefix = p.Prefix()
+		}
+		if !hasPathPrefix(path, prefix) || len(prefix) <= length {
+			continue
+		}
+		result, length = router, len(prefix)
+	}
+	return result
+}
+
+// hasPathPrefix reports whether path is equal to prefix or is below it.
+func hasPathPrefix(path, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" || path == prefix {
+		return true
+	}
+	return strings.HasPrefix(path, prefix+"/")
+}
@@ -0,0 +1,186 @@
+package resource_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+
+	// Packages
+	resource "github.com/mutablelogic/go-server/pkg/httpserver/resource"
+	provider "github.com/mutablelogic/go-server/pkg/provider"
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+	assert "github.com/stretchr/testify/assert"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// HELPERS
+
+func newTestManager(t *testing.T) *provider.Manager {
+	t.Helper()
+	mgr, err := provider.New("test", "test provider", "0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mgr.RegisterResource(resource.Resource{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = mgr.Close(context.Background())
+	})
+	return mgr
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// TESTS
+
+func Test_HTTPServer_001(t *testing.T) {
+	assert := assert.New(t)
+
+	// Schema marks the TLS material as sensitive and the address as readonly
+	attrs := map[string]schema.Attribute{}
+	for _, attr := range (resource.Resource{}).Schema() {
+		attrs[attr.Name] = attr
+	}
+	assert.True(attrs["tls.cert"].Sensitive)
+	assert.True(attrs["tls.key"].Sensitive)
+	assert.True(attrs["addr"].ReadOnly)
+	assert.True(attrs["url"].ReadOnly)
+	assert.Equal("duration", attrs["timeout"].Type)
+}
+
+func Test_HTTPServer_002(t *testing.T) {
+	assert := assert.New(t)
+	mgr := newTestManager(t)
+	ctx := context.Background()
+
+	// Create and apply a server on an ephemeral port
+	_, err := mgr.CreateResourceInstance(ctx, schema.CreateResourceInstanceRequest{Name: "httpserver.main"})
+	assert.NoError(err)
+	resp, err := mgr.UpdateResourceInstance(ctx, "httpserver.main", schema.UpdateResourceInstanceRequest{
+		Attributes: schema.State{"listen": "localhost:0"},
+		Apply:      true,
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal(schema.ActionCreate, resp.Plan.Action)
+
+	// The bound address and URL are reported
+	addr, ok := resp.Instance.State["addr"].(string)
+	assert.True(ok)
+	assert.NotEqual("localhost:0", addr)
+	url, ok := resp.Instance.State["url"].(string)
+	assert.True(ok)
+	assert.Contains(url, "http://")
+
+	// Without a router, requests return a structured 404
+	r, err := http.Get(url + "unknown")
+	if assert.NoError(err) {
+		r.Body.Close()
+		assert.Equal(http.StatusNotFound, r.StatusCode)
+	}
+}
+
+func Test_HTTPServer_003(t *testing.T) {
+	assert := assert.New(t)
+	mgr := newTestManager(t)
+	ctx := context.Background()
+
+	// Apply a server, then rebind it with a different timeout
+	_, err := mgr.CreateResourceInstance(ctx, schema.CreateResourceInstanceRequest{Name: "httpserver.main"})
+	assert.NoError(err)
+	resp, err := mgr.UpdateResourceInstance(ctx, "httpserver.main", schema.UpdateResourceInstanceRequest{
+		Attributes: schema.State{"listen": "localhost:0"},
+		Apply:      true,
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	resp, err = mgr.UpdateResourceInstance(ctx, "httpserver.main", schema.UpdateResourceInstanceRequest{
+		Attributes: schema.State{"timeout": "1m"},
+		Apply:      true,
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal(schema.ActionUpdate, resp.Plan.Action)
+	assert.Equal("1m0s", resp.Instance.State["timeout"])
+
+	// The rebound server serves requests
+	r, err := http.Get(resp.Instance.State["url"].(string))
+	if assert.NoError(err) {
+		r.Body.Close()
+		assert.Equal(http.StatusNotFound, r.StatusCode)
+	}
+
+	// Destroy stops the server and clears the address
+	_, err = mgr.DestroyResourceInstance(ctx, schema.DestroyResourceInstanceRequest{Name: "httpserver.main"})
+	assert.NoError(err)
+}
+
+func Test_HTTPServer_004(t *testing.T) {
+	assert := assert.New(t)
+	mgr := newTestManager(t)
+	ctx := context.Background()
+
+	// Invalid TLS material is rejected before anything is bound
+	_, err := mgr.CreateResourceInstance(ctx, schema.CreateResourceInstanceRequest{Name: "httpserver.main"})
+	assert.NoError(err)
+	_, err = mgr.UpdateResourceInstance(ctx, "httpserver.main", schema.UpdateResourceInstanceRequest{
+		Attributes: schema.State{"listen": "localhost:0", "tls.cert": "not a cert", "tls.key": "not a key"},
+		Apply:      true,
+	})
+	assert.Error(err)
+	assert.Contains(err.Error(), "tls")
+}
+
+func Test_HTTPServer_005(t *testing.T) {
+	assert := assert.New(t)
+	mgr := newTestManager(t)
+	ctx := context.Background()
+
+	// Find a free port, and occupy a second one
+	ln, err := net.Listen("tcp", "localhost:0")
+	if !assert.NoError(err) {
+		return
+	}
+	free := ln.Addr().String()
+	ln.Close()
+	occupied, err := net.Listen("tcp", "localhost:0")
+	if !assert.NoError(err) {
+		return
+	}
+	defer occupied.Close()
+
+	// Apply a server on the free port, then rebind it on the same address
+	_, err = mgr.CreateResourceInstance(ctx, schema.CreateResourceInstanceRequest{Name: "httpserver.main"})
+	assert.NoError(err)
+	_, err = mgr.UpdateResourceInstance(ctx, "httpserver.main", schema.UpdateResourceInstanceRequest{
+		Attributes: schema.State{"listen": free},
+		Apply:      true,
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	resp, err := mgr.UpdateResourceInstance(ctx, "httpserver.main", schema.UpdateResourceInstanceRequest{
+		Attributes: schema.State{"timeout": "1m"},
+		Apply:      true,
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal(free, resp.Instance.State["addr"])
+
+	// Rebinding on the occupied port fails, and leaves the server running
+	_, err = mgr.UpdateResourceInstance(ctx, "httpserver.main", schema.UpdateResourceInstanceRequest{
+		Attributes: schema.State{"listen": occupied.Addr().String()},
+		Apply:      true,
+	})
+	assert.Error(err)
+	r, err := http.Get(resp.Instance.State["url"].(string))
+	if assert.NoError(err) {
+		r.Body.Close()
+		assert.Equal(http.StatusNotFound, r.StatusCode)
+	}
+}
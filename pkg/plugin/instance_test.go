@@ -0,0 +1,66 @@
+package plugin
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	// Packages
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+	assert "github.com/stretchr/testify/assert"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TESTS
+
+func Test_Instance_001(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	// The test binary serves the counter provider of process_test.go
+	p, err := Launch(ctx, os.Args[0], WithEnv("PLUGIN_TEST_SERVE=1"))
+	if !assert.NoError(err) {
+		return
+	}
+	defer p.Close()
+	kept := func() int {
+		p.RLock()
+		defer p.RUnlock()
+		return len(p.instances)
+	}
+
+	// Instances which are validated and planned, but not applied, are not
+	// kept by the host or the plugin
+	resource := p.Resources()[0]
+	discarded, err := resource.New("counter_counter.a")
+	if !assert.NoError(err) {
+		return
+	}
+	config, err := discarded.Validate(ctx, schema.State{"value": 1}, nil)
+	if !assert.NoError(err) {
+		return
+	}
+	_, err = discarded.Plan(ctx, config)
+	assert.NoError(err)
+	assert.Zero(kept())
+	state, err := discarded.Read(ctx)
+	assert.NoError(err)
+	assert.Nil(state)
+
+	// Instances which are applied are kept until they are destroyed
+	applied, err := resource.New("counter_counter.a")
+	if !assert.NoError(err) {
+		return
+	}
+	config, err = applied.Validate(ctx, schema.State{"value": 2}, nil)
+	if !assert.NoError(err) || !assert.NoError(applied.Apply(ctx, config)) {
+		return
+	}
+	assert.Equal(1, kept())
+	state, err = applied.Read(ctx)
+	if assert.NoError(err) {
+		assert.EqualValues(2, state["value"])
+	}
+	assert.NoError(applied.Destroy(ctx))
+	assert.Zero(kept())
+}
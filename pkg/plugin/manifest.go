@@ -0,0 +1,179 @@
+package plugin
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	// Packages
+	httpresponse "github.com/mutablelogic/go-server/pkg/httpresponse"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Manifest describes a plugin, so that the host can check the plugin is
+// compatible before it is used. A Go plugin exports it as a variable named
+// "Manifest", and a plugin executable returns it from a Manifest method of
+// the provider passed to [Serve]:
+//
+//	var Manifest = plugin.Manifest{
+//		Name:         "s3",
+//		Version:      "1.0.0",
+//		APIVersion:   plugin.APIVersion,
+//		Capabilities: []string{plugin.CapabilityImport},
+//	}
+type Manifest struct {
+	// Name is the name of the provider of the plugin.
+	Name string `json:"name"`
+
+	// Version is the version of the plugin.
+	Version string `json:"version,omitempty"`
+
+	// APIVersion is the version of the plugin API the plugin was built
+	// against, which should be set to [APIVersion].
+	APIVersion string `json:"api_version"`
+
+	// Capabilities are the features the host must support to use the
+	// plugin.
+	Capabilities []string `json:"capabilities,omitempty"`
+}
+
+// versionedPlugin is a provider with the version of its manifest.
+type versionedPlugin struct {
+	Plugin
+	version string
+}
+
+// IncompatibleError is returned when a plugin cannot be used by the host,
+// with the reasons why.
+type IncompatibleError struct {
+	Path    string
+	Reasons []string
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+const (
+	// APIVersion is the version of the plugin API, as "major.minor". A
+	// plugin is compatible with a host with the same major version and the
+	// same or a later minor version.
+	APIVersion = "1.0"
+
+	manifestSymbol = "Manifest"
+)
+
+// Capabilities which a plugin can require of the host
+const (
+	CapabilityImport    = "import"    // instances can be imported with schema.Importable
+	CapabilityLifecycle = "lifecycle" // instances have lifecycle options
+	CapabilityObservers = "observers" // instances are observed with provider.Observable
+)
+
+var (
+	// Capabilities supported by Go plugins, which run in the host
+	goCapabilities = []string{CapabilityImport, CapabilityLifecycle, CapabilityObservers}
+
+	// Capabilities supported by plugin executables, whose instances can only
+	// be called over JSON-RPC
+	rpcCapabilities = []string{CapabilityImport, CapabilityLifecycle}
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Version returns the version of the manifest.
+func (p versionedPlugin) Version() string {
+	return p.version
+}
+
+// Compatible returns an [IncompatibleError] when the manifest was built
+// against an incompatible API version, or requires a capability which is
+// not one of the capabilities supported by the host.
+func (m Manifest) Compatible(capabilities ...string) error {
+	var reasons []string
+
+	// Check the API version
+	if m.APIVersion == "" {
+		reasons = append(reasons, "manifest has no API version")
+	} else if major, minor, ok := parseAPIVersion(m.APIVersion); !ok {
+		reasons = append(reasons, fmt.Sprintf("invalid API version %q", m.APIVersion))
+	} else if hostMajor, hostMinor, _ := parseAPIVersion(APIVersion); major != hostMajor || minor > hostMinor {
+		reasons = append(reasons, fmt.Sprintf("built against API version %s, but the host supports API version %s", m.APIVersion, APIVersion))
+	}
+
+	// Check the capabilities
+	var unsupported []string
+	for _, capability := range m.Capabilities {
+		if !slices.Contains(capabilities, capability) && !slices.Contains(unsupported, capability) {
+			unsupported = append(unsupported, capability)
+		}
+	}
+	if len(unsupported) > 0 {
+		reasons = append(reasons, fmt.Sprintf("requires capabilities not supported by the host: %s", strings.Join(unsupported, ", ")))
+	}
+
+	// Return any incompatibilities
+	if len(reasons) > 0 {
+		return &IncompatibleError{Reasons: reasons}
+	}
+	return nil
+}
+
+// Error returns the reasons the plugin is incompatible.
+func (e *IncompatibleError) Error() string {
+	reasons := strings.Join(e.Reasons, "; ")
+	if e.Path == "" {
+		return "incompatible plugin: " + reasons
+	}
+	return fmt.Sprintf("incompatible plugin %q: %s", e.Path, reasons)
+}
+
+// Unwrap returns [httpresponse.ErrPreconditionFailed].
+func (e *IncompatibleError) Unwrap() error {
+	return httpresponse.ErrPreconditionFailed
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// provider checks the provider of a plugin matches the manifest, and
+// returns the provider with the version of the manifest when it has none.
+func (m Manifest) provider(path string, p Plugin) (Plugin, error) {
+	if m.Name != "" && m.Name != p.Name() {
+		return nil, &IncompatibleError{Path: path, Reasons: []string{
+			fmt.Sprintf("manifest name %q does not match provider name %q", m.Name, p.Name()),
+		}}
+	}
+	if _, ok := p.(interface{ Version() string }); !ok && m.Version != "" {
+		return versionedPlugin{Plugin: p, version: m.Version}, nil
+	}
+	return p, nil
+}
+
+// parseAPIVersion returns the major and minor numbers of an API version.
+func parseAPIVersion(version string) (int, int, bool) {
+	major, minor, ok := strings.Cut(version, ".")
+	if !ok {
+		return 0, 0, false
+	}
+	x, err := strconv.ParseUint(major, 10, 16)
+	if err != nil {
+		return 0, 0, false
+	}
+	y, err := strconv.ParseUint(minor, 10, 16)
+	if err != nil {
+		return 0, 0, false
+	}
+	return int(x), int(y), true
+}
+
+// incompatible returns an [IncompatibleError] for the plugin at path.
+func incompatible(path string, err error) error {
+	if e, ok := err.(*IncompatibleError); ok {
+		return &IncompatibleError{Path: path, Reasons: e.Reasons}
+	}
+	return err
+}
@@ -0,0 +1,47 @@
+package plugin_test
+
+import (
+	"testing"
+
+	// Packages
+	httpresponse "github.com/mutablelogic/go-server/pkg/httpresponse"
+	plugin "github.com/mutablelogic/go-server/pkg/plugin"
+	assert "github.com/stretchr/testify/assert"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TESTS
+
+func Test_Manifest_001(t *testing.T) {
+	assert := assert.New(t)
+
+	// The same API version, or an earlier minor version, is compatible
+	assert.NoError(plugin.Manifest{APIVersion: plugin.APIVersion}.Compatible())
+	assert.NoError(plugin.Manifest{APIVersion: "1.0"}.Compatible())
+
+	// A later minor version, or another major version, is not
+	for _, version := range []string{"1.99", "2.0", "0.1"} {
+		err := plugin.Manifest{APIVersion: version}.Compatible()
+		if assert.Error(err, version) {
+			assert.Contains(err.Error(), "built against API version "+version)
+			assert.ErrorIs(err, httpresponse.ErrPreconditionFailed)
+		}
+	}
+
+	// Nor is a missing or invalid version
+	assert.ErrorContains(plugin.Manifest{}.Compatible(), "manifest has no API version")
+	assert.ErrorContains(plugin.Manifest{APIVersion: "v1"}.Compatible(), `invalid API version "v1"`)
+}
+
+func Test_Manifest_002(t *testing.T) {
+	assert := assert.New(t)
+
+	// Capabilities must be supported by the host, and are all reported
+	manifest := plugin.Manifest{APIVersion: plugin.APIVersion, Capabilities: []string{"import", "x", "y", "x"}}
+	assert.NoError(manifest.Compatible("import", "x", "y"))
+	err := manifest.Compatible("import")
+	var incompatible *plugin.IncompatibleError
+	if assert.ErrorAs(err, &incompatible) && assert.Len(incompatible.Reasons, 1) {
+		assert.Equal("requires capabilities not supported by the host: x, y", incompatible.Reasons[0])
+	}
+}
@@ -0,0 +1,101 @@
+package plugin
+
+import (
+	"io"
+	"log/slog"
+	"os"
+
+	// Packages
+	httpresponse "github.com/mutablelogic/go-server/pkg/httpresponse"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type opt struct {
+	args   []string
+	env    []string
+	socket bool
+	stderr io.Writer
+	logger *slog.Logger
+
+	skipIncompatible bool
+}
+
+type Opt func(*opt) error
+
+///////////////////////////////////////////////////////////////////////////////
+// LIFECYCLE
+
+func applyOpts(opts ...Opt) (*opt, error) {
+	o := &opt{stderr: os.Stderr, logger: slog.Default()}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// OPTIONS
+
+// Set the command-line arguments of plugin executables.
+func WithArgs(args ...string) Opt {
+	return func(o *opt) error {
+		o.args = append(o.args, args...)
+		return nil
+	}
+}
+
+// Add environment variables, in "key=value" form, to those which plugin
+// executables inherit from the host.
+func WithEnv(env ...string) Opt {
+	return func(o *opt) error {
+		o.env = append(o.env, env...)
+		return nil
+	}
+}
+
+// Connect to plugin executables over a unix socket rather than stdio. The
+// path of the socket is passed to the plugin in [SocketEnv], and the output
+// of the plugin is written to stderr.
+func WithSocket() Opt {
+	return func(o *opt) error {
+		o.socket = true
+		return nil
+	}
+}
+
+// Set the writer for the stderr of plugin executables, which is the stderr
+// of the host by default.
+func WithStderr(w io.Writer) Opt {
+	return func(o *opt) error {
+		if w == nil {
+			return httpresponse.ErrBadRequest.With("stderr is nil")
+		}
+		o.stderr = w
+		return nil
+	}
+}
+
+// Set the logger which reports plugin executables which exit and are
+// restarted, which is the default logger by default.
+func WithLogger(logger *slog.Logger) Opt {
+	return func(o *opt) error {
+		if logger == nil {
+			return httpresponse.ErrBadRequest.With("logger is nil")
+		}
+		o.logger = logger
+		return nil
+	}
+}
+
+// Skip plugins which are not compatible with the host, rather than
+// returning an error for them, and log a warning for each.
+func WithSkipIncompatible() Opt {
+	return func(o *opt) error {
+		o.skipIncompatible = true
+		return nil
+	}
+}
@@ -1,12 +1,15 @@
 package plugin
 
 import (
+	"context"
 	"debug/elf"
 	"debug/macho"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"plugin"
+	"strings"
 
 	// Packages
 	httpresponse "github.com/mutablelogic/go-server/pkg/httpresponse"
@@ -31,25 +34,50 @@ const (
 ///////////////////////////////////////////////////////////////////////////////
 // PUBLIC METHODS
 
-// PluginsForPattern will load plugins from filesystem for a given glob pattern
+// PluginsForPattern will load plugins from filesystem for the given glob
+// patterns, with the default options. See [PluginsForPatternEx].
 func PluginsForPattern(pattern ...string) ([]Plugin, error) {
+	return PluginsForPatternEx(pattern)
+}
+
+// PluginsForPatternEx will load plugins from filesystem for the given glob
+// patterns. Go plugins are opened in the host, and executables are launched
+// as subprocesses with the options, and served with [Serve]. Plugins which
+// are executables implement [io.Closer], and should be closed when they are
+// no longer used. A plugin with a [Manifest] is checked for compatibility
+// with the host before it is used, and with [WithSkipIncompatible] a plugin
+// which is not compatible is skipped rather than returned as an error. The
+// plugins which were loaded are returned with the errors of any patterns or
+// plugins which could not be loaded, so that they can be closed.
+func PluginsForPatternEx(patterns []string, opts ...Opt) ([]Plugin, error) {
 	var result []Plugin
 	var errs error
 
+	// Apply options
+	o, err := applyOpts(opts...)
+	if err != nil {
+		return nil, err
+	}
+
 	// Seek plugins
-	for _, p := range pattern {
+	for _, p := range patterns {
 		files, err := filepath.Glob(p)
 		if err != nil {
-			return nil, err
+			errs = errors.Join(errs, fmt.Errorf("%q: %w", p, err))
+			continue
 		}
 		if len(files) == 0 {
-			return nil, httpresponse.ErrBadRequest.Withf("No plugins found for pattern: %q", p)
+			errs = errors.Join(errs, httpresponse.ErrBadRequest.Withf("No plugins found for pattern: %q", p))
+			continue
 		}
 
 		// Load plugins
 		for _, path := range files {
-			plugin, err := pluginWithPath(path)
-			if err != nil {
+			plugin, err := pluginWithPath(path, o)
+			var incompatible *IncompatibleError
+			if o.skipIncompatible && errors.As(err, &incompatible) {
+				o.logger.Warn("plugin skipped", "path", path, "error", incompatible.Error())
+			} else if err != nil {
 				errs = errors.Join(errs, err)
 			} else {
 				result = append(result, plugin)
@@ -73,35 +101,83 @@ func isGoPlugin(path string) bool {
 		defer f.Close()
 		return f.Type == macho.TypeDylib || f.Type == macho.TypeBundle
 	}
-	// ELF (Linux/*BSD): only ET_DYN shared objects.
+	// ELF (Linux/*BSD): only ET_DYN shared objects, which unlike position
+	// independent executables have no interpreter.
+	if f, err := elf.Open(path); err == nil {
+		defer f.Close()
+		return f.Type == elf.ET_DYN && !hasInterp(f)
+	}
+	return false
+}
+
+// isExecutable reports whether the file at path is an executable which can
+// be launched as a plugin subprocess.
+func isExecutable(path string, mode os.FileMode) bool {
+	if mode.Perm()&0o111 == 0 {
+		return false
+	}
+	if f, err := macho.Open(path); err == nil {
+		defer f.Close()
+		return f.Type == macho.TypeExec
+	}
 	if f, err := elf.Open(path); err == nil {
 		defer f.Close()
-		return f.Type == elf.ET_DYN
+		return f.Type == elf.ET_EXEC || (f.Type == elf.ET_DYN && hasInterp(f))
+	}
+	return false
+}
+
+// hasInterp reports whether an ELF file names a program interpreter, as
+// dynamically linked executables do.
+func hasInterp(f *elf.File) bool {
+	for _, prog := range f.Progs {
+		if prog.Type == elf.PT_INTERP {
+			return true
+		}
 	}
 	return false
 }
 
 // Create a new plugin from a filepath
-func pluginWithPath(path string) (Plugin, error) {
+func pluginWithPath(path string, o *opt) (Plugin, error) {
 	// Check path to make sure it's a regular file
-	if stat, err := os.Stat(path); err != nil {
+	stat, err := os.Stat(path)
+	if err != nil {
 		return nil, err
 	} else if !stat.Mode().IsRegular() {
 		return nil, httpresponse.ErrBadRequest.Withf("Not a regular file: %q", path)
 	}
 
+	// Launch executables as a subprocess
+	if isExecutable(path, stat.Mode()) {
+		return launch(context.Background(), path, o)
+	}
+
 	// Inspect the binary header before calling plugin.Open — loading a
 	// non-plugin binary (e.g. a regular executable) triggers a fatal runtime
 	// error that cannot be caught by recover.
 	if !isGoPlugin(path) {
-		return nil, httpresponse.ErrBadRequest.Withf("Not a Go plugin (wrong binary type): %q", path)
+		return nil, httpresponse.ErrBadRequest.Withf("Not a Go plugin or executable (wrong binary type): %q", path)
 	}
 
 	// Load the plugin
 	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, openError(path, err)
+	}
+
+	// Check the manifest before calling the plugin
+	manifest, err := manifestOf(path, p)
 	if err != nil {
 		return nil, err
 	}
+	if manifest != nil {
+		if err := manifest.Compatible(goCapabilities...); err != nil {
+			return nil, incompatible(path, err)
+		}
+	}
+
+	// Call the plugin
 	fn, err := p.Lookup(configFunc)
 	if err != nil {
 		return nil, err
@@ -114,5 +190,35 @@ func pluginWithPath(path string) (Plugin, error) {
 	if config == nil {
 		return nil, httpresponse.ErrInternalError.Withf("Provider returned nil in %q", path)
 	}
+	if manifest != nil {
+		return manifest.provider(path, config)
+	}
 	return config, nil
 }
+
+// manifestOf returns the manifest exported by a Go plugin, or nil if it does
+// not export one.
+func manifestOf(path string, p *plugin.Plugin) (*Manifest, error) {
+	symbol, err := p.Lookup(manifestSymbol)
+	if err != nil {
+		return nil, nil
+	}
+	manifest, ok := symbol.(*Manifest)
+	if !ok || manifest == nil {
+		return nil, &IncompatibleError{Path: path, Reasons: []string{fmt.Sprintf("Manifest has type %T rather than plugin.Manifest", symbol)}}
+	}
+	return manifest, nil
+}
+
+// openError returns the error for a Go plugin which could not be opened,
+// explaining when it was built with different versions of the packages it
+// shares with the host, which the Go runtime requires to be identical.
+func openError(path string, err error) error {
+	const mismatch = "plugin was built with a different version of package "
+	if _, pkg, ok := strings.Cut(err.Error(), mismatch); ok {
+		return &IncompatibleError{Path: path, Reasons: []string{
+			fmt.Sprintf("built with a different version of package %s than the host, so it must be rebuilt with the same Go toolchain and module versions", pkg),
+		}}
+	}
+	return err
+}
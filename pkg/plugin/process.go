@@ -0,0 +1,619 @@
+package plugin
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	// Packages
+	httpresponse "github.com/mutablelogic/go-server/pkg/httpresponse"
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Process is a plugin executable which runs as a subprocess of the host,
+// and serves its resource types with [Serve]. It is a [schema.Provider]
+// whose resources and instances call the plugin over JSON-RPC, so a plugin
+// does not need to be built with the same toolchain and dependencies as the
+// host, and a plugin which panics does not take down the host. When the
+// plugin exits it is restarted, and its instances are created again and
+// re-applied with the configuration they were last applied with. Calls
+// made while the plugin is restarting wait for it, and calls in flight
+// when it exits fail.
+type Process struct {
+	sync.RWMutex
+	path      string
+	opt       *opt
+	meta      describeResult
+	resources []schema.Resource
+	conn      *conn
+	instances map[uint64]*remoteInstance
+	handle    atomic.Uint64
+	closed    bool
+	done      chan struct{} // closed by Close
+	restarted chan struct{} // closed and replaced when the plugin is restarted
+}
+
+// conn is a running plugin executable and the connection to it.
+type conn struct {
+	cmd     *exec.Cmd
+	client  *rpcClient
+	cleanup func()
+	exited  chan struct{} // closed when the executable has exited
+}
+
+// remoteResource is a resource type of a plugin executable.
+type remoteResource struct {
+	process *Process
+	name    string
+	schema  []schema.Attribute
+}
+
+// remoteInstance is an instance of a resource type of a plugin executable.
+type remoteInstance struct {
+	sync.Mutex
+	resource *remoteResource
+	handle   uint64
+	name     string
+	applied  *instanceParams // the parameters it was last applied with
+	imported string          // the ID it was imported with, when not applied
+	refs     []string
+}
+
+// remoteConfig is a configuration validated by a plugin executable. It is
+// sent to the plugin again as its state to plan and apply it.
+type remoteConfig struct {
+	params   instanceParams
+	state    schema.State
+	writable schema.State
+}
+
+var _ schema.Provider = (*Process)(nil)
+var _ schema.Resource = (*remoteResource)(nil)
+var _ schema.ResourceInstance = (*remoteInstance)(nil)
+var _ schema.Importable = (*remoteInstance)(nil)
+var _ schema.Configuration = (*remoteConfig)(nil)
+
+///////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+const (
+	startTimeout    = 10 * time.Second // time for a plugin to start and describe itself
+	stopTimeout     = 5 * time.Second  // time for a plugin to exit before it is killed
+	restartDelay    = 100 * time.Millisecond
+	restartDelayMax = 30 * time.Second
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// LIFECYCLE
+
+// Launch starts the plugin executable at path and returns its provider.
+// The plugin is restarted whenever it exits, until [Process.Close] is called.
+// It returns an [IncompatibleError] if the [Manifest] of the plugin is not
+// compatible with the host.
+func Launch(ctx context.Context, path string, opts ...Opt) (*Process, error) {
+	o, err := applyOpts(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return launch(ctx, path, o)
+}
+
+func launch(ctx context.Context, path string, o *opt) (*Process, error) {
+	p := &Process{
+		path:      path,
+		opt:       o,
+		instances: make(map[uint64]*remoteInstance),
+		done:      make(chan struct{}),
+		restarted: make(chan struct{}),
+	}
+
+	// Start the plugin
+	c, meta, err := p.start(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.conn, p.meta = c, meta
+	for _, r := range meta.Resources {
+		p.resources = append(p.resources, &remoteResource{process: p, name: r.Name, schema: r.Schema})
+	}
+
+	// Restart the plugin when it exits
+	go p.monitor(c)
+
+	// Return success
+	return p, nil
+}
+
+// Close stops the plugin executable, and waits for it to exit.
+func (p *Process) Close() error {
+	p.Lock()
+	if p.closed {
+		p.Unlock()
+		return nil
+	}
+	p.closed = true
+	c := p.conn
+	close(p.done)
+	p.Unlock()
+	return c.stop()
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS - PROVIDER
+
+// Name returns the name of the provider of the plugin.
+func (p *Process) Name() string {
+	return p.meta.Name
+}
+
+// Description returns the description of the provider of the plugin.
+func (p *Process) Description() string {
+	return p.meta.Description
+}
+
+// Version returns the version of the provider of the plugin.
+func (p *Process) Version() string {
+	return p.meta.Version
+}
+
+// Resources returns the resource types of the plugin.
+func (p *Process) Resources() []schema.Resource {
+	return p.resources
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS - RESOURCE
+
+func (r *remoteResource) Name() string {
+	return r.name
+}
+
+func (r *remoteResource) Schema() []schema.Attribute {
+	return r.schema
+}
+
+// New returns an instance with a new handle. The plugin creates the
+// instance when it is first used, so New does not call the plugin, and the
+// instance is only kept to be restored once it has been applied or
+// imported.
+func (r *remoteResource) New(name string) (schema.ResourceInstance, error) {
+	return &remoteInstance{
+		resource: r,
+		handle:   r.process.handle.Add(1),
+		name:     name,
+	}, nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS - INSTANCE
+
+func (i *remoteInstance) Name() string {
+	return i.name
+}
+
+func (i *remoteInstance) Resource() schema.Resource {
+	return i.resource
+}
+
+// Validate validates the state in the plugin. The references of the state
+// are resolved by the host, and the plugin is sent the resource type of
+// each instance which exists.
+func (i *remoteInstance) Validate(ctx context.Context, state schema.State, resolve schema.Resolver) (any, error) {
+	params := i.params(state)
+	for _, name := range schema.ReferencesFromState(i.resource.schema, state) {
+		if resolve == nil {
+			break
+		}
+		if ref := resolve(name); ref != nil {
+			if params.Refs == nil {
+				params.Refs = make(map[string]string)
+			}
+			params.Refs[name] = ref.Resource().Name()
+		}
+	}
+	var result validateResult
+	if err := i.resource.process.call(ctx, methodValidate, params, &result); err != nil {
+		return nil, err
+	}
+	return &remoteConfig{params: params, state: result.State, writable: result.Writable}, nil
+}
+
+// Plan plans the configuration in the plugin.
+func (i *remoteInstance) Plan(ctx context.Context, v any) (schema.Plan, error) {
+	config, err := i.config(v)
+	if err != nil {
+		return schema.Plan{}, err
+	}
+	var plan schema.Plan
+	if err := i.resource.process.call(ctx, methodPlan, config.params, &plan); err != nil {
+		return schema.Plan{}, err
+	}
+	return plan, nil
+}
+
+// Apply applies the configuration in the plugin, and keeps it to apply
+// again if the plugin is restarted.
+func (i *remoteInstance) Apply(ctx context.Context, v any) error {
+	config, err := i.config(v)
+	if err != nil {
+		return err
+	}
+	if err := i.resource.process.call(ctx, methodApply, config.params, nil); err != nil {
+		return err
+	}
+	i.Lock()
+	i.applied = &config.params
+	i.refs = slices.Sorted(maps.Keys(config.params.Refs))
+	i.Unlock()
+	i.resource.process.keep(i)
+	return nil
+}
+
+// Destroy destroys the instance in the plugin.
+func (i *remoteInstance) Destroy(ctx context.Context) error {
+	if err := i.resource.process.call(ctx, methodDestroy, i.params(nil), nil); err != nil {
+		return err
+	}
+	i.resource.process.Lock()
+	defer i.resource.process.Unlock()
+	delete(i.resource.process.instances, i.handle)
+	return nil
+}
+
+// Read reads the live state of the instance from the plugin.
+func (i *remoteInstance) Read(ctx context.Context) (schema.State, error) {
+	var state schema.State
+	if err := i.resource.process.call(ctx, methodRead, i.params(nil), &state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// References returns the names of the instances referenced by the
+// configuration which was last applied.
+func (i *remoteInstance) References() []string {
+	i.Lock()
+	defer i.Unlock()
+	return i.refs
+}
+
+// Import imports an existing resource in the plugin. It returns an error
+// if the resource type of the plugin does not support import.
+func (i *remoteInstance) Import(ctx context.Context, id string) (schema.State, error) {
+	params := i.params(nil)
+	params.ID = id
+	var state schema.State
+	if err := i.resource.process.call(ctx, methodImport, params, &state); err != nil {
+		return nil, err
+	}
+	i.Lock()
+	i.imported = id
+	i.Unlock()
+	i.resource.process.keep(i)
+	return state, nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS - CONFIG
+
+func (c *remoteConfig) State() schema.State {
+	return c.state
+}
+
+func (c *remoteConfig) WritableState() schema.State {
+	return c.writable
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS - PROCESS
+
+// call calls a method of the running plugin. When the plugin has exited,
+// it waits until the plugin is restarted, closed, or the context is done.
+func (p *Process) call(ctx context.Context, method string, params, result any) error {
+	for {
+		p.RLock()
+		c, closed, restarted := p.conn, p.closed, p.restarted
+		p.RUnlock()
+		if closed {
+			return httpresponse.ErrServiceUnavailable.Withf("plugin %q is closed", p.meta.Name)
+		}
+
+		// Wait for an exited plugin to be restarted
+		select {
+		case <-c.exited:
+			select {
+			case <-restarted:
+				continue
+			case <-p.done:
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		default:
+		}
+
+		// Call the method
+		return c.client.call(ctx, method, params, result)
+	}
+}
+
+// keep keeps an instance which has been applied or imported, to restore it
+// if the plugin is restarted.
+func (p *Process) keep(i *remoteInstance) {
+	p.Lock()
+	defer p.Unlock()
+	p.instances[i.handle] = i
+}
+
+// start starts the plugin executable, checks its manifest, and returns it
+// with its provider.
+func (p *Process) start(ctx context.Context) (*conn, describeResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, startTimeout)
+	defer cancel()
+
+	cmd := exec.Command(p.path, p.opt.args...)
+	cmd.Env = append(os.Environ(), p.opt.env...)
+	cmd.Stderr = p.opt.stderr
+	c := &conn{cmd: cmd, cleanup: func() {}, exited: make(chan struct{})}
+
+	// Connect over stdio or a unix socket
+	var err error
+	if p.opt.socket {
+		err = c.startSocket(ctx)
+	} else {
+		err = c.startStdio()
+	}
+	if err != nil {
+		return nil, describeResult{}, fmt.Errorf("%s: %w", p.path, err)
+	}
+	go c.wait()
+
+	// Check the manifest before calling the provider
+	var manifest Manifest
+	if err := c.client.call(ctx, methodManifest, nil, &manifest); err != nil {
+		_ = c.stop()
+		return nil, describeResult{}, fmt.Errorf("%s: %w", p.path, err)
+	}
+	if err := manifest.Compatible(rpcCapabilities...); err != nil {
+		_ = c.stop()
+		return nil, describeResult{}, incompatible(p.path, err)
+	}
+
+	// Describe the provider
+	var meta describeResult
+	if err := c.client.call(ctx, methodDescribe, nil, &meta); err != nil {
+		_ = c.stop()
+		return nil, describeResult{}, fmt.Errorf("%s: %w", p.path, err)
+	}
+	if err := schema.ValidateName(meta.Name); err != nil {
+		_ = c.stop()
+		return nil, describeResult{}, httpresponse.ErrBadRequest.Withf("%s: provider name: %v", p.path, err)
+	}
+	if manifest.Name != "" && manifest.Name != meta.Name {
+		_ = c.stop()
+		return nil, describeResult{}, &IncompatibleError{Path: p.path, Reasons: []string{
+			fmt.Sprintf("manifest name %q does not match provider name %q", manifest.Name, meta.Name),
+		}}
+	}
+	if meta.Version == "" {
+		meta.Version = manifest.Version
+	}
+
+	// Return success
+	return c, meta, nil
+}
+
+// monitor restarts the plugin each time it exits, until it is closed.
+func (p *Process) monitor(c *conn) {
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-c.exited:
+		}
+		p.opt.logger.Warn("plugin exited", "plugin", p.meta.Name, "path", p.path, "state", c.cmd.ProcessState.String())
+
+		// Restart with a delay which doubles on each failure
+		delay := restartDelay
+		for {
+			select {
+			case <-p.done:
+				return
+			case <-time.After(delay):
+			}
+			next, err := p.restart()
+			if err == nil {
+				c = next
+				break
+			}
+			p.opt.logger.Error("plugin restart failed", "plugin", p.meta.Name, "path", p.path, "error", err)
+			delay = min(delay*2, restartDelayMax)
+		}
+	}
+}
+
+// restart starts the plugin again, and re-applies or re-imports its
+// instances before it is used. Instances which cannot be re-applied are
+// reported, and remain to be applied again by the host.
+func (p *Process) restart() (*conn, error) {
+	c, meta, err := p.start(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if meta.Name != p.meta.Name {
+		_ = c.stop()
+		return nil, httpresponse.ErrConflict.Withf("%s: provider name changed from %q to %q", p.path, p.meta.Name, meta.Name)
+	}
+
+	// Restore the instances, in the order they were created
+	p.RLock()
+	instances := slices.SortedFunc(maps.Values(p.instances), func(a, b *remoteInstance) int {
+		return cmp.Compare(a.handle, b.handle)
+	})
+	p.RUnlock()
+	for _, instance := range instances {
+		if err := instance.restore(c.client); err != nil {
+			p.opt.logger.Error("plugin instance not restored", "plugin", p.meta.Name, "instance", instance.name, "error", err)
+		}
+	}
+
+	// Use the restarted plugin, unless closed in the meantime
+	p.Lock()
+	defer p.Unlock()
+	if p.closed {
+		_ = c.stop()
+		return c, nil
+	}
+	p.conn = c
+	close(p.restarted)
+	p.restarted = make(chan struct{})
+	p.opt.logger.Info("plugin restarted", "plugin", p.meta.Name, "path", p.path, "instances", len(instances))
+
+	// Return success
+	return c, nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS - CONN
+
+// startStdio starts the executable connected over stdin and stdout.
+func (c *conn) startStdio() error {
+	w, err := c.cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	r, err := c.cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := c.cmd.Start(); err != nil {
+		return err
+	}
+	c.client = newRPCClient(r, w)
+	return nil
+}
+
+// startSocket starts the executable, and waits for it to connect to a
+// unix socket whose path is passed in [SocketEnv].
+func (c *conn) startSocket(ctx context.Context) error {
+	dir, err := os.MkdirTemp("", "plugin")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, "plugin.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return errors.Join(err, os.RemoveAll(dir))
+	}
+	defer listener.Close()
+	c.cleanup = func() {
+		_ = os.RemoveAll(dir)
+	}
+
+	// Start the executable
+	c.cmd.Env = append(c.cmd.Env, SocketEnv+"="+path)
+	c.cmd.Stdout = c.cmd.Stderr
+	if err := c.cmd.Start(); err != nil {
+		c.cleanup()
+		return err
+	}
+
+	// Accept the connection
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = listener.(*net.UnixListener).SetDeadline(deadline)
+	}
+	conn, err := listener.Accept()
+	if err != nil {
+		_ = c.cmd.Process.Kill()
+		_ = c.cmd.Wait()
+		c.cleanup()
+		return err
+	}
+	c.client = newRPCClient(conn, conn)
+	return nil
+}
+
+// wait waits for the executable to exit.
+func (c *conn) wait() {
+	defer close(c.exited)
+	<-c.client.done
+	_ = c.cmd.Wait()
+	c.cleanup()
+}
+
+// stop closes the connection, so that the executable exits, and kills it if
+// it has not exited in time.
+func (c *conn) stop() error {
+	_ = c.client.Close()
+	select {
+	case <-c.exited:
+		return nil
+	case <-time.After(stopTimeout):
+	}
+	if err := c.cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+	<-c.exited
+	return nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS - INSTANCE
+
+// params returns the parameters for the instance, with a state.
+func (i *remoteInstance) params(state schema.State) instanceParams {
+	return instanceParams{
+		Handle:   i.handle,
+		Resource: i.resource.name,
+		Name:     i.name,
+		State:    state,
+	}
+}
+
+// config returns a configuration validated by the plugin, for the instance.
+func (i *remoteInstance) config(v any) (*remoteConfig, error) {
+	config, ok := v.(*remoteConfig)
+	if !ok || config == nil {
+		return nil, httpresponse.ErrInternalError.Withf("instance %q: unexpected configuration %T", i.name, v)
+	}
+	if config.params.Handle != i.handle {
+		params := config.params
+		params.Handle = i.handle
+		return &remoteConfig{params: params, state: config.state, writable: config.writable}, nil
+	}
+	return config, nil
+}
+
+// restore applies the configuration an instance was last applied with in a
+// restarted plugin, or imports it again.
+func (i *remoteInstance) restore(client *rpcClient) error {
+	ctx, cancel := context.WithTimeout(context.Background(), startTimeout)
+	defer cancel()
+
+	i.Lock()
+	applied, imported := i.applied, i.imported
+	i.Unlock()
+	switch {
+	case applied != nil:
+		return client.call(ctx, methodApply, applied, nil)
+	case imported != "":
+		params := i.params(nil)
+		params.ID = imported
+		return client.call(ctx, methodImport, params, nil)
+	default:
+		return nil
+	}
+}
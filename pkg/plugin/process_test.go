@@ -0,0 +1,269 @@
+package plugin_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	// Packages
+	httpresponse "github.com/mutablelogic/go-server/pkg/httpresponse"
+	plugin "github.com/mutablelogic/go-server/pkg/plugin"
+	provider "github.com/mutablelogic/go-server/pkg/provider"
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+	assert "github.com/stretchr/testify/assert"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// MOCK TYPES
+
+// counterProvider is served by the test binary when it is launched as a
+// plugin executable.
+type counterProvider struct{}
+
+func (counterProvider) Name() string                 { return "counter" }
+func (counterProvider) Description() string          { return "counter plugin" }
+func (counterProvider) Version() string              { return "1.2.3" }
+func (counterProvider) Resources() []schema.Resource { return []schema.Resource{counterConfig{}} }
+
+// counterConfig is a resource config with an optional dependency on
+// another instance, and the process ID of the plugin which applied it.
+type counterConfig struct {
+	Dep   schema.ResourceInstance `name:"dep" type:"counter"`
+	Value int                     `name:"value" max:"10"`
+	Pid   int                     `name:"pid" readonly:""`
+}
+
+func (counterConfig) Name() string               { return "counter" }
+func (counterConfig) Schema() []schema.Attribute { return schema.AttributesOf(counterConfig{}) }
+func (c counterConfig) New(name string) (schema.ResourceInstance, error) {
+	return &counterInstance{ResourceInstance: provider.NewResourceInstance(c, name)}, nil
+}
+
+type counterInstance struct {
+	provider.ResourceInstance[counterConfig]
+}
+
+func (i *counterInstance) Apply(ctx context.Context, v any) error {
+	return i.ApplyConfig(ctx, v, func(_ context.Context, c *counterConfig) error {
+		c.Pid = os.Getpid()
+		return nil
+	})
+}
+
+// manifestProvider is a counterProvider with a manifest.
+type manifestProvider struct {
+	counterProvider
+	manifest plugin.Manifest
+}
+
+func (p manifestProvider) Manifest() plugin.Manifest { return p.manifest }
+
+const (
+	serveEnv   = "PLUGIN_TEST_SERVE"
+	requireEnv = "PLUGIN_TEST_REQUIRE"
+)
+
+func TestMain(m *testing.M) {
+	if os.Getenv(serveEnv) != "" {
+		var p schema.Provider = counterProvider{}
+		if capability := os.Getenv(requireEnv); capability != "" {
+			p = manifestProvider{manifest: plugin.Manifest{Name: "counter", Capabilities: []string{capability}}}
+		}
+		if err := plugin.Serve(p); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func launch(t *testing.T, opts ...plugin.Opt) (*plugin.Process, *provider.Manager) {
+	t.Helper()
+	process, err := plugin.Launch(context.Background(), os.Args[0], append(opts, plugin.WithEnv(serveEnv+"=1"))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mgr, err := provider.New("test", "test provider", "0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mgr.RegisterProvider(process); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = mgr.Close(context.Background())
+		_ = process.Close()
+	})
+	return process, mgr
+}
+
+func applyCounter(t *testing.T, mgr *provider.Manager, name string, state schema.State) (*schema.UpdateResourceInstanceResponse, error) {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := mgr.CreateResourceInstance(ctx, schema.CreateResourceInstanceRequest{Name: name}); err != nil {
+		t.Fatal(err)
+	}
+	return mgr.UpdateResourceInstance(ctx, name, schema.UpdateResourceInstanceRequest{Attributes: state, Apply: true})
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// TESTS
+
+func Test_Process_001(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	process, mgr := launch(t)
+
+	// The provider is described by the plugin
+	assert.Equal("counter", process.Name())
+	assert.Equal("counter plugin", process.Description())
+	assert.Equal("1.2.3", process.Version())
+	if assert.Len(process.Resources(), 1) {
+		assert.Equal("counter", process.Resources()[0].Name())
+		assert.Equal(counterConfig{}.Schema(), process.Resources()[0].Schema())
+	}
+
+	// Instances are validated and applied in the plugin
+	resp, err := applyCounter(t, mgr, "counter_counter.a", schema.State{"value": 1})
+	if assert.NoError(err) {
+		assert.EqualValues(1, resp.Instance.State["value"])
+		assert.NotEqualValues(os.Getpid(), resp.Instance.State["pid"])
+	}
+	resp, err = applyCounter(t, mgr, "counter_counter.b", schema.State{"value": 2, "dep": "counter_counter.a"})
+	if assert.NoError(err) {
+		assert.Equal([]string{"counter_counter.a"}, resp.Instance.References)
+	}
+
+	// Validation errors are returned with each failure
+	_, err = mgr.UpdateResourceInstance(ctx, "counter_counter.a", schema.UpdateResourceInstanceRequest{Attributes: schema.State{"value": 11}})
+	var verr *schema.ValidationError
+	if assert.ErrorAs(err, &verr) && assert.Len(verr.Errors, 1) {
+		assert.Equal("value", verr.Errors[0].Attribute)
+	}
+
+	// A plan reports the changes
+	plan, err := mgr.UpdateResourceInstance(ctx, "counter_counter.a", schema.UpdateResourceInstanceRequest{Attributes: schema.State{"value": 3}})
+	if assert.NoError(err) {
+		assert.Equal(schema.ActionUpdate, plan.Plan.Action)
+	}
+
+	// Instances are destroyed in the plugin
+	destroy, err := mgr.DestroyResourceInstance(ctx, schema.DestroyResourceInstanceRequest{Name: "counter_counter.a", Cascade: true})
+	if assert.NoError(err) {
+		assert.Len(destroy.Instances, 2)
+	}
+}
+
+func Test_Process_002(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	_, mgr := launch(t, plugin.WithSocket())
+
+	// Apply an instance over a unix socket
+	resp, err := applyCounter(t, mgr, "counter_counter.a", schema.State{"value": 4})
+	if !assert.NoError(err) {
+		return
+	}
+	pid, ok := resp.Instance.State["pid"].(float64)
+	if !assert.True(ok) {
+		return
+	}
+
+	// Kill the plugin, which is restarted and the instance re-applied
+	proc, err := os.FindProcess(int(pid))
+	if !assert.NoError(err) {
+		return
+	}
+	assert.NoError(proc.Kill())
+	assert.Eventually(func() bool {
+		state, err := mgr.GetResourceInstance(ctx, "counter_counter.a")
+		if err != nil {
+			return false
+		}
+		live, ok := state.Instance.State["pid"].(float64)
+		return ok && live != pid && state.Instance.State["value"] == float64(4)
+	}, 10*time.Second, 50*time.Millisecond)
+}
+
+func Test_Process_003(t *testing.T) {
+	assert := assert.New(t)
+
+	// A plugin which requires a capability the host does not support over
+	// JSON-RPC is incompatible
+	_, err := plugin.Launch(context.Background(), os.Args[0], plugin.WithEnv(serveEnv+"=1", requireEnv+"="+plugin.CapabilityObservers))
+	var incompatible *plugin.IncompatibleError
+	if assert.ErrorAs(err, &incompatible) {
+		assert.Equal(os.Args[0], incompatible.Path)
+		assert.Contains(err.Error(), "requires capabilities not supported by the host: observers")
+	}
+
+	// And can be skipped
+	plugins, err := plugin.PluginsForPatternEx([]string{os.Args[0]}, plugin.WithEnv(serveEnv+"=1", requireEnv+"="+plugin.CapabilityObservers), plugin.WithSkipIncompatible())
+	assert.NoError(err)
+	assert.Empty(plugins)
+
+	// While a supported capability is compatible
+	plugins, err = plugin.PluginsForPatternEx([]string{os.Args[0]}, plugin.WithEnv(serveEnv+"=1", requireEnv+"="+plugin.CapabilityImport))
+	if assert.NoError(err) && assert.Len(plugins, 1) {
+		assert.Equal("counter", plugins[0].Name())
+		assert.NoError(plugins[0].(io.Closer).Close())
+	}
+}
+
+func Test_Process_004(t *testing.T) {
+	assert := assert.New(t)
+
+	// Plugins launched for earlier patterns are returned with the error of a
+	// later pattern which matches nothing, so that they can be closed
+	missing := filepath.Join(t.TempDir(), "*.plugin")
+	plugins, err := plugin.PluginsForPatternEx([]string{os.Args[0], missing}, plugin.WithEnv(serveEnv+"=1"))
+	assert.ErrorIs(err, httpresponse.ErrBadRequest)
+	if assert.Len(plugins, 1) {
+		assert.Equal("counter", plugins[0].Name())
+		assert.NoError(plugins[0].(io.Closer).Close())
+	}
+}
+
+func Test_Process_005(t *testing.T) {
+	assert := assert.New(t)
+
+	// Patterns can be given without options
+	plugins, err := plugin.PluginsForPattern(filepath.Join(t.TempDir(), "*.plugin"))
+	assert.ErrorIs(err, httpresponse.ErrBadRequest)
+	assert.Empty(plugins)
+}
+
+func Test_Process_006(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	_, mgr := launch(t)
+	resp, err := applyCounter(t, mgr, "counter_counter.a", schema.State{"value": 5})
+	if !assert.NoError(err) {
+		return
+	}
+	pid, ok := resp.Instance.State["pid"].(float64)
+	if !assert.True(ok) {
+		return
+	}
+
+	// Kill the plugin and wait for it to exit
+	proc, err := os.FindProcess(int(pid))
+	if !assert.NoError(err) {
+		return
+	}
+	assert.NoError(proc.Kill())
+	assert.Eventually(func() bool {
+		return proc.Signal(syscall.Signal(0)) != nil
+	}, 10*time.Second, 5*time.Millisecond)
+
+	// A call while the plugin is restarting waits for the restarted plugin
+	state, err := mgr.GetResourceInstance(ctx, "counter_counter.a")
+	if assert.NoError(err) {
+		assert.NotEqual(pid, state.Instance.State["pid"])
+		assert.Equal(float64(5), state.Instance.State["value"])
+	}
+}
@@ -0,0 +1,280 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	// Packages
+	httpresponse "github.com/mutablelogic/go-server/pkg/httpresponse"
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// rpcRequest is a JSON-RPC 2.0 request. Messages are exchanged as
+// newline-delimited JSON.
+type rpcRequest struct {
+	Version string          `json:"jsonrpc"`
+	ID      uint64          `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// rpcResponse is a JSON-RPC 2.0 response, with either a result or an error.
+type rpcResponse struct {
+	Version string          `json:"jsonrpc"`
+	ID      uint64          `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// rpcError is a JSON-RPC 2.0 error. The code is the HTTP status code of
+// the error, or one of the codes reserved by JSON-RPC, and the data is the
+// validation error when there is one.
+type rpcError struct {
+	Code    int                     `json:"code"`
+	Message string                  `json:"message"`
+	Data    *schema.ValidationError `json:"data,omitempty"`
+}
+
+// describeResult is the result of [methodDescribe].
+type describeResult struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Version     string         `json:"version,omitempty"`
+	Resources   []resourceMeta `json:"resources"`
+}
+
+// resourceMeta describes a resource type of the plugin.
+type resourceMeta struct {
+	Name   string             `json:"name"`
+	Schema []schema.Attribute `json:"schema"`
+}
+
+// instanceParams are the parameters of the instance methods. Instances are
+// identified by a handle chosen by the host, as a replacement has the same
+// name as the instance it replaces. The plugin creates an instance from its
+// resource type and name when it is first used, and only keeps it once it
+// has been applied or imported, so that instances the host discards
+// without applying do not accumulate in the plugin. The configuration of an
+// instance is sent as its state, and is validated again by the plugin for
+// each call so that the plugin holds no state other than its instances.
+// References are the resource type names of the instances referenced by the
+// state which exist in the host.
+type instanceParams struct {
+	Handle   uint64            `json:"handle"`
+	Resource string            `json:"resource,omitempty"`
+	Name     string            `json:"name,omitempty"`
+	State    schema.State      `json:"state,omitempty"`
+	Refs     map[string]string `json:"refs,omitempty"`
+	ID       string            `json:"id,omitempty"`
+}
+
+// validateResult is the result of [methodValidate].
+type validateResult struct {
+	State    schema.State `json:"state"`
+	Writable schema.State `json:"writable"`
+}
+
+// rpcClient calls methods on the other end of a connection, and matches
+// responses to requests by ID so that calls can be made concurrently.
+type rpcClient struct {
+	sync.Mutex
+	w       io.WriteCloser
+	enc     *json.Encoder
+	next    uint64
+	pending map[uint64]chan rpcResponse
+	err     error         // set when the connection is closed
+	done    chan struct{} // closed when the connection is closed
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+const (
+	rpcVersion = "2.0"
+
+	methodManifest = "plugin.manifest"
+	methodDescribe = "provider.describe"
+	methodValidate = "instance.validate"
+	methodPlan     = "instance.plan"
+	methodApply    = "instance.apply"
+	methodDestroy  = "instance.destroy"
+	methodRead     = "instance.read"
+	methodImport   = "instance.import"
+
+	// Error codes reserved by JSON-RPC
+	codeParseError     = -32700
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// LIFECYCLE
+
+// newRPCClient returns a client which writes requests to w and reads
+// responses from r until r returns an error.
+func newRPCClient(r io.Reader, w io.WriteCloser) *rpcClient {
+	c := &rpcClient{
+		w:       w,
+		enc:     json.NewEncoder(w),
+		pending: make(map[uint64]chan rpcResponse),
+		done:    make(chan struct{}),
+	}
+	go c.read(json.NewDecoder(r))
+	return c
+}
+
+// Close closes the writer, which signals the other end to exit.
+func (c *rpcClient) Close() error {
+	return c.w.Close()
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// call calls a method and decodes the result into result, which may be nil.
+func (c *rpcClient) call(ctx context.Context, method string, params, result any) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	// Send the request
+	ch := make(chan rpcResponse, 1)
+	c.Lock()
+	if c.err != nil {
+		c.Unlock()
+		return c.err
+	}
+	c.next++
+	id := c.next
+	c.pending[id] = ch
+	err = c.enc.Encode(rpcRequest{Version: rpcVersion, ID: id, Method: method, Params: data})
+	c.Unlock()
+	if err != nil {
+		c.forget(id)
+		return httpresponse.ErrServiceUnavailable.Withf("plugin: %v", err)
+	}
+
+	// Wait for the response
+	select {
+	case <-ctx.Done():
+		c.forget(id)
+		return ctx.Err()
+	case resp, ok := <-ch:
+		if !ok {
+			return c.closed()
+		}
+		if resp.Error != nil {
+			return resp.Error.err()
+		}
+		if result == nil || len(resp.Result) == 0 {
+			return nil
+		}
+		return json.Unmarshal(resp.Result, result)
+	}
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// read dispatches responses until the connection is closed, and then fails
+// the calls which are still waiting.
+func (c *rpcClient) read(dec *json.Decoder) {
+	var err error
+	for {
+		var resp rpcResponse
+		if err = dec.Decode(&resp); err != nil {
+			break
+		}
+		c.Lock()
+		ch, exists := c.pending[resp.ID]
+		delete(c.pending, resp.ID)
+		c.Unlock()
+		if exists {
+			ch <- resp
+		}
+	}
+
+	// Close the connection
+	if errors.Is(err, io.EOF) {
+		err = httpresponse.ErrServiceUnavailable.With("plugin exited")
+	} else {
+		err = httpresponse.ErrServiceUnavailable.Withf("plugin: %v", err)
+	}
+	c.Lock()
+	c.err = err
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+	c.Unlock()
+	close(c.done)
+}
+
+// forget removes a call which is no longer waiting for a response.
+func (c *rpcClient) forget(id uint64) {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.pending, id)
+}
+
+// closed returns the error which closed the connection.
+func (c *rpcClient) closed() error {
+	c.Lock()
+	defer c.Unlock()
+	return c.err
+}
+
+// rpcErrorOf returns the error to send for err, keeping its status code
+// and validation failures.
+func rpcErrorOf(err error) *rpcError {
+	if e := new(rpcError); errors.As(err, &e) {
+		return e
+	}
+	e := &rpcError{Code: http.StatusInternalServerError, Message: err.Error()}
+	var code httpresponse.Err
+	if errors.As(err, &code) {
+		e.Code = int(code)
+	}
+	var verr *schema.ValidationError
+	if errors.As(err, &verr) {
+		e.Data = verr
+	}
+	return e
+}
+
+// Error returns the message of the error, so that a handler can return it
+// to send one of the codes reserved by JSON-RPC.
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+// err returns the error received, as a validation error when it has
+// validation failures, and otherwise with its status code.
+func (e *rpcError) err() error {
+	if e.Data != nil && len(e.Data.Errors) > 0 {
+		return e.Data
+	}
+	message := e.Message
+	if text := http.StatusText(e.Code); text != "" {
+		message = strings.TrimPrefix(message, text+": ")
+	}
+	switch {
+	case e.Code == codeMethodNotFound:
+		return httpresponse.ErrNotImplemented.With(message)
+	case e.Code == codeParseError || e.Code == codeInvalidParams:
+		return httpresponse.ErrBadRequest.With(message)
+	case e.Code >= 400 && e.Code < 600:
+		return httpresponse.Err(e.Code).With(message)
+	default:
+		return httpresponse.ErrInternalError.With(message)
+	}
+}
@@ -0,0 +1,343 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+
+	// Packages
+	httpresponse "github.com/mutablelogic/go-server/pkg/httpresponse"
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// server serves the resource types of a provider to the host.
+type server struct {
+	sync.Mutex
+	provider  schema.Provider
+	resources map[string]schema.Resource
+	instances map[uint64]schema.ResourceInstance
+	enc       *json.Encoder
+	encLock   sync.Mutex
+}
+
+// reference stands in for an instance of the host which is referenced by
+// the state of an instance of the plugin. It has the name and resource type
+// of the instance, but none of its methods can be called.
+type reference struct {
+	name     string
+	resource referenceResource
+}
+
+type referenceResource string
+
+var _ schema.ResourceInstance = reference{}
+var _ schema.Resource = referenceResource("")
+
+///////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+const (
+	// SocketEnv is the environment variable with the path of the unix
+	// socket a plugin connects to, when the host does not use stdio.
+	SocketEnv = "GO_SERVER_PLUGIN_SOCKET"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Serve is called from the main function of a plugin executable to serve
+// the resource types of the provider to the host which launched it, until
+// the host closes the connection. The host checks the [Manifest] returned
+// by a Manifest method of the provider, when it has one, before it calls
+// the provider. It connects to the unix socket named by
+// [SocketEnv] when set, and otherwise uses stdin and stdout, so the plugin
+// should write any logging to stderr.
+func Serve(provider schema.Provider) error {
+	ctx := context.Background()
+	if path := os.Getenv(SocketEnv); path != "" {
+		conn, err := net.Dial("unix", path)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		return ServeConn(ctx, provider, conn, conn)
+	}
+	return ServeConn(ctx, provider, os.Stdin, os.Stdout)
+}
+
+// ServeConn serves the resource types of the provider, reading requests
+// from r and writing responses to w, until r is closed or the context is
+// cancelled. Requests are handled concurrently.
+func ServeConn(ctx context.Context, provider schema.Provider, r io.Reader, w io.Writer) error {
+	if provider == nil {
+		return httpresponse.ErrBadRequest.With("provider is nil")
+	}
+	s := &server{
+		provider:  provider,
+		resources: make(map[string]schema.Resource),
+		instances: make(map[uint64]schema.ResourceInstance),
+		enc:       json.NewEncoder(w),
+	}
+	for _, r := range provider.Resources() {
+		s.resources[r.Name()] = r
+	}
+
+	// Read requests in the background, so that cancelling the context
+	// returns without waiting for the reader
+	requests := make(chan rpcRequest)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(requests)
+		dec := json.NewDecoder(r)
+		for {
+			var req rpcRequest
+			if err := dec.Decode(&req); err != nil {
+				errs <- err
+				return
+			}
+			select {
+			case requests <- req:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// Handle requests until the connection is closed
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case req, ok := <-requests:
+			if !ok {
+				if err := <-errs; !errors.Is(err, io.EOF) {
+					return err
+				}
+				return nil
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				result, err := s.handle(ctx, req)
+				s.respond(req.ID, result, err)
+			}()
+		}
+	}
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// respond writes the response to a request, with the result or error.
+func (s *server) respond(id uint64, result any, err error) {
+	resp := rpcResponse{Version: rpcVersion, ID: id}
+	if err != nil {
+		resp.Error = rpcErrorOf(err)
+	} else if data, err := json.Marshal(result); err != nil {
+		resp.Error = rpcErrorOf(err)
+	} else {
+		resp.Result = data
+	}
+	s.encLock.Lock()
+	defer s.encLock.Unlock()
+	_ = s.enc.Encode(resp)
+}
+
+// handle calls the method of the request.
+func (s *server) handle(ctx context.Context, req rpcRequest) (any, error) {
+	switch req.Method {
+	case methodManifest:
+		return s.manifest(), nil
+	case methodDescribe:
+		return s.describe(), nil
+	}
+
+	// Decode the parameters
+	var params instanceParams
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return nil, &rpcError{Code: codeInvalidParams, Message: err.Error()}
+	}
+
+	switch req.Method {
+	case methodValidate:
+		return s.validate(ctx, params)
+	case methodPlan:
+		instance, config, err := s.config(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+		return instance.Plan(ctx, config)
+	case methodApply:
+		instance, config, err := s.config(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+		if err := instance.Apply(ctx, config); err != nil {
+			return nil, err
+		}
+		s.keep(params.Handle, instance)
+		return nil, nil
+	case methodDestroy:
+		instance, exists := s.kept(params.Handle)
+		if !exists {
+			return nil, nil
+		}
+		if err := instance.Destroy(ctx); err != nil {
+			return nil, err
+		}
+		s.Lock()
+		delete(s.instances, params.Handle)
+		s.Unlock()
+		return nil, nil
+	case methodRead:
+		instance, err := s.instance(params)
+		if err != nil {
+			return nil, err
+		}
+		return instance.Read(ctx)
+	case methodImport:
+		instance, err := s.instance(params)
+		if err != nil {
+			return nil, err
+		}
+		importable, ok := instance.(schema.Importable)
+		if !ok {
+			return nil, httpresponse.ErrBadRequest.Withf("resource %q does not support import", instance.Resource().Name())
+		}
+		state, err := importable.Import(ctx, params.ID)
+		if err != nil {
+			return nil, err
+		}
+		s.keep(params.Handle, instance)
+		return state, nil
+	default:
+		return nil, &rpcError{Code: codeMethodNotFound, Message: "method not found: " + req.Method}
+	}
+}
+
+// manifest returns the manifest of the provider, which was built against
+// this version of the API unless the manifest says otherwise.
+func (s *server) manifest() Manifest {
+	var manifest Manifest
+	if m, ok := s.provider.(interface{ Manifest() Manifest }); ok {
+		manifest = m.Manifest()
+	}
+	if manifest.APIVersion == "" {
+		manifest.APIVersion = APIVersion
+	}
+	return manifest
+}
+
+// describe returns the provider and its resource types.
+func (s *server) describe() describeResult {
+	result := describeResult{
+		Name:        s.provider.Name(),
+		Description: s.provider.Description(),
+	}
+	if v, ok := s.provider.(interface{ Version() string }); ok {
+		result.Version = v.Version()
+	}
+	for _, r := range s.provider.Resources() {
+		result.Resources = append(result.Resources, resourceMeta{
+			Name:   r.Name(),
+			Schema: r.Schema(),
+		})
+	}
+	return result
+}
+
+// validate validates the state of an instance, and returns the state of the
+// validated configuration.
+func (s *server) validate(ctx context.Context, params instanceParams) (any, error) {
+	_, config, err := s.config(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	return validateResult{
+		State:    schema.StateOf(config),
+		Writable: schema.WritableStateOf(config),
+	}, nil
+}
+
+// config returns an instance and its configuration validated from the state.
+func (s *server) config(ctx context.Context, params instanceParams) (schema.ResourceInstance, any, error) {
+	instance, err := s.instance(params)
+	if err != nil {
+		return nil, nil, err
+	}
+	config, err := instance.Validate(ctx, params.State, func(name string) schema.ResourceInstance {
+		if resource, exists := params.Refs[name]; exists {
+			return reference{name: name, resource: referenceResource(resource)}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return instance, config, nil
+}
+
+// instance returns the instance with the handle of the parameters, or
+// creates one from their resource type and name which is not kept.
+func (s *server) instance(params instanceParams) (schema.ResourceInstance, error) {
+	if instance, exists := s.kept(params.Handle); exists {
+		return instance, nil
+	}
+	r, exists := s.resources[params.Resource]
+	if !exists {
+		return nil, httpresponse.ErrNotFound.Withf("resource %q", params.Resource)
+	}
+	return r.New(params.Name)
+}
+
+// kept returns the instance with a handle, if it has been kept.
+func (s *server) kept(handle uint64) (schema.ResourceInstance, bool) {
+	s.Lock()
+	defer s.Unlock()
+	instance, exists := s.instances[handle]
+	return instance, exists
+}
+
+// keep keeps an instance which has been applied or imported.
+func (s *server) keep(handle uint64, instance schema.ResourceInstance) {
+	s.Lock()
+	defer s.Unlock()
+	s.instances[handle] = instance
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// REFERENCE
+
+func (r reference) Name() string                     { return r.name }
+func (r reference) Resource() schema.Resource        { return r.resource }
+func (r reference) References() []string             { return nil }
+func (r reference) Destroy(context.Context) error    { return r.unsupported() }
+func (r reference) Apply(context.Context, any) error { return r.unsupported() }
+func (r reference) Read(context.Context) (schema.State, error) {
+	return nil, r.unsupported()
+}
+func (r reference) Plan(context.Context, any) (schema.Plan, error) {
+	return schema.Plan{}, r.unsupported()
+}
+func (r reference) Validate(context.Context, schema.State, schema.Resolver) (any, error) {
+	return nil, r.unsupported()
+}
+
+func (r reference) unsupported() error {
+	return httpresponse.ErrNotImplemented.Withf("instance %q is not in the plugin", r.name)
+}
+
+func (r referenceResource) Name() string               { return string(r) }
+func (r referenceResource) Schema() []schema.Attribute { return nil }
+func (r referenceResource) New(string) (schema.ResourceInstance, error) {
+	return nil, httpresponse.ErrNotImplemented.Withf("resource %q is not in the plugin", string(r))
+}
@@ -0,0 +1,321 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	// Packages
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+	types "github.com/mutablelogic/go-server/pkg/types"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// ApplyConfig validates and plans a complete desired set of instances as a
+// single operation, with every instance locked. Instances are planned in
+// dependency order, so that each comes after the instances it references;
+// instances which do not yet exist are created. When req.Prune is true,
+// instances absent from the document are planned for destruction, in
+// safe-to-destroy order, after all creates and updates. When req.Apply is
+// true the combined plan is also applied; instances whose plan is a no-op
+// are not re-applied. Instances which do not depend on each other are
+// applied, and pruned, concurrently. If a create or update fails, those
+// already applied are reverted and nothing is pruned; the error of each
+// instance which failed is returned as an [InstanceError]. If an instance
+// fails to be pruned, its error is returned together with the response,
+// which lists the instances which were applied and those which were
+// destroyed. Lifecycle options are kept for instances which do not set them
+// in the document. When an instance to prune has a lifecycle which prevents
+// destroy, the whole request fails with [ErrConflict] before anything is
+// applied.
+func (m *Manager) ApplyConfig(ctx context.Context, req schema.ApplyConfigRequest) (*schema.ApplyConfigResponse, error) {
+	m.graph.Lock()
+	defer m.graph.Unlock()
+
+	// Check context
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Index the document by instance name
+	docs := make(map[string]schema.State, len(req.Instances))
+	lifecycles := make(map[string]*schema.Lifecycle, len(req.Instances))
+	for _, cfg := range req.Instances {
+		parts := strings.SplitN(cfg.Name, ".", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, ErrBadRequest.Withf("invalid instance name %q: expected resource.label", cfg.Name)
+		}
+		res, exists := m.resource(parts[0])
+		if !exists {
+			return nil, ErrBadRequest.Withf("instance %q: resource %q is not registered", cfg.Name, parts[0])
+		}
+		if _, exists := docs[cfg.Name]; exists {
+			return nil, ErrBadRequest.Withf("instance %q appears more than once", cfg.Name)
+		}
+		if inst, exists := m.get(cfg.Name); exists && inst.readOnly {
+			return nil, ErrConflict.Withf("cannot update %q: instance is read-only", cfg.Name)
+		}
+		attrs := cfg.Attributes
+		if attrs == nil {
+			attrs = schema.State{}
+		}
+		if cfg.Lifecycle != nil {
+			if err := cfg.Lifecycle.Validate(res.Schema()); err != nil {
+				return nil, fmt.Errorf("instance %q: validate: %w", cfg.Name, err)
+			}
+		}
+		docs[cfg.Name] = attrs
+		lifecycles[cfg.Name] = cfg.Lifecycle
+	}
+
+	// Order the document so that dependencies come first
+	order, err := m.applyOrder(docs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Stage the instances, creating those which do not yet exist. New
+	// instances are only added to the manager once applied.
+	staged := make(map[string]instance, len(order))
+	for _, name := range order {
+		if inst, exists := m.get(name); exists {
+			staged[name] = inst
+			continue
+		}
+		resource, label, _ := strings.Cut(name, ".")
+		if !types.IsIdentifier(label) {
+			return nil, ErrBadRequest.Withf("invalid label %q: must match [a-zA-Z][a-zA-Z0-9_-]{0,63}", label)
+		}
+		res, _ := m.resource(resource)
+		inst, err := res.New(name)
+		if err != nil {
+			return nil, fmt.Errorf("resource %q: %w", resource, err)
+		} else if inst == nil {
+			return nil, ErrBadRequest.With("resource instance is nil")
+		}
+		staged[name] = newEntry(inst)
+	}
+	for name, lifecycle := range lifecycles {
+		if inst, exists := staged[name]; exists && lifecycle != nil {
+			inst.lifecycle = *lifecycle
+			staged[name] = inst
+		}
+	}
+
+	// Resolve references to staged instances before live ones
+	resolve := func(name string) schema.ResourceInstance {
+		if inst, ok := staged[name]; ok {
+			return inst.instance
+		}
+		if inst, ok := m.get(name); ok {
+			return inst.instance
+		}
+		return nil
+	}
+
+	// Validate and plan each instance
+	steps := make([]step, 0, len(order))
+	response := new(schema.ApplyConfigResponse)
+	for _, name := range order {
+		inst := staged[name]
+		current, exists := m.get(name)
+		var previous schema.State
+		if exists {
+			if state, err := inst.instance.Read(ctx); err == nil {
+				previous = state
+			}
+		}
+
+		// Attributes ignored by the lifecycle keep their current values
+		attrs := docs[name]
+		if current.applied != nil {
+			attrs = ignoreChanges(inst.lifecycle, attrs, previous)
+		}
+		config, err := inst.instance.Validate(ctx, attrs, resolve)
+		if err != nil {
+			return nil, fmt.Errorf("instance %q: validate: %w", name, err)
+		}
+		plan, err := inst.instance.Plan(ctx, config)
+		if err != nil {
+			return nil, fmt.Errorf("instance %q: plan: %w", name, err)
+		}
+		m.publishPlan(schema.EventPlanned, inst.instance, plan)
+		steps = append(steps, step{instance: inst, config: config, plan: plan, attrs: attrs, previous: previous, lifecycle: current.lifecycle, created: !exists})
+		response.Plan = append(response.Plan, schema.InstancePlan{Name: name, Plan: plan})
+	}
+
+	// Plan the instances to prune
+	var prune [][]string
+	if req.Prune {
+		if prune, err = m.pruneLayers(docs); err != nil {
+			return nil, err
+		}
+		for _, name := range slices.Concat(prune...) {
+			plan := schema.Plan{Action: schema.ActionDestroy}
+			if inst, exists := m.get(name); exists {
+				m.publishPlan(schema.EventPlanned, inst.instance, plan)
+			}
+			response.Plan = append(response.Plan, schema.InstancePlan{Name: name, Plan: plan})
+		}
+	}
+
+	// Return the plan if not applying
+	if !req.Apply {
+		return response, nil
+	}
+
+	// Apply the creates and updates in dependency order, reverting
+	// those already applied if one fails
+	if err := m.applySteps(ctx, steps); err != nil {
+		return nil, err
+	}
+	for _, name := range order {
+		if inst, exists := m.get(name); exists {
+			response.Instances = append(response.Instances, m.redactedInstanceMeta(ctx, inst))
+		}
+	}
+
+	// Destroy the pruned instances
+	var mu sync.Mutex
+	metas := make(map[string]schema.InstanceMeta)
+	done, err := m.runLayers(ctx, prune, false, func(ctx context.Context, name string) error {
+		inst, exists := m.get(name)
+		if !exists {
+			return nil
+		}
+		meta, err := m.destroyInstance(ctx, inst)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		metas[name] = meta
+		return nil
+	})
+	for _, name := range done {
+		if meta, exists := metas[name]; exists {
+			response.Destroyed = append(response.Destroyed, meta)
+		}
+	}
+
+	// Return the response, with the errors of any instances which failed to
+	// be pruned
+	return response, err
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// applyOrder returns the instance names in the document ordered so that
+// each comes after the instances it references. References are read from
+// the document for instances in it, and from the live instance otherwise,
+// so that a circular dependency through an instance outside the document
+// is also rejected.
+func (m *Manager) applyOrder(docs map[string]schema.State) ([]string, error) {
+	refs := func(name string) []string {
+		if state, exists := docs[name]; exists {
+			resource, _, _ := strings.Cut(name, ".")
+			if res, exists := m.resource(resource); exists {
+				return schema.ReferencesFromState(res.Schema(), state)
+			}
+			return nil
+		}
+		if inst, exists := m.get(name); exists {
+			return inst.instance.References()
+		}
+		return nil
+	}
+
+	// Visit in name order so that the result is deterministic
+	names := make([]string, 0, len(docs))
+	for name := range docs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	// Depth-first walk, emitting dependencies before dependents. An
+	// instance which is reached again while it is being visited is part
+	// of a cycle.
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int, len(docs))
+	order := make([]string, 0, len(docs))
+	var visit func(string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return ErrBadRequest.Withf("circular dependency: %q leads back to itself", name)
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		for _, ref := range refs(name) {
+			if err := visit(ref); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		if _, exists := docs[name]; exists {
+			order = append(order, name)
+		}
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// pruneLayers returns the live instances which are absent from the document,
+// in layers which are safe to destroy in turn. Read-only instances are never
+// pruned. It returns an error when an instance which is kept references one
+// which would be pruned, or when the lifecycle of an instance which would be
+// pruned prevents destroy.
+func (m *Manager) pruneLayers(docs map[string]schema.State) ([][]string, error) {
+	all := m.snapshot()
+	prune := make(map[string]bool)
+	for name, inst := range all {
+		if _, exists := docs[name]; !exists && !inst.readOnly {
+			prune[name] = true
+		}
+	}
+
+	// Check that kept instances do not reference pruned ones
+	for name, state := range docs {
+		resource, _, _ := strings.Cut(name, ".")
+		res, exists := m.resource(resource)
+		if !exists {
+			continue
+		}
+		for _, ref := range schema.ReferencesFromState(res.Schema(), state) {
+			if prune[ref] {
+				return nil, ErrBadRequest.Withf("instance %q references %q, which is not in the document", name, ref)
+			}
+		}
+	}
+	for name, inst := range all {
+		if !inst.readOnly {
+			continue
+		}
+		for _, ref := range inst.instance.References() {
+			if prune[ref] {
+				return nil, ErrConflict.Withf("cannot destroy %q: read-only instance %q depends on it", ref, name)
+			}
+		}
+	}
+
+	if err := m.checkPreventDestroy(prune); err != nil {
+		return nil, err
+	}
+
+	// Return the instances in safe-to-destroy layers
+	return m.destroyLayers(prune), nil
+}
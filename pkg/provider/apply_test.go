@@ -0,0 +1,207 @@
+package provider_test
+
+import (
+	"context"
+	"testing"
+
+	// Packages
+	provider "github.com/mutablelogic/go-server/pkg/provider"
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+	assert "github.com/stretchr/testify/assert"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// HELPERS
+
+func planNames(plan []schema.InstancePlan) []string {
+	names := make([]string, 0, len(plan))
+	for _, p := range plan {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+func planActions(plan []schema.InstancePlan) map[string]schema.Action {
+	actions := make(map[string]schema.Action, len(plan))
+	for _, p := range plan {
+		actions[p.Name] = p.Plan.Action
+	}
+	return actions
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// TESTS - APPLY CONFIG
+
+func Test_Manager_ApplyConfig_001(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	mgr := newPersistManager(t)
+
+	// Dependencies are created before the instances which reference them
+	resp, err := mgr.ApplyConfig(ctx, schema.ApplyConfigRequest{
+		Instances: []schema.InstanceConfig{
+			{Name: "secret.a", Attributes: schema.State{"dep": "secret.b"}},
+			{Name: "secret.b", Attributes: schema.State{"dep": "secret.c"}},
+			{Name: "secret.c", Attributes: schema.State{"port": 1}},
+		},
+		Apply: true,
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal([]string{"secret.c", "secret.b", "secret.a"}, planNames(resp.Plan))
+	for _, p := range resp.Plan {
+		assert.Equal(schema.ActionCreate, p.Plan.Action)
+	}
+	assert.Len(resp.Instances, 3)
+	a, err := mgr.GetResourceInstance(ctx, "secret.a")
+	if assert.NoError(err) {
+		assert.Equal([]string{"secret.b"}, a.Instance.References)
+	}
+
+	// Re-applying the same document is a no-op
+	resp, err = mgr.ApplyConfig(ctx, schema.ApplyConfigRequest{
+		Instances: []schema.InstanceConfig{
+			{Name: "secret.a", Attributes: schema.State{"dep": "secret.b"}},
+			{Name: "secret.b", Attributes: schema.State{"dep": "secret.c"}},
+			{Name: "secret.c", Attributes: schema.State{"port": 1}},
+		},
+		Apply: true,
+	})
+	if assert.NoError(err) {
+		for _, p := range resp.Plan {
+			assert.Equal(schema.ActionNoop, p.Plan.Action)
+		}
+	}
+}
+
+func Test_Manager_ApplyConfig_002(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	mgr := newPersistManager(t)
+	assert.NoError(applySecret(t, mgr, "secret.a", schema.State{"port": 1}))
+
+	// Planning does not change anything
+	resp, err := mgr.ApplyConfig(ctx, schema.ApplyConfigRequest{
+		Instances: []schema.InstanceConfig{
+			{Name: "secret.a", Attributes: schema.State{"port": 2}},
+			{Name: "secret.b", Attributes: schema.State{"dep": "secret.a"}},
+		},
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal(map[string]schema.Action{"secret.a": schema.ActionUpdate, "secret.b": schema.ActionCreate}, planActions(resp.Plan))
+	assert.Empty(resp.Instances)
+	_, err = mgr.GetResourceInstance(ctx, "secret.b")
+	assert.Error(err)
+	a, err := mgr.GetResourceInstance(ctx, "secret.a")
+	if assert.NoError(err) {
+		assert.Equal(1, a.Instance.State["port"])
+	}
+}
+
+func Test_Manager_ApplyConfig_003(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	mgr := newPersistManager(t)
+	assert.NoError(applySecret(t, mgr, "secret.a", schema.State{"port": 1}))
+	assert.NoError(applySecret(t, mgr, "secret.b", schema.State{"dep": "secret.a"}))
+	assert.NoError(applySecret(t, mgr, "secret.c", schema.State{"port": 3}))
+
+	// Without prune, instances absent from the document are kept
+	resp, err := mgr.ApplyConfig(ctx, schema.ApplyConfigRequest{
+		Instances: []schema.InstanceConfig{{Name: "secret.c", Attributes: schema.State{"port": 3}}},
+		Apply:     true,
+	})
+	if assert.NoError(err) {
+		assert.Equal([]string{"secret.c"}, planNames(resp.Plan))
+	}
+
+	// With prune, they are destroyed with dependents first
+	resp, err = mgr.ApplyConfig(ctx, schema.ApplyConfigRequest{
+		Instances: []schema.InstanceConfig{{Name: "secret.c", Attributes: schema.State{"port": 3}}},
+		Prune:     true,
+		Apply:     true,
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal([]string{"secret.c", "secret.b", "secret.a"}, planNames(resp.Plan))
+	assert.Equal(schema.ActionDestroy, resp.Plan[1].Plan.Action)
+	if assert.Len(resp.Destroyed, 2) {
+		assert.Equal("secret.b", resp.Destroyed[0].Name)
+		assert.Equal("secret.a", resp.Destroyed[1].Name)
+	}
+	list, err := mgr.ListResources(ctx, schema.ListResourcesRequest{})
+	if assert.NoError(err) && assert.Len(list.Resources, 1) {
+		assert.Len(list.Resources[0].Instances, 1)
+	}
+}
+
+func Test_Manager_ApplyConfig_004(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	mgr := newPersistManager(t)
+
+	// Circular dependencies within the document are rejected
+	_, err := mgr.ApplyConfig(ctx, schema.ApplyConfigRequest{
+		Instances: []schema.InstanceConfig{
+			{Name: "secret.a", Attributes: schema.State{"dep": "secret.b"}},
+			{Name: "secret.b", Attributes: schema.State{"dep": "secret.a"}},
+		},
+		Apply: true,
+	})
+	assert.ErrorContains(err, "circular dependency")
+
+	// So are circular dependencies through instances outside the document
+	assert.NoError(applySecret(t, mgr, "secret.x", schema.State{"port": 1}))
+	assert.NoError(applySecret(t, mgr, "secret.y", schema.State{"dep": "secret.x"}))
+	_, err = mgr.ApplyConfig(ctx, schema.ApplyConfigRequest{
+		Instances: []schema.InstanceConfig{{Name: "secret.x", Attributes: schema.State{"dep": "secret.y"}}},
+		Apply:     true,
+	})
+	assert.ErrorContains(err, "circular dependency")
+
+	// Kept instances cannot reference pruned ones
+	_, err = mgr.ApplyConfig(ctx, schema.ApplyConfigRequest{
+		Instances: []schema.InstanceConfig{{Name: "secret.y", Attributes: schema.State{"dep": "secret.x"}}},
+		Prune:     true,
+		Apply:     true,
+	})
+	assert.ErrorContains(err, "not in the document")
+
+	// Invalid documents are rejected before anything is applied
+	for _, instances := range [][]schema.InstanceConfig{
+		{{Name: "secret"}},
+		{{Name: "other.a"}},
+		{{Name: "secret.a"}, {Name: "secret.a"}},
+		{{Name: "secret.a"}, {Name: "secret.b", Attributes: schema.State{"unknown": true}}},
+	} {
+		_, err := mgr.ApplyConfig(ctx, schema.ApplyConfigRequest{Instances: instances, Apply: true})
+		assert.Error(err)
+	}
+	_, err = mgr.GetResourceInstance(ctx, "secret.a")
+	assert.Error(err)
+}
+
+func Test_Manager_ApplyConfig_005(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	mgr := newPersistManager(t)
+	_, err := mgr.RegisterReadonlyInstance(ctx, secretConfig{}, "ro", schema.State{"port": 1})
+	assert.NoError(err)
+
+	// Read-only instances cannot be updated, and are never pruned
+	_, err = mgr.ApplyConfig(ctx, schema.ApplyConfigRequest{
+		Instances: []schema.InstanceConfig{{Name: "secret.ro", Attributes: schema.State{"port": 2}}},
+		Apply:     true,
+	})
+	assert.ErrorIs(err, provider.ErrConflict)
+	resp, err := mgr.ApplyConfig(ctx, schema.ApplyConfigRequest{Prune: true, Apply: true})
+	if assert.NoError(err) {
+		assert.Empty(resp.Plan)
+	}
+	_, err = mgr.GetResourceInstance(ctx, "secret.ro")
+	assert.NoError(err)
+}
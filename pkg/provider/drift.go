@@ -0,0 +1,268 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	// Packages
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// DriftEvent reports an instance whose live state differs from the state it
+// was last applied with, as found by [Manager.Refresh].
+type DriftEvent struct {
+	// Name is the instance name.
+	Name string
+
+	// Plan is the update which would restore the applied state, with
+	// sensitive values redacted.
+	Plan schema.Plan
+
+	// Reapplied is true when the applied state was re-applied.
+	Reapplied bool
+
+	// Err is the error from re-applying the instance, if any.
+	Err error
+}
+
+// DriftFunc is called for each instance found to have drifted.
+type DriftFunc func(DriftEvent)
+
+///////////////////////////////////////////////////////////////////////////////
+// TASK
+
+// Run checks every instance for drift with [Manager.Refresh] at the interval
+// set with [WithRefresh], until the context is cancelled. Errors from a
+// refresh do not stop the loop: instances which cannot be read are checked
+// again on the next refresh. Without a refresh interval, Run just waits for
+// the context to be cancelled.
+func (m *Manager) Run(ctx context.Context) error {
+	if m.refresh <= 0 {
+		<-ctx.Done()
+		return nil
+	}
+
+	ticker := time.NewTicker(m.refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			_ = m.Refresh(ctx)
+		}
+	}
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// GetResourceInstanceDrift reads the live state of the named instance and
+// compares it with the state it was last applied with. Instances which have
+// not been applied never drift.
+func (m *Manager) GetResourceInstanceDrift(ctx context.Context, name string) (*schema.GetResourceInstanceDriftResponse, error) {
+	m.graph.RLock()
+	defer m.graph.RUnlock()
+
+	// Check context
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	defer m.lockClosure(false, name)()
+
+	// Get the instance by name
+	inst, exists := m.get(name)
+	if !exists {
+		return nil, ErrNotFound.Withf("resource instance %q not found", name)
+	}
+
+	// Compute the drift
+	plan, err := m.driftPlan(ctx, inst)
+	if err != nil {
+		return nil, fmt.Errorf("instance %q: read: %w", name, err)
+	}
+
+	// Return the drift, without sensitive values
+	return &schema.GetResourceInstanceDriftResponse{
+		Name: name,
+		Plan: redactPlan(inst.instance.Resource().Schema(), plan),
+	}, nil
+}
+
+// Refresh checks every applied instance for drift, in name order. When the
+// manager was created with [WithRefresh] and reapply set, each drifted
+// instance which is not read-only is re-applied with the state it was last
+// applied with. The drift handler set with [WithDriftHandler] is called for
+// each drifted instance once the instance locks are released. Refresh returns
+// all errors encountered but continues with the remaining instances.
+func (m *Manager) Refresh(ctx context.Context) error {
+	events, err := m.refreshInstances(ctx)
+	if m.drift != nil {
+		for _, event := range events {
+			m.drift(event)
+		}
+	}
+	return err
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// refreshInstances checks each instance for drift, re-applying drifted
+// instances when configured to, and returns an event for each drifted
+// instance. Each instance is locked only while it is checked, so that a
+// refresh does not hold up operations on other instances.
+func (m *Manager) refreshInstances(ctx context.Context) ([]DriftEvent, error) {
+	m.graph.RLock()
+	defer m.graph.RUnlock()
+
+	// Check context
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Visit instances in name order so that events are deterministic
+	all := m.snapshot()
+	names := make([]string, 0, len(all))
+	for name := range all {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var events []DriftEvent
+	var result error
+	for _, name := range names {
+		event, drifted, err := m.refreshInstance(ctx, name, m.reapply && !all[name].readOnly)
+		if err != nil {
+			result = errors.Join(result, err)
+		}
+		if drifted {
+			events = append(events, event)
+		}
+	}
+
+	// Return the events
+	return events, result
+}
+
+// refreshInstance checks the named instance for drift, re-applying it when
+// reapply is true, and reports whether it had drifted. The caller must hold
+// m.graph.RLock().
+func (m *Manager) refreshInstance(ctx context.Context, name string, reapply bool) (DriftEvent, bool, error) {
+	defer m.lockClosure(reapply, name)()
+
+	// Get the instance, which may have been destroyed since
+	inst, exists := m.get(name)
+	if !exists {
+		return DriftEvent{}, false, nil
+	}
+
+	// Compute the drift
+	plan, err := m.driftPlan(ctx, inst)
+	if err != nil {
+		return DriftEvent{}, false, fmt.Errorf("instance %q: read: %w", name, err)
+	} else if plan.Action == schema.ActionNoop {
+		return DriftEvent{}, false, nil
+	}
+
+	// Re-apply the applied state
+	m.publishPlan(schema.EventDrift, inst.instance, plan)
+	event := DriftEvent{Name: name, Plan: redactPlan(inst.instance.Resource().Schema(), plan)}
+	if reapply {
+		event.Err = m.reapplyInstance(ctx, inst)
+		event.Reapplied = event.Err == nil
+	}
+	return event, true, event.Err
+}
+
+// reapplyInstance validates and applies the state the instance was last
+// applied with. The caller must hold the instance for writing.
+func (m *Manager) reapplyInstance(ctx context.Context, inst instance) error {
+	config, err := inst.instance.Validate(ctx, inst.applied, m.resolver())
+	if err != nil {
+		return fmt.Errorf("instance %q: validate: %w", inst.instance.Name(), err)
+	}
+	return m.applyInstance(ctx, inst, config)
+}
+
+// driftPlan reads the live state of the instance and returns the update
+// which would restore the state it was last applied with. Only writable
+// attributes are compared, so computed values never count as drift, and
+// attributes ignored by the lifecycle of the instance are skipped.
+// The caller must hold the instance for reading.
+func (m *Manager) driftPlan(ctx context.Context, inst instance) (schema.Plan, error) {
+	if inst.applied == nil {
+		return schema.Plan{Action: schema.ActionNoop}, nil
+	}
+	live, err := inst.instance.Read(ctx)
+	if err != nil {
+		return schema.Plan{}, err
+	}
+
+	// Compare each applied field with the live state, in field order
+	fields := make([]string, 0, len(inst.applied))
+	for field := range inst.applied {
+		fields = append(fields, field)
+	}
+	slices.Sort(fields)
+	var changes []schema.Change
+	for _, field := range fields {
+		if inst.lifecycle.Ignores(field) {
+			continue
+		}
+		applied, current := inst.applied[field], live[field]
+		if isNil(applied) && isNil(current) {
+			continue
+		}
+		if !reflect.DeepEqual(current, applied) {
+			changes = append(changes, schema.Change{
+				Field: field,
+				Old:   current,
+				New:   applied,
+			})
+		}
+	}
+
+	// Return the plan
+	if len(changes) == 0 {
+		return schema.Plan{Action: schema.ActionNoop}, nil
+	}
+	return schema.Plan{Action: schema.ActionUpdate, Changes: changes}, nil
+}
+
+// redactPlan returns a copy of the plan with the values of sensitive
+// attributes, and of the elements of sensitive blocks, replaced by
+// [schema.RedactedValue].
+func redactPlan(attrs []schema.Attribute, plan schema.Plan) schema.Plan {
+	if len(plan.Changes) == 0 {
+		return plan
+	}
+	sensitive := make(map[string]bool, len(attrs))
+	for _, attr := range attrs {
+		if attr.Sensitive {
+			sensitive[attr.Name] = true
+		}
+	}
+	changes := make([]schema.Change, len(plan.Changes))
+	for i, change := range plan.Changes {
+		// The change of an element of a block is named "name[index]..."
+		if field, _, _ := strings.Cut(change.Field, "["); sensitive[field] {
+			if !isNil(change.Old) {
+				change.Old = schema.RedactedValue
+			}
+			if !isNil(change.New) {
+				change.New = schema.RedactedValue
+			}
+		}
+		changes[i] = change
+	}
+	return schema.Plan{Action: plan.Action, Changes: changes}
+}
@@ -0,0 +1,139 @@
+package provider_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	// Packages
+	provider "github.com/mutablelogic/go-server/pkg/provider"
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+	assert "github.com/stretchr/testify/assert"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TESTS - DRIFT
+
+func newSecretInstance(t *testing.T, mgr *provider.Manager, label string, state schema.State) *secretInstance {
+	t.Helper()
+	inst, err := mgr.New("secret", label)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mgr.UpdateResourceInstance(context.Background(), inst.Name(), schema.UpdateResourceInstanceRequest{Attributes: state, Apply: true}); err != nil {
+		t.Fatal(err)
+	}
+	return inst.(*secretInstance)
+}
+
+func Test_Manager_Drift_001(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	mgr := newPersistManager(t)
+	inst := newSecretInstance(t, mgr, "a", schema.State{"port": 1, "password": "hunter2"})
+
+	// An applied instance which matches its live state has not drifted
+	resp, err := mgr.GetResourceInstanceDrift(ctx, "secret.a")
+	if assert.NoError(err) {
+		assert.Equal("secret.a", resp.Name)
+		assert.Equal(schema.ActionNoop, resp.Plan.Action)
+	}
+
+	// Changes to the live state are reported, with sensitive values redacted
+	inst.SetLive(schema.State{"port": 2, "password": "changed"})
+	resp, err = mgr.GetResourceInstanceDrift(ctx, "secret.a")
+	if assert.NoError(err) {
+		assert.Equal(schema.ActionUpdate, resp.Plan.Action)
+		assert.Equal([]schema.Change{
+			{Field: "password", Old: schema.RedactedValue, New: schema.RedactedValue},
+			{Field: "port", Old: 2, New: 1},
+		}, resp.Plan.Changes)
+	}
+
+	// Unknown instances are not found
+	_, err = mgr.GetResourceInstanceDrift(ctx, "secret.missing")
+	assert.ErrorIs(err, provider.ErrNotFound)
+}
+
+func Test_Manager_Drift_002(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	mgr := newPersistManager(t)
+
+	// Instances which have not been applied never drift
+	_, err := mgr.CreateResourceInstance(ctx, schema.CreateResourceInstanceRequest{Name: "secret.a"})
+	assert.NoError(err)
+	resp, err := mgr.GetResourceInstanceDrift(ctx, "secret.a")
+	if assert.NoError(err) {
+		assert.Equal(schema.ActionNoop, resp.Plan.Action)
+	}
+}
+
+func Test_Manager_Drift_003(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	var events []provider.DriftEvent
+	mgr := newPersistManager(t, provider.WithDriftHandler(func(event provider.DriftEvent) {
+		events = append(events, event)
+	}))
+	a := newSecretInstance(t, mgr, "a", schema.State{"port": 1})
+	newSecretInstance(t, mgr, "b", schema.State{"port": 1})
+
+	// Refresh reports drifted instances without re-applying them
+	a.SetLive(schema.State{"port": 2})
+	assert.NoError(mgr.Refresh(ctx))
+	if assert.Len(events, 1) {
+		assert.Equal("secret.a", events[0].Name)
+		assert.Equal(schema.ActionUpdate, events[0].Plan.Action)
+		assert.False(events[0].Reapplied)
+	}
+	resp, _ := mgr.GetResourceInstance(ctx, "secret.a")
+	assert.Equal(2, resp.Instance.State["port"])
+}
+
+func Test_Manager_Drift_004(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	var mu sync.Mutex
+	var events []provider.DriftEvent
+	mgr := newPersistManager(t, provider.WithRefresh(10*time.Millisecond, true), provider.WithDriftHandler(func(event provider.DriftEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}))
+	a := newSecretInstance(t, mgr, "a", schema.State{"port": 1})
+
+	// The refresh loop re-applies drifted instances
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan error)
+	go func() { done <- mgr.Run(ctx) }()
+	a.SetLive(schema.State{"port": 2})
+	assert.Eventually(func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(events) > 0
+	}, time.Second, 5*time.Millisecond)
+	cancel()
+	assert.NoError(<-done)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal("secret.a", events[0].Name)
+	assert.True(events[0].Reapplied)
+	assert.NoError(events[0].Err)
+	resp, err := mgr.GetResourceInstanceDrift(context.Background(), "secret.a")
+	if assert.NoError(err) {
+		assert.Equal(schema.ActionNoop, resp.Plan.Action)
+	}
+}
+
+func Test_Manager_Drift_005(t *testing.T) {
+	assert := assert.New(t)
+
+	// Options are validated
+	_, err := provider.New("test", "", "", provider.WithRefresh(0, false))
+	assert.Error(err)
+	_, err = provider.New("test", "", "", provider.WithDriftHandler(nil))
+	assert.Error(err)
+}
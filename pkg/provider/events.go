@@ -0,0 +1,152 @@
+package provider
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	// Packages
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+	types "github.com/mutablelogic/go-server/pkg/types"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// subscriber receives the events which match its filter.
+type subscriber struct {
+	ch     chan schema.Event
+	filter schema.EventStreamRequest
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+// Number of events buffered for each subscriber. Events are dropped for a
+// subscriber which falls further behind than this, rather than blocking
+// the manager.
+const eventBufferSize = 64
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Subscribe returns a channel of lifecycle events which match the filters
+// in req. The channel is closed when the context is cancelled. Events are
+// delivered without blocking the manager, so a subscriber which does not
+// keep up misses events. It returns an error if the resource type filter
+// names a type which is not registered.
+func (m *Manager) Subscribe(ctx context.Context, req schema.EventStreamRequest) (<-chan schema.Event, error) {
+	// Check the resource type filter
+	if filter := strings.TrimSpace(types.Value(req.Type)); filter != "" {
+		if _, exists := m.resource(filter); !exists {
+			return nil, ErrBadRequest.Withf("resource type %q is not registered", filter)
+		}
+	}
+
+	// Add the subscriber
+	sub := &subscriber{ch: make(chan schema.Event, eventBufferSize), filter: req}
+	m.subsMu.Lock()
+	if m.subs == nil {
+		m.subs = make(map[*subscriber]struct{})
+	}
+	m.subs[sub] = struct{}{}
+	m.subsMu.Unlock()
+
+	// Remove the subscriber when the context is cancelled
+	go func() {
+		<-ctx.Done()
+		m.subsMu.Lock()
+		defer m.subsMu.Unlock()
+		delete(m.subs, sub)
+		close(sub.ch)
+	}()
+
+	// Return the channel
+	return sub.ch, nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// subscribed reports whether there are any subscribers, so that events
+// are not built when nobody is listening.
+func (m *Manager) subscribed() bool {
+	m.subsMu.Lock()
+	defer m.subsMu.Unlock()
+	return len(m.subs) > 0
+}
+
+// publish sends the event to each subscriber whose filter it matches,
+// dropping it for subscribers whose buffer is full.
+func (m *Manager) publish(event schema.Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	m.subsMu.Lock()
+	defer m.subsMu.Unlock()
+	for sub := range m.subs {
+		if !sub.filter.Match(event) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+		}
+	}
+}
+
+// publishInstance publishes an event with the redacted state of the
+// instance. The caller must hold the instance for reading.
+func (m *Manager) publishInstance(ctx context.Context, t schema.EventType, inst instance) {
+	if !m.subscribed() {
+		return
+	}
+	meta := m.redactedInstanceMeta(ctx, inst)
+	m.publish(schema.Event{
+		Type:     t,
+		Name:     meta.Name,
+		Resource: meta.Resource,
+		State:    meta.State,
+	})
+}
+
+// publishNew publishes an event for an instance which has been created but
+// not yet applied.
+func (m *Manager) publishNew(inst schema.ResourceInstance) {
+	if !m.subscribed() {
+		return
+	}
+	m.publish(schema.Event{
+		Type:     schema.EventCreated,
+		Name:     inst.Name(),
+		Resource: resourceName(inst),
+	})
+}
+
+// publishPlan publishes an event with the redacted plan for the instance.
+func (m *Manager) publishPlan(t schema.EventType, inst schema.ResourceInstance, plan schema.Plan) {
+	if !m.subscribed() {
+		return
+	}
+	plan = redactPlan(inst.Resource().Schema(), plan)
+	m.publish(schema.Event{
+		Type:     t,
+		Name:     inst.Name(),
+		Resource: resourceName(inst),
+		Plan:     &plan,
+	})
+}
+
+// publishNotified publishes an event for an instance notified of a change
+// to the source instance, which references it.
+func (m *Manager) publishNotified(inst, source schema.ResourceInstance) {
+	if !m.subscribed() {
+		return
+	}
+	m.publish(schema.Event{
+		Type:     schema.EventNotified,
+		Name:     inst.Name(),
+		Resource: resourceName(inst),
+		Source:   source.Name(),
+	})
+}
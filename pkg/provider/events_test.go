@@ -0,0 +1,130 @@
+package provider_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	// Packages
+	provider "github.com/mutablelogic/go-server/pkg/provider"
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+	types "github.com/mutablelogic/go-server/pkg/types"
+	assert "github.com/stretchr/testify/assert"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TESTS - EVENTS
+
+// drain returns the events received until none arrive for a short while.
+func drain(ch <-chan schema.Event) []schema.Event {
+	var events []schema.Event
+	for {
+		select {
+		case event, ok := <-ch:
+			if !ok {
+				return events
+			}
+			events = append(events, event)
+		case <-time.After(50 * time.Millisecond):
+			return events
+		}
+	}
+}
+
+func eventTypes(events []schema.Event) []schema.EventType {
+	result := make([]schema.EventType, 0, len(events))
+	for _, event := range events {
+		result = append(result, event.Type)
+	}
+	return result
+}
+
+func Test_Manager_Events_001(t *testing.T) {
+	assert := assert.New(t)
+	mgr := newPersistManager(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch, err := mgr.Subscribe(ctx, schema.EventStreamRequest{})
+	if !assert.NoError(err) {
+		return
+	}
+
+	// Lifecycle changes are published in order, with sensitive values redacted
+	assert.NoError(applySecret(t, mgr, "secret.a", schema.State{"port": 1, "password": "hunter2"}))
+	_, err = mgr.DestroyResourceInstance(ctx, schema.DestroyResourceInstanceRequest{Name: "secret.a"})
+	assert.NoError(err)
+
+	events := drain(ch)
+	assert.Equal([]schema.EventType{
+		schema.EventCreated, schema.EventPlanned, schema.EventApplied, schema.EventDestroyed,
+	}, eventTypes(events))
+	for _, event := range events {
+		assert.Equal("secret.a", event.Name)
+		assert.Equal("secret", event.Resource)
+		assert.False(event.Time.IsZero())
+	}
+	if assert.Len(events, 4) {
+		for _, change := range events[1].Plan.Changes {
+			if change.Field == "password" {
+				assert.Equal(schema.RedactedValue, change.New)
+			}
+		}
+		assert.Equal(schema.RedactedValue, events[2].State["password"])
+		assert.Equal(schema.RedactedValue, events[3].State["password"])
+	}
+
+	// The channel is closed when the context is cancelled
+	cancel()
+	_, ok := <-ch
+	for ok {
+		_, ok = <-ch
+	}
+}
+
+func Test_Manager_Events_002(t *testing.T) {
+	assert := assert.New(t)
+	mgr := newPersistManager(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Filter by instance name
+	ch, err := mgr.Subscribe(ctx, schema.EventStreamRequest{Name: types.Ptr("secret.b")})
+	if !assert.NoError(err) {
+		return
+	}
+	assert.NoError(applySecret(t, mgr, "secret.a", schema.State{"port": 1}))
+	assert.NoError(applySecret(t, mgr, "secret.b", schema.State{"port": 2}))
+	events := drain(ch)
+	assert.NotEmpty(events)
+	for _, event := range events {
+		assert.Equal("secret.b", event.Name)
+	}
+
+	// Resource type filters must name a registered type
+	_, err = mgr.Subscribe(ctx, schema.EventStreamRequest{Type: types.Ptr("missing")})
+	assert.ErrorIs(err, provider.ErrBadRequest)
+	_, err = mgr.Subscribe(ctx, schema.EventStreamRequest{Type: types.Ptr("secret")})
+	assert.NoError(err)
+}
+
+func Test_Manager_Events_003(t *testing.T) {
+	assert := assert.New(t)
+	mgr := newPersistManager(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a := newSecretInstance(t, mgr, "a", schema.State{"port": 1})
+
+	// Drift is published with the plan which would restore the applied state
+	ch, err := mgr.Subscribe(ctx, schema.EventStreamRequest{})
+	if !assert.NoError(err) {
+		return
+	}
+	a.SetLive(schema.State{"port": 2})
+	assert.NoError(mgr.Refresh(ctx))
+	events := drain(ch)
+	if assert.Len(events, 1) {
+		assert.Equal(schema.EventDrift, events[0].Type)
+		assert.Equal([]schema.Change{{Field: "port", Old: 2, New: 1}}, events[0].Plan.Changes)
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 	// Packages
 	client "github.com/mutablelogic/go-client"
+	jsonschema "github.com/mutablelogic/go-server/pkg/jsonschema"
 	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
 )
 
@@ -31,6 +32,26 @@ func (c *Client) ListResources(ctx context.Context, req schema.ListResourcesRequ
 	return &response, nil
 }
 
+// ListProviders returns the providers, such as plugins, whose resource
+// types are registered with the server.
+func (c *Client) ListProviders(ctx context.Context) (*schema.ListProvidersResponse, error) {
+	var response schema.ListProvidersResponse
+	if err := c.DoWithContext(ctx, nil, &response, client.OptPath("provider")); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// GetResourceSchema returns the JSON Schema of the attributes of the named
+// resource type.
+func (c *Client) GetResourceSchema(ctx context.Context, name string) (*jsonschema.Schema, error) {
+	var response json.RawMessage
+	if err := c.DoWithContext(ctx, nil, &response, client.OptPath("resource", name, "schema")); err != nil {
+		return nil, err
+	}
+	return jsonschema.FromJSON(response)
+}
+
 func (c *Client) CreateResourceInstance(ctx context.Context, req schema.CreateResourceInstanceRequest) (*schema.CreateResourceInstanceResponse, error) {
 	request, err := client.NewJSONRequest(req)
 	if err != nil {
@@ -55,15 +76,24 @@ func (c *Client) GetResourceInstance(ctx context.Context, name string) (*schema.
 	return &response, nil
 }
 
+// UpdateResourceInstance plans or applies changes to the named instance.
+// When req.IfMatch or req.Generation is set, it is sent as an If-Match
+// header, so that the request fails unless the instance matches it.
 func (c *Client) UpdateResourceInstance(ctx context.Context, name string, req schema.UpdateResourceInstanceRequest) (*schema.UpdateResourceInstanceResponse, error) {
 	request, err := client.NewJSONRequestEx(http.MethodPatch, req, "")
 	if err != nil {
 		return nil, err
 	}
 
+	// Set request options
+	opts := []client.RequestOpt{client.OptPath("resource", name)}
+	if value := ifMatch(req.Generation, req.IfMatch); value != "" {
+		opts = append(opts, client.OptReqHeader("If-Match", value))
+	}
+
 	// Perform PATCH request
 	var response schema.UpdateResourceInstanceResponse
-	if err := c.DoWithContext(ctx, request, &response, client.OptPath("resource", name)); err != nil {
+	if err := c.DoWithContext(ctx, request, &response, opts...); err != nil {
 		return nil, err
 	}
 
@@ -71,16 +101,28 @@ func (c *Client) UpdateResourceInstance(ctx context.Context, name string, req sc
 	return &response, nil
 }
 
+// DestroyResourceInstance destroys the named instance, and when cascade is
+// true the instances which depend on it.
 func (c *Client) DestroyResourceInstance(ctx context.Context, name string, cascade bool) (*schema.DestroyResourceInstanceResponse, error) {
+	return c.DestroyResourceInstanceEx(ctx, schema.DestroyResourceInstanceRequest{Name: name, Cascade: cascade})
+}
+
+// DestroyResourceInstanceEx destroys the instance named in the request.
+// When req.IfMatch or req.Generation is set, it is sent as an If-Match
+// header, so that the request fails unless the instance matches it.
+func (c *Client) DestroyResourceInstanceEx(ctx context.Context, req schema.DestroyResourceInstanceRequest) (*schema.DestroyResourceInstanceResponse, error) {
 	request, err := client.NewJSONRequestEx(http.MethodDelete, nil, "")
 	if err != nil {
 		return nil, err
 	}
 
-	opts := []client.RequestOpt{client.OptPath("resource", name)}
-	if cascade {
+	opts := []client.RequestOpt{client.OptPath("resource", req.Name)}
+	if req.Cascade {
 		opts = append(opts, client.OptQuery(map[string][]string{"cascade": {"true"}}))
 	}
+	if value := ifMatch(req.Generation, req.IfMatch); value != "" {
+		opts = append(opts, client.OptReqHeader("If-Match", value))
+	}
 
 	var response schema.DestroyResourceInstanceResponse
 	if err := c.DoWithContext(ctx, request, &response, opts...); err != nil {
@@ -89,6 +131,48 @@ func (c *Client) DestroyResourceInstance(ctx context.Context, name string, casca
 	return &response, nil
 }
 
+// ImportResourceInstance creates the named instance from the existing
+// resource identified by req.ID.
+func (c *Client) ImportResourceInstance(ctx context.Context, name string, req schema.ImportResourceInstanceRequest) (*schema.ImportResourceInstanceResponse, error) {
+	request, err := client.NewJSONRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Perform POST request
+	var response schema.ImportResourceInstanceResponse
+	if err := c.DoWithContext(ctx, request, &response, client.OptPath("resource", name, "import")); err != nil {
+		return nil, err
+	}
+
+	// Return response
+	return &response, nil
+}
+
+func (c *Client) ApplyConfig(ctx context.Context, req schema.ApplyConfigRequest) (*schema.ApplyConfigResponse, error) {
+	request, err := client.NewJSONRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Perform POST request
+	var response schema.ApplyConfigResponse
+	if err := c.DoWithContext(ctx, request, &response, client.OptPath("resource:apply")); err != nil {
+		return nil, err
+	}
+
+	// Return response
+	return &response, nil
+}
+
+func (c *Client) GetResourceInstanceDrift(ctx context.Context, name string) (*schema.GetResourceInstanceDriftResponse, error) {
+	var response schema.GetResourceInstanceDriftResponse
+	if err := c.DoWithContext(ctx, nil, &response, client.OptPath("resource", name, "drift")); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
 // GetOpenAPI looks up the named router instance, reads its endpoint
 // from state, and fetches {endpoint}/openapi.json.
 func (c *Client) GetOpenAPI(ctx context.Context, routerName string) (json.RawMessage, error) {
@@ -117,3 +201,18 @@ func (c *Client) GetOpenAPI(ctx context.Context, routerName string) (json.RawMes
 	}
 	return spec, nil
 }
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// ifMatch returns the If-Match header value for a request, preferring the
+// precondition over the expected generation, or an empty string if neither
+// is set.
+func ifMatch(generation *uint64, precondition *schema.IfMatch) string {
+	if precondition != nil {
+		return precondition.String()
+	} else if generation != nil {
+		return schema.ETag(*generation)
+	}
+	return ""
+}
@@ -1,11 +1,17 @@
 package httphandler
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
+	"slices"
+	"strings"
 
 	// Packages
+	upstream "github.com/google/jsonschema-go/jsonschema"
 	httprequest "github.com/mutablelogic/go-server/pkg/httprequest"
 	httpresponse "github.com/mutablelogic/go-server/pkg/httpresponse"
+	httprouter "github.com/mutablelogic/go-server/pkg/httprouter"
 	jsonschema "github.com/mutablelogic/go-server/pkg/jsonschema"
 	openapi "github.com/mutablelogic/go-server/pkg/openapi/schema"
 	provider "github.com/mutablelogic/go-server/pkg/provider"
@@ -13,6 +19,33 @@ import (
 	types "github.com/mutablelogic/go-server/pkg/types"
 )
 
+///////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+const (
+	ifMatchHeader = "If-Match"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// LIFECYCLE
+
+// RegisterHandlers registers the provider and resource endpoints of the
+// manager with the router, relative to the router's prefix. The PATCH
+// request of the single-instance endpoint is described by the resource
+// types which are registered with the manager at the time.
+func RegisterHandlers(router *httprouter.Router, manager *provider.Manager) error {
+	return errors.Join(
+		router.RegisterFunc("provider", ProviderListHandler(manager), true, ProviderListSpec()),
+		router.RegisterFunc("resource", ResourceListHandler(manager), true, ResourceListSpec()),
+		router.RegisterFunc("resource:apply", ResourceApplyHandler(manager), true, ResourceApplySpec()),
+		router.RegisterFunc("resource:events", ResourceEventsHandler(manager), true, ResourceEventsSpec()),
+		router.RegisterFunc("resource/{id}", ResourceInstanceHandler(manager), true, ResourceInstanceSpec(manager.Resources()...)),
+		router.RegisterFunc("resource/{type}/schema", ResourceSchemaHandler(manager), true, ResourceSchemaSpec()),
+		router.RegisterFunc("resource/{id}/drift", ResourceDriftHandler(manager), true, ResourceDriftSpec()),
+		router.RegisterFunc("resource/{id}/import", ResourceImportHandler(manager), true, ResourceImportSpec()),
+	)
+}
+
 ///////////////////////////////////////////////////////////////////////////////
 // HANDLER FUNCTIONS
 
@@ -93,6 +126,101 @@ func ResourceListSpec() *openapi.PathItem {
 	})
 }
 
+// ResourceSchemaHandler returns an HTTP handler that returns the JSON
+// Schema of the attributes of a resource type (GET).
+func ResourceSchemaHandler(manager *provider.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("type")
+		if name == "" {
+			_ = httpresponse.Error(w, httpresponse.ErrBadRequest.With("missing resource type"))
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			resp, err := manager.GetResourceSchema(r.Context(), name)
+			if err != nil {
+				_ = httpresponse.Error(w, err)
+				return
+			}
+			_ = httpresponse.JSON(w, http.StatusOK, httprequest.Indent(r), resp)
+		default:
+			_ = httpresponse.Error(w, httpresponse.Err(http.StatusMethodNotAllowed), r.Method)
+		}
+	}
+}
+
+// ResourceSchemaSpec returns the OpenAPI path-item for the resource schema
+// endpoint.
+func ResourceSchemaSpec() *openapi.PathItem {
+	typeSchema, _ := jsonschema.For[string]()
+	return types.Ptr(openapi.PathItem{
+		Get: &openapi.Operation{
+			Tags:        []string{"Resources"},
+			Summary:     "Get resource schema",
+			Description: "Returns a JSON Schema for the attributes of a resource type, including their types, constraints, defaults and nested blocks, so that clients can validate attributes before sending them.",
+			Parameters: []openapi.Parameter{
+				{
+					Name:        "type",
+					In:          openapi.ParameterInPath,
+					Description: "Resource type name (e.g. \"httpserver\")",
+					Required:    true,
+					Schema:      typeSchema,
+				},
+			},
+			Responses: map[string]openapi.Response{
+				"200":     {Description: "OK", Content: map[string]openapi.MediaType{types.ContentTypeJSON: {}}},
+				"default": openapi.ErrorResponse("Error"),
+			},
+		},
+	})
+}
+
+// ResourceApplyHandler returns an HTTP handler that plans or applies a
+// complete configuration document (POST).
+func ResourceApplyHandler(manager *provider.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			var req schema.ApplyConfigRequest
+			if err := httprequest.Read(r, &req); err != nil {
+				_ = httpresponse.Error(w, err)
+				return
+			}
+			resp, err := manager.ApplyConfig(r.Context(), req)
+			if err != nil {
+				_ = httpresponse.Error(w, err)
+				return
+			}
+			_ = httpresponse.JSON(w, http.StatusOK, httprequest.Indent(r), resp)
+		default:
+			_ = httpresponse.Error(w, httpresponse.Err(http.StatusMethodNotAllowed), r.Method)
+		}
+	}
+}
+
+// ResourceApplySpec returns the OpenAPI path-item for the apply endpoint.
+func ResourceApplySpec() *openapi.PathItem {
+	applySchema, _ := jsonschema.For[schema.ApplyConfigRequest]()
+	applyRespSchema, _ := jsonschema.For[schema.ApplyConfigResponse]()
+	return types.Ptr(openapi.PathItem{
+		Post: &openapi.Operation{
+			Tags:        []string{"Resources"},
+			Summary:     "Plan or apply a configuration",
+			Description: "Computes a combined plan for a complete set of desired instances, ordered by their references. When apply is true, the plan is executed as a single operation. When prune is true, instances absent from the document are destroyed.",
+			RequestBody: &openapi.RequestBody{
+				Required: true,
+				Content: map[string]openapi.MediaType{
+					types.ContentTypeJSON: {Schema: applySchema},
+				},
+			},
+			Responses: map[string]openapi.Response{
+				"200":     {Description: "OK", Content: map[string]openapi.MediaType{types.ContentTypeJSON: {Schema: applyRespSchema}}},
+				"default": openapi.ErrorResponse("Error"),
+			},
+		},
+	})
+}
+
 // ResourceInstanceHandler returns an HTTP handler for get (GET), plan/apply
 // (PATCH), and destroy (DELETE) of a single resource instance.
 func ResourceInstanceHandler(manager *provider.Manager) http.HandlerFunc {
@@ -109,6 +237,7 @@ func ResourceInstanceHandler(manager *provider.Manager) http.HandlerFunc {
 				_ = httpresponse.Error(w, err)
 				return
 			}
+			w.Header().Set(types.ContentHashHeader, schema.ETag(resp.Instance.Generation))
 			_ = httpresponse.JSON(w, http.StatusOK, httprequest.Indent(r), resp)
 		case http.MethodPatch:
 			var req schema.UpdateResourceInstanceRequest
@@ -116,16 +245,19 @@ func ResourceInstanceHandler(manager *provider.Manager) http.HandlerFunc {
 				_ = httpresponse.Error(w, err)
 				return
 			}
+			req.IfMatch = schema.ParseIfMatch(r.Header.Values(ifMatchHeader)...)
 			resp, err := manager.UpdateResourceInstance(r.Context(), id, req)
 			if err != nil {
 				_ = httpresponse.Error(w, err)
 				return
 			}
+			w.Header().Set(types.ContentHashHeader, schema.ETag(resp.Instance.Generation))
 			_ = httpresponse.JSON(w, http.StatusOK, httprequest.Indent(r), resp)
 		case http.MethodDelete:
 			resp, err := manager.DestroyResourceInstance(r.Context(), schema.DestroyResourceInstanceRequest{
 				Name:    id,
 				Cascade: r.URL.Query().Get("cascade") == "true",
+				IfMatch: schema.ParseIfMatch(r.Header.Values(ifMatchHeader)...),
 			})
 			if err != nil {
 				_ = httpresponse.Error(w, err)
@@ -138,9 +270,11 @@ func ResourceInstanceHandler(manager *provider.Manager) http.HandlerFunc {
 	}
 }
 
-// ResourceInstanceSpec returns the OpenAPI path-item for the single-instance endpoint.
-func ResourceInstanceSpec() *openapi.PathItem {
-	updateSchema, _ := jsonschema.For[schema.UpdateResourceInstanceRequest]()
+// ResourceInstanceSpec returns the OpenAPI path-item for the single-instance
+// endpoint. The PATCH request is one of the requests for the given resource
+// types, discriminated by its type property.
+func ResourceInstanceSpec(resources ...schema.Resource) *openapi.PathItem {
+	updateSchema := updateRequestSchema(resources)
 	idSchema, _ := jsonschema.For[string]()
 	boolSchema, _ := jsonschema.For[bool]()
 	getRespSchema, _ := jsonschema.For[schema.GetResourceInstanceResponse]()
@@ -153,11 +287,17 @@ func ResourceInstanceSpec() *openapi.PathItem {
 		Required:    true,
 		Schema:      idSchema,
 	}
+	ifMatchParam := openapi.Parameter{
+		Name:        ifMatchHeader,
+		In:          openapi.ParameterInHeader,
+		Description: "Fail with 412 Precondition Failed unless the instance exists and, unless this is *, its generation matches one of these ETags",
+		Schema:      idSchema,
+	}
 	return types.Ptr(openapi.PathItem{
 		Get: &openapi.Operation{
 			Tags:        []string{"Resources"},
 			Summary:     "Get resource instance",
-			Description: "Returns the metadata and current state of a single resource instance by ID.",
+			Description: "Returns the metadata and current state of a single resource instance by ID. The ETag header holds the instance generation.",
 			Parameters:  []openapi.Parameter{idParam},
 			Responses: map[string]openapi.Response{
 				"200":     {Description: "OK", Content: map[string]openapi.MediaType{types.ContentTypeJSON: {Schema: getRespSchema}}},
@@ -167,8 +307,8 @@ func ResourceInstanceSpec() *openapi.PathItem {
 		Patch: &openapi.Operation{
 			Tags:        []string{"Resources"},
 			Summary:     "Plan or apply changes",
-			Description: "Computes a plan for the desired attribute values. When apply is true, the plan is executed immediately.",
-			Parameters:  []openapi.Parameter{idParam},
+			Description: "Computes a plan for the desired attribute values. When apply is true, the plan is executed immediately. A plan response includes a plan_id; send it back with apply set to true, and without attributes, to apply exactly that plan.",
+			Parameters:  []openapi.Parameter{idParam, ifMatchParam},
 			RequestBody: &openapi.RequestBody{
 				Required: true,
 				Content: map[string]openapi.MediaType{
@@ -186,6 +326,7 @@ func ResourceInstanceSpec() *openapi.PathItem {
 			Description: "Tears down the resource instance and releases its resources. Set cascade=true to also destroy dependents.",
 			Parameters: []openapi.Parameter{
 				idParam,
+				ifMatchParam,
 				{
 					Name:        "cascade",
 					In:          openapi.ParameterInQuery,
@@ -200,3 +341,271 @@ func ResourceInstanceSpec() *openapi.PathItem {
 		},
 	})
 }
+
+// ResourceDriftHandler returns an HTTP handler that reports the drift of a
+// single resource instance from its applied state (GET).
+func ResourceDriftHandler(manager *provider.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		if id == "" {
+			_ = httpresponse.Error(w, httpresponse.ErrBadRequest.With("missing resource id"))
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			resp, err := manager.GetResourceInstanceDrift(r.Context(), id)
+			if err != nil {
+				_ = httpresponse.Error(w, err)
+				return
+			}
+			_ = httpresponse.JSON(w, http.StatusOK, httprequest.Indent(r), resp)
+		default:
+			_ = httpresponse.Error(w, httpresponse.Err(http.StatusMethodNotAllowed), r.Method)
+		}
+	}
+}
+
+// ResourceDriftSpec returns the OpenAPI path-item for the drift endpoint.
+func ResourceDriftSpec() *openapi.PathItem {
+	idSchema, _ := jsonschema.For[string]()
+	driftRespSchema, _ := jsonschema.For[schema.GetResourceInstanceDriftResponse]()
+	return types.Ptr(openapi.PathItem{
+		Get: &openapi.Operation{
+			Tags:        []string{"Resources"},
+			Summary:     "Get resource instance drift",
+			Description: "Compares the live state of a resource instance with the state it was last applied with, and returns the changes which would restore the applied state.",
+			Parameters: []openapi.Parameter{
+				{
+					Name:        "id",
+					In:          openapi.ParameterInPath,
+					Description: "Resource instance ID",
+					Required:    true,
+					Schema:      idSchema,
+				},
+			},
+			Responses: map[string]openapi.Response{
+				"200":     {Description: "OK", Content: map[string]openapi.MediaType{types.ContentTypeJSON: {Schema: driftRespSchema}}},
+				"default": openapi.ErrorResponse("Error"),
+			},
+		},
+	})
+}
+
+// ProviderListHandler returns an HTTP handler that lists the providers, such
+// as plugins, whose resource types are registered with the manager (GET).
+func ProviderListHandler(manager *provider.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			resp, err := manager.ListProviders(r.Context())
+			if err != nil {
+				_ = httpresponse.Error(w, err)
+				return
+			}
+			_ = httpresponse.JSON(w, http.StatusOK, httprequest.Indent(r), resp)
+		default:
+			_ = httpresponse.Error(w, httpresponse.Err(http.StatusMethodNotAllowed), r.Method)
+		}
+	}
+}
+
+// ProviderListSpec returns the OpenAPI path-item for the provider list
+// endpoint.
+func ProviderListSpec() *openapi.PathItem {
+	listRespSchema, _ := jsonschema.For[schema.ListProvidersResponse]()
+	return types.Ptr(openapi.PathItem{
+		Get: &openapi.Operation{
+			Tags:        []string{"Resources"},
+			Summary:     "List providers",
+			Description: "Returns the providers, such as plugins, whose resource types are registered, with the names of their resource types.",
+			Responses: map[string]openapi.Response{
+				"200":     {Description: "OK", Content: map[string]openapi.MediaType{types.ContentTypeJSON: {Schema: listRespSchema}}},
+				"default": openapi.ErrorResponse("Error"),
+			},
+		},
+	})
+}
+
+// ResourceImportHandler returns an HTTP handler that creates a resource
+// instance from an existing resource (POST).
+func ResourceImportHandler(manager *provider.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		if id == "" {
+			_ = httpresponse.Error(w, httpresponse.ErrBadRequest.With("missing resource id"))
+			return
+		}
+		switch r.Method {
+		case http.MethodPost:
+			var req schema.ImportResourceInstanceRequest
+			if err := httprequest.Read(r, &req); err != nil {
+				_ = httpresponse.Error(w, err)
+				return
+			}
+			resp, err := manager.ImportResourceInstance(r.Context(), id, req)
+			if err != nil {
+				_ = httpresponse.Error(w, err)
+				return
+			}
+			w.Header().Set(types.ContentHashHeader, schema.ETag(resp.Instance.Generation))
+			_ = httpresponse.JSON(w, http.StatusCreated, httprequest.Indent(r), resp)
+		default:
+			_ = httpresponse.Error(w, httpresponse.Err(http.StatusMethodNotAllowed), r.Method)
+		}
+	}
+}
+
+// ResourceImportSpec returns the OpenAPI path-item for the import endpoint.
+func ResourceImportSpec() *openapi.PathItem {
+	idSchema, _ := jsonschema.For[string]()
+	importSchema, _ := jsonschema.For[schema.ImportResourceInstanceRequest]()
+	importRespSchema, _ := jsonschema.For[schema.ImportResourceInstanceResponse]()
+	return types.Ptr(openapi.PathItem{
+		Post: &openapi.Operation{
+			Tags:        []string{"Resources"},
+			Summary:     "Import resource instance",
+			Description: "Creates a resource instance which adopts an existing resource, identified by an id whose format is defined by the resource type. The live state of the resource becomes the applied state of the instance.",
+			Parameters: []openapi.Parameter{
+				{
+					Name:        "id",
+					In:          openapi.ParameterInPath,
+					Description: "Resource instance ID",
+					Required:    true,
+					Schema:      idSchema,
+				},
+			},
+			RequestBody: &openapi.RequestBody{
+				Required: true,
+				Content: map[string]openapi.MediaType{
+					types.ContentTypeJSON: {Schema: importSchema},
+				},
+			},
+			Responses: map[string]openapi.Response{
+				"201":     {Description: "Created", Content: map[string]openapi.MediaType{types.ContentTypeJSON: {Schema: importRespSchema}}},
+				"default": openapi.ErrorResponse("Error"),
+			},
+		},
+	})
+}
+
+// ResourceEventsHandler returns an HTTP handler that streams lifecycle
+// events (GET) until the client disconnects. Events are sent as
+// server-sent events when the client accepts text/event-stream, and as
+// newline-delimited JSON otherwise.
+func ResourceEventsHandler(manager *provider.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			_ = httpresponse.Error(w, httpresponse.Err(http.StatusMethodNotAllowed), r.Method)
+			return
+		}
+		var req schema.EventStreamRequest
+		if err := httprequest.Query(r.URL.Query(), &req); err != nil {
+			_ = httpresponse.Error(w, err)
+			return
+		}
+		events, err := manager.Subscribe(r.Context(), req)
+		if err != nil {
+			_ = httpresponse.Error(w, err)
+			return
+		}
+
+		// Stream server-sent events
+		if accept, _ := types.AcceptContentType(r); accept == types.ContentTypeTextStream {
+			stream := httpresponse.NewTextStream(w)
+			defer stream.Close()
+			for event := range events {
+				stream.Write(string(event.Type), event)
+			}
+			return
+		}
+
+		// Stream newline-delimited JSON
+		stream, err := httpresponse.NewJSONStream(w, r)
+		if err != nil {
+			_ = httpresponse.Error(w, err)
+			return
+		}
+		defer stream.Close()
+		for event := range events {
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			if err := stream.Send(data); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// ResourceEventsSpec returns the OpenAPI path-item for the event stream
+// endpoint.
+func ResourceEventsSpec() *openapi.PathItem {
+	stringSchema, _ := jsonschema.For[string]()
+	eventSchema, _ := jsonschema.For[schema.Event]()
+	return types.Ptr(openapi.PathItem{
+		Get: &openapi.Operation{
+			Tags:        []string{"Resources"},
+			Summary:     "Stream lifecycle events",
+			Description: "Streams resource instance lifecycle events (created, planned, applied, imported, destroyed, notified and drift) until the client disconnects. Events are sent as server-sent events when the client accepts text/event-stream, and as newline-delimited JSON otherwise. Sensitive values are redacted.",
+			Parameters: []openapi.Parameter{
+				{
+					Name:        "type",
+					In:          openapi.ParameterInQuery,
+					Description: "Filter by resource type name (e.g. \"httpserver\")",
+					Schema:      stringSchema,
+				},
+				{
+					Name:        "name",
+					In:          openapi.ParameterInQuery,
+					Description: "Filter by instance name (e.g. \"httpserver.main\")",
+					Schema:      stringSchema,
+				},
+			},
+			Responses: map[string]openapi.Response{
+				"200": {Description: "OK", Content: map[string]openapi.MediaType{
+					types.ContentTypeJSONStream: {Schema: eventSchema},
+					types.ContentTypeTextStream: {Schema: eventSchema},
+				}},
+				"default": openapi.ErrorResponse("Error"),
+			},
+		},
+	})
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// updateRequestSchema returns the schema of the PATCH request. With resource
+// types, it is one of a request for each type in name order, discriminated
+// by the type property, with the attributes described by the update schema
+// of that type, and a request without a type, with the attributes any
+// object. The attributes are merged with the current state, so none of
+// them are required.
+func updateRequestSchema(resources []schema.Resource) *jsonschema.Schema {
+	base, _ := jsonschema.For[schema.UpdateResourceInstanceRequest]()
+	if base == nil || len(resources) == 0 {
+		return base
+	}
+	resources = slices.SortedFunc(slices.Values(resources), func(a, b schema.Resource) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	update := &upstream.Schema{Description: "Request to plan or apply changes; set type to the resource type of the instance to validate the attributes"}
+	for _, r := range resources {
+		attributes, err := schema.PatchJSONSchema(r.Name(), r.Schema())
+		if err != nil {
+			continue
+		}
+		var name any = r.Name()
+		request := base.CloneSchemas()
+		request.Title = r.Name()
+		request.Properties["type"] = &upstream.Schema{Type: "string", Const: &name}
+		request.Properties["attributes"] = &attributes.Schema
+		request.Required = append(request.Required, "type")
+		update.OneOf = append(update.OneOf, request)
+	}
+	untyped := base.CloneSchemas()
+	untyped.Not = &upstream.Schema{Required: []string{"type"}}
+	update.OneOf = append(update.OneOf, untyped)
+	return &jsonschema.Schema{Schema: *update}
+}
@@ -0,0 +1,363 @@
+package httphandler_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	// Packages
+	httprouter "github.com/mutablelogic/go-server/pkg/httprouter"
+	jsonschema "github.com/mutablelogic/go-server/pkg/jsonschema"
+	provider "github.com/mutablelogic/go-server/pkg/provider"
+	httphandler "github.com/mutablelogic/go-server/pkg/provider/httphandler"
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+	types "github.com/mutablelogic/go-server/pkg/types"
+	assert "github.com/stretchr/testify/assert"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// MOCK TYPES
+
+type portConfig struct {
+	Port int `name:"port"`
+}
+
+func (portConfig) Name() string               { return "port" }
+func (portConfig) Schema() []schema.Attribute { return schema.AttributesOf(portConfig{}) }
+func (c portConfig) New(name string) (schema.ResourceInstance, error) {
+	return &portInstance{ResourceInstance: provider.NewResourceInstance(c, name)}, nil
+}
+
+type portInstance struct {
+	provider.ResourceInstance[portConfig]
+}
+
+type labelConfig struct {
+	Label string `name:"label"`
+}
+
+func (labelConfig) Name() string               { return "label" }
+func (labelConfig) Schema() []schema.Attribute { return schema.AttributesOf(labelConfig{}) }
+func (c labelConfig) New(name string) (schema.ResourceInstance, error) {
+	return &labelInstance{ResourceInstance: provider.NewResourceInstance(c, name)}, nil
+}
+
+type labelInstance struct {
+	provider.ResourceInstance[labelConfig]
+}
+
+// newManager returns a manager with the instance "port.a" applied twice, so
+// that it is at generation 2.
+func newManager(t *testing.T) *provider.Manager {
+	t.Helper()
+	ctx := context.Background()
+	mgr, err := provider.New("test", "test provider", "0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = mgr.Close(ctx) })
+	if err := mgr.RegisterResource(portConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := mgr.RegisterResource(labelConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mgr.CreateResourceInstance(ctx, schema.CreateResourceInstanceRequest{Name: "port.a"}); err != nil {
+		t.Fatal(err)
+	}
+	for port := 1; port <= 2; port++ {
+		if _, err := mgr.UpdateResourceInstance(ctx, "port.a", schema.UpdateResourceInstanceRequest{Attributes: schema.State{"port": port}, Apply: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return mgr
+}
+
+// serveInstance serves a request to the resource instance handler, with an
+// If-Match header unless ifMatch is empty.
+func serveInstance(mgr *provider.Manager, method, id, ifMatch string) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/resource/{id}", httphandler.ResourceInstanceHandler(mgr))
+	var body string
+	if method == http.MethodPatch {
+		body = `{"attributes":{"port":3},"apply":true}`
+	}
+	req := httptest.NewRequest(method, "/resource/"+id, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+// streamEvents requests the event stream with the query and Accept header,
+// and returns the response, a function which disconnects the client, and a
+// channel which is closed when the handler returns.
+func streamEvents(t *testing.T, mgr *provider.Manager, query, accept string) (*http.Response, context.CancelFunc, <-chan struct{}) {
+	t.Helper()
+	done := make(chan struct{})
+	handler := httphandler.ResourceEventsHandler(mgr)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(done)
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"?"+query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	return resp, cancel, done
+}
+
+// nextEvent returns the next event in a stream of newline-delimited JSON,
+// or server-sent events when sse is true, skipping keep-alive messages.
+func nextEvent(t *testing.T, scanner *bufio.Scanner, sse bool) schema.Event {
+	t.Helper()
+	for scanner.Scan() {
+		line := scanner.Text()
+		if sse {
+			var ok bool
+			if line, ok = strings.CutPrefix(line, "data: "); !ok {
+				continue
+			}
+		} else if line == "" {
+			continue
+		}
+		var event schema.Event
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatal(err)
+		}
+		return event
+	}
+	t.Fatal("event stream ended", scanner.Err())
+	return schema.Event{}
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// TESTS - IF-MATCH
+
+func Test_IfMatch_001(t *testing.T) {
+	assert := assert.New(t)
+	mgr := newManager(t)
+
+	// GET returns the generation as the entity tag
+	rec := serveInstance(mgr, http.MethodGet, "port.a", "")
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal(schema.ETag(2), rec.Header().Get(types.ContentHashHeader))
+
+	// PATCH with a list of entity tags succeeds when one of them matches
+	rec = serveInstance(mgr, http.MethodPatch, "port.a", `"1", "2"`)
+	assert.Equal(http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(schema.ETag(3), rec.Header().Get(types.ContentHashHeader))
+}
+
+func Test_IfMatch_002(t *testing.T) {
+	assert := assert.New(t)
+	mgr := newManager(t)
+
+	// PATCH and DELETE fail when no entity tag in the list matches
+	for _, method := range []string{http.MethodPatch, http.MethodDelete} {
+		rec := serveInstance(mgr, method, "port.a", `"0", "1"`)
+		assert.Equal(http.StatusPreconditionFailed, rec.Code, method)
+	}
+
+	// Nothing was changed
+	resp, err := mgr.GetResourceInstance(context.Background(), "port.a")
+	if assert.NoError(err) {
+		assert.Equal(uint64(2), resp.Instance.Generation)
+	}
+}
+
+func Test_IfMatch_003(t *testing.T) {
+	assert := assert.New(t)
+	mgr := newManager(t)
+
+	// Weak and invalid entity tags never match
+	for _, etag := range []string{`W/"2"`, `2`, `"abc"`} {
+		rec := serveInstance(mgr, http.MethodPatch, "port.a", etag)
+		assert.Equal(http.StatusPreconditionFailed, rec.Code, etag)
+	}
+
+	// A strong entity tag in the same list still matches
+	rec := serveInstance(mgr, http.MethodPatch, "port.a", `W/"2", "2"`)
+	assert.Equal(http.StatusOK, rec.Code, rec.Body.String())
+}
+
+func Test_IfMatch_004(t *testing.T) {
+	assert := assert.New(t)
+	mgr := newManager(t)
+
+	// "*" fails for an instance which does not exist
+	for _, method := range []string{http.MethodPatch, http.MethodDelete} {
+		rec := serveInstance(mgr, method, "port.b", "*")
+		assert.Equal(http.StatusPreconditionFailed, rec.Code, method)
+	}
+
+	// Without If-Match, deleting an instance which does not exist is not found
+	rec := serveInstance(mgr, http.MethodDelete, "port.b", "")
+	assert.Equal(http.StatusNotFound, rec.Code)
+
+	// "*" matches an instance at any generation
+	rec = serveInstance(mgr, http.MethodDelete, "port.a", "*")
+	assert.Equal(http.StatusOK, rec.Code, rec.Body.String())
+	_, err := mgr.GetResourceInstance(context.Background(), "port.a")
+	assert.ErrorIs(err, provider.ErrNotFound)
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// TESTS - EVENTS
+
+func Test_Events_001(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	mgr := newManager(t)
+
+	// Events are streamed as newline-delimited JSON by default, filtered by
+	// instance name
+	resp, _, _ := streamEvents(t, mgr, "name=port.c", "")
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal(types.ContentTypeJSONStream, resp.Header.Get(types.ContentTypeHeader))
+	_, err := mgr.CreateResourceInstance(ctx, schema.CreateResourceInstanceRequest{Name: "port.b"})
+	assert.NoError(err)
+	_, err = mgr.CreateResourceInstance(ctx, schema.CreateResourceInstanceRequest{Name: "port.c"})
+	assert.NoError(err)
+	_, err = mgr.UpdateResourceInstance(ctx, "port.c", schema.UpdateResourceInstanceRequest{Attributes: schema.State{"port": 1}, Apply: true})
+	assert.NoError(err)
+
+	scanner := bufio.NewScanner(resp.Body)
+	event := nextEvent(t, scanner, false)
+	assert.Equal(schema.EventCreated, event.Type)
+	assert.Equal("port.c", event.Name)
+	event = nextEvent(t, scanner, false)
+	assert.Equal(schema.EventPlanned, event.Type)
+	assert.Equal("port.c", event.Name)
+	event = nextEvent(t, scanner, false)
+	assert.Equal(schema.EventApplied, event.Type)
+	assert.Equal("port.c", event.Name)
+}
+
+func Test_Events_002(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	mgr := newManager(t)
+
+	// Events are streamed as server-sent events when accepted, filtered by
+	// resource type
+	resp, _, _ := streamEvents(t, mgr, "type=label", types.ContentTypeTextStream)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal(types.ContentTypeTextStream, resp.Header.Get(types.ContentTypeHeader))
+	_, err := mgr.CreateResourceInstance(ctx, schema.CreateResourceInstanceRequest{Name: "port.b"})
+	assert.NoError(err)
+	_, err = mgr.CreateResourceInstance(ctx, schema.CreateResourceInstanceRequest{Name: "label.a"})
+	assert.NoError(err)
+
+	event := nextEvent(t, bufio.NewScanner(resp.Body), true)
+	assert.Equal(schema.EventCreated, event.Type)
+	assert.Equal("label.a", event.Name)
+	assert.Equal("label", event.Resource)
+}
+
+func Test_Events_003(t *testing.T) {
+	assert := assert.New(t)
+	mgr := newManager(t)
+
+	// A resource type which is not registered is rejected
+	resp, _, _ := streamEvents(t, mgr, "type=other", "")
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+}
+
+func Test_Events_004(t *testing.T) {
+	assert := assert.New(t)
+	mgr := newManager(t)
+
+	// The handler returns, which unsubscribes, when the client disconnects
+	for _, accept := range []string{"", types.ContentTypeTextStream} {
+		_, disconnect, done := streamEvents(t, mgr, "", accept)
+		disconnect()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			assert.Fail("handler did not return", accept)
+		}
+	}
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// TESTS - SPEC
+
+func Test_Spec_001(t *testing.T) {
+	assert := assert.New(t)
+
+	// The PATCH request is one of the requests for each resource type
+	spec := httphandler.ResourceInstanceSpec(portConfig{}, labelConfig{})
+	data, err := json.Marshal(spec.Patch.RequestBody.Content["application/json"].Schema)
+	if !assert.NoError(err) {
+		return
+	}
+	update, err := jsonschema.FromJSON(data)
+	if !assert.NoError(err) {
+		return
+	}
+
+	// The attributes are checked against the schema of the type
+	assert.NoError(update.Validate(json.RawMessage(`{"type":"port","apply":false,"attributes":{"port":1}}`)))
+	assert.NoError(update.Validate(json.RawMessage(`{"type":"label","apply":false,"attributes":{"label":"a"}}`)))
+	assert.Error(update.Validate(json.RawMessage(`{"type":"port","apply":false,"attributes":{"label":"a"}}`)))
+	assert.Error(update.Validate(json.RawMessage(`{"type":"port","apply":false,"attributes":{"port":"a"}}`)))
+	assert.Error(update.Validate(json.RawMessage(`{"type":"other","apply":false,"attributes":{}}`)))
+
+	// Without a type, the attributes can be any object
+	assert.NoError(update.Validate(json.RawMessage(`{"apply":false,"attributes":{"label":"a"}}`)))
+	assert.NoError(update.Validate(json.RawMessage(`{"plan_id":"abc","apply":true}`)))
+}
+
+func Test_Spec_002(t *testing.T) {
+	assert := assert.New(t)
+	mgr := newManager(t)
+	router, err := httprouter.NewRouter(context.Background(), http.NewServeMux(), "/api", "", "Test API", "v1")
+	if !assert.NoError(err) {
+		return
+	}
+
+	// The served spec describes the attributes of the registered resource types
+	assert.NoError(httphandler.RegisterHandlers(router, mgr))
+	data, err := json.Marshal(router.Spec())
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Contains(string(data), `"const":"port"`)
+
+	// The instance endpoint is served
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/resource/port.a", nil))
+	assert.Equal(http.StatusOK, rec.Code, rec.Body.String())
+}
+
+func Test_Spec_003(t *testing.T) {
+	assert := assert.New(t)
+	mgr := newManager(t)
+
+	// A request for another resource type is rejected
+	_, err := mgr.UpdateResourceInstance(context.Background(), "port.a", schema.UpdateResourceInstanceRequest{Type: "label", Attributes: schema.State{"port": 3}})
+	assert.ErrorIs(err, provider.ErrBadRequest)
+	_, err = mgr.UpdateResourceInstance(context.Background(), "port.a", schema.UpdateResourceInstanceRequest{Type: "port", Attributes: schema.State{"port": 3}})
+	assert.NoError(err)
+}
@@ -0,0 +1,116 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	// Packages
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+	types "github.com/mutablelogic/go-server/pkg/types"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// ImportResourceInstance creates the named instance from an existing
+// resource, which is identified by req.ID. The resource type must create
+// instances which satisfy [schema.Importable]. The imported state is
+// validated and stored as the applied state of the instance, so that the
+// instance is managed (and checked for drift) as though it had been applied.
+// When the import fails, the instance is discarded without being destroyed,
+// since the existing resource is not owned by the manager until the import
+// succeeds. If the imported instance cannot be saved to the state store, it
+// is kept, and the response is returned together with a [PersistError].
+func (m *Manager) ImportResourceInstance(ctx context.Context, name string, req schema.ImportResourceInstanceRequest) (*schema.ImportResourceInstanceResponse, error) {
+	m.graph.Lock()
+	defer m.graph.Unlock()
+
+	// Check context
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Check the request
+	resource, label, _ := strings.Cut(name, ".")
+	if resource == "" || label == "" {
+		return nil, ErrBadRequest.Withf("invalid instance name %q: expected resource.label", name)
+	} else if !types.IsIdentifier(label) {
+		return nil, ErrBadRequest.Withf("invalid label %q: must match [a-zA-Z][a-zA-Z0-9_-]{0,63}", label)
+	} else if strings.TrimSpace(req.ID) == "" {
+		return nil, ErrBadRequest.With("missing import id")
+	}
+	res, exists := m.resource(resource)
+	if !exists {
+		return nil, ErrBadRequest.Withf("resource %q is not registered", resource)
+	}
+	if _, exists := m.get(name); exists {
+		return nil, ErrConflict.Withf("resource instance %q already exists", name)
+	}
+
+	// Create the instance
+	inst, err := res.New(name)
+	if err != nil {
+		return nil, fmt.Errorf("resource %q: %w", resource, err)
+	} else if inst == nil {
+		return nil, ErrBadRequest.With("resource instance is nil")
+	}
+	importable, ok := inst.(schema.Importable)
+	if !ok {
+		return nil, ErrBadRequest.Withf("resource %q does not support import", resource)
+	}
+
+	// Store temporarily so the resolver can find it during Validate
+	entry := newEntry(inst)
+	m.set(entry)
+	config, err := m.importInstance(ctx, importable, entry, req.ID)
+	if err != nil {
+		m.remove(name)
+		return nil, err
+	}
+
+	// Build the stored form of the instance
+	var rec schema.StoredInstance
+	if m.store != nil {
+		if rec, err = m.record(entry, config); err != nil {
+			m.remove(name)
+			return nil, fmt.Errorf("instance %q: persist: %w", name, err)
+		}
+	}
+
+	// Seed the applied state with the imported state
+	entry.applied = schema.WritableStateOf(config)
+	entry.generation = 1
+	m.set(entry)
+	m.publishNew(inst)
+	m.publishInstance(ctx, schema.EventImported, entry)
+	m.wireAndNotify(inst)
+
+	// Persist the applied state, and return the instance even if that fails
+	err = m.persist(ctx, rec)
+	return &schema.ImportResourceInstanceResponse{
+		Instance: m.instanceMeta(ctx, entry),
+	}, err
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// importInstance imports the resource identified by id into the instance,
+// then validates the imported state and returns the validated config.
+// The caller must hold m.graph.Lock().
+func (m *Manager) importInstance(ctx context.Context, importable schema.Importable, entry instance, id string) (any, error) {
+	name := entry.instance.Name()
+	state, err := importable.Import(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("instance %q: import: %w", name, err)
+	}
+	config, err := entry.instance.Validate(ctx, state, m.resolver())
+	if err != nil {
+		return nil, fmt.Errorf("instance %q: validate: %w", name, err)
+	}
+	if err := m.checkCycles(name, entry.instance.Resource().Schema(), state); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
@@ -0,0 +1,134 @@
+package provider_test
+
+import (
+	"context"
+	"testing"
+
+	// Packages
+	provider "github.com/mutablelogic/go-server/pkg/provider"
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+	store "github.com/mutablelogic/go-server/pkg/provider/store"
+	assert "github.com/stretchr/testify/assert"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// MOCK TYPES
+
+// diskConfig is a resource config for existing disks, which are imported
+// by their path.
+type diskConfig struct {
+	Path string `name:"path" required:""`
+	Size int    `name:"size"`
+	Free int    `name:"free" readonly:""`
+}
+
+func (diskConfig) Name() string               { return "disk" }
+func (diskConfig) Schema() []schema.Attribute { return schema.AttributesOf(diskConfig{}) }
+func (c diskConfig) New(name string) (schema.ResourceInstance, error) {
+	return &diskInstance{ResourceInstance: provider.NewResourceInstance(c, name)}, nil
+}
+
+type diskInstance struct {
+	provider.ResourceInstance[diskConfig]
+}
+
+var _ schema.Importable = (*diskInstance)(nil)
+
+func (i *diskInstance) Import(ctx context.Context, id string) (schema.State, error) {
+	return i.ImportConfig(ctx, id, func(_ context.Context, id string) (*diskConfig, error) {
+		if id != "/dev/sda" {
+			return nil, nil
+		}
+		return &diskConfig{Path: id, Size: 100, Free: 10}, nil
+	})
+}
+
+func newImportManager(t *testing.T, opts ...provider.Opt) *provider.Manager {
+	t.Helper()
+	mgr := newPersistManager(t, opts...)
+	if err := mgr.RegisterResource(diskConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	return mgr
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// TESTS - IMPORT
+
+func Test_Manager_Import_001(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	mgr := newImportManager(t)
+
+	// An imported instance is applied, with the imported state
+	resp, err := mgr.ImportResourceInstance(ctx, "disk.a", schema.ImportResourceInstanceRequest{ID: "/dev/sda"})
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal("disk.a", resp.Instance.Name)
+	assert.Equal(uint64(1), resp.Instance.Generation)
+	assert.False(resp.Instance.ReadOnly)
+	assert.Equal(100, resp.Instance.State["size"])
+	assert.Equal(10, resp.Instance.State["free"])
+
+	// It has not drifted from the imported state
+	drift, err := mgr.GetResourceInstanceDrift(ctx, "disk.a")
+	if assert.NoError(err) {
+		assert.Equal(schema.ActionNoop, drift.Plan.Action)
+	}
+
+	// It is managed like any other instance
+	update, err := mgr.UpdateResourceInstance(ctx, "disk.a", schema.UpdateResourceInstanceRequest{
+		Attributes: schema.State{"size": 200},
+		Apply:      true,
+	})
+	if assert.NoError(err) {
+		assert.Equal(schema.ActionUpdate, update.Plan.Action)
+		assert.Equal([]schema.Change{{Field: "size", Old: 100, New: 200}}, update.Plan.Changes)
+		assert.Equal(uint64(2), update.Instance.Generation)
+	}
+}
+
+func Test_Manager_Import_002(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	mgr := newImportManager(t)
+
+	// A resource which does not exist is not found, and no instance is kept
+	_, err := mgr.ImportResourceInstance(ctx, "disk.a", schema.ImportResourceInstanceRequest{ID: "/dev/sdb"})
+	assert.ErrorIs(err, provider.ErrNotFound)
+	_, err = mgr.GetResourceInstance(ctx, "disk.a")
+	assert.ErrorIs(err, provider.ErrNotFound)
+
+	// The instance name must be valid and not in use
+	_, err = mgr.ImportResourceInstance(ctx, "disk", schema.ImportResourceInstanceRequest{ID: "/dev/sda"})
+	assert.ErrorIs(err, provider.ErrBadRequest)
+	_, err = mgr.ImportResourceInstance(ctx, "disk.a", schema.ImportResourceInstanceRequest{})
+	assert.ErrorIs(err, provider.ErrBadRequest)
+	_, err = mgr.ImportResourceInstance(ctx, "disk.a", schema.ImportResourceInstanceRequest{ID: "/dev/sda"})
+	assert.NoError(err)
+	_, err = mgr.ImportResourceInstance(ctx, "disk.a", schema.ImportResourceInstanceRequest{ID: "/dev/sda"})
+	assert.ErrorIs(err, provider.ErrConflict)
+
+	// The resource type must support import
+	_, err = mgr.ImportResourceInstance(ctx, "secret.a", schema.ImportResourceInstanceRequest{ID: "x"})
+	assert.ErrorIs(err, provider.ErrBadRequest)
+	_, err = mgr.ImportResourceInstance(ctx, "missing.a", schema.ImportResourceInstanceRequest{ID: "x"})
+	assert.ErrorIs(err, provider.ErrBadRequest)
+}
+
+func Test_Manager_Import_003(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	st := store.NewMemory()
+	mgr := newImportManager(t, provider.WithStateStore(st))
+
+	// The imported state is persisted, without read-only attributes
+	_, err := mgr.ImportResourceInstance(ctx, "disk.a", schema.ImportResourceInstanceRequest{ID: "/dev/sda"})
+	assert.NoError(err)
+	stored, err := st.List(ctx)
+	if assert.NoError(err) && assert.Len(stored, 1) {
+		assert.Equal("disk.a", stored[0].Name)
+		assert.Equal(schema.State{"path": "/dev/sda", "size": 100}, stored[0].State)
+	}
+}
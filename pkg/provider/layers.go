@@ -0,0 +1,191 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+
+	// Packages
+	errgroup "golang.org/x/sync/errgroup"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// InstanceError is the error from applying or destroying one instance in
+// an operation across many instances. Errors from several instances are
+// returned joined; use [InstanceErrors] to retrieve them.
+type InstanceError struct {
+	Name string
+	Err  error
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Error returns the message of the underlying error, which names the
+// instance.
+func (e *InstanceError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *InstanceError) Unwrap() error {
+	return e.Err
+}
+
+// InstanceErrors returns each [InstanceError] in err, which may be a
+// joined error, in the order they were joined.
+func InstanceErrors(err error) []*InstanceError {
+	var result []*InstanceError
+	var walk func(error)
+	walk = func(err error) {
+		if e, ok := err.(*InstanceError); ok {
+			result = append(result, e)
+			return
+		}
+		switch err := err.(type) {
+		case interface{ Unwrap() []error }:
+			for _, err := range err.Unwrap() {
+				walk(err)
+			}
+		case interface{ Unwrap() error }:
+			walk(err.Unwrap())
+		}
+	}
+	walk(err)
+	return result
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// runLayers calls fn for each instance, one layer after another, running
+// at most m.parallelism instances of a layer concurrently. A failure is
+// wrapped in an [InstanceError]; unless keepGoing is true, the layers
+// after a failure are not run, although the rest of the failed layer is.
+// It returns the names of the instances which succeeded, in layer order,
+// and the errors of those which failed, joined in name order.
+func (m *Manager) runLayers(ctx context.Context, layers [][]string, keepGoing bool, fn func(context.Context, string) error) ([]string, error) {
+	var done []string
+	var errs []error
+	for _, layer := range layers {
+		var mu sync.Mutex
+		failed := make(map[string]error, len(layer))
+
+		// Run the layer, waiting for all instances to complete
+		var g errgroup.Group
+		g.SetLimit(m.parallelism)
+		for _, name := range layer {
+			g.Go(func() error {
+				if err := fn(ctx, name); err != nil {
+					mu.Lock()
+					defer mu.Unlock()
+					failed[name] = err
+				}
+				return nil
+			})
+		}
+		_ = g.Wait()
+
+		// Collect the results in name order
+		for _, name := range layer {
+			if err, exists := failed[name]; exists {
+				errs = append(errs, &InstanceError{Name: name, Err: err})
+			} else {
+				done = append(done, name)
+			}
+		}
+		if len(failed) > 0 && !keepGoing {
+			break
+		}
+	}
+	return done, errors.Join(errs...)
+}
+
+// destroyLayers returns the given set of instance names in layers which
+// are safe to destroy in turn: the instances in each layer depend on
+// nothing in the same or a later layer, so the instances of a layer can be
+// destroyed concurrently. Instances involved in cycles each get a layer of
+// their own at the end, so that they are still destroyed.
+func (m *Manager) destroyLayers(names map[string]bool) [][]string {
+	// Each instance waits for the instances in the set which reference it
+	before := make(map[string][]string, len(names))
+	for name := range names {
+		inst, exists := m.get(name)
+		if !exists {
+			continue
+		}
+		for _, ref := range inst.instance.References() {
+			if names[ref] && ref != name {
+				before[ref] = append(before[ref], name)
+			}
+		}
+	}
+	return layers(names, func(name string) []string {
+		return before[name]
+	})
+}
+
+// layers groups the given set of names into layers, so that each name is
+// in a later layer than each of the names returned by before. Names within
+// a layer are sorted. Names involved in cycles each get a layer of their
+// own at the end, in name order.
+func layers(names map[string]bool, before func(string) []string) [][]string {
+	// Count the distinct names in the set which each name waits for
+	waits := make(map[string]int, len(names))
+	next := make(map[string][]string, len(names))
+	for name := range names {
+		seen := make(map[string]bool)
+		for _, b := range before(name) {
+			if names[b] && b != name && !seen[b] {
+				seen[b] = true
+				waits[name]++
+				next[b] = append(next[b], name)
+			}
+		}
+	}
+
+	// Kahn's algorithm, taking every name which waits for nothing as the
+	// next layer
+	var result [][]string
+	layer := make([]string, 0, len(names))
+	for name := range names {
+		if waits[name] == 0 {
+			layer = append(layer, name)
+		}
+	}
+	placed := 0
+	for len(layer) > 0 {
+		slices.Sort(layer)
+		result = append(result, layer)
+		placed += len(layer)
+		var following []string
+		for _, name := range layer {
+			for _, n := range next[name] {
+				if waits[n]--; waits[n] == 0 {
+					following = append(following, n)
+				}
+			}
+		}
+		layer = following
+	}
+
+	// Any remaining names form a cycle
+	if placed < len(names) {
+		var cycle []string
+		for name := range names {
+			if waits[name] > 0 {
+				cycle = append(cycle, name)
+			}
+		}
+		slices.Sort(cycle)
+		for _, name := range cycle {
+			result = append(result, []string{name})
+		}
+	}
+
+	// Return the layers
+	return result
+}
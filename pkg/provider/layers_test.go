@@ -0,0 +1,313 @@
+package provider_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	// Packages
+	provider "github.com/mutablelogic/go-server/pkg/provider"
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+	assert "github.com/stretchr/testify/assert"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// MOCK TYPES
+
+// layerConfig is a resource config with an optional dependency on another
+// instance. An instance with fail set fails to apply, and one named in the
+// tracker's failDestroy fails to destroy.
+type layerConfig struct {
+	Dep  schema.ResourceInstance `name:"dep" type:"layer"`
+	Fail bool                    `name:"fail"`
+}
+
+func (layerConfig) Name() string               { return "layer" }
+func (layerConfig) Schema() []schema.Attribute { return schema.AttributesOf(layerConfig{}) }
+func (layerConfig) New(string) (schema.ResourceInstance, error) {
+	return nil, errors.New("use layerTracker")
+}
+
+// layerTracker creates layer instances, and records the order in which
+// they are applied and destroyed and how many ran at once. The ops are
+// both, in order, as "apply name" or "destroy name". It also records how
+// many observer callbacks ran at once.
+type layerTracker struct {
+	mu          sync.Mutex
+	active      int
+	peak        int
+	notifying   int
+	notifyPeak  int
+	applied     []string
+	destroyed   []string
+	ops         []string
+	failDestroy map[string]bool
+}
+
+func (r *layerTracker) Name() string               { return "layer" }
+func (r *layerTracker) Schema() []schema.Attribute { return layerConfig{}.Schema() }
+func (r *layerTracker) New(name string) (schema.ResourceInstance, error) {
+	return &layerInstance{ResourceInstance: provider.NewResourceInstance(layerConfig{}, name), tracker: r}, nil
+}
+
+// run records fn running in the log, overlapping with other instances
+func (r *layerTracker) run(log *[]string, op, name string, fn func() error) error {
+	r.mu.Lock()
+	r.active++
+	r.peak = max(r.peak, r.active)
+	r.mu.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	err := fn()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.active--
+	if err == nil {
+		*log = append(*log, name)
+		r.ops = append(r.ops, op+" "+name)
+	}
+	return err
+}
+
+type layerInstance struct {
+	provider.ResourceInstance[layerConfig]
+	tracker *layerTracker
+}
+
+func (i *layerInstance) Apply(ctx context.Context, v any) error {
+	return i.ApplyConfig(ctx, v, func(_ context.Context, c *layerConfig) error {
+		return i.tracker.run(&i.tracker.applied, "apply", i.Name(), func() error {
+			if c.Fail {
+				return errors.New("failed")
+			}
+			return nil
+		})
+	})
+}
+
+func (i *layerInstance) Destroy(context.Context) error {
+	return i.tracker.run(&i.tracker.destroyed, "destroy", i.Name(), func() error {
+		if i.tracker.failDestroy[i.Name()] {
+			return errors.New("failed")
+		}
+		return nil
+	})
+}
+
+func (i *layerInstance) OnStateChange(schema.ResourceInstance) {
+	i.tracker.notify()
+}
+
+func (i *layerInstance) OnStateRemove(schema.ResourceInstance) {
+	i.tracker.notify()
+}
+
+// notify records an observer callback overlapping with other callbacks
+func (r *layerTracker) notify() {
+	r.mu.Lock()
+	r.notifying++
+	r.notifyPeak = max(r.notifyPeak, r.notifying)
+	r.mu.Unlock()
+	time.Sleep(5 * time.Millisecond)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.notifying--
+}
+
+func newLayerManager(t *testing.T, opts ...provider.Opt) (*provider.Manager, *layerTracker) {
+	t.Helper()
+	mgr, err := provider.New("test", "test provider", "0.0.1", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker := &layerTracker{failDestroy: make(map[string]bool)}
+	if err := mgr.RegisterResource(tracker); err != nil {
+		t.Fatal(err)
+	}
+	return mgr, tracker
+}
+
+// applyTree applies a root instance with leaves which reference it, and
+// returns the names of the leaves
+func applyTree(t *testing.T, mgr *provider.Manager, leaves int) []string {
+	t.Helper()
+	instances := []schema.InstanceConfig{{Name: "layer.root"}}
+	var names []string
+	for i := 0; i < leaves; i++ {
+		name := fmt.Sprintf("layer.leaf%d", i)
+		names = append(names, name)
+		instances = append(instances, schema.InstanceConfig{Name: name, Attributes: schema.State{"dep": "layer.root"}})
+	}
+	if _, err := mgr.ApplyConfig(context.Background(), schema.ApplyConfigRequest{Instances: instances, Apply: true}); err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// TESTS - LAYERS
+
+func Test_Manager_Layers_001(t *testing.T) {
+	assert := assert.New(t)
+	mgr, tracker := newLayerManager(t, provider.WithParallelism(4))
+
+	// Independent leaves are applied concurrently, after the root
+	leaves := applyTree(t, mgr, 4)
+	assert.Equal("layer.root", tracker.applied[0])
+	assert.ElementsMatch(leaves, tracker.applied[1:])
+	assert.Equal(4, tracker.peak)
+
+	// Close destroys the leaves concurrently, before the root
+	tracker.peak = 0
+	assert.NoError(mgr.Close(context.Background()))
+	assert.ElementsMatch(leaves, tracker.destroyed[:4])
+	assert.Equal("layer.root", tracker.destroyed[4])
+	assert.Equal(4, tracker.peak)
+}
+
+func Test_Manager_Layers_002(t *testing.T) {
+	assert := assert.New(t)
+	mgr, tracker := newLayerManager(t, provider.WithParallelism(1))
+
+	// With a parallelism of one, instances are applied one at a time
+	applyTree(t, mgr, 3)
+	assert.NoError(mgr.Close(context.Background()))
+	assert.Equal(1, tracker.peak)
+	assert.Len(tracker.destroyed, 4)
+}
+
+func Test_Manager_Layers_003(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	mgr, tracker := newLayerManager(t)
+	t.Cleanup(func() { _ = mgr.Close(ctx) })
+
+	// A cascaded destroy reports each instance which failed, and keeps the
+	// instances they depend on
+	applyTree(t, mgr, 3)
+	tracker.failDestroy["layer.leaf0"] = true
+	tracker.failDestroy["layer.leaf2"] = true
+	resp, err := mgr.DestroyResourceInstance(ctx, schema.DestroyResourceInstanceRequest{Name: "layer.root", Cascade: true})
+	assert.Error(err)
+	if assert.NotNil(resp) && assert.Len(resp.Instances, 1) {
+		assert.Equal("layer.leaf1", resp.Instances[0].Name)
+	}
+	errs := provider.InstanceErrors(err)
+	if assert.Len(errs, 2) {
+		assert.Equal("layer.leaf0", errs[0].Name)
+		assert.Equal("layer.leaf2", errs[1].Name)
+		assert.Contains(errs[0].Error(), `instance "layer.leaf0"`)
+	}
+	assert.Equal([]string{"layer.leaf1"}, tracker.destroyed)
+	for _, name := range []string{"layer.root", "layer.leaf0", "layer.leaf2"} {
+		_, err := mgr.GetResourceInstance(ctx, name)
+		assert.NoError(err, name)
+	}
+	tracker.failDestroy = map[string]bool{}
+}
+
+func Test_Manager_Layers_004(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	mgr, tracker := newLayerManager(t)
+	t.Cleanup(func() { _ = mgr.Close(ctx) })
+
+	// Close reports each instance which failed, but destroys the rest
+	applyTree(t, mgr, 2)
+	tracker.failDestroy["layer.leaf1"] = true
+	err := mgr.Close(ctx)
+	errs := provider.InstanceErrors(err)
+	if assert.Len(errs, 1) {
+		assert.Equal("layer.leaf1", errs[0].Name)
+	}
+	slices.Sort(tracker.destroyed)
+	assert.Equal([]string{"layer.leaf0", "layer.root"}, tracker.destroyed)
+	resp, err := mgr.ListResources(ctx, schema.ListResourcesRequest{})
+	if assert.NoError(err) {
+		assert.Empty(resp.Resources[0].Instances)
+	}
+}
+
+func Test_Manager_Layers_005(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	mgr, tracker := newLayerManager(t)
+	t.Cleanup(func() { _ = mgr.Close(ctx) })
+
+	// A failed bulk apply reports each instance which failed, and reverts
+	// the rest, without applying later layers
+	_, err := mgr.ApplyConfig(ctx, schema.ApplyConfigRequest{
+		Instances: []schema.InstanceConfig{
+			{Name: "layer.a"},
+			{Name: "layer.b", Attributes: schema.State{"fail": true}},
+			{Name: "layer.c", Attributes: schema.State{"fail": true}},
+			{Name: "layer.d", Attributes: schema.State{"dep": "layer.a"}},
+		},
+		Apply: true,
+	})
+	errs := provider.InstanceErrors(err)
+	if assert.Len(errs, 2) {
+		assert.Equal("layer.b", errs[0].Name)
+		assert.Equal("layer.c", errs[1].Name)
+	}
+	assert.Equal([]string{"layer.a"}, tracker.applied)
+	assert.Equal([]string{"layer.a"}, tracker.destroyed)
+	resp, err := mgr.ListResources(ctx, schema.ListResourcesRequest{})
+	if assert.NoError(err) {
+		assert.Empty(resp.Resources[0].Instances)
+	}
+}
+
+func Test_Manager_Layers_006(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	mgr, tracker := newLayerManager(t)
+	t.Cleanup(func() { _ = mgr.Close(ctx) })
+
+	// A prune which fails part way reports the instances which were applied
+	// and destroyed, with the errors of those which failed
+	applyTree(t, mgr, 2)
+	tracker.failDestroy["layer.leaf1"] = true
+	resp, err := mgr.ApplyConfig(ctx, schema.ApplyConfigRequest{
+		Instances: []schema.InstanceConfig{{Name: "layer.other"}},
+		Prune:     true,
+		Apply:     true,
+	})
+	errs := provider.InstanceErrors(err)
+	if assert.Len(errs, 1) {
+		assert.Equal("layer.leaf1", errs[0].Name)
+	}
+	if assert.NotNil(resp) {
+		if assert.Len(resp.Instances, 1) {
+			assert.Equal("layer.other", resp.Instances[0].Name)
+		}
+		if assert.Len(resp.Destroyed, 1) {
+			assert.Equal("layer.leaf0", resp.Destroyed[0].Name)
+		}
+	}
+	tracker.failDestroy = map[string]bool{}
+}
+
+func Test_Manager_Layers_007(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	mgr, tracker := newLayerManager(t, provider.WithParallelism(4))
+
+	// Leaves are applied and destroyed concurrently, but the callbacks on
+	// the root they reference are not
+	applyTree(t, mgr, 4)
+	assert.Equal(4, tracker.peak)
+	assert.NoError(mgr.Close(ctx))
+	assert.Equal(1, tracker.notifyPeak)
+}
+
+func Test_Manager_Layers_008(t *testing.T) {
+	assert := assert.New(t)
+
+	// Parallelism must be at least one
+	_, err := provider.New("test", "test provider", "0.0.1", provider.WithParallelism(0))
+	assert.Error(err)
+}
@@ -0,0 +1,251 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	// Packages
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// lifecycleFor returns the lifecycle options for a change to the instance:
+// the options given with the change, or the current options of the
+// instance when none are given. The options are checked against the
+// resource schema.
+func lifecycleFor(inst instance, lifecycle *schema.Lifecycle) (schema.Lifecycle, error) {
+	if lifecycle == nil {
+		return inst.lifecycle, nil
+	}
+	if err := lifecycle.Validate(inst.instance.Resource().Schema()); err != nil {
+		return schema.Lifecycle{}, fmt.Errorf("instance %q: validate: %w", inst.instance.Name(), err)
+	}
+	return *lifecycle, nil
+}
+
+// ignoreChanges returns attrs with each attribute ignored by the lifecycle
+// set to its value in the current state, so that no change to it is
+// planned. Nothing is ignored when the instance has not been applied, in
+// which case current is nil. The attrs are not modified.
+func ignoreChanges(lifecycle schema.Lifecycle, attrs, current schema.State) schema.State {
+	if current == nil || len(lifecycle.IgnoreChanges) == 0 {
+		return attrs
+	}
+	result := make(schema.State, len(attrs))
+	for k, v := range attrs {
+		result[k] = v
+	}
+	for _, name := range lifecycle.IgnoreChanges {
+		if v, exists := current[name]; exists {
+			result[name] = v
+		} else {
+			delete(result, name)
+		}
+	}
+	return result
+}
+
+// checkPreventDestroy returns an error if any of the named instances cannot
+// be destroyed because its lifecycle sets PreventDestroy.
+func (m *Manager) checkPreventDestroy(names map[string]bool) error {
+	for name := range names {
+		if inst, exists := m.get(name); exists && inst.lifecycle.PreventDestroy {
+			return ErrConflict.Withf("cannot destroy %q: lifecycle prevents destroy", name)
+		}
+	}
+	return nil
+}
+
+// replaceResourceInstance plans the replacement of the named instance with
+// a new instance, and applies it when req.Apply is true. With the
+// CreateBeforeDestroy lifecycle option the new instance is applied and the
+// dependents moved to it before the old instance is destroyed, so that
+// there is no time at which the dependents have nothing to reference.
+// Otherwise the old instance is destroyed first. Once the new instance is
+// swapped in, it is returned together with any error which follows, such
+// as a [PersistError].
+func (m *Manager) replaceResourceInstance(ctx context.Context, name string, req schema.UpdateResourceInstanceRequest) (*schema.UpdateResourceInstanceResponse, error) {
+	m.graph.Lock()
+	defer m.graph.Unlock()
+
+	// Check context
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Check the request
+	if req.PlanID != "" {
+		return nil, ErrBadRequest.With("plan_id cannot be used to replace an instance")
+	}
+	old, exists := m.get(name)
+	if err := checkIfMatch(name, old, exists, req.IfMatch); err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, ErrNotFound.Withf("resource instance %q not found", name)
+	} else if err := checkGeneration(old, req.Generation); err != nil {
+		return nil, err
+	}
+
+	// Validate and plan the change against the old instance
+	step, err := m.planUpdate(ctx, name, req.Attributes, req.Lifecycle)
+	if err != nil {
+		return nil, err
+	}
+	lifecycle := step.instance.lifecycle
+	if lifecycle.PreventDestroy || old.lifecycle.PreventDestroy {
+		return nil, ErrConflict.Withf("cannot replace %q: lifecycle prevents destroy", name)
+	}
+	for _, dep := range m.directDependents(name) {
+		if inst, exists := m.get(dep); exists && inst.readOnly {
+			return nil, ErrConflict.Withf("cannot replace %q: read-only instance %q depends on it", name, dep)
+		}
+	}
+	plan := schema.Plan{Action: schema.ActionReplace, Changes: step.plan.Changes}
+	m.publishPlan(schema.EventPlanned, old.instance, plan)
+
+	// Return the plan if not applying
+	if !req.Apply {
+		return &schema.UpdateResourceInstanceResponse{
+			Instance: m.instanceMeta(ctx, old),
+			Plan:     plan,
+		}, nil
+	}
+
+	// Create and validate the new instance
+	resource := resourceName(old.instance)
+	res, exists := m.resource(resource)
+	if !exists {
+		return nil, ErrBadRequest.Withf("resource %q is not registered", resource)
+	}
+	inst, err := res.New(name)
+	if err != nil {
+		return nil, fmt.Errorf("resource %q: %w", resource, err)
+	} else if inst == nil {
+		return nil, ErrBadRequest.With("resource instance is nil")
+	}
+	entry := newEntry(inst)
+	entry.lifecycle = lifecycle
+	entry.generation = old.generation + 1
+	config, err := inst.Validate(ctx, step.attrs, m.resolver())
+	if err != nil {
+		return nil, fmt.Errorf("instance %q: validate: %w", name, err)
+	}
+	entry.applied = schema.WritableStateOf(config)
+	var rec schema.StoredInstance
+	if m.store != nil {
+		if rec, err = m.record(entry, config); err != nil {
+			return nil, fmt.Errorf("instance %q: persist: %w", name, err)
+		}
+	}
+
+	// Replace the instance, which persists the applied state
+	var swapped bool
+	if lifecycle.CreateBeforeDestroy {
+		swapped, err = m.createBeforeDestroy(ctx, old, entry, config, rec)
+	} else {
+		swapped, err = m.destroyBeforeCreate(ctx, old, entry, config, rec)
+	}
+	if !swapped {
+		return nil, err
+	}
+
+	// Return the new instance, with any error after it was swapped in
+	return &schema.UpdateResourceInstanceResponse{
+		Instance: m.instanceMeta(ctx, entry),
+		Plan:     plan,
+	}, err
+}
+
+// createBeforeDestroy applies the new instance, persists it with the
+// record, moves the dependents of the old instance to it, and then destroys
+// the old instance. The old instance is kept when the new instance cannot
+// be applied. Once the new instance is swapped in it is persisted, even if
+// the dependents cannot be moved or the old instance cannot be destroyed.
+// It returns true once the new instance is swapped in.
+// The caller must hold m.graph.Lock().
+func (m *Manager) createBeforeDestroy(ctx context.Context, old, entry instance, config any, rec schema.StoredInstance) (bool, error) {
+	name := old.instance.Name()
+	if err := entry.instance.Apply(ctx, config); err != nil {
+		return false, fmt.Errorf("instance %q: apply: %w", name, err)
+	}
+
+	// Swap the new instance in and persist it, and move the dependents to it
+	m.notifyRemovals(old.instance)
+	m.unwireObservers(old.instance)
+	m.swapInstance(ctx, entry)
+	result := m.persist(ctx, rec)
+	result = errors.Join(result, m.rewireDependents(ctx, name))
+
+	// Destroy the old instance
+	if err := old.instance.Destroy(ctx); err != nil {
+		result = errors.Join(result, fmt.Errorf("instance %q: destroy: %w", name, err))
+	}
+	return true, result
+}
+
+// destroyBeforeCreate destroys the old instance, then applies the new
+// instance, persists it with the record and moves the dependents of the old
+// instance to it. When the new instance cannot be applied, it is kept
+// without being applied, so that it can be updated again, and the record of
+// the old instance is removed from the store. It returns true once the new
+// instance is swapped in.
+// The caller must hold m.graph.Lock().
+func (m *Manager) destroyBeforeCreate(ctx context.Context, old, entry instance, config any, rec schema.StoredInstance) (bool, error) {
+	name := old.instance.Name()
+
+	// Destroy the old instance, re-wiring it on failure
+	m.notifyRemovals(old.instance)
+	m.unwireObservers(old.instance)
+	if err := old.instance.Destroy(ctx); err != nil {
+		m.wireAndNotify(old.instance)
+		for _, dep := range m.directDependents(name) {
+			if inst, exists := m.get(dep); exists {
+				m.wireAndNotify(inst.instance)
+			}
+		}
+		return false, fmt.Errorf("instance %q: destroy: %w", name, err)
+	}
+
+	// Apply the new instance
+	if err := entry.instance.Apply(ctx, config); err != nil {
+		m.set(instance{instance: entry.instance, lock: entry.lock, lifecycle: entry.lifecycle})
+		m.discardPlans(name)
+		return false, errors.Join(fmt.Errorf("instance %q: apply: %w", name, err), m.unpersist(ctx, name))
+	}
+
+	// Swap the new instance in and persist it, and move the dependents to it
+	m.swapInstance(ctx, entry)
+	return true, errors.Join(m.persist(ctx, rec), m.rewireDependents(ctx, name))
+}
+
+// swapInstance stores the applied instance in place of the instance with
+// the same name, and wires its observers.
+// The caller must hold m.graph.Lock().
+func (m *Manager) swapInstance(ctx context.Context, entry instance) {
+	m.set(entry)
+	m.discardPlans(entry.instance.Name())
+	m.publishInstance(ctx, schema.EventApplied, entry)
+	m.wireAndNotify(entry.instance)
+}
+
+// rewireDependents re-applies each applied instance which depends on the
+// named instance with the state it was last applied with, so that its
+// references resolve to the instance now stored with that name. It returns
+// all errors encountered but continues with the remaining dependents.
+// The caller must hold m.graph.Lock().
+func (m *Manager) rewireDependents(ctx context.Context, name string) error {
+	var result error
+	for _, dep := range m.directDependents(name) {
+		inst, exists := m.get(dep)
+		if !exists || inst.applied == nil {
+			continue
+		}
+		if err := m.reapplyInstance(ctx, inst); err != nil {
+			result = errors.Join(result, err)
+		}
+	}
+	return result
+}
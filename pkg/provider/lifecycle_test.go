@@ -0,0 +1,265 @@
+package provider_test
+
+import (
+	"context"
+	"testing"
+
+	// Packages
+	provider "github.com/mutablelogic/go-server/pkg/provider"
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+	store "github.com/mutablelogic/go-server/pkg/provider/store"
+	assert "github.com/stretchr/testify/assert"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TESTS - LIFECYCLE OPTIONS
+
+func Test_Manager_LifecycleOptions_001(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	mgr := newPersistManager(t)
+	assert.NoError(applySecret(t, mgr, "secret.a", schema.State{"port": 1}))
+	assert.NoError(applySecret(t, mgr, "secret.b", schema.State{"port": 2, "dep": "secret.a"}))
+
+	// Set prevent_destroy on the instance which is depended on
+	resp, err := mgr.UpdateResourceInstance(ctx, "secret.a", schema.UpdateResourceInstanceRequest{
+		Lifecycle: &schema.Lifecycle{PreventDestroy: true},
+		Apply:     true,
+	})
+	if assert.NoError(err) && assert.NotNil(resp.Instance.Lifecycle) {
+		assert.True(resp.Instance.Lifecycle.PreventDestroy)
+	}
+
+	// The options are kept by updates which do not set them
+	resp, err = mgr.UpdateResourceInstance(ctx, "secret.a", schema.UpdateResourceInstanceRequest{
+		Attributes: schema.State{"port": 3},
+		Apply:      true,
+	})
+	if assert.NoError(err) && assert.NotNil(resp.Instance.Lifecycle) {
+		assert.True(resp.Instance.Lifecycle.PreventDestroy)
+	}
+
+	// The instance cannot be destroyed, directly or by cascade, or pruned
+	_, err = mgr.DestroyResourceInstance(ctx, schema.DestroyResourceInstanceRequest{Name: "secret.a", Cascade: true})
+	assert.ErrorIs(err, provider.ErrConflict)
+	_, err = mgr.ApplyConfig(ctx, schema.ApplyConfigRequest{Prune: true})
+	assert.ErrorIs(err, provider.ErrConflict)
+	_, err = mgr.UpdateResourceInstance(ctx, "secret.a", schema.UpdateResourceInstanceRequest{Replace: true})
+	assert.ErrorIs(err, provider.ErrConflict)
+	_, err = mgr.GetResourceInstance(ctx, "secret.b")
+	assert.NoError(err)
+
+	// Until the option is cleared
+	_, err = mgr.UpdateResourceInstance(ctx, "secret.a", schema.UpdateResourceInstanceRequest{
+		Lifecycle: &schema.Lifecycle{},
+		Apply:     true,
+	})
+	assert.NoError(err)
+	destroy, err := mgr.DestroyResourceInstance(ctx, schema.DestroyResourceInstanceRequest{Name: "secret.a", Cascade: true})
+	if assert.NoError(err) {
+		assert.Len(destroy.Instances, 2)
+	}
+}
+
+func Test_Manager_LifecycleOptions_002(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	mgr := newPersistManager(t)
+	inst := newSecretInstance(t, mgr, "a", schema.State{"port": 1, "password": "hunter2"})
+
+	// Ignored attributes must be writable attributes of the resource
+	_, err := mgr.UpdateResourceInstance(ctx, "secret.a", schema.UpdateResourceInstanceRequest{
+		Lifecycle: &schema.Lifecycle{IgnoreChanges: []string{"missing"}},
+	})
+	assert.Error(err)
+
+	// Changes to an ignored attribute are not planned
+	_, err = mgr.UpdateResourceInstance(ctx, "secret.a", schema.UpdateResourceInstanceRequest{
+		Lifecycle: &schema.Lifecycle{IgnoreChanges: []string{"port"}},
+		Apply:     true,
+	})
+	assert.NoError(err)
+	resp, err := mgr.UpdateResourceInstance(ctx, "secret.a", schema.UpdateResourceInstanceRequest{
+		Attributes: schema.State{"port": 2},
+	})
+	if assert.NoError(err) {
+		assert.Equal(schema.ActionNoop, resp.Plan.Action)
+	}
+
+	// Nor are they changed by a complete configuration
+	config, err := mgr.ApplyConfig(ctx, schema.ApplyConfigRequest{
+		Instances: []schema.InstanceConfig{{Name: "secret.a", Attributes: schema.State{"password": "hunter2"}}},
+	})
+	if assert.NoError(err) && assert.Len(config.Plan, 1) {
+		assert.Equal(schema.ActionNoop, config.Plan[0].Plan.Action)
+	}
+
+	// Nor are they reported as drift
+	inst.SetLive(schema.State{"port": 5})
+	drift, err := mgr.GetResourceInstanceDrift(ctx, "secret.a")
+	if assert.NoError(err) {
+		assert.Equal(schema.ActionNoop, drift.Plan.Action)
+	}
+}
+
+func Test_Manager_LifecycleOptions_003(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	st := store.NewMemory()
+	mgr := newPersistManager(t, provider.WithStateStore(st))
+	assert.NoError(applySecret(t, mgr, "secret.a", schema.State{"port": 1}))
+
+	// The lifecycle options are persisted and restored
+	_, err := mgr.UpdateResourceInstance(ctx, "secret.a", schema.UpdateResourceInstanceRequest{
+		Lifecycle: &schema.Lifecycle{PreventDestroy: true},
+		Apply:     true,
+	})
+	assert.NoError(err)
+	restored := newPersistManager(t, provider.WithStateStore(st))
+	assert.NoError(restored.Restore(ctx))
+	resp, err := restored.GetResourceInstance(ctx, "secret.a")
+	if assert.NoError(err) && assert.NotNil(resp.Instance.Lifecycle) {
+		assert.True(resp.Instance.Lifecycle.PreventDestroy)
+	}
+}
+
+func Test_Manager_LifecycleOptions_004(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	mgr, tracker := newLayerManager(t)
+	applyTree(t, mgr, 1)
+
+	// A replacement is planned without an ID
+	resp, err := mgr.UpdateResourceInstance(ctx, "layer.root", schema.UpdateResourceInstanceRequest{Replace: true})
+	if assert.NoError(err) {
+		assert.Equal(schema.ActionReplace, resp.Plan.Action)
+		assert.Empty(resp.PlanID)
+		assert.Equal(uint64(1), resp.Instance.Generation)
+	}
+
+	// By default the old instance is destroyed before the new instance is
+	// applied, and then the dependent is re-applied
+	tracker.ops = nil
+	resp, err = mgr.UpdateResourceInstance(ctx, "layer.root", schema.UpdateResourceInstanceRequest{Replace: true, Apply: true})
+	if assert.NoError(err) {
+		assert.Equal(uint64(2), resp.Instance.Generation)
+	}
+	assert.Equal([]string{"destroy layer.root", "apply layer.root", "apply layer.leaf0"}, tracker.ops)
+	leaf, err := mgr.GetResourceInstance(ctx, "layer.leaf0")
+	if assert.NoError(err) {
+		assert.Equal(uint64(2), leaf.Instance.Generation)
+		assert.Equal([]string{"layer.root"}, leaf.Instance.References)
+	}
+}
+
+func Test_Manager_LifecycleOptions_005(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	mgr, tracker := newLayerManager(t)
+	applyTree(t, mgr, 1)
+
+	// With create_before_destroy, the new instance is applied and the
+	// dependent moved to it before the old instance is destroyed
+	_, err := mgr.UpdateResourceInstance(ctx, "layer.root", schema.UpdateResourceInstanceRequest{
+		Lifecycle: &schema.Lifecycle{CreateBeforeDestroy: true},
+		Apply:     true,
+	})
+	assert.NoError(err)
+	tracker.ops = nil
+	resp, err := mgr.UpdateResourceInstance(ctx, "layer.root", schema.UpdateResourceInstanceRequest{Replace: true, Apply: true})
+	if assert.NoError(err) {
+		assert.Equal(uint64(3), resp.Instance.Generation)
+		if assert.NotNil(resp.Instance.Lifecycle) {
+			assert.True(resp.Instance.Lifecycle.CreateBeforeDestroy)
+		}
+	}
+	assert.Equal([]string{"apply layer.root", "apply layer.leaf0", "destroy layer.root"}, tracker.ops)
+
+	// When the new instance fails to apply, the old instance is kept
+	tracker.ops, tracker.destroyed = nil, nil
+	_, err = mgr.UpdateResourceInstance(ctx, "layer.root", schema.UpdateResourceInstanceRequest{
+		Attributes: schema.State{"fail": true},
+		Replace:    true,
+		Apply:      true,
+	})
+	assert.Error(err)
+	assert.Empty(tracker.destroyed)
+	root, err := mgr.GetResourceInstance(ctx, "layer.root")
+	if assert.NoError(err) {
+		assert.Equal(uint64(3), root.Instance.Generation)
+	}
+}
+
+func Test_Manager_LifecycleOptions_006(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	st := store.NewMemory()
+	mgr, tracker := newLayerManager(t, provider.WithStateStore(st))
+	applyTree(t, mgr, 1)
+	stored := func(name string) *schema.StoredInstance {
+		records, err := st.List(ctx)
+		assert.NoError(err)
+		for _, rec := range records {
+			if rec.Name == name {
+				return &rec
+			}
+		}
+		return nil
+	}
+
+	// When the old instance fails to destroy after the new instance has
+	// been swapped in, the new instance is persisted
+	tracker.failDestroy["layer.root"] = true
+	_, err := mgr.UpdateResourceInstance(ctx, "layer.root", schema.UpdateResourceInstanceRequest{
+		Lifecycle: &schema.Lifecycle{CreateBeforeDestroy: true},
+		Replace:   true,
+		Apply:     true,
+	})
+	assert.Error(err)
+	if rec := stored("layer.root"); assert.NotNil(rec) && assert.NotNil(rec.Lifecycle) {
+		assert.True(rec.Lifecycle.CreateBeforeDestroy)
+	}
+
+	// When the new instance fails to apply after the old instance has been
+	// destroyed, the old instance is no longer persisted
+	delete(tracker.failDestroy, "layer.root")
+	_, err = mgr.UpdateResourceInstance(ctx, "layer.root", schema.UpdateResourceInstanceRequest{
+		Attributes: schema.State{"fail": true},
+		Lifecycle:  &schema.Lifecycle{},
+		Replace:    true,
+		Apply:      true,
+	})
+	assert.Error(err)
+	assert.Nil(stored("layer.root"))
+}
+
+func Test_Manager_LifecycleOptions_007(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	mgr := newPersistManager(t)
+	assert.NoError(applySecret(t, mgr, "secret.a", schema.State{"port": 1}))
+
+	// Plans which differ only in their lifecycle have different IDs
+	protect, err := mgr.UpdateResourceInstance(ctx, "secret.a", schema.UpdateResourceInstanceRequest{
+		Attributes: schema.State{"port": 2},
+		Lifecycle:  &schema.Lifecycle{PreventDestroy: true},
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	replace, err := mgr.UpdateResourceInstance(ctx, "secret.a", schema.UpdateResourceInstanceRequest{
+		Attributes: schema.State{"port": 2},
+		Lifecycle:  &schema.Lifecycle{CreateBeforeDestroy: true},
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	assert.NotEqual(protect.PlanID, replace.PlanID)
+
+	// Applying a plan applies its own lifecycle
+	resp, err := mgr.UpdateResourceInstance(ctx, "secret.a", schema.UpdateResourceInstanceRequest{PlanID: protect.PlanID, Apply: true})
+	if assert.NoError(err) && assert.NotNil(resp.Instance.Lifecycle) {
+		assert.True(resp.Instance.Lifecycle.PreventDestroy)
+		assert.False(resp.Instance.Lifecycle.CreateBeforeDestroy)
+	}
+}
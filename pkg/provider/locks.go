@@ -0,0 +1,165 @@
+package provider
+
+import (
+	"slices"
+	"sync"
+
+	// Packages
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS - INSTANCE MAP
+
+// The embedded m.RWMutex guards the instances and resources maps only, and
+// is held just long enough to read or change them, so that reads of the
+// manager are never blocked by a slow Apply or Destroy. Lifecycle
+// operations are serialised with m.graph and the instance locks instead:
+//
+//   - operations on a single instance hold m.graph for reading, and the
+//     locks of the instance and every instance it references, directly or
+//     indirectly (see [Manager.lockClosure]), so that operations on
+//     independent subgraphs run concurrently;
+//   - operations across many instances (Close, Restore, ApplyConfig,
+//     transactions, import and destroy) hold m.graph for writing.
+//
+// A caller holds an instance for writing when it holds m.graph for writing,
+// or m.graph for reading and the instance's closure locked for writing; and
+// for reading when it holds either lock for reading or writing.
+
+// newEntry returns a new, unapplied instance entry with its own lock.
+func newEntry(inst schema.ResourceInstance) instance {
+	return instance{instance: inst, lock: new(sync.RWMutex)}
+}
+
+// get returns the named instance.
+func (m *Manager) get(name string) (instance, bool) {
+	m.RLock()
+	defer m.RUnlock()
+	inst, exists := m.instances[name]
+	return inst, exists
+}
+
+// set stores the instance, replacing any instance with the same name.
+func (m *Manager) set(inst instance) {
+	m.Lock()
+	defer m.Unlock()
+	m.instances[inst.instance.Name()] = inst
+}
+
+// remove removes the named instance.
+func (m *Manager) remove(name string) {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.instances, name)
+}
+
+// snapshot returns a copy of the instances map.
+func (m *Manager) snapshot() map[string]instance {
+	m.RLock()
+	defer m.RUnlock()
+	result := make(map[string]instance, len(m.instances))
+	for name, inst := range m.instances {
+		result[name] = inst
+	}
+	return result
+}
+
+// resource returns the named resource type.
+func (m *Manager) resource(name string) (schema.Resource, bool) {
+	m.RLock()
+	defer m.RUnlock()
+	res, exists := m.resources[name]
+	return res, exists
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS - INSTANCE LOCKS
+
+// lockClosure locks the named instances and every live instance they
+// reference, directly or indirectly, and returns a function which unlocks
+// them. Locks are taken in name order so that overlapping closures cannot
+// deadlock. Since references only change when an instance is applied,
+// which needs its lock, the closure is computed again once locked and the
+// locks retaken if it has changed in the meantime. Names of instances which
+// do not exist are ignored. The caller must hold m.graph.RLock().
+func (m *Manager) lockClosure(write bool, names ...string) func() {
+	for {
+		entries := m.closure(names...)
+		for _, inst := range entries {
+			if write {
+				inst.lock.Lock()
+			} else {
+				inst.lock.RLock()
+			}
+		}
+		unlock := func() {
+			for i := len(entries) - 1; i >= 0; i-- {
+				if write {
+					entries[i].lock.Unlock()
+				} else {
+					entries[i].lock.RUnlock()
+				}
+			}
+		}
+		if slices.EqualFunc(entries, m.closure(names...), func(a, b instance) bool {
+			return a.instance == b.instance && a.lock == b.lock
+		}) {
+			return unlock
+		}
+		unlock()
+	}
+}
+
+// closure returns the named instances and every live instance they
+// reference, directly or indirectly, sorted by name.
+func (m *Manager) closure(names ...string) []instance {
+	all := m.snapshot()
+	seen := make(map[string]bool, len(all))
+	var visit func(string)
+	visit = func(name string) {
+		inst, exists := all[name]
+		if !exists || seen[name] {
+			return
+		}
+		seen[name] = true
+		for _, ref := range inst.instance.References() {
+			visit(ref)
+		}
+	}
+	for _, name := range names {
+		visit(name)
+	}
+
+	// Return the instances in name order
+	sorted := make([]string, 0, len(seen))
+	for name := range seen {
+		sorted = append(sorted, name)
+	}
+	slices.Sort(sorted)
+	result := make([]instance, 0, len(sorted))
+	for _, name := range sorted {
+		result = append(result, all[name])
+	}
+	return result
+}
+
+// updateNames returns the names to lock for an update of the named
+// instance: the instance itself, and the instances referenced by the
+// attributes of the update or of the saved plan it applies, which are not
+// yet in its closure.
+func (m *Manager) updateNames(name string, req schema.UpdateResourceInstanceRequest) []string {
+	names := []string{name}
+	inst, exists := m.get(name)
+	if !exists {
+		return names
+	}
+	attrs := inst.instance.Resource().Schema()
+	names = append(names, schema.ReferencesFromState(attrs, req.Attributes)...)
+	if req.PlanID != "" {
+		if plan, exists := m.lookupPlan(name, req.PlanID); exists {
+			names = append(names, schema.ReferencesFromState(attrs, plan.attrs)...)
+		}
+	}
+	return names
+}
@@ -0,0 +1,313 @@
+package provider_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	// Packages
+	provider "github.com/mutablelogic/go-server/pkg/provider"
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+	assert "github.com/stretchr/testify/assert"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// MOCK TYPES
+
+// slowConfig is a resource config with an optional dependency on another
+// instance. An instance applied with block set waits in Apply until the
+// gate of its resource is released.
+type slowConfig struct {
+	Dep   schema.ResourceInstance `name:"dep" type:"slow"`
+	Block bool                    `name:"block"`
+	Port  int                     `name:"port"`
+}
+
+func (slowConfig) Name() string               { return "slow" }
+func (slowConfig) Schema() []schema.Attribute { return schema.AttributesOf(slowConfig{}) }
+func (c slowConfig) New(name string) (schema.ResourceInstance, error) {
+	return nil, fmt.Errorf("use slowResource")
+}
+
+// slowResource creates slow instances which share its gate.
+type slowResource struct {
+	entered chan string
+	release chan struct{}
+}
+
+func newSlowResource() *slowResource {
+	return &slowResource{entered: make(chan string, 16), release: make(chan struct{})}
+}
+
+func (r *slowResource) Name() string               { return "slow" }
+func (r *slowResource) Schema() []schema.Attribute { return slowConfig{}.Schema() }
+func (r *slowResource) New(name string) (schema.ResourceInstance, error) {
+	return &slowInstance{ResourceInstance: provider.NewResourceInstance(slowConfig{}, name), gate: r}, nil
+}
+
+type slowInstance struct {
+	provider.ResourceInstance[slowConfig]
+	gate *slowResource
+}
+
+func (i *slowInstance) Apply(ctx context.Context, v any) error {
+	return i.ApplyConfig(ctx, v, func(ctx context.Context, c *slowConfig) error {
+		if !c.Block {
+			return nil
+		}
+		i.gate.entered <- i.Name()
+		select {
+		case <-i.gate.release:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+func newSlowManager(t *testing.T) (*provider.Manager, *slowResource) {
+	t.Helper()
+	mgr, err := provider.New("test", "test provider", "0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := newSlowResource()
+	if err := mgr.RegisterResource(res); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = mgr.Close(context.Background())
+	})
+	return mgr, res
+}
+
+func applySlow(ctx context.Context, mgr *provider.Manager, name string, state schema.State) error {
+	_, err := mgr.UpdateResourceInstance(ctx, name, schema.UpdateResourceInstanceRequest{Attributes: state, Apply: true})
+	return err
+}
+
+// applyBlocked starts applying the named instance with block set, and
+// returns once the apply is waiting on the gate. The returned channel
+// receives the result of the apply.
+func applyBlocked(t *testing.T, mgr *provider.Manager, res *slowResource, name string, state schema.State) <-chan error {
+	t.Helper()
+	state["block"] = true
+	done := make(chan error, 1)
+	go func() {
+		done <- applySlow(context.Background(), mgr, name, state)
+	}()
+	select {
+	case entered := <-res.entered:
+		if entered != name {
+			t.Fatalf("expected %q to be applying, got %q", name, entered)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout waiting for %q to apply", name)
+	}
+	return done
+}
+
+func createSlow(t *testing.T, mgr *provider.Manager, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if _, err := mgr.CreateResourceInstance(context.Background(), schema.CreateResourceInstanceRequest{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// within runs fn and fails the test if it does not return in time.
+func within(t *testing.T, fn func()) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn()
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout: operation was blocked")
+	}
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// TESTS - CONCURRENCY
+
+func Test_Manager_Concurrent_001(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	mgr, res := newSlowManager(t)
+	createSlow(t, mgr, "slow.a", "slow.b")
+
+	// A slow apply of A does not block reads, plans or applies of B
+	done := applyBlocked(t, mgr, res, "slow.a", schema.State{"port": 1})
+	within(t, func() {
+		_, err := mgr.GetResourceInstance(ctx, "slow.b")
+		assert.NoError(err)
+		_, err = mgr.UpdateResourceInstance(ctx, "slow.b", schema.UpdateResourceInstanceRequest{Attributes: schema.State{"port": 2}})
+		assert.NoError(err)
+		assert.NoError(applySlow(ctx, mgr, "slow.b", schema.State{"port": 2}))
+		_, err = mgr.GetResourceInstanceDrift(ctx, "slow.b")
+		assert.NoError(err)
+	})
+
+	// Release A
+	close(res.release)
+	assert.NoError(<-done)
+	resp, err := mgr.GetResourceInstance(ctx, "slow.a")
+	if assert.NoError(err) {
+		assert.Equal(uint64(1), resp.Instance.Generation)
+		assert.Equal(1, resp.Instance.State["port"])
+	}
+}
+
+func Test_Manager_Concurrent_002(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	mgr, res := newSlowManager(t)
+	createSlow(t, mgr, "slow.a", "slow.b")
+
+	// An instance which is about to reference A waits for A's apply
+	done := applyBlocked(t, mgr, res, "slow.a", schema.State{"port": 1})
+	dependent := make(chan error, 1)
+	go func() {
+		dependent <- applySlow(ctx, mgr, "slow.b", schema.State{"dep": "slow.a"})
+	}()
+	select {
+	case err := <-dependent:
+		t.Fatalf("dependent apply was not blocked: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Release A, after which B is applied
+	close(res.release)
+	assert.NoError(<-done)
+	assert.NoError(<-dependent)
+	resp, err := mgr.GetResourceInstance(ctx, "slow.b")
+	if assert.NoError(err) {
+		assert.Equal([]string{"slow.a"}, resp.Instance.References)
+	}
+}
+
+func Test_Manager_Concurrent_003(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	mgr, res := newSlowManager(t)
+	createSlow(t, mgr, "slow.a", "slow.b")
+	assert.NoError(applySlow(ctx, mgr, "slow.a", schema.State{"port": 1}))
+	assert.NoError(applySlow(ctx, mgr, "slow.b", schema.State{"dep": "slow.a"}))
+
+	// Reading B waits for an apply of A, which it references
+	done := applyBlocked(t, mgr, res, "slow.a", schema.State{"port": 2})
+	read := make(chan error, 1)
+	go func() {
+		_, err := mgr.GetResourceInstance(ctx, "slow.b")
+		read <- err
+	}()
+	select {
+	case err := <-read:
+		t.Fatalf("read of dependent was not blocked: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Release A
+	close(res.release)
+	assert.NoError(<-done)
+	assert.NoError(<-read)
+}
+
+func Test_Manager_Concurrent_004(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	mgr, _ := newSlowManager(t)
+
+	// Independent chains are applied, planned and read concurrently
+	const chains, depth, rounds = 4, 3, 10
+	for c := 0; c < chains; c++ {
+		for d := 0; d < depth; d++ {
+			createSlow(t, mgr, fmt.Sprintf("slow.c%d_%d", c, d))
+		}
+	}
+	var wg sync.WaitGroup
+	for c := 0; c < chains; c++ {
+		wg.Add(2)
+		go func(c int) {
+			defer wg.Done()
+			for r := 1; r <= rounds; r++ {
+				for d := 0; d < depth; d++ {
+					state := schema.State{"port": r}
+					if d > 0 {
+						state["dep"] = fmt.Sprintf("slow.c%d_%d", c, d-1)
+					}
+					assert.NoError(applySlow(ctx, mgr, fmt.Sprintf("slow.c%d_%d", c, d), state))
+				}
+			}
+		}(c)
+		go func(c int) {
+			defer wg.Done()
+			for r := 0; r < rounds; r++ {
+				_, err := mgr.UpdateResourceInstance(ctx, fmt.Sprintf("slow.c%d_0", c), schema.UpdateResourceInstanceRequest{})
+				assert.NoError(err)
+				_, err = mgr.ListResources(ctx, schema.ListResourcesRequest{})
+				assert.NoError(err)
+				assert.NoError(mgr.Refresh(ctx))
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	// Each instance was applied once per round
+	for c := 0; c < chains; c++ {
+		for d := 0; d < depth; d++ {
+			resp, err := mgr.GetResourceInstance(ctx, fmt.Sprintf("slow.c%d_%d", c, d))
+			if assert.NoError(err) {
+				assert.Equal(uint64(rounds), resp.Instance.Generation)
+				assert.Equal(rounds, resp.Instance.State["port"])
+			}
+		}
+	}
+}
+
+func Test_Manager_Concurrent_005(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	mgr, _ := newSlowManager(t)
+
+	// Concurrent applies of the same instance are serialised
+	const n = 20
+	createSlow(t, mgr, "slow.a")
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(applySlow(ctx, mgr, "slow.a", schema.State{"port": i}))
+		}(i)
+	}
+	wg.Wait()
+
+	resp, err := mgr.GetResourceInstance(ctx, "slow.a")
+	if assert.NoError(err) {
+		assert.Equal(uint64(n), resp.Instance.Generation)
+	}
+}
+
+func Test_Manager_Concurrent_006(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	mgr, _ := newSlowManager(t)
+
+	// Concurrent applies which would each close a cycle cannot both succeed
+	for i := 0; i < 20; i++ {
+		a, b := fmt.Sprintf("slow.a%d", i), fmt.Sprintf("slow.b%d", i)
+		createSlow(t, mgr, a, b)
+		errs := make(chan error, 2)
+		go func() { errs <- applySlow(ctx, mgr, a, schema.State{"dep": b}) }()
+		go func() { errs <- applySlow(ctx, mgr, b, schema.State{"dep": a}) }()
+		err1, err2 := <-errs, <-errs
+		assert.True(err1 != nil || err2 != nil, "both sides of a cycle were applied")
+	}
+}
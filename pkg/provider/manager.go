@@ -2,14 +2,18 @@ package provider
 
 import (
 	"context"
-	"errors"
+	"crypto/rand"
+	"crypto/sha256"
 	"fmt"
+	"regexp"
 	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	// Packages
 	httpresponse "github.com/mutablelogic/go-server/pkg/httpresponse"
+	jsonschema "github.com/mutablelogic/go-server/pkg/jsonschema"
 	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
 	types "github.com/mutablelogic/go-server/pkg/types"
 )
@@ -18,9 +22,10 @@ import (
 // GLOBALS
 
 var (
-	ErrBadRequest = httpresponse.ErrBadRequest
-	ErrNotFound   = httpresponse.ErrNotFound
-	ErrConflict   = httpresponse.ErrConflict
+	ErrBadRequest         = httpresponse.ErrBadRequest
+	ErrNotFound           = httpresponse.ErrNotFound
+	ErrConflict           = httpresponse.ErrConflict
+	ErrPreconditionFailed = httpresponse.ErrPreconditionFailed
 )
 
 ///////////////////////////////////////////////////////////////////////////////
@@ -32,12 +37,30 @@ type Manager struct {
 	version      string
 	resources    map[string]schema.Resource
 	instances    map[string]instance
-	sync.RWMutex // Guard for instances
+	store        schema.StateStore             // optional, persists applied instances
+	key          []byte                        // state key for sensitive values
+	refresh      time.Duration                 // interval between drift checks in Run
+	reapply      bool                          // re-apply drifted instances in Refresh
+	drift        DriftFunc                     // optional, called for each drifted instance
+	parallelism  int                           // instances applied or destroyed at once
+	subs         map[*subscriber]struct{}      // event subscribers
+	subsMu       sync.Mutex                    // Guard for subs
+	providers    map[string]registeredProvider // registered providers by name
+	plans        map[string][]savedPlan        // saved plans by instance name
+	planKey      []byte                        // key for plan IDs
+	plansMu      sync.Mutex                    // Guard for plans
+	graph        sync.RWMutex                  // Guard for lifecycle operations
+	notifyMu     sync.Mutex                    // Serialises observer callbacks
+	sync.RWMutex                               // Guard for instances, resources and providers maps
 }
 
 type instance struct {
-	instance schema.ResourceInstance
-	readOnly bool // manager-level override (e.g. RegisterReadonlyInstance)
+	instance   schema.ResourceInstance
+	lock       *sync.RWMutex // serialises lifecycle operations on the instance
+	readOnly   bool          // manager-level override (e.g. RegisterReadonlyInstance)
+	applied    schema.State  // writable state last applied, nil if never applied
+	generation uint64        // bumped on every apply, zero if never applied
+	lifecycle  schema.Lifecycle
 }
 
 var _ schema.Provider = (*Manager)(nil)
@@ -45,44 +68,71 @@ var _ schema.Provider = (*Manager)(nil)
 ///////////////////////////////////////////////////////////////////////////////
 // LIFECYCLE
 
-func New(name, description, version string) (*Manager, error) {
+// New creates a manager for the named provider. With [WithStateStore], the
+// applied state of each instance is persisted after every successful apply
+// and destroy, and can be re-created after a restart with [Manager.Restore].
+func New(name, description, version string, opts ...Opt) (*Manager, error) {
+	o, err := applyOpts(opts...)
+	if err != nil {
+		return nil, err
+	}
+	planKey := make([]byte, sha256.Size)
+	if _, err := rand.Read(planKey); err != nil {
+		return nil, err
+	}
 	return &Manager{
 		name:        name,
 		description: description,
 		version:     version,
 		resources:   make(map[string]schema.Resource),
 		instances:   make(map[string]instance),
+		providers:   make(map[string]registeredProvider),
+		store:       o.store,
+		key:         o.key,
+		refresh:     o.refresh,
+		reapply:     o.reapply,
+		drift:       o.drift,
+		parallelism: o.parallelism,
+		plans:       make(map[string][]savedPlan),
+		planKey:     planKey,
 	}, nil
 }
 
 // Close destroys all instances and removes them from the manager,
 // respecting dependency order (dependents are destroyed before their
-// dependencies). It returns all errors encountered but continues
-// destroying remaining instances.
+// dependencies); instances which do not depend on each other are destroyed
+// concurrently. It returns the error of each instance which failed, as an
+// [InstanceError], but continues destroying remaining instances. Instances
+// are not removed from the state store, so that they can be restored on
+// the next start.
 func (m *Manager) Close(ctx context.Context) error {
-	m.Lock()
-	defer m.Unlock()
+	m.graph.Lock()
+	defer m.graph.Unlock()
 
 	// Build the set of all instance names
-	all := make(map[string]bool, len(m.instances))
-	for name := range m.instances {
+	all := make(map[string]bool)
+	for name := range m.snapshot() {
 		all[name] = true
 	}
 
-	var result error
-	for _, name := range m.safeDestroyOrder(all) {
-		inst, exists := m.instances[name]
+	_, err := m.runLayers(ctx, m.destroyLayers(all), true, func(ctx context.Context, name string) error {
+		inst, exists := m.get(name)
 		if !exists {
-			continue
+			return nil
 		}
+		meta := m.redactedInstanceMeta(ctx, inst)
 		m.notifyRemovals(inst.instance)
 		m.unwireObservers(inst.instance)
+		var result error
 		if err := inst.instance.Destroy(ctx); err != nil {
-			result = errors.Join(result, err)
+			result = fmt.Errorf("instance %q: destroy: %w", name, err)
 		}
-		delete(m.instances, name)
-	}
-	return result
+		m.remove(name)
+		m.discardPlans(name)
+		m.publish(schema.Event{Type: schema.EventDestroyed, Name: meta.Name, Resource: meta.Resource, State: meta.State})
+		return result
+	})
+	return err
 }
 
 ///////////////////////////////////////////////////////////////////////////////
@@ -119,12 +169,13 @@ func (m *Manager) Resources() []schema.Resource {
 // The returned resource is not yet applied; call [ResourceInstance.Apply] to
 // materialise it.
 func (m *Manager) New(resource, label string) (schema.ResourceInstance, error) {
-	m.Lock()
-	defer m.Unlock()
+	m.graph.RLock()
+	defer m.graph.RUnlock()
 	return m.newInstance(resource, label)
 }
 
-// newInstance is the lock-free core of [New]. The caller must hold m.Lock().
+// newInstance is the core of [New]. The caller must hold at least
+// m.graph.RLock().
 func (m *Manager) newInstance(resource, label string) (schema.ResourceInstance, error) {
 	// Validate the label
 	if !types.IsIdentifier(label) {
@@ -132,7 +183,7 @@ func (m *Manager) newInstance(resource, label string) (schema.ResourceInstance,
 	}
 
 	// Look up the resource type
-	res, exists := m.resources[resource]
+	res, exists := m.resource(resource)
 	if !exists {
 		return nil, ErrBadRequest.Withf("resource %q is not registered", resource)
 	}
@@ -146,14 +197,16 @@ func (m *Manager) newInstance(resource, label string) (schema.ResourceInstance,
 	if resourceinstance == nil {
 		return nil, ErrBadRequest.With("resource instance is nil")
 	}
-	if _, exists := m.instances[instanceName]; exists {
-		return nil, ErrConflict.Withf("resource instance %q already exists", instanceName)
-	}
 
 	// Set the instance
-	m.instances[instanceName] = instance{
-		instance: resourceinstance,
+	m.Lock()
+	if _, exists := m.instances[instanceName]; exists {
+		m.Unlock()
+		return nil, ErrConflict.Withf("resource instance %q already exists", instanceName)
 	}
+	m.instances[instanceName] = newEntry(resourceinstance)
+	m.Unlock()
+	m.publishNew(resourceinstance)
 
 	// Return the instance
 	return resourceinstance, nil
@@ -177,15 +230,12 @@ func (m *Manager) RegisterResource(r schema.Resource) error {
 		return ErrConflict.Withf("resource %q is already registered", name)
 	}
 
-	// Validate attribute names in the resource schema
-	for _, attr := range r.Schema() {
-		// Strip dot-prefix (e.g. "tls.cert" → validate "tls" and "cert")
-		parts := strings.SplitN(attr.Name, ".", 2)
-		for _, part := range parts {
-			if err := schema.ValidateName(part); err != nil {
-				return ErrBadRequest.Withf("resource %q attribute %q: %v", name, attr.Name, err)
-			}
-		}
+	// Validate attribute names and patterns in the resource schema
+	if err := validateAttributeNames(name, r.Schema()); err != nil {
+		return err
+	}
+	if err := validatePatterns(name, "", r.Schema()); err != nil {
+		return err
 	}
 
 	m.resources[name] = r
@@ -202,19 +252,30 @@ func (m *Manager) RegisterResource(r schema.Resource) error {
 // [schema.ResourceInstance] so the caller can type-assert to the
 // concrete object (e.g. *httpserver.Server).
 func (m *Manager) RegisterReadonlyInstance(ctx context.Context, resource schema.Resource, label string, state schema.State) (schema.ResourceInstance, error) {
-	m.Lock()
-	defer m.Unlock()
+	m.graph.Lock()
+	defer m.graph.Unlock()
 
 	// Validate the label
 	if !types.IsIdentifier(label) {
 		return nil, ErrBadRequest.Withf("invalid label %q: must match [a-zA-Z][a-zA-Z0-9_-]{0,63}", label)
 	}
 
-	// Auto-register the resource type if not already registered
+	// Auto-register the resource type if not already registered, validating
+	// it as RegisterResource does
 	name := resource.Name()
+	m.Lock()
 	if _, exists := m.resources[name]; !exists {
+		if err := validateAttributeNames(name, resource.Schema()); err != nil {
+			m.Unlock()
+			return nil, err
+		}
+		if err := validatePatterns(name, "", resource.Schema()); err != nil {
+			m.Unlock()
+			return nil, err
+		}
 		m.resources[name] = resource
 	}
+	m.Unlock()
 
 	// Create a new instance with the name {resource}.{label}
 	instanceName := name + "." + label
@@ -222,31 +283,34 @@ func (m *Manager) RegisterReadonlyInstance(ctx context.Context, resource schema.
 	if err != nil {
 		return nil, fmt.Errorf("resource %q: %w", name, err)
 	}
-	if _, exists := m.instances[instanceName]; exists {
+	if _, exists := m.get(instanceName); exists {
 		return nil, ErrConflict.Withf("instance %q already exists", instanceName)
 	}
 
 	// Store temporarily so the resolver can find it during Validate
-	m.instances[instanceName] = instance{instance: inst}
+	entry := newEntry(inst)
+	m.set(entry)
 
 	// Validate the state
 	config, err := inst.Validate(ctx, state, m.resolver())
 	if err != nil {
-		delete(m.instances, instanceName)
+		m.remove(instanceName)
 		return nil, fmt.Errorf("instance %q: validate: %w", instanceName, err)
 	}
 
 	// Apply the state
 	if err := inst.Apply(ctx, config); err != nil {
-		delete(m.instances, instanceName)
+		m.remove(instanceName)
 		return nil, fmt.Errorf("instance %q: apply: %w", instanceName, err)
 	}
 
 	// Store with read-only flag
-	m.instances[instanceName] = instance{
-		instance: inst,
-		readOnly: true,
-	}
+	entry.readOnly = true
+	entry.applied = schema.WritableStateOf(config)
+	entry.generation = 1
+	m.set(entry)
+	m.publishNew(inst)
+	m.publishInstance(ctx, schema.EventApplied, entry)
 
 	// Wire observers so referenced instances are notified on state changes
 	m.wireAndNotify(inst)
@@ -260,9 +324,6 @@ func (m *Manager) RegisterReadonlyInstance(ctx context.Context, resource schema.
 // ListResources returns metadata for every registered resource type
 // (optionally filtered by type name) with their instances.
 func (m *Manager) ListResources(ctx context.Context, req schema.ListResourcesRequest) (*schema.ListResourcesResponse, error) {
-	m.RLock()
-	defer m.RUnlock()
-
 	// Check context
 	if err := ctx.Err(); err != nil {
 		return nil, err
@@ -271,23 +332,31 @@ func (m *Manager) ListResources(ctx context.Context, req schema.ListResourcesReq
 	// Get the filter for the resource type
 	filter := strings.TrimSpace(types.Value(req.Type))
 	if filter != "" {
-		if _, exists := m.resources[filter]; !exists {
+		if _, exists := m.resource(filter); !exists {
 			return nil, ErrBadRequest.Withf("resource type %q is not registered", filter)
 		}
 	}
-	resources := make([]schema.ResourceMeta, 0, len(m.resources))
-	for _, r := range m.resources {
+	m.graph.RLock()
+	defer m.graph.RUnlock()
+	all := m.snapshot()
+	resources := make([]schema.ResourceMeta, 0)
+	for _, r := range m.Resources() {
 		if filter != "" && r.Name() != filter {
 			continue
 		}
 
-		// Collect instances for this resource type
+		// Collect instances for this resource type, reading each under
+		// its own lock so that only instances being applied are waited on
 		instances := make([]schema.InstanceMeta, 0)
-		for _, inst := range m.instances {
-			if inst.instance.Resource().Name() != r.Name() {
+		for name, inst := range all {
+			if resourceName(inst.instance) != r.Name() {
 				continue
 			}
-			instances = append(instances, m.redactedInstanceMeta(ctx, inst))
+			unlock := m.lockClosure(false, name)
+			if inst, exists := m.get(name); exists {
+				instances = append(instances, m.redactedInstanceMeta(ctx, inst))
+			}
+			unlock()
 		}
 
 		// Sort instances by name
@@ -315,6 +384,19 @@ func (m *Manager) ListResources(ctx context.Context, req schema.ListResourcesReq
 	}, nil
 }
 
+// GetResourceSchema returns the JSON Schema of the attributes of the named
+// resource type, as accepted when planning or applying an instance.
+func (m *Manager) GetResourceSchema(ctx context.Context, name string) (*jsonschema.Schema, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r, exists := m.resource(name)
+	if !exists {
+		return nil, ErrNotFound.Withf("resource type %q is not registered", name)
+	}
+	return schema.JSONSchema(r.Name(), r.Schema())
+}
+
 ///////////////////////////////////////////////////////////////////////////////
 // PUBLIC METHODS - INSTANCE LIFECYCLE
 
@@ -322,8 +404,8 @@ func (m *Manager) ListResources(ctx context.Context, req schema.ListResourcesReq
 // and stores it in the manager. The instance is not yet validated or applied;
 // call [UpdateResourceInstance] to plan or apply it.
 func (m *Manager) CreateResourceInstance(ctx context.Context, req schema.CreateResourceInstanceRequest) (*schema.CreateResourceInstanceResponse, error) {
-	m.Lock()
-	defer m.Unlock()
+	m.graph.RLock()
+	defer m.graph.RUnlock()
 
 	// Check context
 	if err := ctx.Err(); err != nil {
@@ -341,24 +423,26 @@ func (m *Manager) CreateResourceInstance(ctx context.Context, req schema.CreateR
 	if err != nil {
 		return nil, err
 	}
+	entry, _ := m.get(inst.Name())
 
 	return &schema.CreateResourceInstanceResponse{
-		Instance: m.instanceMeta(ctx, m.instances[inst.Name()]),
+		Instance: m.instanceMeta(ctx, entry),
 	}, nil
 }
 
 // GetResourceInstance returns the metadata for a single named instance.
 func (m *Manager) GetResourceInstance(ctx context.Context, name string) (*schema.GetResourceInstanceResponse, error) {
-	m.RLock()
-	defer m.RUnlock()
+	m.graph.RLock()
+	defer m.graph.RUnlock()
 
 	// Check context
 	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
+	defer m.lockClosure(false, name)()
 
 	// Check instance, return its metadata
-	if inst, exists := m.instances[name]; !exists {
+	if inst, exists := m.get(name); !exists {
 		return nil, ErrNotFound.Withf("resource instance %q not found", name)
 	} else {
 		return &schema.GetResourceInstanceResponse{
@@ -369,97 +453,97 @@ func (m *Manager) GetResourceInstance(ctx context.Context, name string) (*schema
 
 // UpdateResourceInstance validates and plans the named instance. When
 // req.Apply is true the plan is also applied and the resulting state stored.
+// When req.Generation is set and the instance has since been applied, or
+// req.IfMatch is set and the instance does not exist or match it, it
+// returns [ErrPreconditionFailed]. A plan response includes an ID which can
+// be passed back in req.PlanID to apply exactly that plan; it is refused
+// with [ErrPreconditionFailed] if the instance has been applied since, or
+// the configuration no longer validates to the same result. When
+// req.Replace is true, the instance is replaced by a new instance instead,
+// which requires all instances to be locked. When req.Type is set and the
+// instance is of another resource type, it returns [ErrBadRequest]. If the
+// instance is applied but
+// cannot be saved to the state store, the response is returned together
+// with a [PersistError].
 func (m *Manager) UpdateResourceInstance(ctx context.Context, name string, req schema.UpdateResourceInstanceRequest) (*schema.UpdateResourceInstanceResponse, error) {
-	// Apply needs a write lock; plan is read-only
-	if req.Apply {
-		m.Lock()
-		defer m.Unlock()
-	} else {
-		m.RLock()
-		defer m.RUnlock()
+	if typ, _, _ := strings.Cut(name, "."); req.Type != "" && req.Type != typ {
+		return nil, ErrBadRequest.Withf("instance %q is not of resource type %q", name, req.Type)
 	}
+	if req.Replace {
+		return m.replaceResourceInstance(ctx, name, req)
+	}
+
+	m.graph.RLock()
+	defer m.graph.RUnlock()
 
 	// Check context
 	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
 
-	// Get the instance by name
-	inst, exists := m.instances[name]
-	if !exists {
-		return nil, ErrNotFound.Withf("resource instance %q not found", name)
-	}
+	// Lock the instance and the instances it references, including any it
+	// is about to reference. Apply needs write locks; plan is read-only.
+	defer m.lockClosure(req.Apply, m.updateNames(name, req)...)()
 
-	// Reject updates to read-only (data) instances
-	if inst.readOnly {
-		return nil, ErrConflict.Withf("cannot update %q: instance is read-only", name)
+	// Check the expected generation
+	inst, exists := m.get(name)
+	if err := checkIfMatch(name, inst, exists, req.IfMatch); err != nil {
+		return nil, err
 	}
-
-	// Merge incoming attributes on top of current state so that
-	// unspecified fields retain their applied values.
-	attrs := req.Attributes
-	if current, err := inst.instance.Read(ctx); err == nil && current != nil {
-		merged := make(schema.State, len(current))
-		for k, v := range current {
-			merged[k] = v
-		}
-		for k, v := range attrs {
-			merged[k] = v
+	if exists {
+		if err := checkGeneration(inst, req.Generation); err != nil {
+			return nil, err
 		}
-		attrs = merged
 	}
 
-	// Validate before planning/applying — returns the decoded config
-	config, err := inst.instance.Validate(ctx, attrs, m.resolver())
-	if err != nil {
-		return nil, fmt.Errorf("instance %q: validate: %w", name, err)
+	// Apply a saved plan
+	if req.PlanID != "" {
+		return m.applyPlan(ctx, name, req)
 	}
 
-	// Reject circular dependencies
-	if err := m.checkCycles(name, inst.instance.Resource().Schema(), attrs); err != nil {
-		return nil, err
-	}
-
-	// Compute the plan
-	plan, err := inst.instance.Plan(ctx, config)
+	// Validate the merged attributes and compute the plan
+	step, err := m.planUpdate(ctx, name, req.Attributes, req.Lifecycle)
 	if err != nil {
-		return nil, fmt.Errorf("instance %q: plan: %w", name, err)
+		return nil, err
 	}
 
-	// Optionally apply the plan
+	// Apply the plan, or save it so that it can be applied by ID. An
+	// instance which was applied but not persisted is still returned.
+	var id string
+	var perr error
 	if req.Apply {
-		// Remove stale observers and notify old references before
-		// applying the new config, since Apply will overwrite the
-		// instance's references.
-		m.notifyRemovals(inst.instance)
-		m.unwireObservers(inst.instance)
-
-		if err := inst.instance.Apply(ctx, config); err != nil {
-			// Re-wire old observers on failure so state stays consistent
-			m.wireAndNotify(inst.instance)
-			return nil, fmt.Errorf("instance %q: apply: %w", name, err)
+		if perr = m.applyInstance(ctx, step.instance, step.config); perr != nil && !isPersistError(perr) {
+			return nil, perr
 		}
-		m.instances[name] = instance{
-			instance: inst.instance,
-			readOnly: inst.readOnly,
+	} else {
+		if id, err = m.planID(name, inst.generation, step.config, req.Lifecycle); err != nil {
+			return nil, err
 		}
-		inst = m.instances[name]
-		m.wireAndNotify(inst.instance)
+		m.savePlan(name, savedPlan{id: id, generation: inst.generation, attrs: step.attrs, lifecycle: req.Lifecycle})
 	}
 
+	inst, _ = m.get(name)
+
 	return &schema.UpdateResourceInstanceResponse{
 		Instance: m.instanceMeta(ctx, inst),
-		Plan:     plan,
-	}, nil
+		Plan:     step.plan,
+		PlanID:   id,
+	}, perr
 }
 
 // DestroyResourceInstance tears down the named instance and removes it
 // from the manager. When req.Cascade is true, all instances that
 // (transitively) depend on the target are destroyed first, in
-// topological order.
+// topological order, with instances which do not depend on each other
+// destroyed concurrently. If an instance fails to destroy, the instances
+// it depends on are kept, and the error of each instance which failed is
+// returned as an [InstanceError], together with the response listing the
+// instances which were destroyed. When req.Generation is set and the
+// target has since been applied, or req.IfMatch is set and the target does
+// not exist or match it, it returns [ErrPreconditionFailed].
 func (m *Manager) DestroyResourceInstance(ctx context.Context, req schema.DestroyResourceInstanceRequest) (*schema.DestroyResourceInstanceResponse, error) {
-	m.Lock()
-	defer m.Unlock()
+	m.graph.Lock()
+	defer m.graph.Unlock()
 
 	// Check context
 	if err := ctx.Err(); err != nil {
@@ -467,79 +551,278 @@ func (m *Manager) DestroyResourceInstance(ctx context.Context, req schema.Destro
 	}
 
 	// Check the target exists
-	if _, exists := m.instances[req.Name]; !exists {
+	inst, exists := m.get(req.Name)
+	if err := checkIfMatch(req.Name, inst, exists, req.IfMatch); err != nil {
+		return nil, err
+	} else if !exists {
 		return nil, ErrNotFound.Withf("resource instance %q not found", req.Name)
 	}
 
 	// Reject destruction of read-only (data) instances
-	inst := m.instances[req.Name]
 	if inst.readOnly {
 		return nil, ErrConflict.Withf("cannot destroy %q: instance is read-only", req.Name)
 	}
 
-	// Build the ordered list of instances to destroy
-	var order []string
+	// Check the expected generation
+	if err := checkGeneration(inst, req.Generation); err != nil {
+		return nil, err
+	}
+
+	// Build the set of instances to destroy
+	subgraph := make(map[string]bool)
 	if req.Cascade {
-		subgraph := make(map[string]bool)
 		m.collectDependents(req.Name, subgraph)
-		order = m.safeDestroyOrder(subgraph)
 	} else {
 		// Without cascade, refuse if anything depends on this instance
 		if err := m.checkDependents(req.Name); err != nil {
 			return nil, err
 		}
-		order = []string{req.Name}
+		subgraph[req.Name] = true
 	}
 
-	// Destroy each instance in order, collecting metadata
-	destroyed := make([]schema.InstanceMeta, 0, len(order))
-	for _, name := range order {
-		inst, exists := m.instances[name]
-		if !exists {
-			continue
-		}
-
-		// Read-only instances cannot be destroyed via cascade
-		if inst.readOnly {
+	// Read-only instances cannot be destroyed via cascade
+	for name := range subgraph {
+		if inst, exists := m.get(name); exists && inst.readOnly {
 			return nil, ErrConflict.Withf("cannot destroy %q: instance is read-only", name)
 		}
+	}
 
-		// Capture metadata before destruction (redacted — no need to
-		// return sensitive values for instances being removed)
-		meta := m.redactedInstanceMeta(ctx, inst)
+	// Nor can instances whose lifecycle prevents it
+	if err := m.checkPreventDestroy(subgraph); err != nil {
+		return nil, err
+	}
 
-		m.notifyRemovals(inst.instance)
-		m.unwireObservers(inst.instance)
-		if err := inst.instance.Destroy(ctx); err != nil {
-			return nil, err
+	// Destroy the instances in layers, collecting metadata
+	var mu sync.Mutex
+	metas := make(map[string]schema.InstanceMeta, len(subgraph))
+	done, err := m.runLayers(ctx, m.destroyLayers(subgraph), false, func(ctx context.Context, name string) error {
+		inst, exists := m.get(name)
+		if !exists {
+			return nil
 		}
-		delete(m.instances, name)
-		destroyed = append(destroyed, meta)
-	}
+		meta, err := m.destroyInstance(ctx, inst)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		metas[name] = meta
+		return nil
+	})
 
+	// Return the destroyed instances in the order they were destroyed, with
+	// the errors of those which failed
+	destroyed := make([]schema.InstanceMeta, 0, len(done))
+	for _, name := range done {
+		if meta, exists := metas[name]; exists {
+			destroyed = append(destroyed, meta)
+		}
+	}
 	return &schema.DestroyResourceInstanceResponse{
 		Instances: destroyed,
-	}, nil
+	}, err
 }
 
 ///////////////////////////////////////////////////////////////////////////////
 // PRIVATE METHODS
 
+// applyPlan applies the saved plan req.PlanID to the named instance, after
+// checking that the instance has not been applied since the plan was made
+// and that the saved state still validates to the same configuration.
+// The caller must hold the instance for writing.
+func (m *Manager) applyPlan(ctx context.Context, name string, req schema.UpdateResourceInstanceRequest) (*schema.UpdateResourceInstanceResponse, error) {
+	if !req.Apply || len(req.Attributes) > 0 {
+		return nil, ErrBadRequest.With("plan_id can only be used to apply a plan, without attributes")
+	}
+
+	// Get the saved plan
+	plan, exists := m.lookupPlan(name, req.PlanID)
+	if !exists {
+		return nil, ErrNotFound.Withf("plan %q not found for instance %q", req.PlanID, name)
+	}
+	if inst, exists := m.get(name); !exists || inst.generation != plan.generation {
+		return nil, ErrPreconditionFailed.Withf("instance %q has changed since plan %q", name, req.PlanID)
+	}
+
+	// Re-validate the saved state and check it matches the plan
+	step, err := m.planUpdate(ctx, name, plan.attrs, plan.lifecycle)
+	if err != nil {
+		return nil, err
+	}
+	if id, err := m.planID(name, plan.generation, step.config, plan.lifecycle); err != nil {
+		return nil, err
+	} else if id != req.PlanID {
+		return nil, ErrPreconditionFailed.Withf("configuration of instance %q has changed since plan %q", name, req.PlanID)
+	}
+
+	// Apply the plan. An instance which was applied but not persisted is
+	// still returned.
+	perr := m.applyInstance(ctx, step.instance, step.config)
+	if perr != nil && !isPersistError(perr) {
+		return nil, perr
+	}
+	inst, _ := m.get(name)
+
+	return &schema.UpdateResourceInstanceResponse{
+		Instance: m.instanceMeta(ctx, inst),
+		Plan:     step.plan,
+	}, perr
+}
+
+// planUpdate merges attrs on top of the current state of the named
+// instance, validates the result and computes the plan, without applying
+// it. Attributes ignored by the lifecycle keep their current values. When
+// lifecycle is nil, the current lifecycle options of the instance are
+// kept. The returned step records the current state so the update can be
+// reverted. The caller must hold the instance for reading.
+func (m *Manager) planUpdate(ctx context.Context, name string, attrs schema.State, lifecycle *schema.Lifecycle) (step, error) {
+	// Get the instance by name
+	inst, exists := m.get(name)
+	if !exists {
+		return step{}, ErrNotFound.Withf("resource instance %q not found", name)
+	}
+
+	// Reject updates to read-only (data) instances
+	if inst.readOnly {
+		return step{}, ErrConflict.Withf("cannot update %q: instance is read-only", name)
+	}
+
+	// Check the lifecycle options
+	options, err := lifecycleFor(inst, lifecycle)
+	if err != nil {
+		return step{}, err
+	}
+
+	// Merge incoming attributes on top of current state so that
+	// unspecified fields retain their applied values.
+	current, err := inst.instance.Read(ctx)
+	if err == nil && current != nil {
+		merged := make(schema.State, len(current))
+		for k, v := range current {
+			merged[k] = v
+		}
+		for k, v := range attrs {
+			merged[k] = v
+		}
+		attrs = ignoreChanges(options, merged, current)
+	} else {
+		current = nil
+	}
+
+	// Validate before planning/applying — returns the decoded config
+	config, err := inst.instance.Validate(ctx, attrs, m.resolver())
+	if err != nil {
+		return step{}, fmt.Errorf("instance %q: validate: %w", name, err)
+	}
+
+	// Reject circular dependencies
+	if err := m.checkCycles(name, inst.instance.Resource().Schema(), attrs); err != nil {
+		return step{}, err
+	}
+
+	// Compute the plan
+	plan, err := inst.instance.Plan(ctx, config)
+	if err != nil {
+		return step{}, fmt.Errorf("instance %q: plan: %w", name, err)
+	}
+	m.publishPlan(schema.EventPlanned, inst.instance, plan)
+
+	// Return the step, with the lifecycle options to store on apply
+	previous := inst.lifecycle
+	inst.lifecycle = options
+	return step{instance: inst, config: config, plan: plan, attrs: attrs, previous: current, lifecycle: previous}, nil
+}
+
+// applyInstance applies the validated config to the instance, stores it in
+// the manager, re-wires its observers and persists the applied state. On
+// failure the previous observers are restored.
+// The caller must hold the instance for writing.
+func (m *Manager) applyInstance(ctx context.Context, inst instance, config any) error {
+	name := inst.instance.Name()
+
+	// Build the stored form of the instance before applying, so that
+	// an instance which cannot be persisted is not applied
+	var rec schema.StoredInstance
+	if m.store != nil {
+		var err error
+		if rec, err = m.record(inst, config); err != nil {
+			return fmt.Errorf("instance %q: persist: %w", name, err)
+		}
+	}
+
+	// Remove stale observers and notify old references before
+	// applying the new config, since Apply will overwrite the
+	// instance's references.
+	m.notifyRemovals(inst.instance)
+	m.unwireObservers(inst.instance)
+
+	if err := inst.instance.Apply(ctx, config); err != nil {
+		// Re-wire old observers on failure so state stays consistent
+		m.wireAndNotify(inst.instance)
+		return fmt.Errorf("instance %q: apply: %w", name, err)
+	}
+	inst.applied = schema.WritableStateOf(config)
+	if current, exists := m.get(name); exists {
+		inst.generation = current.generation + 1
+	} else {
+		inst.generation = 1
+	}
+	m.set(inst)
+	m.publishInstance(ctx, schema.EventApplied, inst)
+	m.wireAndNotify(inst.instance)
+
+	// Persist the applied state
+	return m.persist(ctx, rec)
+}
+
+// destroyInstance tears down the instance, removes it from the manager
+// and the state store, and returns its metadata as captured before
+// destruction (redacted — no need to return sensitive values for
+// instances being removed).
+// The caller must hold the instance for writing.
+func (m *Manager) destroyInstance(ctx context.Context, inst instance) (schema.InstanceMeta, error) {
+	name := inst.instance.Name()
+	meta := m.redactedInstanceMeta(ctx, inst)
+
+	m.notifyRemovals(inst.instance)
+	m.unwireObservers(inst.instance)
+	if err := inst.instance.Destroy(ctx); err != nil {
+		return meta, fmt.Errorf("instance %q: destroy: %w", name, err)
+	}
+	m.remove(name)
+	m.discardPlans(name)
+	m.publish(schema.Event{Type: schema.EventDestroyed, Name: meta.Name, Resource: meta.Resource, State: meta.State})
+
+	// Remove the instance from the state store
+	if err := m.unpersist(ctx, name); err != nil {
+		return meta, err
+	}
+
+	// Return success
+	return meta, nil
+}
+
 // instanceMeta builds an [schema.InstanceMeta] from a live instance.
 // It calls Read() on the instance to get the current state.
-// The caller must hold at least m.RLock().
+// The caller must hold the instance for reading.
 func (m *Manager) instanceMeta(ctx context.Context, inst instance) schema.InstanceMeta {
 	var state schema.State
 	if s, err := inst.instance.Read(ctx); err == nil {
 		state = s
 	}
-	return schema.InstanceMeta{
+	meta := schema.InstanceMeta{
 		Name:       inst.instance.Name(),
-		Resource:   inst.instance.Resource().Name(),
+		Resource:   resourceName(inst.instance),
+		Generation: inst.generation,
 		ReadOnly:   inst.readOnly,
 		State:      state,
 		References: inst.instance.References(),
 	}
+	if !inst.lifecycle.IsZero() {
+		lifecycle := inst.lifecycle
+		meta.Lifecycle = &lifecycle
+	}
+	return meta
 }
 
 // redactedInstanceMeta is like [instanceMeta] but replaces sensitive
@@ -552,11 +835,10 @@ func (m *Manager) redactedInstanceMeta(ctx context.Context, inst instance) schem
 }
 
 // directDependents returns the names of all live instances that
-// directly reference the given instance name. The caller must hold
-// at least m.RLock().
+// directly reference the given instance name, in name order.
 func (m *Manager) directDependents(name string) []string {
 	var deps []string
-	for instName, inst := range m.instances {
+	for instName, inst := range m.snapshot() {
 		if instName == name {
 			continue
 		}
@@ -567,12 +849,12 @@ func (m *Manager) directDependents(name string) []string {
 			}
 		}
 	}
+	slices.Sort(deps)
 	return deps
 }
 
 // collectDependents recursively adds name and every instance that
-// (transitively) depends on it to the set. The caller must hold at
-// least m.RLock().
+// (transitively) depends on it to the set.
 func (m *Manager) collectDependents(name string, set map[string]bool) {
 	if set[name] {
 		return
@@ -583,67 +865,10 @@ func (m *Manager) collectDependents(name string, set map[string]bool) {
 	}
 }
 
-// safeDestroyOrder returns the given set of instance names in
-// safe-to-destroy order: instances that nothing else (within the set)
-// depends on come first, working inward to the foundations. Any
-// instances involved in cycles are appended at the end so they are
-// still destroyed. The caller must hold at least m.RLock().
-func (m *Manager) safeDestroyOrder(names map[string]bool) []string {
-	// Build adjacency within the set.
-	// dependsOn[X] = refs X makes to other set members.
-	// inDegree[X]  = how many set members depend on X.
-	dependsOn := make(map[string][]string, len(names))
-	inDegree := make(map[string]int, len(names))
-	for name := range names {
-		inDegree[name] = 0
-	}
-	for name := range names {
-		inst := m.instances[name]
-		for _, ref := range inst.instance.References() {
-			if names[ref] {
-				dependsOn[name] = append(dependsOn[name], ref)
-				inDegree[ref]++
-			}
-		}
-	}
-
-	// Kahn's algorithm — nodes that nothing depends on are safe to
-	// destroy first, working inward.
-	queue := make([]string, 0, len(names))
-	for name, deg := range inDegree {
-		if deg == 0 {
-			queue = append(queue, name)
-		}
-	}
-	order := make([]string, 0, len(names))
-	for len(queue) > 0 {
-		name := queue[0]
-		queue = queue[1:]
-		order = append(order, name)
-		for _, ref := range dependsOn[name] {
-			inDegree[ref]--
-			if inDegree[ref] == 0 {
-				queue = append(queue, ref)
-			}
-		}
-	}
-
-	// Any remaining instances form a cycle — append them so they
-	// still get destroyed.
-	for name := range names {
-		if inDegree[name] > 0 {
-			order = append(order, name)
-		}
-	}
-
-	return order
-}
-
 // resolver returns a [schema.Resolver] that looks up instances by name.
-// The caller must hold at least m.RLock().
 func (m *Manager) resolver() schema.Resolver {
 	return func(name string) schema.ResourceInstance {
-		if inst, ok := m.instances[name]; ok {
+		if inst, ok := m.get(name); ok {
 			return inst.instance
 		}
 		return nil
@@ -654,14 +879,13 @@ func (m *Manager) resolver() schema.Resolver {
 // create a circular dependency through instanceName. It extracts reference
 // names from the state using the resource schema, then walks the existing
 // dependency graph via DFS to see if any path leads back to instanceName.
-// The caller must hold at least m.RLock().
 func (m *Manager) checkCycles(instanceName string, attrs []schema.Attribute, state schema.State) error {
 	newRefs := schema.ReferencesFromState(attrs, state)
 	if len(newRefs) == 0 {
 		return nil
 	}
 
-	visited := make(map[string]bool, len(m.instances))
+	visited := make(map[string]bool)
 	var walk func(string) bool
 	walk = func(current string) bool {
 		if current == instanceName {
@@ -671,7 +895,7 @@ func (m *Manager) checkCycles(instanceName string, attrs []schema.Attribute, sta
 			return false
 		}
 		visited[current] = true
-		if inst, ok := m.instances[current]; ok {
+		if inst, ok := m.get(current); ok {
 			for _, ref := range inst.instance.References() {
 				if walk(ref) {
 					return true
@@ -694,60 +918,72 @@ func (m *Manager) checkCycles(instanceName string, attrs []schema.Attribute, sta
 // instance's state changes in the future. It also fires an initial
 // notification for each reference, since SetState already ran during
 // Apply before the observers were wired.
-// The caller must hold m.Lock().
+// The caller must hold the instance for writing.
 func (m *Manager) wireAndNotify(inst schema.ResourceInstance) {
 	obs, ok := inst.(Observable)
 	if !ok {
 		return
 	}
 	for _, refName := range inst.References() {
-		dep, exists := m.instances[refName]
+		dep, exists := m.get(refName)
 		if !exists {
 			continue
 		}
 		depInst := dep.instance
 		obs.AddObserver(refName, func(source schema.ResourceInstance) {
-			if h, ok := depInst.(interface {
-				OnStateChange(schema.ResourceInstance)
-			}); ok {
-				h.OnStateChange(source)
-			}
+			m.notifyChange(depInst, source)
 		})
 		// Fire initial notification
-		if h, ok := depInst.(interface {
-			OnStateChange(schema.ResourceInstance)
-		}); ok {
-			h.OnStateChange(inst)
-		}
+		m.notifyChange(depInst, inst)
 	}
 }
 
 // notifyRemovals tells each referenced (dependency) instance that the
 // given instance is being removed. This is the inverse of the initial
 // OnStateChange notification in wireAndNotify.
-// The caller must hold m.Lock().
+// The caller must hold the instance for writing.
 func (m *Manager) notifyRemovals(inst schema.ResourceInstance) {
 	for _, refName := range inst.References() {
-		dep, exists := m.instances[refName]
+		dep, exists := m.get(refName)
 		if !exists {
 			continue
 		}
 		if h, ok := dep.instance.(interface {
 			OnStateRemove(schema.ResourceInstance)
 		}); ok {
+			m.notifyMu.Lock()
 			h.OnStateRemove(inst)
+			m.notifyMu.Unlock()
 		}
 	}
 }
 
+// notifyChange tells the dependency instance that the state of the source
+// instance has changed. Instances in the same layer are applied and
+// destroyed concurrently, so callbacks are serialised across the manager
+// to keep the guarantee that an instance is never called back from
+// several goroutines at once.
+func (m *Manager) notifyChange(dep, source schema.ResourceInstance) {
+	h, ok := dep.(interface {
+		OnStateChange(schema.ResourceInstance)
+	})
+	if !ok {
+		return
+	}
+	m.notifyMu.Lock()
+	h.OnStateChange(source)
+	m.notifyMu.Unlock()
+	m.publishNotified(dep, source)
+}
+
 // unwireObservers removes observers that reference the given instance.
 // For each depender (an instance that references this one), the observer
 // with the destroyed instance's name is removed.
-// The caller must hold m.Lock().
+// The caller must hold the instance for writing.
 func (m *Manager) unwireObservers(inst schema.ResourceInstance) {
 	name := inst.Name()
 	for _, dependerName := range m.directDependents(name) {
-		depender, ok := m.instances[dependerName]
+		depender, ok := m.get(dependerName)
 		if !ok {
 			continue
 		}
@@ -757,11 +993,74 @@ func (m *Manager) unwireObservers(inst schema.ResourceInstance) {
 	}
 }
 
+// checkGeneration returns an error if expected is set and the instance is
+// no longer at that generation.
+func checkGeneration(inst instance, expected *uint64) error {
+	if expected != nil && *expected != inst.generation {
+		return ErrPreconditionFailed.Withf("instance %q is at generation %d, expected %d", inst.instance.Name(), inst.generation, *expected)
+	}
+	return nil
+}
+
+// checkIfMatch returns an error if ifMatch is set and the instance does not
+// exist or does not match it.
+func checkIfMatch(name string, inst instance, exists bool, ifMatch *schema.IfMatch) error {
+	if ifMatch == nil {
+		return nil
+	} else if !exists {
+		return ErrPreconditionFailed.Withf("instance %q does not exist", name)
+	} else if !ifMatch.Match(inst.generation) {
+		return ErrPreconditionFailed.Withf("instance %q is at generation %d, which does not match %s", name, inst.generation, ifMatch)
+	}
+	return nil
+}
+
 // checkDependents returns an error if any live instance depends on the
-// given instance name. The caller must hold at least m.RLock().
+// given instance name.
 func (m *Manager) checkDependents(name string) error {
 	if deps := m.directDependents(name); len(deps) > 0 {
 		return ErrConflict.Withf("cannot destroy %q: instance %q depends on it", name, deps[0])
 	}
 	return nil
 }
+
+// resourceName returns the name of the resource type the instance was
+// created from, which is the part of the instance name before the dot. It
+// differs from the name returned by the instance's Resource for resource
+// types registered with [Manager.RegisterProvider], which are namespaced.
+func resourceName(inst schema.ResourceInstance) string {
+	name, _, _ := strings.Cut(inst.Name(), ".")
+	return name
+}
+
+// validateAttributeNames checks the attribute names in the schema of the
+// named resource type.
+func validateAttributeNames(name string, attrs []schema.Attribute) error {
+	for _, attr := range attrs {
+		// Strip dot-prefix (e.g. "tls.cert" → validate "tls" and "cert")
+		parts := strings.SplitN(attr.Name, ".", 2)
+		for _, part := range parts {
+			if err := schema.ValidateName(part); err != nil {
+				return ErrBadRequest.Withf("resource %q attribute %q: %v", name, attr.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validatePatterns checks that the pattern of each attribute in the schema
+// of the named resource type, including the attributes of blocks, is a
+// valid regular expression. Block attributes are reported with the prefix.
+func validatePatterns(name, prefix string, attrs []schema.Attribute) error {
+	for _, attr := range attrs {
+		if attr.Pattern != "" {
+			if _, err := regexp.Compile(attr.Pattern); err != nil {
+				return ErrBadRequest.Withf("resource %q attribute %q: invalid pattern: %v", name, prefix+attr.Name, err)
+			}
+		}
+		if err := validatePatterns(name, prefix+attr.Name+".", attr.Attributes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/mutablelogic/go-server/pkg/provider"
 	"github.com/mutablelogic/go-server/pkg/provider/schema"
+	"github.com/mutablelogic/go-server/pkg/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -931,3 +932,331 @@ func Test_Manager_ReadOnly_006(t *testing.T) {
 	_, err = mgr.GetResourceInstance(context.Background(), a.Name())
 	assert.Error(err)
 }
+
+///////////////////////////////////////////////////////////////////////////////
+// TESTS - GENERATION
+
+func Test_Manager_Generation_001(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	mgr := newPersistManager(t)
+
+	// Instances start at generation zero, and each apply bumps it
+	resp, err := mgr.CreateResourceInstance(ctx, schema.CreateResourceInstanceRequest{Name: "secret.a"})
+	assert.NoError(err)
+	assert.Equal(uint64(0), resp.Instance.Generation)
+	for i := uint64(1); i <= 2; i++ {
+		resp, err := mgr.UpdateResourceInstance(ctx, "secret.a", schema.UpdateResourceInstanceRequest{Attributes: schema.State{"port": int(i)}, Apply: true})
+		if assert.NoError(err) {
+			assert.Equal(i, resp.Instance.Generation)
+		}
+	}
+
+	// Plans do not bump the generation
+	plan, err := mgr.UpdateResourceInstance(ctx, "secret.a", schema.UpdateResourceInstanceRequest{Attributes: schema.State{"port": 3}})
+	if assert.NoError(err) {
+		assert.Equal(uint64(2), plan.Instance.Generation)
+	}
+}
+
+func Test_Manager_Generation_002(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	mgr := newPersistManager(t)
+	assert.NoError(applySecret(t, mgr, "secret.a", schema.State{"port": 1}))
+
+	// An update with a stale generation fails and changes nothing
+	_, err := mgr.UpdateResourceInstance(ctx, "secret.a", schema.UpdateResourceInstanceRequest{
+		Attributes: schema.State{"port": 2}, Apply: true, Generation: types.Ptr(uint64(0)),
+	})
+	assert.ErrorIs(err, provider.ErrPreconditionFailed)
+	get, _ := mgr.GetResourceInstance(ctx, "secret.a")
+	assert.Equal(1, get.Instance.State["port"])
+
+	// An update with the current generation succeeds
+	resp, err := mgr.UpdateResourceInstance(ctx, "secret.a", schema.UpdateResourceInstanceRequest{
+		Attributes: schema.State{"port": 2}, Apply: true, Generation: types.Ptr(uint64(1)),
+	})
+	if assert.NoError(err) {
+		assert.Equal(uint64(2), resp.Instance.Generation)
+	}
+
+	// Destroy checks the generation too
+	_, err = mgr.DestroyResourceInstance(ctx, schema.DestroyResourceInstanceRequest{Name: "secret.a", Generation: types.Ptr(uint64(1))})
+	assert.ErrorIs(err, provider.ErrPreconditionFailed)
+	_, err = mgr.DestroyResourceInstance(ctx, schema.DestroyResourceInstanceRequest{Name: "secret.a", Generation: types.Ptr(uint64(2))})
+	assert.NoError(err)
+}
+
+func Test_Manager_Generation_003(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	mgr := newPersistManager(t)
+	assert.NoError(applySecret(t, mgr, "secret.a", schema.State{"port": 1}))
+
+	// An If-Match precondition which does not match fails
+	_, err := mgr.UpdateResourceInstance(ctx, "secret.a", schema.UpdateResourceInstanceRequest{
+		Attributes: schema.State{"port": 2}, Apply: true, IfMatch: &schema.IfMatch{Generations: []uint64{0, 2}},
+	})
+	assert.ErrorIs(err, provider.ErrPreconditionFailed)
+
+	// One which matches succeeds
+	_, err = mgr.UpdateResourceInstance(ctx, "secret.a", schema.UpdateResourceInstanceRequest{
+		Attributes: schema.State{"port": 2}, Apply: true, IfMatch: &schema.IfMatch{Generations: []uint64{0, 1}},
+	})
+	assert.NoError(err)
+
+	// Any generation matches, but the instance must exist
+	_, err = mgr.DestroyResourceInstance(ctx, schema.DestroyResourceInstanceRequest{Name: "secret.b", IfMatch: &schema.IfMatch{Any: true}})
+	assert.ErrorIs(err, provider.ErrPreconditionFailed)
+	_, err = mgr.UpdateResourceInstance(ctx, "secret.b", schema.UpdateResourceInstanceRequest{Replace: true, IfMatch: &schema.IfMatch{Any: true}})
+	assert.ErrorIs(err, provider.ErrPreconditionFailed)
+	_, err = mgr.DestroyResourceInstance(ctx, schema.DestroyResourceInstanceRequest{Name: "secret.a", IfMatch: &schema.IfMatch{Any: true}})
+	assert.NoError(err)
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// TESTS - SAVED PLANS
+
+func Test_Manager_Plan_001(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	mgr := newPersistManager(t)
+	assert.NoError(applySecret(t, mgr, "secret.a", schema.State{"port": 1}))
+
+	// A plan returns an ID, which is stable for the same config
+	plan, err := mgr.UpdateResourceInstance(ctx, "secret.a", schema.UpdateResourceInstanceRequest{Attributes: schema.State{"port": 2}})
+	if !assert.NoError(err) {
+		return
+	}
+	assert.NotEmpty(plan.PlanID)
+	again, err := mgr.UpdateResourceInstance(ctx, "secret.a", schema.UpdateResourceInstanceRequest{Attributes: schema.State{"port": 2}})
+	assert.NoError(err)
+	assert.Equal(plan.PlanID, again.PlanID)
+	other, err := mgr.UpdateResourceInstance(ctx, "secret.a", schema.UpdateResourceInstanceRequest{Attributes: schema.State{"port": 3}})
+	assert.NoError(err)
+	assert.NotEqual(plan.PlanID, other.PlanID)
+
+	// Applying by ID applies exactly the saved plan
+	resp, err := mgr.UpdateResourceInstance(ctx, "secret.a", schema.UpdateResourceInstanceRequest{PlanID: plan.PlanID, Apply: true})
+	if assert.NoError(err) {
+		assert.Equal(2, resp.Instance.State["port"])
+		assert.Equal(plan.Plan, resp.Plan)
+		assert.Empty(resp.PlanID)
+	}
+
+	// The other plan is now out of date
+	_, err = mgr.UpdateResourceInstance(ctx, "secret.a", schema.UpdateResourceInstanceRequest{PlanID: other.PlanID, Apply: true})
+	assert.ErrorIs(err, provider.ErrPreconditionFailed)
+	get, _ := mgr.GetResourceInstance(ctx, "secret.a")
+	assert.Equal(2, get.Instance.State["port"])
+}
+
+func Test_Manager_Plan_002(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	mgr := newPersistManager(t)
+	assert.NoError(applySecret(t, mgr, "secret.a", schema.State{"port": 1}))
+	plan, err := mgr.UpdateResourceInstance(ctx, "secret.a", schema.UpdateResourceInstanceRequest{Attributes: schema.State{"port": 2}})
+	if !assert.NoError(err) {
+		return
+	}
+
+	// Unknown plan IDs are not found
+	_, err = mgr.UpdateResourceInstance(ctx, "secret.a", schema.UpdateResourceInstanceRequest{PlanID: "unknown", Apply: true})
+	assert.ErrorIs(err, provider.ErrNotFound)
+
+	// Plan IDs are only for applying, without attributes
+	_, err = mgr.UpdateResourceInstance(ctx, "secret.a", schema.UpdateResourceInstanceRequest{PlanID: plan.PlanID})
+	assert.ErrorIs(err, provider.ErrBadRequest)
+	_, err = mgr.UpdateResourceInstance(ctx, "secret.a", schema.UpdateResourceInstanceRequest{PlanID: plan.PlanID, Apply: true, Attributes: schema.State{"port": 3}})
+	assert.ErrorIs(err, provider.ErrBadRequest)
+
+	// Plans are discarded when the instance is destroyed
+	_, err = mgr.DestroyResourceInstance(ctx, schema.DestroyResourceInstanceRequest{Name: "secret.a"})
+	assert.NoError(err)
+	assert.NoError(applySecret(t, mgr, "secret.a", schema.State{"port": 1}))
+	_, err = mgr.UpdateResourceInstance(ctx, "secret.a", schema.UpdateResourceInstanceRequest{PlanID: plan.PlanID, Apply: true})
+	assert.ErrorIs(err, provider.ErrNotFound)
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// TESTS - VALIDATION ERRORS
+
+func Test_Manager_Validation_001(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	mgr := newPersistManager(t)
+
+	// Every invalid attribute is reported as a bad request
+	_, err := mgr.CreateResourceInstance(ctx, schema.CreateResourceInstanceRequest{Name: "secret.a"})
+	assert.NoError(err)
+	_, err = mgr.UpdateResourceInstance(ctx, "secret.a", schema.UpdateResourceInstanceRequest{
+		Attributes: schema.State{"port": "http", "bogus": true},
+	})
+	assert.ErrorIs(err, provider.ErrBadRequest)
+	var verr *schema.ValidationError
+	if assert.ErrorAs(err, &verr) {
+		assert.Equal([]schema.FieldError{
+			{Attribute: "port", Code: schema.CodeType, Message: verr.Errors[0].Message},
+			{Attribute: "bogus", Code: schema.CodeUnknown, Message: "unknown attribute"},
+		}, verr.Errors)
+	}
+}
+
+func Test_Manager_Validation_002(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	mgr := newPersistManager(t)
+
+	// Constraints are enforced, and returned with the schema
+	_, err := mgr.CreateResourceInstance(ctx, schema.CreateResourceInstanceRequest{Name: "secret.a"})
+	assert.NoError(err)
+	_, err = mgr.UpdateResourceInstance(ctx, "secret.a", schema.UpdateResourceInstanceRequest{
+		Attributes: schema.State{"port": 70000},
+	})
+	var verr *schema.ValidationError
+	if assert.ErrorAs(err, &verr) && assert.Len(verr.Errors, 1) {
+		assert.Equal("port", verr.Errors[0].Attribute)
+		assert.Equal(schema.CodeRange, verr.Errors[0].Code)
+	}
+	resp, err := mgr.ListResources(ctx, schema.ListResourcesRequest{})
+	if assert.NoError(err) {
+		for _, attr := range resp.Resources[0].Attributes {
+			if attr.Name == "port" && assert.NotNil(attr.Max) {
+				assert.Equal(65535.0, *attr.Max)
+			}
+		}
+	}
+}
+
+// badPatternConfig is a resource config with an invalid pattern in a block.
+type badPatternConfig struct {
+	Rules []struct {
+		Path string `name:"path" pattern:"^(/"`
+	} `name:"rule"`
+}
+
+func (badPatternConfig) Name() string               { return "badpattern" }
+func (badPatternConfig) Schema() []schema.Attribute { return schema.AttributesOf(badPatternConfig{}) }
+func (badPatternConfig) New(string) (schema.ResourceInstance, error) {
+	return nil, provider.ErrBadRequest
+}
+
+func Test_Manager_Validation_003(t *testing.T) {
+	assert := assert.New(t)
+	mgr, err := provider.New("test", "test provider", "0.0.1")
+	if !assert.NoError(err) {
+		return
+	}
+
+	// An invalid pattern is rejected when the resource is registered
+	err = mgr.RegisterResource(badPatternConfig{})
+	assert.ErrorIs(err, provider.ErrBadRequest)
+	assert.ErrorContains(err, "rule")
+}
+
+func Test_Manager_Validation_004(t *testing.T) {
+	assert := assert.New(t)
+	mgr, err := provider.New("test", "test provider", "0.0.1")
+	if !assert.NoError(err) {
+		return
+	}
+
+	// An invalid pattern is rejected when a read-only instance registers
+	// the resource type
+	_, err = mgr.RegisterReadonlyInstance(context.Background(), badPatternConfig{}, "main", nil)
+	assert.ErrorIs(err, provider.ErrBadRequest)
+	assert.ErrorContains(err, "rule")
+	assert.Empty(mgr.Resources())
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// TESTS - BLOCKS
+
+// ruleConfig is a resource config with a block of rules keyed by path.
+type ruleConfig struct {
+	Rules []ruleBlock `name:"rule" key:"path"`
+}
+
+type ruleBlock struct {
+	Path    string   `name:"path" required:""`
+	Methods []string `name:"methods"`
+}
+
+func (ruleConfig) Name() string               { return "rules" }
+func (ruleConfig) Schema() []schema.Attribute { return schema.AttributesOf(ruleConfig{}) }
+func (c ruleConfig) New(name string) (schema.ResourceInstance, error) {
+	return &ruleInstance{ResourceInstance: provider.NewResourceInstance(c, name)}, nil
+}
+
+type ruleInstance struct {
+	provider.ResourceInstance[ruleConfig]
+}
+
+func Test_Manager_Blocks_001(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	mgr, err := provider.New("test", "test provider", "0.0.1")
+	if !assert.NoError(err) {
+		return
+	}
+	assert.NoError(mgr.RegisterResource(ruleConfig{}))
+	t.Cleanup(func() { _ = mgr.Close(ctx) })
+
+	// A block is applied from JSON-style state
+	_, err = mgr.CreateResourceInstance(ctx, schema.CreateResourceInstanceRequest{Name: "rules.a"})
+	assert.NoError(err)
+	_, err = mgr.UpdateResourceInstance(ctx, "rules.a", schema.UpdateResourceInstanceRequest{
+		Attributes: schema.State{"rule": []any{
+			map[string]any{"path": "/a", "methods": []any{"GET"}},
+			map[string]any{"path": "/b"},
+		}},
+		Apply: true,
+	})
+	assert.NoError(err)
+
+	// A change to one element is planned against that element
+	resp, err := mgr.UpdateResourceInstance(ctx, "rules.a", schema.UpdateResourceInstanceRequest{
+		Attributes: schema.State{"rule": []any{
+			map[string]any{"path": "/a", "methods": []any{"GET", "POST"}},
+			map[string]any{"path": "/b"},
+		}},
+	})
+	if assert.NoError(err) && assert.Len(resp.Plan.Changes, 1) {
+		assert.Equal(`rule["/a"].methods`, resp.Plan.Changes[0].Field)
+		assert.Equal([]string{"GET", "POST"}, resp.Plan.Changes[0].New)
+	}
+
+	// An element without its required attribute is rejected
+	_, err = mgr.UpdateResourceInstance(ctx, "rules.a", schema.UpdateResourceInstanceRequest{
+		Attributes: schema.State{"rule": []any{map[string]any{"methods": []any{"GET"}}}},
+	})
+	var verr *schema.ValidationError
+	if assert.ErrorAs(err, &verr) && assert.Len(verr.Errors, 1) {
+		assert.Equal("rule[0].path", verr.Errors[0].Attribute)
+	}
+}
+
+func Test_Manager_Blocks_002(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	mgr, err := provider.New("test", "test provider", "0.0.1")
+	if !assert.NoError(err) {
+		return
+	}
+	assert.NoError(mgr.RegisterResource(ruleConfig{}))
+
+	// The schema of a resource type describes its blocks
+	s, err := mgr.GetResourceSchema(ctx, "rules")
+	if assert.NoError(err) {
+		assert.Equal("rules", s.Title)
+		if rule := s.Properties["rule"]; assert.NotNil(rule) && assert.NotNil(rule.Items) {
+			assert.Equal([]string{"path"}, rule.Items.Required)
+		}
+	}
+
+	// An unregistered resource type is not found
+	_, err = mgr.GetResourceSchema(ctx, "missing")
+	assert.ErrorIs(err, provider.ErrNotFound)
+}
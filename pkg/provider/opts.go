@@ -0,0 +1,105 @@
+package provider
+
+import (
+	"crypto/sha256"
+	"runtime"
+	"time"
+
+	// Packages
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type opt struct {
+	store       schema.StateStore
+	key         []byte
+	refresh     time.Duration
+	reapply     bool
+	drift       DriftFunc
+	parallelism int
+}
+
+type Opt func(*opt) error
+
+///////////////////////////////////////////////////////////////////////////////
+// LIFECYCLE
+
+func applyOpts(opts ...Opt) (*opt, error) {
+	o := &opt{parallelism: runtime.GOMAXPROCS(0)}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// OPTIONS
+
+// Persist the applied state of instances to the store, so that they can be
+// re-created with [Manager.Restore] after a restart.
+func WithStateStore(store schema.StateStore) Opt {
+	return func(o *opt) error {
+		if store == nil {
+			return ErrBadRequest.With("state store is nil")
+		}
+		o.store = store
+		return nil
+	}
+}
+
+// Set the operator key used to encrypt sensitive attribute values in the
+// state store. Without a key, instances with sensitive values cannot be
+// persisted.
+func WithStateKey(key string) Opt {
+	return func(o *opt) error {
+		if key == "" {
+			return ErrBadRequest.With("state key is empty")
+		}
+		sum := sha256.Sum256([]byte(key))
+		o.key = sum[:]
+		return nil
+	}
+}
+
+// Check every instance for drift at the given interval while
+// [Manager.Run] is running. When reapply is true, instances which have
+// drifted are re-applied with the state they were last applied with.
+func WithRefresh(interval time.Duration, reapply bool) Opt {
+	return func(o *opt) error {
+		if interval <= 0 {
+			return ErrBadRequest.With("refresh interval must be positive")
+		}
+		o.refresh = interval
+		o.reapply = reapply
+		return nil
+	}
+}
+
+// Call fn for each instance found to have drifted by [Manager.Refresh].
+func WithDriftHandler(fn DriftFunc) Opt {
+	return func(o *opt) error {
+		if fn == nil {
+			return ErrBadRequest.With("drift handler is nil")
+		}
+		o.drift = fn
+		return nil
+	}
+}
+
+// Apply or destroy at most n independent instances at once in operations
+// across many instances, such as [Manager.Close] and [Manager.ApplyConfig].
+// The default is GOMAXPROCS; set n to one to apply and destroy instances
+// one at a time.
+func WithParallelism(n int) Opt {
+	return func(o *opt) error {
+		if n < 1 {
+			return ErrBadRequest.With("parallelism must be at least one")
+		}
+		o.parallelism = n
+		return nil
+	}
+}
@@ -0,0 +1,295 @@
+package provider
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	// Packages
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// PersistError is the error from saving an instance to, or removing it
+// from, the state store after it was applied or destroyed. The change has
+// taken effect, but is not recorded in the store, so the response is
+// returned together with the error.
+type PersistError struct {
+	Name string
+	Err  error
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Error returns the message of the underlying error, with the instance name.
+func (e *PersistError) Error() string {
+	return fmt.Sprintf("instance %q: persist: %v", e.Name, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *PersistError) Unwrap() error {
+	return e.Err
+}
+
+// Restore re-creates and re-applies every instance in the state store, in
+// dependency order, so that each instance is applied after the instances it
+// references. Instances which fail to restore are skipped and their errors
+// returned together; their dependents then fail to resolve the reference.
+// Restore does nothing when the manager has no state store.
+func (m *Manager) Restore(ctx context.Context) error {
+	m.graph.Lock()
+	defer m.graph.Unlock()
+
+	// Check for a state store
+	if m.store == nil {
+		return nil
+	}
+
+	// Read the stored instances
+	stored, err := m.store.List(ctx)
+	if err != nil {
+		return fmt.Errorf("state store: %w", err)
+	}
+
+	// Restore the instances in dependency order
+	var result error
+	for _, rec := range m.restoreOrder(stored) {
+		if err := m.restoreInstance(ctx, rec); err != nil {
+			result = errors.Join(result, fmt.Errorf("instance %q: restore: %w", rec.Name, err))
+		}
+	}
+	return result
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// record returns the stored form of the instance for the validated config,
+// with sensitive attribute values sealed with the state key. It returns an
+// error when a sensitive value is set and the manager has no state key.
+func (m *Manager) record(inst instance, config any) (schema.StoredInstance, error) {
+	rec := schema.StoredInstance{
+		Name:     inst.instance.Name(),
+		Resource: resourceName(inst.instance),
+		State:    schema.WritableStateOf(config),
+	}
+	if !inst.lifecycle.IsZero() {
+		lifecycle := inst.lifecycle
+		rec.Lifecycle = &lifecycle
+	}
+	for _, attr := range inst.instance.Resource().Schema() {
+		value, exists := rec.State[attr.Name]
+		if !attr.Sensitive || !exists || isNil(value) || value == "" {
+			continue
+		}
+		if m.key == nil {
+			return rec, ErrBadRequest.Withf("attribute %q is sensitive: a state key is required to persist it", attr.Name)
+		}
+		sealed, err := m.seal(rec.Name, attr.Name, value)
+		if err != nil {
+			return rec, err
+		}
+		if rec.Encrypted == nil {
+			rec.Encrypted = make(map[string]string)
+		}
+		rec.Encrypted[attr.Name] = sealed
+		delete(rec.State, attr.Name)
+	}
+	return rec, nil
+}
+
+// persist stores the record when the manager has a state store. A failure
+// is returned as a [PersistError].
+func (m *Manager) persist(ctx context.Context, rec schema.StoredInstance) error {
+	if m.store == nil {
+		return nil
+	}
+	if err := m.store.Put(ctx, rec); err != nil {
+		return &PersistError{Name: rec.Name, Err: err}
+	}
+	return nil
+}
+
+// unpersist removes the named instance when the manager has a state store.
+// A failure is returned as a [PersistError].
+func (m *Manager) unpersist(ctx context.Context, name string) error {
+	if m.store == nil {
+		return nil
+	}
+	if err := m.store.Delete(ctx, name); err != nil {
+		return &PersistError{Name: name, Err: err}
+	}
+	return nil
+}
+
+// restoreInstance creates, validates and applies a stored instance, and
+// wires its observers. On failure the instance is removed again.
+// The caller must hold m.graph.Lock().
+func (m *Manager) restoreInstance(ctx context.Context, rec schema.StoredInstance) error {
+	// Unseal the sensitive attribute values
+	state := make(schema.State, len(rec.State)+len(rec.Encrypted))
+	for k, v := range rec.State {
+		state[k] = v
+	}
+	for attr, sealed := range rec.Encrypted {
+		value, err := m.unseal(rec.Name, attr, sealed)
+		if err != nil {
+			return err
+		}
+		state[attr] = value
+	}
+
+	// Check the references were restored, since optional references
+	// which cannot be resolved would otherwise be silently dropped
+	if res, exists := m.resource(rec.Resource); exists {
+		for _, ref := range schema.ReferencesFromState(res.Schema(), state) {
+			if _, exists := m.get(ref); !exists {
+				return ErrNotFound.Withf("reference %q not found", ref)
+			}
+		}
+	}
+
+	// Create the instance
+	label, found := strings.CutPrefix(rec.Name, rec.Resource+".")
+	if !found {
+		return ErrBadRequest.Withf("invalid instance name %q for resource %q", rec.Name, rec.Resource)
+	}
+	inst, err := m.newInstance(rec.Resource, label)
+	if err != nil {
+		return err
+	}
+
+	// Validate and apply the state
+	config, err := inst.Validate(ctx, state, m.resolver())
+	if err != nil {
+		m.remove(rec.Name)
+		return fmt.Errorf("validate: %w", err)
+	}
+	if err := inst.Apply(ctx, config); err != nil {
+		m.remove(rec.Name)
+		return fmt.Errorf("apply: %w", err)
+	}
+	entry, _ := m.get(rec.Name)
+	entry.applied = schema.WritableStateOf(config)
+	entry.generation = 1
+	if rec.Lifecycle != nil {
+		entry.lifecycle = *rec.Lifecycle
+	}
+	m.set(entry)
+	m.publishInstance(ctx, schema.EventApplied, entry)
+
+	// Wire observers so referenced instances are notified
+	m.wireAndNotify(inst)
+
+	// Return success
+	return nil
+}
+
+// restoreOrder returns the stored instances ordered so that each comes
+// after the stored instances it references. References to instances which
+// are not stored are ignored, and cycles are broken at the instance which
+// sorts first by name.
+func (m *Manager) restoreOrder(stored []schema.StoredInstance) []schema.StoredInstance {
+	byName := make(map[string]schema.StoredInstance, len(stored))
+	for _, rec := range stored {
+		byName[rec.Name] = rec
+	}
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	// Depth-first walk, emitting dependencies before dependents
+	order := make([]schema.StoredInstance, 0, len(byName))
+	visited := make(map[string]bool, len(byName))
+	var visit func(string)
+	visit = func(name string) {
+		rec, exists := byName[name]
+		if !exists || visited[name] {
+			return
+		}
+		visited[name] = true
+		if res, exists := m.resource(rec.Resource); exists {
+			for _, ref := range schema.ReferencesFromState(res.Schema(), rec.State) {
+				visit(ref)
+			}
+		}
+		order = append(order, rec)
+	}
+	for _, name := range names {
+		visit(name)
+	}
+	return order
+}
+
+// seal encrypts a sensitive attribute value with the state key, binding it
+// to the instance and attribute name.
+func (m *Manager) seal(name, attr string, value any) (string, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	aead, err := m.aead()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, data, []byte(name+"/"+attr))), nil
+}
+
+// unseal decrypts a sensitive attribute value sealed by [seal].
+func (m *Manager) unseal(name, attr, sealed string) (any, error) {
+	if m.key == nil {
+		return nil, ErrBadRequest.Withf("attribute %q is sensitive: a state key is required to restore it", attr)
+	}
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, ErrBadRequest.Withf("attribute %q: %v", attr, err)
+	}
+	aead, err := m.aead()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, ErrBadRequest.Withf("attribute %q: sealed value is too short", attr)
+	}
+	data, err = aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(name+"/"+attr))
+	if err != nil {
+		return nil, ErrBadRequest.Withf("attribute %q: cannot decrypt (wrong state key?)", attr)
+	}
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, ErrBadRequest.Withf("attribute %q: %v", attr, err)
+	}
+	return value, nil
+}
+
+// aead returns the AES-GCM cipher for the state key.
+func (m *Manager) aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(m.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// isPersistError reports whether err is a [PersistError], so that the
+// change which was not persisted is still returned to the caller.
+func isPersistError(err error) bool {
+	var perr *PersistError
+	return errors.As(err, &perr)
+}
@@ -0,0 +1,305 @@
+package provider_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	// Packages
+	provider "github.com/mutablelogic/go-server/pkg/provider"
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+	store "github.com/mutablelogic/go-server/pkg/provider/store"
+	assert "github.com/stretchr/testify/assert"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// MOCK TYPES
+
+// secretConfig is a resource config with a sensitive attribute and an
+// optional dependency on another instance.
+type secretConfig struct {
+	Dep      schema.ResourceInstance `name:"dep" type:"secret"`
+	Password string                  `name:"password" sensitive:""`
+	Port     int                     `name:"port" max:"65535"`
+}
+
+func (secretConfig) Name() string               { return "secret" }
+func (secretConfig) Schema() []schema.Attribute { return schema.AttributesOf(secretConfig{}) }
+func (c secretConfig) New(name string) (schema.ResourceInstance, error) {
+	return &secretInstance{ResourceInstance: provider.NewResourceInstance(c, name)}, nil
+}
+
+// secretInstance fails to apply when the port is negative. Its live state
+// can be changed with SetLive to simulate drift, until the next apply.
+type secretInstance struct {
+	provider.ResourceInstance[secretConfig]
+	mu   sync.Mutex
+	live schema.State
+}
+
+func (i *secretInstance) Apply(ctx context.Context, v any) error {
+	return i.ApplyConfig(ctx, v, func(_ context.Context, c *secretConfig) error {
+		if c.Port < 0 {
+			return errors.New("invalid port")
+		}
+		i.SetLive(nil)
+		return nil
+	})
+}
+
+func (i *secretInstance) Read(ctx context.Context) (schema.State, error) {
+	state, err := i.ResourceInstance.Read(ctx)
+	if err != nil || state == nil {
+		return state, err
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for k, v := range i.live {
+		state[k] = v
+	}
+	return state, nil
+}
+
+func (i *secretInstance) SetLive(state schema.State) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.live = state
+}
+
+// failStore is a state store which fails to store instances while fail is
+// set.
+type failStore struct {
+	*store.Memory
+	fail bool
+}
+
+func (s *failStore) Put(ctx context.Context, instance schema.StoredInstance) error {
+	if s.fail {
+		return errors.New("store unavailable")
+	}
+	return s.Memory.Put(ctx, instance)
+}
+
+func newPersistManager(t *testing.T, opts ...provider.Opt) *provider.Manager {
+	t.Helper()
+	mgr, err := provider.New("test", "test provider", "0.0.1", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mgr.RegisterResource(secretConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = mgr.Close(context.Background())
+	})
+	return mgr
+}
+
+func applySecret(t *testing.T, mgr *provider.Manager, name string, state schema.State) error {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := mgr.CreateResourceInstance(ctx, schema.CreateResourceInstanceRequest{Name: name}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := mgr.UpdateResourceInstance(ctx, name, schema.UpdateResourceInstanceRequest{Attributes: state, Apply: true})
+	return err
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// TESTS - PERSISTENCE
+
+func Test_Manager_Persist_001(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	st := store.NewMemory()
+
+	// Apply persists the writable state, sealing sensitive values
+	mgr := newPersistManager(t, provider.WithStateStore(st), provider.WithStateKey("secret"))
+	assert.NoError(applySecret(t, mgr, "secret.z", schema.State{"password": "hunter2", "port": 8080}))
+	assert.NoError(applySecret(t, mgr, "secret.a", schema.State{"dep": "secret.z"}))
+
+	stored, err := st.List(ctx)
+	if !assert.NoError(err) || !assert.Len(stored, 2) {
+		return
+	}
+	assert.Equal("secret.a", stored[0].Name)
+	assert.Equal("secret", stored[0].Resource)
+	assert.Equal("secret.z", stored[0].State["dep"])
+	assert.Equal("secret.z", stored[1].Name)
+	assert.Equal(8080, stored[1].State["port"])
+	assert.NotContains(stored[1].State, "password")
+	assert.Contains(stored[1].Encrypted, "password")
+	assert.NotContains(stored[1].Encrypted["password"], "hunter2")
+}
+
+func Test_Manager_Persist_002(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	st := store.NewMemory()
+
+	// Populate the store
+	mgr := newPersistManager(t, provider.WithStateStore(st), provider.WithStateKey("secret"))
+	assert.NoError(applySecret(t, mgr, "secret.z", schema.State{"password": "hunter2", "port": 8080}))
+	assert.NoError(applySecret(t, mgr, "secret.a", schema.State{"dep": "secret.z"}))
+
+	// Restore into a new manager: the dependency is restored first even
+	// though it sorts last
+	restored := newPersistManager(t, provider.WithStateStore(st), provider.WithStateKey("secret"))
+	if !assert.NoError(restored.Restore(ctx)) {
+		return
+	}
+	z, err := restored.GetResourceInstance(ctx, "secret.z")
+	if assert.NoError(err) {
+		assert.Equal("hunter2", z.Instance.State["password"])
+		assert.Equal(8080, z.Instance.State["port"])
+	}
+	a, err := restored.GetResourceInstance(ctx, "secret.a")
+	if assert.NoError(err) {
+		assert.Equal([]string{"secret.z"}, a.Instance.References)
+	}
+
+	// Closing the manager does not remove the stored instances
+	assert.NoError(restored.Close(ctx))
+	stored, err := st.List(ctx)
+	assert.NoError(err)
+	assert.Len(stored, 2)
+}
+
+func Test_Manager_Persist_003(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	st := store.NewMemory()
+
+	// Without a state key, sensitive values cannot be persisted, and the
+	// instance is not applied
+	mgr := newPersistManager(t, provider.WithStateStore(st))
+	err := applySecret(t, mgr, "secret.a", schema.State{"password": "hunter2"})
+	assert.ErrorContains(err, "state key")
+	resp, err := mgr.GetResourceInstance(ctx, "secret.a")
+	if assert.NoError(err) {
+		assert.Nil(resp.Instance.State)
+	}
+
+	// Empty sensitive values do not need a key
+	assert.NoError(applySecret(t, mgr, "secret.b", schema.State{"port": 1}))
+	stored, err := st.List(ctx)
+	assert.NoError(err)
+	assert.Len(stored, 1)
+}
+
+func Test_Manager_Persist_004(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	st := store.NewMemory()
+
+	// Destroy removes the instance from the store
+	mgr := newPersistManager(t, provider.WithStateStore(st), provider.WithStateKey("secret"))
+	assert.NoError(applySecret(t, mgr, "secret.z", schema.State{"port": 1}))
+	assert.NoError(applySecret(t, mgr, "secret.a", schema.State{"dep": "secret.z"}))
+	_, err := mgr.DestroyResourceInstance(ctx, schema.DestroyResourceInstanceRequest{Name: "secret.z", Cascade: true})
+	assert.NoError(err)
+	stored, err := st.List(ctx)
+	assert.NoError(err)
+	assert.Empty(stored)
+}
+
+func Test_Manager_Persist_005(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	st := store.NewMemory()
+
+	// Restoring with the wrong key fails for the sealed instance and its
+	// dependents, but not for other instances
+	mgr := newPersistManager(t, provider.WithStateStore(st), provider.WithStateKey("secret"))
+	assert.NoError(applySecret(t, mgr, "secret.z", schema.State{"password": "hunter2"}))
+	assert.NoError(applySecret(t, mgr, "secret.a", schema.State{"dep": "secret.z"}))
+	assert.NoError(applySecret(t, mgr, "secret.b", schema.State{"port": 1}))
+
+	restored := newPersistManager(t, provider.WithStateStore(st), provider.WithStateKey("wrong"))
+	err := restored.Restore(ctx)
+	assert.ErrorContains(err, "secret.z")
+	assert.ErrorContains(err, "secret.a")
+	_, err = restored.GetResourceInstance(ctx, "secret.b")
+	assert.NoError(err)
+	_, err = restored.GetResourceInstance(ctx, "secret.z")
+	assert.Error(err)
+}
+
+func Test_Manager_Persist_006(t *testing.T) {
+	assert := assert.New(t)
+
+	// Invalid options are rejected
+	_, err := provider.New("test", "test provider", "0.0.1", provider.WithStateStore(nil))
+	assert.Error(err)
+	_, err = provider.New("test", "test provider", "0.0.1", provider.WithStateKey(""))
+	assert.Error(err)
+
+	// Restore without a store does nothing
+	mgr := newPersistManager(t)
+	assert.NoError(mgr.Restore(context.Background()))
+}
+
+func Test_Manager_Persist_007(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	st := &failStore{Memory: store.NewMemory(), fail: true}
+
+	// An instance which is applied but not persisted is returned with the
+	// error
+	mgr := newImportManager(t, provider.WithStateStore(st))
+	_, err := mgr.CreateResourceInstance(ctx, schema.CreateResourceInstanceRequest{Name: "secret.a"})
+	assert.NoError(err)
+	resp, err := mgr.UpdateResourceInstance(ctx, "secret.a", schema.UpdateResourceInstanceRequest{
+		Attributes: schema.State{"port": 1},
+		Apply:      true,
+	})
+	var perr *provider.PersistError
+	if assert.ErrorAs(err, &perr) && assert.NotNil(resp) {
+		assert.Equal("secret.a", perr.Name)
+		assert.Equal(uint64(1), resp.Instance.Generation)
+		assert.Equal(1, resp.Instance.State["port"])
+	}
+
+	// So is an imported instance, which is kept
+	imported, err := mgr.ImportResourceInstance(ctx, "disk.a", schema.ImportResourceInstanceRequest{ID: "/dev/sda"})
+	if assert.ErrorAs(err, &perr) && assert.NotNil(imported) {
+		assert.Equal("disk.a", imported.Instance.Name)
+	}
+	_, err = mgr.GetResourceInstance(ctx, "disk.a")
+	assert.NoError(err)
+	stored, err := st.List(ctx)
+	assert.NoError(err)
+	assert.Empty(stored)
+}
+
+func Test_Manager_Persist_008(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	st := &failStore{Memory: store.NewMemory()}
+	mgr := newPersistManager(t, provider.WithStateStore(st))
+	assert.NoError(applySecret(t, mgr, "secret.a", schema.State{"port": 1}))
+
+	// A replacement which is swapped in but not persisted is returned with
+	// the error, whether or not it is created before the old instance is
+	// destroyed
+	st.fail = true
+	for i, lifecycle := range []*schema.Lifecycle{{}, {CreateBeforeDestroy: true}} {
+		resp, err := mgr.UpdateResourceInstance(ctx, "secret.a", schema.UpdateResourceInstanceRequest{
+			Attributes: schema.State{"port": 2 + i},
+			Lifecycle:  lifecycle,
+			Replace:    true,
+			Apply:      true,
+		})
+		var perr *provider.PersistError
+		if assert.ErrorAs(err, &perr) && assert.NotNil(resp) {
+			assert.Equal("secret.a", perr.Name)
+			assert.Equal(uint64(2+i), resp.Instance.Generation)
+			assert.Equal(2+i, resp.Instance.State["port"])
+		}
+	}
+	get, err := mgr.GetResourceInstance(ctx, "secret.a")
+	if assert.NoError(err) {
+		assert.Equal(3, get.Instance.State["port"])
+	}
+}
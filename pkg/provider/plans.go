@@ -0,0 +1,101 @@
+package provider
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+
+	// Packages
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// savedPlan is a plan computed for an instance, kept so that it can be
+// applied later by its ID.
+type savedPlan struct {
+	id         string
+	generation uint64            // instance generation the plan was computed from
+	attrs      schema.State      // validated state, merged with the current state
+	lifecycle  *schema.Lifecycle // lifecycle options, nil to keep the current options
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+// Number of plans kept for each instance. Older plans for the same
+// instance generation are discarded.
+const maxPlans = 16
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// planID returns an opaque ID for a plan of the named instance: a keyed
+// hash of the instance generation, the validated config and the lifecycle
+// options, so that plans which differ only in their lifecycle have
+// different IDs. A nil lifecycle, which keeps the current options, is
+// distinct from an empty one, which clears them. The key is random for
+// each manager, so IDs cannot be used to guess sensitive values and do not
+// survive a restart.
+func (m *Manager) planID(name string, generation uint64, config any, lifecycle *schema.Lifecycle) (string, error) {
+	data, err := json.Marshal(schema.WritableStateOf(config))
+	if err != nil {
+		return "", err
+	}
+	if lifecycle != nil {
+		canonical := *lifecycle
+		canonical.IgnoreChanges = slices.Compact(slices.Sorted(slices.Values(lifecycle.IgnoreChanges)))
+		lifecycle = &canonical
+	}
+	options, err := json.Marshal(lifecycle)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, m.planKey)
+	mac.Write([]byte(name))
+	mac.Write([]byte{0})
+	mac.Write(binary.BigEndian.AppendUint64(nil, generation))
+	mac.Write(data)
+	mac.Write([]byte{0})
+	mac.Write(options)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// savePlan keeps the plan for the named instance, discarding plans for
+// other generations of the instance and the oldest plans over [maxPlans].
+func (m *Manager) savePlan(name string, plan savedPlan) {
+	m.plansMu.Lock()
+	defer m.plansMu.Unlock()
+	plans := slices.DeleteFunc(m.plans[name], func(p savedPlan) bool {
+		return p.generation != plan.generation || p.id == plan.id
+	})
+	plans = append(plans, plan)
+	if len(plans) > maxPlans {
+		plans = slices.Delete(plans, 0, len(plans)-maxPlans)
+	}
+	m.plans[name] = plans
+}
+
+// lookupPlan returns the saved plan with the given ID for the named
+// instance.
+func (m *Manager) lookupPlan(name, id string) (savedPlan, bool) {
+	m.plansMu.Lock()
+	defer m.plansMu.Unlock()
+	for _, plan := range m.plans[name] {
+		if plan.id == id {
+			return plan, true
+		}
+	}
+	return savedPlan{}, false
+}
+
+// discardPlans removes all saved plans for the named instance.
+func (m *Manager) discardPlans(name string) {
+	m.plansMu.Lock()
+	defer m.plansMu.Unlock()
+	delete(m.plans, name)
+}
@@ -0,0 +1,154 @@
+package provider
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+
+	// Packages
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// registeredProvider is a provider whose resource types have been
+// registered with [Manager.RegisterProvider].
+type registeredProvider struct {
+	provider  schema.Provider
+	resources []string // namespaced resource type names, in name order
+}
+
+// namespacedResource is a resource type of a registered provider, with its
+// name prefixed by the name of the provider.
+type namespacedResource struct {
+	schema.Resource
+	name string
+}
+
+var _ schema.Resource = namespacedResource{}
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// RegisterProvider registers the resource types of another provider, such
+// as a plugin, with the manager. Each resource type is registered with its
+// name prefixed by the provider name and an underscore, following the
+// Terraform convention (e.g. resource type "bucket" of provider "s3" is
+// registered as "s3_bucket"), so that providers can use the same names for
+// their resource types. Either all the resource types of the provider are
+// registered, or none: it returns [ErrConflict] if the provider is already
+// registered or a resource type name is already in use.
+func (m *Manager) RegisterProvider(p schema.Provider) error {
+	m.Lock()
+	defer m.Unlock()
+	if p == nil {
+		return ErrBadRequest.With("provider is nil")
+	}
+
+	// Validate the provider name
+	name := p.Name()
+	if err := schema.ValidateName(name); err != nil {
+		return ErrBadRequest.Withf("provider name: %v", err)
+	}
+	if _, exists := m.providers[name]; exists {
+		return ErrConflict.Withf("provider %q is already registered", name)
+	}
+
+	// Validate the resource types before registering any of them
+	resources := make(map[string]schema.Resource)
+	for _, r := range p.Resources() {
+		if r == nil {
+			return ErrBadRequest.Withf("provider %q: resource is nil", name)
+		}
+		if err := schema.ValidateName(r.Name()); err != nil {
+			return ErrBadRequest.Withf("provider %q resource name: %v", name, err)
+		}
+		namespaced := name + "_" + r.Name()
+		if _, exists := resources[namespaced]; exists {
+			return ErrConflict.Withf("provider %q: resource %q is provided more than once", name, r.Name())
+		}
+		if _, exists := m.resources[namespaced]; exists {
+			if owner := m.ownerOf(namespaced); owner != "" {
+				return ErrConflict.Withf("provider %q: resource %q is already registered by provider %q", name, namespaced, owner)
+			}
+			return ErrConflict.Withf("provider %q: resource %q is already registered", name, namespaced)
+		}
+		if err := validateAttributeNames(namespaced, r.Schema()); err != nil {
+			return err
+		}
+		if err := validatePatterns(namespaced, "", r.Schema()); err != nil {
+			return err
+		}
+		resources[namespaced] = namespacedResource{Resource: r, name: namespaced}
+	}
+
+	// Register the resource types
+	for namespaced, r := range resources {
+		m.resources[namespaced] = r
+	}
+	m.providers[name] = registeredProvider{
+		provider:  p,
+		resources: slices.Sorted(maps.Keys(resources)),
+	}
+
+	// Return success
+	return nil
+}
+
+// ListProviders returns the providers registered with
+// [Manager.RegisterProvider], in name order.
+func (m *Manager) ListProviders(ctx context.Context) (*schema.ListProvidersResponse, error) {
+	// Check context
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.RLock()
+	defer m.RUnlock()
+	providers := make([]schema.ProviderMeta, 0, len(m.providers))
+	for name, p := range m.providers {
+		meta := schema.ProviderMeta{
+			Name:        name,
+			Description: p.provider.Description(),
+			Resources:   p.resources,
+		}
+		if v, ok := p.provider.(interface{ Version() string }); ok {
+			meta.Version = v.Version()
+		}
+		providers = append(providers, meta)
+	}
+
+	// Sort providers by name for deterministic output
+	slices.SortFunc(providers, func(a, b schema.ProviderMeta) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return &schema.ListProvidersResponse{
+		Providers: providers,
+	}, nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS - NAMESPACED RESOURCE
+
+// Name returns the namespaced name of the resource type.
+func (r namespacedResource) Name() string {
+	return r.name
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// ownerOf returns the name of the registered provider with the named
+// resource type, or an empty string if it was registered on its own.
+// The caller must hold m.RLock().
+func (m *Manager) ownerOf(resource string) string {
+	for name, p := range m.providers {
+		if slices.Contains(p.resources, resource) {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,159 @@
+package provider_test
+
+import (
+	"context"
+	"testing"
+
+	// Packages
+	provider "github.com/mutablelogic/go-server/pkg/provider"
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+	store "github.com/mutablelogic/go-server/pkg/provider/store"
+	types "github.com/mutablelogic/go-server/pkg/types"
+	assert "github.com/stretchr/testify/assert"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// MOCK TYPES
+
+// pluginProvider is a provider with a fixed set of resource types, as
+// returned by a plugin.
+type pluginProvider struct {
+	name      string
+	resources []schema.Resource
+}
+
+func (p pluginProvider) Name() string                 { return p.name }
+func (p pluginProvider) Description() string          { return "plugin " + p.name }
+func (p pluginProvider) Version() string              { return "1.0.0" }
+func (p pluginProvider) Resources() []schema.Resource { return p.resources }
+
+// renamedResource is a resource type with another name.
+type renamedResource struct {
+	schema.Resource
+	name string
+}
+
+func (r renamedResource) Name() string { return r.name }
+
+///////////////////////////////////////////////////////////////////////////////
+// TESTS - PROVIDERS
+
+func Test_Manager_Providers_001(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	mgr, err := provider.New("test", "test provider", "0.0.1")
+	if !assert.NoError(err) {
+		return
+	}
+	t.Cleanup(func() { _ = mgr.Close(ctx) })
+
+	// The resource types of each provider are namespaced by its name
+	assert.NoError(mgr.RegisterProvider(pluginProvider{name: "a", resources: []schema.Resource{secretConfig{}, diskConfig{}}}))
+	assert.NoError(mgr.RegisterProvider(pluginProvider{name: "b", resources: []schema.Resource{secretConfig{}}}))
+	resp, err := mgr.ListProviders(ctx)
+	if assert.NoError(err) {
+		assert.Equal([]schema.ProviderMeta{
+			{Name: "a", Description: "plugin a", Version: "1.0.0", Resources: []string{"a_disk", "a_secret"}},
+			{Name: "b", Description: "plugin b", Version: "1.0.0", Resources: []string{"b_secret"}},
+		}, resp.Providers)
+	}
+	list, err := mgr.ListResources(ctx, schema.ListResourcesRequest{})
+	if assert.NoError(err) {
+		names := make([]string, 0, len(list.Resources))
+		for _, r := range list.Resources {
+			names = append(names, r.Name)
+		}
+		assert.Equal([]string{"a_disk", "a_secret", "b_secret"}, names)
+	}
+}
+
+func Test_Manager_Providers_002(t *testing.T) {
+	assert := assert.New(t)
+	mgr, err := provider.New("test", "test provider", "0.0.1")
+	if !assert.NoError(err) {
+		return
+	}
+	t.Cleanup(func() { _ = mgr.Close(context.Background()) })
+	assert.NoError(mgr.RegisterProvider(pluginProvider{name: "a_b", resources: []schema.Resource{secretConfig{}}}))
+
+	// A provider can only be registered once
+	err = mgr.RegisterProvider(pluginProvider{name: "a_b"})
+	assert.ErrorIs(err, provider.ErrConflict)
+
+	// A namespaced name in use by another provider is a conflict, and none
+	// of the resource types of the provider are registered
+	err = mgr.RegisterProvider(pluginProvider{name: "a", resources: []schema.Resource{diskConfig{}, renamedResource{Resource: secretConfig{}, name: "b_secret"}}})
+	if assert.ErrorIs(err, provider.ErrConflict) {
+		assert.Contains(err.Error(), `"a_b_secret" is already registered by provider "a_b"`)
+	}
+	_, err = mgr.ListResources(context.Background(), schema.ListResourcesRequest{Type: types.Ptr("a_disk")})
+	assert.ErrorIs(err, provider.ErrBadRequest)
+
+	// As is a name registered on its own, or a name provided twice
+	assert.NoError(mgr.RegisterResource(renamedResource{Resource: diskConfig{}, name: "c_disk"}))
+	err = mgr.RegisterProvider(pluginProvider{name: "c", resources: []schema.Resource{diskConfig{}}})
+	if assert.ErrorIs(err, provider.ErrConflict) {
+		assert.Contains(err.Error(), `"c_disk" is already registered`)
+	}
+	err = mgr.RegisterProvider(pluginProvider{name: "d", resources: []schema.Resource{diskConfig{}, diskConfig{}}})
+	assert.ErrorIs(err, provider.ErrConflict)
+
+	// Provider names must be valid
+	assert.ErrorIs(mgr.RegisterProvider(pluginProvider{name: "not.valid"}), provider.ErrBadRequest)
+	assert.ErrorIs(mgr.RegisterProvider(nil), provider.ErrBadRequest)
+}
+
+func Test_Manager_Providers_003(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	st := store.NewMemory()
+	mgr, err := provider.New("test", "test provider", "0.0.1", provider.WithStateStore(st))
+	if !assert.NoError(err) {
+		return
+	}
+	t.Cleanup(func() { _ = mgr.Close(ctx) })
+	assert.NoError(mgr.RegisterProvider(pluginProvider{name: "p", resources: []schema.Resource{secretConfig{}}}))
+
+	// Instances of namespaced resource types are named, listed and
+	// persisted by the namespaced name
+	assert.NoError(applySecret(t, mgr, "p_secret.a", schema.State{"port": 1}))
+	assert.NoError(applySecret(t, mgr, "p_secret.b", schema.State{"port": 2, "dep": "p_secret.a"}))
+	resp, err := mgr.GetResourceInstance(ctx, "p_secret.b")
+	if assert.NoError(err) {
+		assert.Equal("p_secret", resp.Instance.Resource)
+		assert.Equal([]string{"p_secret.a"}, resp.Instance.References)
+	}
+	list, err := mgr.ListResources(ctx, schema.ListResourcesRequest{Type: types.Ptr("p_secret")})
+	if assert.NoError(err) && assert.Len(list.Resources, 1) {
+		assert.Len(list.Resources[0].Instances, 2)
+	}
+
+	// And restored
+	restored, err := provider.New("test", "test provider", "0.0.1", provider.WithStateStore(st))
+	if !assert.NoError(err) {
+		return
+	}
+	t.Cleanup(func() { _ = restored.Close(ctx) })
+	assert.NoError(restored.RegisterProvider(pluginProvider{name: "p", resources: []schema.Resource{secretConfig{}}}))
+	assert.NoError(restored.Restore(ctx))
+	resp, err = restored.GetResourceInstance(ctx, "p_secret.b")
+	if assert.NoError(err) {
+		assert.Equal(uint64(1), resp.Instance.Generation)
+	}
+}
+
+func Test_Manager_Providers_004(t *testing.T) {
+	assert := assert.New(t)
+	mgr, err := provider.New("test", "test provider", "0.0.1")
+	if !assert.NoError(err) {
+		return
+	}
+	t.Cleanup(func() { _ = mgr.Close(context.Background()) })
+
+	// An invalid pattern is rejected when the provider is registered, and
+	// none of its resource types are registered
+	err = mgr.RegisterProvider(pluginProvider{name: "p", resources: []schema.Resource{secretConfig{}, badPatternConfig{}}})
+	assert.ErrorIs(err, provider.ErrBadRequest)
+	assert.ErrorContains(err, "rule")
+	assert.Empty(mgr.Resources())
+}
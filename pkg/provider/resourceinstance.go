@@ -21,7 +21,10 @@ type ObserverFunc func(source schema.ResourceInstance)
 
 // Observable is optionally satisfied by resource instances that
 // support state-change observer registration. All types that embed
-// [ResourceInstance] automatically implement this interface.
+// [ResourceInstance] automatically implement this interface. The manager
+// serialises the OnStateChange and OnStateRemove callbacks of dependency
+// instances, even when the instances which reference them are applied or
+// destroyed concurrently.
 type Observable interface {
 	AddObserver(id string, fn ObserverFunc)
 	RemoveObserver(id string)
@@ -119,19 +122,20 @@ func (b *ResourceInstance[C]) RemoveObserver(id string) {
 }
 
 // Validate decodes incoming [schema.State] into a *C, resolves
-// references via resolve, and checks required/type constraints.
+// references via resolve, and checks required, type, enum, range and
+// pattern constraints.
+// Every failure is collected into a single [schema.ValidationError].
 // Concrete Validate methods should call this first, then add
 // resource-specific checks.
 func (b *ResourceInstance[C]) Validate(_ context.Context, state schema.State, resolve schema.Resolver) (any, error) {
 	var desired C
-	if err := state.Decode(&desired, resolve); err != nil {
-		return nil, httpresponse.ErrBadRequest.Withf("invalid state: %v", err)
-	}
-	if err := schema.ValidateRefs(desired); err != nil {
-		return nil, httpresponse.ErrBadRequest.With(err.Error())
-	}
-	if err := schema.ValidateRequired(desired); err != nil {
-		return nil, httpresponse.ErrBadRequest.With(err.Error())
+	verr := new(schema.ValidationError)
+	verr.Join("", state.Decode(&desired, resolve))
+	verr.Join("", schema.ValidateRefs(desired))
+	verr.Join("", schema.ValidateRequired(desired))
+	verr.Join("", schema.ValidateConstraints(desired, state))
+	if err := verr.Err(); err != nil {
+		return nil, err
 	}
 	return &desired, nil
 }
@@ -160,11 +164,22 @@ func (b *ResourceInstance[C]) PlanConfig(ctx context.Context, v any, fn func(con
 		return schema.Plan{Action: schema.ActionCreate, Changes: changes}, nil
 	}
 
-	// Compare each desired field against the current state
+	// Compare each desired field against the current state, and each
+	// element of a block against the matching current element
+	blocks := make(map[string]schema.Attribute)
+	for _, attr := range b.resource.Schema() {
+		if len(attr.Attributes) > 0 {
+			blocks[attr.Name] = attr
+		}
+	}
 	oldState := schema.WritableStateOf(current)
 	var changes []schema.Change
 	for field, newVal := range newState {
 		oldVal := oldState[field]
+		if attr, exists := blocks[field]; exists {
+			changes = append(changes, schema.DiffBlocks(attr, oldVal, newVal)...)
+			continue
+		}
 		if !reflect.DeepEqual(oldVal, newVal) {
 			changes = append(changes, schema.Change{
 				Field: field,
@@ -202,6 +217,21 @@ func (b *ResourceInstance[C]) ApplyConfig(ctx context.Context, v any, fn func(co
 	return nil
 }
 
+// ImportConfig is a helper for concrete types which satisfy
+// [schema.Importable].  The callback returns the configuration of the
+// existing resource identified by id, which is stored as though it had
+// been applied, and the state of the configuration is returned.
+func (b *ResourceInstance[C]) ImportConfig(ctx context.Context, id string, fn func(context.Context, string) (*C, error)) (schema.State, error) {
+	c, err := fn(ctx, id)
+	if err != nil {
+		return nil, err
+	} else if c == nil {
+		return nil, httpresponse.ErrNotFound.Withf("import: %q not found", id)
+	}
+	b.state.Store(c)
+	return schema.StateOf(c), nil
+}
+
 // Plan satisfies [schema.ResourceInstance].  It computes the diff between
 // the validated configuration v (which must be *C) and the instance's
 // current applied state.
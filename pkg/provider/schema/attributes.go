@@ -1,11 +1,15 @@
 package schema
 
 import (
-	"errors"
 	"fmt"
 	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 )
 
 ///////////////////////////////////////////////////////////////////////////////
@@ -17,7 +21,9 @@ type Attribute struct {
 	Name string `json:"name"`
 
 	// Type is the value type (e.g. "string", "int", "bool", "duration",
-	// "[]string").
+	// "[]string", or "[]object" for a block). For a reference, it is the
+	// referenced resource type (e.g. "httpserver" or "[]httpserver"), or
+	// "ref" when any resource type may be referenced.
 	Type string `json:"type"`
 
 	// Description is a human-readable explanation of the field.
@@ -41,11 +47,39 @@ type Attribute struct {
 	// Reference indicates this attribute is a dependency on another
 	// resource instance, resolved by name at decode time.
 	Reference bool `json:"reference,omitempty"`
+
+	// Enum lists the permitted values, in their string form. Each element
+	// of a list must be one of them.
+	Enum []string `json:"enum,omitempty"`
+
+	// Min and Max bound the value of a number, or the length of a string.
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+
+	// Pattern is a regular expression which a string, or each string in a
+	// list, must match.
+	Pattern string `json:"pattern,omitempty"`
+
+	// MinItems and MaxItems bound the number of elements of a list or map.
+	MinItems *int `json:"min_items,omitempty"`
+	MaxItems *int `json:"max_items,omitempty"`
+
+	// Attributes describes each element of a block: a list of objects,
+	// decoded into a slice of structs. It is empty for other attributes.
+	Attributes []Attribute `json:"attributes,omitempty"`
+
+	// Key names the attribute which identifies each element of a block, so
+	// that changes to the block are planned by key rather than by index.
+	Key string `json:"key,omitempty"`
 }
 
 ///////////////////////////////////////////////////////////////////////////////
 // GLOBALS
 
+// patterns caches the result of compiling each pattern:"" tag, by pattern,
+// so that it is compiled once rather than on every validation.
+var patterns sync.Map
+
 // reservedNames are names that must not be used as attribute or resource
 // names because they clash with Terraform or HCL reserved identifiers.
 var reservedNames = map[string]bool{
@@ -114,8 +148,17 @@ func ValidateName(name string) error {
 //   - type:"<type>" — overrides the inferred type string (e.g. "file", "url")
 //   - sensitive:"" — marks the field as containing secrets; values are redacted
 //     in plan output, logs and state serialisation
+//   - enum:"<a>,<b>,..." — comma-separated list of permitted values
+//   - min:"<n>" and max:"<n>" — bounds on the value of a number, the length
+//     of a string, or the number of elements of a list or map
+//   - pattern:"<regexp>" — regular expression a string must match
 //   - embed:"" with prefix:"<prefix>" — flatten nested struct, prepending prefix
 //     to all child attribute names
+//   - key:"<name>" — on a block, the attribute which identifies each element
+//
+// A field which is a slice of structs is a block: a list of objects, each
+// described by the struct tags of the struct. A block which contains a
+// sensitive attribute is itself sensitive.
 func AttributesOf(resource any) []Attribute {
 	rv := reflect.ValueOf(resource)
 	if rv.Kind() == reflect.Ptr {
@@ -157,10 +200,13 @@ func structAttributes(t reflect.Type, prefix string) []Attribute {
 		// Prepend the prefix to the attribute name
 		name = prefix + name
 
-		// Determine the type string
+		// Determine the type string. For a list of references, the type
+		// tag names the referenced resource type of each element.
 		typeName := field.Tag.Get("type")
 		if typeName == "" {
 			typeName = goTypeString(field.Type)
+		} else if field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.Interface {
+			typeName = "[]" + typeName
 		}
 
 		// Build the attribute
@@ -177,12 +223,91 @@ func structAttributes(t reflect.Type, prefix string) []Attribute {
 		if hasDef {
 			attr.Default = def
 		}
+		applyConstraints(&attr, field)
+
+		// Describe the elements of a block
+		if isBlock(field.Type) {
+			attr.Attributes = structAttributes(blockType(field.Type), "")
+			attr.Key = field.Tag.Get("key")
+			attr.Sensitive = attr.Sensitive || slices.ContainsFunc(attr.Attributes, func(a Attribute) bool {
+				return a.Sensitive
+			})
+		}
 
 		attrs = append(attrs, attr)
 	}
 	return attrs
 }
 
+// applyConstraints sets the enum, min, max and pattern constraints of the
+// attribute from the struct tags of the field. Bounds which cannot be
+// parsed, or which do not apply to the type of the field, are ignored.
+func applyConstraints(attr *Attribute, field reflect.StructField) {
+	t := field.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if enum := field.Tag.Get("enum"); enum != "" {
+		for _, v := range strings.Split(enum, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				attr.Enum = append(attr.Enum, v)
+			}
+		}
+	}
+	if attr.Pattern = field.Tag.Get("pattern"); attr.Pattern != "" {
+		compilePattern(attr.Pattern)
+	}
+	if v := field.Tag.Get("min"); v != "" {
+		attr.Min, attr.MinItems = parseBound(t, v)
+	}
+	if v := field.Tag.Get("max"); v != "" {
+		attr.Max, attr.MaxItems = parseBound(t, v)
+	}
+}
+
+// compilePattern returns the compiled pattern, or an error if it is not a
+// valid regular expression. The result is cached.
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	type compiled struct {
+		re  *regexp.Regexp
+		err error
+	}
+	if v, ok := patterns.Load(pattern); ok {
+		return v.(compiled).re, v.(compiled).err
+	}
+	re, err := regexp.Compile(pattern)
+	patterns.Store(pattern, compiled{re, err})
+	return re, err
+}
+
+// parseBound parses a min or max tag value, returning a bound on the value
+// or length for numbers and strings, or a bound on the number of elements
+// for lists and maps.
+func parseBound(t reflect.Type, v string) (*float64, *int) {
+	switch {
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Map:
+		if n, err := strconv.Atoi(v); err == nil {
+			return nil, &n
+		}
+	case t.Kind() == reflect.String || (isNumericKind(t.Kind()) && t != durationType):
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return &f, nil
+		}
+	}
+	return nil, nil
+}
+
+// isNumericKind reports whether k is an integer or floating point kind.
+func isNumericKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
 // goTypeString returns a human-readable type name for a reflect.Type.
 func goTypeString(t reflect.Type) string {
 	// Check for well-known types
@@ -215,6 +340,8 @@ func goTypeString(t reflect.Type) string {
 		return "map[" + goTypeString(t.Key()) + "]" + goTypeString(t.Elem())
 	case reflect.Interface:
 		return "ref"
+	case reflect.Struct:
+		return "object"
 	default:
 		return t.String()
 	}
@@ -236,7 +363,8 @@ func hasTag(tag reflect.StructTag, key string) bool {
 //   - required:"" — the reference must be non-nil
 //   - type:"<name>" — the referenced instance's [Resource.Name] must match
 //
-// It returns a combined error for all failing fields, or nil if valid.
+// It returns a [ValidationError] listing every failing field, or nil if
+// valid.
 func ValidateRefs(resource any) error {
 	rv := reflect.ValueOf(resource)
 	if rv.Kind() == reflect.Ptr {
@@ -245,7 +373,9 @@ func ValidateRefs(resource any) error {
 	if rv.Kind() != reflect.Struct {
 		return nil
 	}
-	return validateRefs(rv, "")
+	verr := new(ValidationError)
+	validateRefs(rv, "", verr)
+	return verr.Err()
 }
 
 ///////////////////////////////////////////////////////////////////////////////
@@ -308,6 +438,14 @@ func referencesOf(rv reflect.Value, refs *[]string) {
 					*refs = append(*refs, ri.Name())
 				}
 			}
+			continue
+		}
+
+		// Block field — the references of each element
+		if isBlock(field.Type) {
+			eachBlock(rv.Field(i), func(_ int, elem reflect.Value) {
+				referencesOf(elem, refs)
+			})
 		}
 	}
 }
@@ -319,6 +457,13 @@ func referencesOf(rv reflect.Value, refs *[]string) {
 func ReferencesFromState(attrs []Attribute, state State) []string {
 	var refs []string
 	for _, attr := range attrs {
+		if len(attr.Attributes) > 0 {
+			elems, _ := blockStates(state[attr.Name])
+			for _, elem := range elems {
+				refs = append(refs, ReferencesFromState(attr.Attributes, elem)...)
+			}
+			continue
+		}
 		if !attr.Reference {
 			continue
 		}
@@ -343,9 +488,8 @@ func ReferencesFromState(attrs []Attribute, state State) []string {
 	return refs
 }
 
-func validateRefs(rv reflect.Value, prefix string) error {
+func validateRefs(rv reflect.Value, prefix string, verr *ValidationError) {
 	t := rv.Type()
-	var errs []error
 
 	for i := range t.NumField() {
 		field := t.Field(i)
@@ -358,9 +502,7 @@ func validateRefs(rv reflect.Value, prefix string) error {
 		// Handle structs with embed:"" tag — recurse with prefix
 		if field.Type.Kind() == reflect.Struct && hasTag(field.Tag, "embed") {
 			childPrefix := prefix + field.Tag.Get("prefix")
-			if err := validateRefs(rv.Field(i), childPrefix); err != nil {
-				errs = append(errs, err)
-			}
+			validateRefs(rv.Field(i), childPrefix, verr)
 			continue
 		}
 
@@ -376,7 +518,7 @@ func validateRefs(rv reflect.Value, prefix string) error {
 			v := rv.Field(i)
 			if v.IsNil() {
 				if hasTag(field.Tag, "required") {
-					errs = append(errs, fmt.Errorf("%s: required", name))
+					verr.Add(name, CodeRequired, "required")
 				}
 				continue
 			}
@@ -386,7 +528,7 @@ func validateRefs(rv reflect.Value, prefix string) error {
 			}
 			if ri, ok := v.Interface().(ResourceInstance); ok {
 				if gotType := ri.Resource().Name(); gotType != wantType {
-					errs = append(errs, fmt.Errorf("%s: must be of type %q, got %q", name, wantType, gotType))
+					verr.Add(name, CodeReference, "must be of type %q, got %q", wantType, gotType)
 				}
 			}
 			continue
@@ -397,7 +539,7 @@ func validateRefs(rv reflect.Value, prefix string) error {
 			slice := rv.Field(i)
 			if slice.Len() == 0 {
 				if hasTag(field.Tag, "required") {
-					errs = append(errs, fmt.Errorf("%s: required", name))
+					verr.Add(name, CodeRequired, "required")
 				}
 				continue
 			}
@@ -408,19 +550,26 @@ func validateRefs(rv reflect.Value, prefix string) error {
 			for j := range slice.Len() {
 				if ri, ok := slice.Index(j).Interface().(ResourceInstance); ok {
 					if gotType := ri.Resource().Name(); gotType != wantType {
-						errs = append(errs, fmt.Errorf("%s[%d]: must be of type %q, got %q", name, j, wantType, gotType))
+						verr.Add(fmt.Sprintf("%s[%d]", name, j), CodeReference, "must be of type %q, got %q", wantType, gotType)
 					}
 				}
 			}
+			continue
 		}
-	}
 
-	return errors.Join(errs...)
+		// Block field — validate the references of each element
+		if isBlock(field.Type) {
+			eachBlock(rv.Field(i), func(j int, elem reflect.Value) {
+				validateRefs(elem, blockPath(name, j, "")+".", verr)
+			})
+		}
+	}
 }
 
 // ValidateRequired checks that every field tagged required:"" (without a
 // default:"" tag) has a non-zero value.  Reference (interface) fields are
-// skipped — those are handled by [ValidateRefs].
+// skipped — those are handled by [ValidateRefs]. It returns a
+// [ValidationError] listing every failing field, or nil if valid.
 func ValidateRequired(resource any) error {
 	rv := reflect.ValueOf(resource)
 	if rv.Kind() == reflect.Ptr {
@@ -429,12 +578,13 @@ func ValidateRequired(resource any) error {
 	if rv.Kind() != reflect.Struct {
 		return nil
 	}
-	return validateRequired(rv, "")
+	verr := new(ValidationError)
+	validateRequired(rv, "", verr)
+	return verr.Err()
 }
 
-func validateRequired(rv reflect.Value, prefix string) error {
+func validateRequired(rv reflect.Value, prefix string, verr *ValidationError) {
 	t := rv.Type()
-	var errs []error
 
 	for i := range t.NumField() {
 		field := t.Field(i)
@@ -447,9 +597,7 @@ func validateRequired(rv reflect.Value, prefix string) error {
 		// Handle structs with embed:"" tag — recurse with prefix
 		if field.Type.Kind() == reflect.Struct && hasTag(field.Tag, "embed") {
 			childPrefix := prefix + field.Tag.Get("prefix")
-			if err := validateRequired(rv.Field(i), childPrefix); err != nil {
-				errs = append(errs, err)
-			}
+			validateRequired(rv.Field(i), childPrefix, verr)
 			continue
 		}
 
@@ -480,9 +628,169 @@ func validateRequired(rv reflect.Value, prefix string) error {
 
 		// Check required
 		if hasTag(field.Tag, "required") && rv.Field(i).IsZero() {
-			errs = append(errs, fmt.Errorf("%s: required", name))
+			verr.Add(name, CodeRequired, "required")
+		}
+
+		// Check the required attributes of each element of a block
+		if isBlock(field.Type) {
+			eachBlock(rv.Field(i), func(j int, elem reflect.Value) {
+				validateRequired(elem, blockPath(name, j, "")+".", verr)
+			})
 		}
 	}
 
-	return errors.Join(errs...)
+}
+
+// ValidateConstraints checks the value of every field against the
+// enum:"", min:"", max:"" and pattern:"" constraints in its struct tags, as
+// described by [AttributesOf]. A field is checked when it was set: when its
+// value is not zero, or when its attribute is present in state, which is
+// usually the state the resource was decoded from. Absent optional fields
+// are not checked; readonly and reference fields are skipped. It returns a
+// [ValidationError] listing every failing field, or nil if valid.
+func ValidateConstraints(resource any, state State) error {
+	rv := reflect.ValueOf(resource)
+	if rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+	verr := new(ValidationError)
+	validateConstraints(rv, "", "", state, verr)
+	return verr.Err()
+}
+
+// validateConstraints checks the fields of a struct, whose attributes are
+// looked up in state with the prefix, and reported with path and prefix.
+func validateConstraints(rv reflect.Value, path, prefix string, state State, verr *ValidationError) {
+	t := rv.Type()
+
+	for i := range t.NumField() {
+		field := t.Field(i)
+
+		// Skip unexported fields
+		if !field.IsExported() {
+			continue
+		}
+
+		// Handle structs with embed:"" tag — recurse with prefix
+		if field.Type.Kind() == reflect.Struct && hasTag(field.Tag, "embed") {
+			childPrefix := prefix + field.Tag.Get("prefix")
+			validateConstraints(rv.Field(i), path, childPrefix, state, verr)
+			continue
+		}
+
+		// Skip fields tagged name:"-" or with no name tag, and readonly fields
+		name, hasName := field.Tag.Lookup("name")
+		if !hasName || name == "-" || hasTag(field.Tag, "readonly") {
+			continue
+		}
+		key := prefix + name
+		name = path + key
+
+		// Skip unset fields: a zero value is checked only when present
+		v := rv.Field(i)
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				continue
+			}
+			v = v.Elem()
+		}
+		if v.IsZero() && state[key] == nil {
+			continue
+		}
+
+		// Check the constraints
+		var attr Attribute
+		applyConstraints(&attr, field)
+		switch v.Kind() {
+		case reflect.Interface:
+			continue
+		case reflect.Slice, reflect.Map:
+			if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Interface {
+				continue
+			}
+			if attr.MinItems != nil && v.Len() < *attr.MinItems {
+				verr.Add(name, CodeRange, "must have at least %d elements", *attr.MinItems)
+			}
+			if attr.MaxItems != nil && v.Len() > *attr.MaxItems {
+				verr.Add(name, CodeRange, "must have at most %d elements", *attr.MaxItems)
+			}
+			switch {
+			case isBlock(v.Type()):
+				elems, _ := blockStates(state[key])
+				validateBlocks(name, field.Tag.Get("key"), v, elems, verr)
+			case v.Kind() == reflect.Slice:
+				for j := range v.Len() {
+					validateElement(blockPath(name, j, ""), attr, v.Index(j), verr)
+				}
+			}
+		default:
+			validateElement(name, attr, v, verr)
+			if attr.Min == nil && attr.Max == nil {
+				continue
+			}
+			var n float64
+			var what string
+			switch {
+			case v.Kind() == reflect.String:
+				n, what = float64(utf8.RuneCountInString(v.String())), "length "
+			case v.CanInt():
+				n = float64(v.Int())
+			case v.CanUint():
+				n = float64(v.Uint())
+			case v.CanFloat():
+				n = v.Float()
+			default:
+				continue
+			}
+			if attr.Min != nil && n < *attr.Min {
+				verr.Add(name, CodeRange, "%smust be at least %v", what, *attr.Min)
+			}
+			if attr.Max != nil && n > *attr.Max {
+				verr.Add(name, CodeRange, "%smust be at most %v", what, *attr.Max)
+			}
+		}
+	}
+}
+
+// validateElement checks a single value, or an element of a list, against
+// the enum and pattern constraints of the attribute.
+func validateElement(name string, attr Attribute, v reflect.Value, verr *ValidationError) {
+	if len(attr.Enum) > 0 {
+		if value := fmt.Sprint(v.Interface()); !slices.Contains(attr.Enum, value) {
+			verr.Add(name, CodeEnum, "must be one of %q, got %q", attr.Enum, value)
+		}
+	}
+	if attr.Pattern != "" && v.Kind() == reflect.String {
+		re, err := compilePattern(attr.Pattern)
+		if err != nil {
+			verr.Add(name, CodeInvalid, "invalid pattern %q: %v", attr.Pattern, err)
+		} else if !re.MatchString(v.String()) {
+			verr.Add(name, CodePattern, "must match %q", attr.Pattern)
+		}
+	}
+}
+
+// validateBlocks checks the constraints of each element of a block against
+// the element states, and that the elements have distinct keys when the
+// block has a key.
+func validateBlocks(name, key string, v reflect.Value, elems []State, verr *ValidationError) {
+	seen := make(map[string]bool, v.Len())
+	eachBlock(v, func(j int, elem reflect.Value) {
+		var state State
+		if j < len(elems) {
+			state = elems[j]
+		}
+		validateConstraints(elem, blockPath(name, j, "")+".", "", state, verr)
+		if key == "" {
+			return
+		}
+		if k := blockKey(key, StateOf(elem.Interface())); seen[k] {
+			verr.Add(blockPath(name, j, key), CodeInvalid, "duplicate key %q", k)
+		} else {
+			seen[k] = true
+		}
+	})
 }
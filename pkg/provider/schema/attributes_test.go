@@ -478,3 +478,107 @@ func Test_ValidateName_013(t *testing.T) {
 	assert.Error(schema.ValidateName("endif"))
 	assert.Error(schema.ValidateName("endfor"))
 }
+
+///////////////////////////////////////////////////////////////////////////////
+// TESTS - CONSTRAINTS
+
+type constrainedResource struct {
+	Mode    string        `name:"mode" enum:"fast, slow" help:"Mode"`
+	Port    int           `name:"port" min:"1" max:"65535"`
+	Label   string        `name:"label" min:"2" max:"8" pattern:"^[a-z]+$"`
+	Tags    []string      `name:"tags" min:"1" max:"2" enum:"a,b,c"`
+	Timeout time.Duration `name:"timeout" min:"1" enum:"1s,5s"`
+	ID      string        `name:"id" readonly:"" enum:"x"`
+}
+
+func Test_Constraints_001(t *testing.T) {
+	assert := assert.New(t)
+
+	// Constraints are read from the struct tags
+	attrs := schema.AttributesOf(constrainedResource{})
+	byName := make(map[string]schema.Attribute, len(attrs))
+	for _, attr := range attrs {
+		byName[attr.Name] = attr
+	}
+	assert.Equal([]string{"fast", "slow"}, byName["mode"].Enum)
+	if assert.NotNil(byName["port"].Min) && assert.NotNil(byName["port"].Max) {
+		assert.Equal(1.0, *byName["port"].Min)
+		assert.Equal(65535.0, *byName["port"].Max)
+	}
+	if assert.NotNil(byName["label"].Min) {
+		assert.Equal(2.0, *byName["label"].Min)
+	}
+	assert.Equal("^[a-z]+$", byName["label"].Pattern)
+	assert.Nil(byName["tags"].Min)
+	if assert.NotNil(byName["tags"].MinItems) && assert.NotNil(byName["tags"].MaxItems) {
+		assert.Equal(1, *byName["tags"].MinItems)
+		assert.Equal(2, *byName["tags"].MaxItems)
+	}
+
+	// A duration has no numeric bound
+	assert.Nil(byName["timeout"].Min)
+	assert.Equal([]string{"1s", "5s"}, byName["timeout"].Enum)
+}
+
+func Test_Constraints_002(t *testing.T) {
+	assert := assert.New(t)
+
+	// Unset fields and valid values pass
+	assert.NoError(schema.ValidateConstraints(constrainedResource{}, nil))
+	assert.NoError(schema.ValidateConstraints(&constrainedResource{
+		Mode: "slow", Port: 8080, Label: "abc", Tags: []string{"a", "c"}, Timeout: 5 * time.Second, ID: "y",
+	}, nil))
+}
+
+func Test_Constraints_003(t *testing.T) {
+	assert := assert.New(t)
+
+	// Every failure is reported with its code
+	err := schema.ValidateConstraints(constrainedResource{
+		Mode: "medium", Port: 70000, Label: "A", Tags: []string{"a", "b", "d"}, Timeout: 2 * time.Second,
+	}, nil)
+	var verr *schema.ValidationError
+	if assert.ErrorAs(err, &verr) {
+		codes := make(map[string][]schema.ValidationCode)
+		for _, fe := range verr.Errors {
+			codes[fe.Attribute] = append(codes[fe.Attribute], fe.Code)
+		}
+		assert.Equal(map[string][]schema.ValidationCode{
+			"mode":    {schema.CodeEnum},
+			"port":    {schema.CodeRange},
+			"label":   {schema.CodePattern, schema.CodeRange},
+			"tags":    {schema.CodeRange},
+			"tags[2]": {schema.CodeEnum},
+			"timeout": {schema.CodeEnum},
+		}, codes)
+	}
+}
+
+func Test_Constraints_004(t *testing.T) {
+	assert := assert.New(t)
+
+	// Zero values present in the state are checked
+	state := schema.State{"mode": "", "port": 0, "label": "", "tags": []any{}, "timeout": "0s"}
+	var res constrainedResource
+	if !assert.NoError(state.Decode(&res, nil)) {
+		return
+	}
+	err := schema.ValidateConstraints(res, state)
+	var verr *schema.ValidationError
+	if assert.ErrorAs(err, &verr) {
+		codes := make(map[string][]schema.ValidationCode)
+		for _, fe := range verr.Errors {
+			codes[fe.Attribute] = append(codes[fe.Attribute], fe.Code)
+		}
+		assert.Equal(map[string][]schema.ValidationCode{
+			"mode":    {schema.CodeEnum},
+			"port":    {schema.CodeRange},
+			"label":   {schema.CodePattern, schema.CodeRange},
+			"tags":    {schema.CodeRange},
+			"timeout": {schema.CodeEnum},
+		}, codes)
+	}
+
+	// Absent fields are not checked
+	assert.NoError(schema.ValidateConstraints(constrainedResource{}, schema.State{"tags": nil}))
+}
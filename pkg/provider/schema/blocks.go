@@ -0,0 +1,214 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// DiffBlocks returns the changes between the old and new elements of a
+// block attribute, as stored in a [State]. Elements are matched by the
+// value of the attribute named by [Attribute.Key], or by index when the
+// block has no key. An added or removed element is a change of the whole
+// element, named "name[index]" or "name[key]"; each changed attribute of
+// a matched element is a change named "name[index].attribute", recursing
+// into nested blocks.
+func DiffBlocks(attr Attribute, old, new any) []Change {
+	oldElems, _ := blockStates(old)
+	newElems, _ := blockStates(new)
+	return diffBlocks(attr.Name, attr, oldElems, newElems)
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// isBlock reports whether t is a block: a slice of structs, or of pointers
+// to structs, each of which is decoded from a nested [State].
+func isBlock(t reflect.Type) bool {
+	if t.Kind() != reflect.Slice {
+		return false
+	}
+	elem := t.Elem()
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	return elem.Kind() == reflect.Struct && elem != timeType
+}
+
+// blockType returns the struct type of the elements of a block.
+func blockType(t reflect.Type) reflect.Type {
+	elem := t.Elem()
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	return elem
+}
+
+// blockPath returns the name of an attribute of the element at index j of
+// the named block, or of the element itself when attr is empty.
+func blockPath(name string, j int, attr string) string {
+	if attr == "" {
+		return fmt.Sprintf("%s[%d]", name, j)
+	}
+	return fmt.Sprintf("%s[%d].%s", name, j, attr)
+}
+
+// eachBlock calls fn with the index and struct value of each element of a
+// block, skipping nil pointers.
+func eachBlock(v reflect.Value, fn func(int, reflect.Value)) {
+	for j := range v.Len() {
+		elem := v.Index(j)
+		if elem.Kind() == reflect.Ptr {
+			if elem.IsNil() {
+				continue
+			}
+			elem = elem.Elem()
+		}
+		fn(j, elem)
+	}
+}
+
+// blockState returns the state of each element of a block, or nil if the
+// block is empty.
+func blockState(v reflect.Value, skipReadOnly bool) []State {
+	if v.Len() == 0 {
+		return nil
+	}
+	result := make([]State, v.Len())
+	eachBlock(v, func(j int, elem reflect.Value) {
+		result[j] = make(State)
+		collectState(elem, "", result[j], skipReadOnly)
+	})
+	return result
+}
+
+// blockStates returns the elements of a block value from a [State], which
+// is a []State when built by [StateOf] or a []any of objects when decoded
+// from JSON. It returns false if the value is not a list of objects.
+func blockStates(raw any) ([]State, bool) {
+	switch v := raw.(type) {
+	case []State:
+		return v, true
+	case []map[string]any:
+		result := make([]State, len(v))
+		for j, elem := range v {
+			result[j] = State(elem)
+		}
+		return result, true
+	case []any:
+		result := make([]State, len(v))
+		for j, elem := range v {
+			switch elem := elem.(type) {
+			case State:
+				result[j] = elem
+			case map[string]any:
+				result[j] = State(elem)
+			default:
+				return nil, false
+			}
+		}
+		return result, true
+	}
+	return nil, false
+}
+
+// decodeBlocks decodes each element of a block from the state value raw,
+// and sets dst to the result. Failures are reported against the attributes
+// of each element, as "name[index].attribute".
+func decodeBlocks(name string, raw any, dst reflect.Value, resolve Resolver, verr *ValidationError) {
+	if raw == nil {
+		return
+	}
+	elems, ok := blockStates(raw)
+	if !ok {
+		verr.Add(name, CodeType, "expected list of objects, got %T", raw)
+		return
+	}
+	result := reflect.MakeSlice(dst.Type(), len(elems), len(elems))
+	for j, elem := range elems {
+		v := result.Index(j)
+		if v.Kind() == reflect.Ptr {
+			v.Set(reflect.New(v.Type().Elem()))
+			v = v.Elem()
+		}
+		var eerr *ValidationError
+		if errors.As(elem.Decode(v.Addr().Interface(), resolve), &eerr) {
+			for _, fe := range eerr.Errors {
+				fe.Attribute = blockPath(name, j, fe.Attribute)
+				verr.Errors = append(verr.Errors, fe)
+			}
+		}
+	}
+	dst.Set(result)
+}
+
+// blockKey returns the key of an element of a block.
+func blockKey(key string, elem State) string {
+	return fmt.Sprint(elem[key])
+}
+
+func diffBlocks(name string, attr Attribute, old, new []State) []Change {
+	var changes []Change
+
+	// Without a key, match elements by index
+	if attr.Key == "" {
+		for j := range max(len(old), len(new)) {
+			path := blockPath(name, j, "")
+			switch {
+			case j >= len(old):
+				changes = append(changes, Change{Field: path, New: new[j]})
+			case j >= len(new):
+				changes = append(changes, Change{Field: path, Old: old[j]})
+			default:
+				changes = append(changes, diffElement(path, attr.Attributes, old[j], new[j])...)
+			}
+		}
+		return changes
+	}
+
+	// Match elements by key, in the new order, then report removed elements
+	// in the old order
+	oldByKey := make(map[string]State, len(old))
+	for _, elem := range old {
+		oldByKey[blockKey(attr.Key, elem)] = elem
+	}
+	seen := make(map[string]bool, len(new))
+	for _, elem := range new {
+		key := blockKey(attr.Key, elem)
+		seen[key] = true
+		path := fmt.Sprintf("%s[%q]", name, key)
+		if prev, exists := oldByKey[key]; exists {
+			changes = append(changes, diffElement(path, attr.Attributes, prev, elem)...)
+		} else {
+			changes = append(changes, Change{Field: path, New: elem})
+		}
+	}
+	for _, elem := range old {
+		if key := blockKey(attr.Key, elem); !seen[key] {
+			changes = append(changes, Change{Field: fmt.Sprintf("%s[%q]", name, key), Old: elem})
+		}
+	}
+	return changes
+}
+
+// diffElement returns the changes between two elements of a block, in
+// attribute order.
+func diffElement(path string, attrs []Attribute, old, new State) []Change {
+	var changes []Change
+	for _, attr := range attrs {
+		oldVal, newVal := old[attr.Name], new[attr.Name]
+		if len(attr.Attributes) > 0 {
+			oldElems, _ := blockStates(oldVal)
+			newElems, _ := blockStates(newVal)
+			changes = append(changes, diffBlocks(path+"."+attr.Name, attr, oldElems, newElems)...)
+			continue
+		}
+		if !reflect.DeepEqual(oldVal, newVal) {
+			changes = append(changes, Change{Field: path + "." + attr.Name, Old: oldVal, New: newVal})
+		}
+	}
+	return changes
+}
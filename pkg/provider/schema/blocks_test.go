@@ -0,0 +1,185 @@
+package schema_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	// Packages
+	"github.com/mutablelogic/go-server/pkg/provider/schema"
+	"github.com/mutablelogic/go-server/pkg/provider/schema/schematest"
+	"github.com/stretchr/testify/assert"
+)
+
+type routeRule struct {
+	Path       string                    `name:"path" required:""`
+	Methods    []string                  `name:"methods" enum:"GET,POST"`
+	Middleware []schema.ResourceInstance `name:"middleware" type:"middleware"`
+	Token      string                    `name:"token"`
+}
+
+type routerResource struct {
+	Prefix string      `name:"prefix"`
+	Routes []routeRule `name:"route" key:"path" max:"3"`
+}
+
+type secretRule struct {
+	Token string `name:"token" sensitive:""`
+}
+
+type indexedResource struct {
+	Rules []*secretRule `name:"rule"`
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// TESTS - BLOCKS
+
+func Test_Blocks_001(t *testing.T) {
+	assert := assert.New(t)
+
+	// A block is described by the attributes of its elements
+	attrs := schema.AttributesOf(routerResource{})
+	if assert.Len(attrs, 2) {
+		route := attrs[1]
+		assert.Equal("route", route.Name)
+		assert.Equal("[]object", route.Type)
+		assert.Equal("path", route.Key)
+		if assert.NotNil(route.MaxItems) {
+			assert.Equal(3, *route.MaxItems)
+		}
+		if assert.Len(route.Attributes, 4) {
+			assert.Equal("path", route.Attributes[0].Name)
+			assert.True(route.Attributes[0].Required)
+			assert.True(route.Attributes[2].Reference)
+		}
+		assert.False(route.Sensitive)
+	}
+
+	// A block with a sensitive attribute is sensitive
+	attrs = schema.AttributesOf(indexedResource{})
+	if assert.Len(attrs, 1) {
+		assert.True(attrs[0].Sensitive)
+	}
+}
+
+func Test_Blocks_002(t *testing.T) {
+	assert := assert.New(t)
+
+	// A block round-trips through JSON
+	mw := &schematest.ResourceInstance{N: "middleware.log", RN: "middleware"}
+	resolve := func(name string) schema.ResourceInstance {
+		if name == mw.N {
+			return mw
+		}
+		return nil
+	}
+	in := routerResource{Prefix: "/api", Routes: []routeRule{
+		{Path: "/a", Methods: []string{"GET"}, Middleware: []schema.ResourceInstance{mw}},
+		{Path: "/b"},
+	}}
+	data, err := json.Marshal(schema.StateOf(in))
+	assert.NoError(err)
+	var state schema.State
+	assert.NoError(json.Unmarshal(data, &state))
+	var out routerResource
+	if assert.NoError(state.Decode(&out, resolve)) {
+		assert.Equal(in, out)
+	}
+
+	// References are found in the elements of a block
+	assert.Equal([]string{"middleware.log"}, schema.ReferencesOf(out))
+	assert.Equal([]string{"middleware.log"}, schema.ReferencesFromState(schema.AttributesOf(out), state))
+}
+
+func Test_Blocks_003(t *testing.T) {
+	assert := assert.New(t)
+
+	// Decode failures are reported against each element
+	state := schema.State{"route": []any{
+		map[string]any{"path": "/a", "methods": 1},
+		map[string]any{"path": "/b", "bogus": true},
+	}}
+	var out routerResource
+	err := state.Decode(&out, nil)
+	var verr *schema.ValidationError
+	if assert.ErrorAs(err, &verr) && assert.Len(verr.Errors, 2) {
+		assert.Equal("route[0].methods", verr.Errors[0].Attribute)
+		assert.Equal(schema.CodeType, verr.Errors[0].Code)
+		assert.Equal("route[1].bogus", verr.Errors[1].Attribute)
+		assert.Equal(schema.CodeUnknown, verr.Errors[1].Code)
+	}
+
+	// A block must be a list of objects
+	err = schema.State{"route": []any{"/a"}}.Decode(&out, nil)
+	if assert.ErrorAs(err, &verr) && assert.Len(verr.Errors, 1) {
+		assert.Equal("route", verr.Errors[0].Attribute)
+		assert.Equal(schema.CodeType, verr.Errors[0].Code)
+	}
+}
+
+func Test_Blocks_004(t *testing.T) {
+	assert := assert.New(t)
+
+	// Each element is validated
+	res := routerResource{Routes: []routeRule{
+		{Path: "/a", Methods: []string{"PUT"}},
+		{},
+		{Path: "/a"},
+	}}
+	var verr *schema.ValidationError
+	if assert.ErrorAs(schema.ValidateRequired(res), &verr) && assert.Len(verr.Errors, 1) {
+		assert.Equal("route[1].path", verr.Errors[0].Attribute)
+	}
+	if assert.ErrorAs(schema.ValidateConstraints(res, nil), &verr) && assert.Len(verr.Errors, 2) {
+		assert.Equal("route[0].methods[0]", verr.Errors[0].Attribute)
+		assert.Equal(schema.CodeEnum, verr.Errors[0].Code)
+		assert.Equal("route[2].path", verr.Errors[1].Attribute)
+		assert.Contains(verr.Errors[1].Message, "duplicate key")
+	}
+
+	// A reference in an element is checked against its type
+	wrong := &schematest.ResourceInstance{N: "other.a", RN: "other"}
+	res = routerResource{Routes: []routeRule{{Path: "/a", Middleware: []schema.ResourceInstance{wrong}}}}
+	if assert.ErrorAs(schema.ValidateRefs(res), &verr) && assert.Len(verr.Errors, 1) {
+		assert.Equal("route[0].middleware[0]", verr.Errors[0].Attribute)
+	}
+}
+
+func Test_Blocks_005(t *testing.T) {
+	assert := assert.New(t)
+
+	// Elements of a keyed block are matched by key
+	attr := schema.AttributesOf(routerResource{})[1]
+	old := schema.StateOf(routerResource{Routes: []routeRule{
+		{Path: "/a", Token: "x"},
+		{Path: "/b"},
+	}})
+	new := schema.StateOf(routerResource{Routes: []routeRule{
+		{Path: "/c"},
+		{Path: "/a", Token: "y"},
+	}})
+	changes := schema.DiffBlocks(attr, old["route"], new["route"])
+	if assert.Len(changes, 3) {
+		assert.Equal(`route["/c"]`, changes[0].Field)
+		assert.Nil(changes[0].Old)
+		assert.Equal(schema.Change{Field: `route["/a"].token`, Old: "x", New: "y"}, changes[1])
+		assert.Equal(`route["/b"]`, changes[2].Field)
+		assert.Nil(changes[2].New)
+	}
+
+	// An unchanged block has no changes
+	assert.Empty(schema.DiffBlocks(attr, old["route"], old["route"]))
+}
+
+func Test_Blocks_006(t *testing.T) {
+	assert := assert.New(t)
+
+	// Elements of a block without a key are matched by index
+	attr := schema.AttributesOf(indexedResource{})[0]
+	old := schema.StateOf(indexedResource{Rules: []*secretRule{{Token: "a"}, {Token: "b"}}})
+	new := schema.StateOf(indexedResource{Rules: []*secretRule{{Token: "a"}, {Token: "c"}, {Token: "d"}}})
+	changes := schema.DiffBlocks(attr, old["rule"], new["rule"])
+	if assert.Len(changes, 2) {
+		assert.Equal(schema.Change{Field: "rule[1].token", Old: "b", New: "c"}, changes[0])
+		assert.Equal(schema.Change{Field: "rule[2]", New: schema.State{"token": "d"}}, changes[1])
+	}
+}
@@ -0,0 +1,80 @@
+package schema
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	// Packages
+	types "github.com/mutablelogic/go-server/pkg/types"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// EventType describes the kind of lifecycle change reported by an [Event].
+type EventType string
+
+const (
+	EventCreated   EventType = "created"   // instance created, not yet applied
+	EventPlanned   EventType = "planned"   // plan computed for an instance
+	EventApplied   EventType = "applied"   // configuration applied to an instance
+	EventImported  EventType = "imported"  // existing resource adopted by an instance
+	EventDestroyed EventType = "destroyed" // instance destroyed and removed
+	EventNotified  EventType = "notified"  // instance notified of a change to a dependent
+	EventDrift     EventType = "drift"     // live state differs from the applied state
+)
+
+// Event is a lifecycle change to a resource instance. Sensitive attribute
+// values in State and Plan are always redacted.
+type Event struct {
+	Type     EventType `json:"type"`
+	Time     time.Time `json:"time"`
+	Name     string    `json:"name"`             // instance name
+	Resource string    `json:"resource"`         // resource type name
+	Source   string    `json:"source,omitempty"` // for notified, the instance which changed
+	State    State     `json:"state,omitempty"`  // for created, applied, imported and destroyed
+	Plan     *Plan     `json:"plan,omitempty"`   // for planned and drift
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// EVENT STREAM
+
+// EventStreamRequest filters the events to stream. Empty filters match
+// every event.
+type EventStreamRequest struct {
+	Type *string `json:"type,omitempty" help:"Resource type name (e.g. \"httpserver\")"`                   // filter by resource type
+	Name *string `json:"name,omitempty" help:"Instance name as resource.label (e.g. \"httpserver.main\")"` // filter by instance name
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (e Event) String() string {
+	return types.Stringify(e)
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+func (r EventStreamRequest) Query() url.Values {
+	v := url.Values{}
+	if t := strings.TrimSpace(types.Value(r.Type)); t != "" {
+		v.Set("type", t)
+	}
+	if n := strings.TrimSpace(types.Value(r.Name)); n != "" {
+		v.Set("name", n)
+	}
+	return v
+}
+
+// Match reports whether the event passes the filters.
+func (r EventStreamRequest) Match(event Event) bool {
+	if t := strings.TrimSpace(types.Value(r.Type)); t != "" && t != event.Resource {
+		return false
+	}
+	if n := strings.TrimSpace(types.Value(r.Name)); n != "" && n != event.Name {
+		return false
+	}
+	return true
+}
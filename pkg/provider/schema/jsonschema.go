@@ -0,0 +1,197 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	// Packages
+	upstream "github.com/google/jsonschema-go/jsonschema"
+	jsonschema "github.com/mutablelogic/go-server/pkg/jsonschema"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// JSONSchema returns a JSON Schema for the attributes of a resource type,
+// describing the [State] which is accepted by [ResourceInstance.Validate],
+// with the resource type name as the title. Attribute constraints, defaults
+// and blocks are included. A reference is a string (or list of strings)
+// naming another instance, with the referenced resource type in the
+// "x-reference" keyword; sensitive attributes are marked "x-sensitive".
+func JSONSchema(title string, attrs []Attribute) (*jsonschema.Schema, error) {
+	s := objectSchema(attrs)
+	s.Title = title
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	return jsonschema.FromJSON(data)
+}
+
+// PatchJSONSchema returns a JSON Schema for the attributes of a resource
+// type in an update, which are merged with the current state of an
+// instance. It is the same as [JSONSchema] except that no attribute is
+// required, so that an update can set any subset of the attributes.
+// Attributes of blocks are still required, as a block is replaced as a
+// whole.
+func PatchJSONSchema(title string, attrs []Attribute) (*jsonschema.Schema, error) {
+	s := objectSchema(attrs)
+	s.Title = title
+	s.Required = nil
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	return jsonschema.FromJSON(data)
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// objectSchema returns the schema of an object with the given attributes,
+// which does not allow other properties.
+func objectSchema(attrs []Attribute) *upstream.Schema {
+	s := &upstream.Schema{
+		Type:                 "object",
+		Properties:           make(map[string]*upstream.Schema, len(attrs)),
+		AdditionalProperties: &upstream.Schema{Not: &upstream.Schema{}},
+	}
+	for _, attr := range attrs {
+		s.Properties[attr.Name] = attributeSchema(attr)
+		if attr.Required && !attr.ReadOnly {
+			s.Required = append(s.Required, attr.Name)
+		}
+	}
+	return s
+}
+
+// attributeSchema returns the schema of a single attribute.
+func attributeSchema(attr Attribute) *upstream.Schema {
+	var s *upstream.Schema
+	switch {
+	case len(attr.Attributes) > 0:
+		s = &upstream.Schema{Type: "array", Items: objectSchema(attr.Attributes)}
+	case attr.Reference:
+		ref, list := strings.CutPrefix(attr.Type, "[]")
+		s = &upstream.Schema{Type: "string"}
+		if list {
+			s = &upstream.Schema{Type: "array", Items: s}
+		}
+		if ref != "ref" {
+			setExtra(s, "x-reference", ref)
+		}
+	default:
+		s = typeSchema(attr.Type)
+	}
+	s.Description = attr.Description
+	s.ReadOnly = attr.ReadOnly
+	if attr.Sensitive {
+		setExtra(s, "x-sensitive", true)
+	}
+
+	// The number of elements bounds a list or map
+	switch s.Type {
+	case "array":
+		s.MinItems, s.MaxItems = attr.MinItems, attr.MaxItems
+	case "object":
+		s.MinProperties, s.MaxProperties = attr.MinItems, attr.MaxItems
+	}
+
+	// Other constraints apply to the value, or each element of a list
+	value := s
+	if s.Type == "array" && len(attr.Attributes) == 0 {
+		value = s.Items
+	}
+	for _, v := range attr.Enum {
+		value.Enum = append(value.Enum, typedValue(value.Type, v))
+	}
+	value.Pattern = attr.Pattern
+	switch value.Type {
+	case "string":
+		value.MinLength, value.MaxLength = intBound(attr.Min), intBound(attr.Max)
+	case "integer", "number":
+		value.Minimum, value.Maximum = attr.Min, attr.Max
+	}
+
+	// Set the default for scalar values
+	if attr.Default != nil && s.Type != "array" && s.Type != "object" {
+		if data, err := json.Marshal(typedValue(s.Type, fmt.Sprint(attr.Default))); err == nil {
+			s.Default = data
+		}
+	}
+
+	// Return the schema
+	return s
+}
+
+// typeSchema returns the schema for an attribute type string, as returned
+// by goTypeString. Types which are not known accept any value.
+func typeSchema(t string) *upstream.Schema {
+	if elem, ok := strings.CutPrefix(t, "[]"); ok {
+		return &upstream.Schema{Type: "array", Items: typeSchema(elem)}
+	}
+	if rest, ok := strings.CutPrefix(t, "map["); ok {
+		if _, elem, ok := strings.Cut(rest, "]"); ok {
+			return &upstream.Schema{Type: "object", AdditionalProperties: typeSchema(elem)}
+		}
+	}
+	switch t {
+	case "string":
+		return &upstream.Schema{Type: "string"}
+	case "bool":
+		return &upstream.Schema{Type: "boolean"}
+	case "int":
+		return &upstream.Schema{Type: "integer"}
+	case "uint":
+		return &upstream.Schema{Type: "integer", Minimum: new(float64)}
+	case "float":
+		return &upstream.Schema{Type: "number"}
+	case "duration":
+		return &upstream.Schema{Type: "string", Format: "duration"}
+	case "time":
+		return &upstream.Schema{Type: "string", Format: "date-time"}
+	case "object":
+		return &upstream.Schema{Type: "object"}
+	default:
+		return &upstream.Schema{}
+	}
+}
+
+// typedValue converts a value from a struct tag to the JSON type, returning
+// the string itself when it cannot be converted.
+func typedValue(t, v string) any {
+	switch t {
+	case "integer":
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return n
+		}
+	case "number":
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return v
+}
+
+// intBound returns a length bound as an integer, or nil.
+func intBound(f *float64) *int {
+	if f == nil {
+		return nil
+	}
+	n := int(*f)
+	return &n
+}
+
+// setExtra sets a keyword which is not part of JSON Schema.
+func setExtra(s *upstream.Schema, key string, value any) {
+	if s.Extra == nil {
+		s.Extra = make(map[string]any)
+	}
+	s.Extra[key] = value
+}
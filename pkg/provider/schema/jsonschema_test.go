@@ -0,0 +1,108 @@
+package schema_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	// Packages
+	"github.com/mutablelogic/go-server/pkg/provider/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TESTS - JSON SCHEMA
+
+func Test_JSONSchema_001(t *testing.T) {
+	assert := assert.New(t)
+
+	// Attributes are described with their types and constraints
+	s, err := schema.JSONSchema("constrained", schema.AttributesOf(constrainedResource{}))
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal("constrained", s.Title)
+	assert.Equal("object", s.Type)
+	if port := s.Properties["port"]; assert.NotNil(port) {
+		assert.Equal("integer", port.Type)
+		assert.Equal(1.0, *port.Minimum)
+		assert.Equal(65535.0, *port.Maximum)
+	}
+	if label := s.Properties["label"]; assert.NotNil(label) {
+		assert.Equal(2, *label.MinLength)
+		assert.Equal("^[a-z]+$", label.Pattern)
+	}
+	if tags := s.Properties["tags"]; assert.NotNil(tags) {
+		assert.Equal("array", tags.Type)
+		assert.Equal(2, *tags.MaxItems)
+		assert.Equal([]any{"a", "b", "c"}, tags.Items.Enum)
+	}
+	assert.Equal("duration", s.Properties["timeout"].Format)
+	assert.True(s.Properties["id"].ReadOnly)
+}
+
+func Test_JSONSchema_002(t *testing.T) {
+	assert := assert.New(t)
+
+	// References, defaults, sensitive values and blocks are described
+	s, err := schema.JSONSchema("httpserver", schema.AttributesOf(httpserverResource{}))
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal([]string{"router"}, s.Required)
+	if router := s.Properties["router"]; assert.NotNil(router) {
+		assert.Equal("string", router.Type)
+		assert.Equal("httprouter", router.Extra["x-reference"])
+	}
+	assert.JSONEq(`"5m"`, string(s.Properties["read_timeout"].Default))
+
+	s, err = schema.JSONSchema("router", schema.AttributesOf(routerResource{}))
+	if !assert.NoError(err) {
+		return
+	}
+	if route := s.Properties["route"]; assert.NotNil(route) && assert.NotNil(route.Items) {
+		assert.Equal("array", route.Type)
+		assert.Equal([]string{"path"}, route.Items.Required)
+		assert.Equal("middleware", route.Items.Properties["middleware"].Extra["x-reference"])
+	}
+}
+
+func Test_JSONSchema_003(t *testing.T) {
+	assert := assert.New(t)
+
+	// The schema validates state before it is sent
+	s, err := schema.JSONSchema("router", schema.AttributesOf(routerResource{}))
+	if !assert.NoError(err) {
+		return
+	}
+	valid, _ := json.Marshal(schema.State{"prefix": "/api", "route": []any{map[string]any{"path": "/a", "methods": []string{"GET"}}}})
+	assert.NoError(s.Validate(valid))
+	for _, state := range []schema.State{
+		{"bogus": true},
+		{"route": []any{map[string]any{"methods": []string{"GET"}}}},
+		{"route": []any{map[string]any{"path": "/a", "methods": []string{"PUT"}}}},
+	} {
+		invalid, _ := json.Marshal(state)
+		assert.Error(s.Validate(invalid), string(invalid))
+	}
+}
+
+func Test_JSONSchema_004(t *testing.T) {
+	assert := assert.New(t)
+
+	// The update schema does not require any attribute, except within
+	// blocks, which are replaced as a whole
+	s, err := schema.PatchJSONSchema("httpserver", schema.AttributesOf(httpserverResource{}))
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Empty(s.Required)
+	partial, _ := json.Marshal(schema.State{"read_timeout": "1m"})
+	assert.NoError(s.Validate(partial))
+	bogus, _ := json.Marshal(schema.State{"bogus": true})
+	assert.Error(s.Validate(bogus))
+
+	s, err = schema.PatchJSONSchema("router", schema.AttributesOf(routerResource{}))
+	if assert.NoError(err) && assert.NotNil(s.Properties["route"].Items) {
+		assert.Equal([]string{"path"}, s.Properties["route"].Items.Required)
+	}
+}
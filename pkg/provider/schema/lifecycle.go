@@ -0,0 +1,105 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Lifecycle holds the options which control how the manager changes an
+// instance, rather than the configuration of the instance itself. It is
+// named after the Terraform "lifecycle" meta-argument, which is why
+// "lifecycle" cannot be used as an attribute name.
+type Lifecycle struct {
+	// PreventDestroy refuses to destroy or replace the instance, including
+	// when it is destroyed as a dependent of another instance or pruned.
+	PreventDestroy bool `json:"prevent_destroy,omitempty"`
+
+	// CreateBeforeDestroy replaces the instance by applying a new instance
+	// and moving its dependents to it before the old instance is
+	// destroyed, rather than destroying the old instance first.
+	CreateBeforeDestroy bool `json:"create_before_destroy,omitempty"`
+
+	// IgnoreChanges lists attributes whose changes are not planned once the
+	// instance has been applied, and which are not reported as drift.
+	IgnoreChanges []string `json:"ignore_changes,omitempty"`
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+// LifecycleAttribute is the name of the meta-attribute which holds the
+// [Lifecycle] when it is given together with attribute values.
+const LifecycleAttribute = "lifecycle"
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// LifecycleOf removes the lifecycle meta-attribute from the state, and
+// returns the remaining attributes and the lifecycle, which is nil when the
+// meta-attribute is not set. The state is not modified.
+func LifecycleOf(state State) (State, *Lifecycle, error) {
+	value, exists := state[LifecycleAttribute]
+	if !exists {
+		return state, nil, nil
+	}
+
+	// Decode the lifecycle through JSON, so that it can be given as any
+	// map of values
+	var lifecycle Lifecycle
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, nil, NewValidationError(LifecycleAttribute, CodeType, "%v", err)
+	}
+	if err := json.Unmarshal(data, &lifecycle); err != nil {
+		return nil, nil, NewValidationError(LifecycleAttribute, CodeType, "%v", err)
+	}
+
+	// Return the other attributes
+	result := make(State, len(state)-1)
+	for k, v := range state {
+		if k != LifecycleAttribute {
+			result[k] = v
+		}
+	}
+	return result, &lifecycle, nil
+}
+
+// IsZero reports whether no lifecycle options are set.
+func (l Lifecycle) IsZero() bool {
+	return !l.PreventDestroy && !l.CreateBeforeDestroy && len(l.IgnoreChanges) == 0
+}
+
+// Equal reports whether the lifecycle options are the same as other.
+func (l Lifecycle) Equal(other Lifecycle) bool {
+	return l.PreventDestroy == other.PreventDestroy &&
+		l.CreateBeforeDestroy == other.CreateBeforeDestroy &&
+		slices.Equal(l.IgnoreChanges, other.IgnoreChanges)
+}
+
+// Ignores reports whether changes to the named attribute are ignored.
+func (l Lifecycle) Ignores(name string) bool {
+	return slices.Contains(l.IgnoreChanges, name)
+}
+
+// Validate checks that each attribute in IgnoreChanges is a writable
+// attribute in attrs.
+func (l Lifecycle) Validate(attrs []Attribute) error {
+	verr := new(ValidationError)
+	for i, name := range l.IgnoreChanges {
+		field := fmt.Sprintf("%s.ignore_changes[%d]", LifecycleAttribute, i)
+		idx := slices.IndexFunc(attrs, func(attr Attribute) bool {
+			return attr.Name == name
+		})
+		switch {
+		case idx < 0:
+			verr.Add(field, CodeUnknown, "unknown attribute %q", name)
+		case attrs[idx].ReadOnly:
+			verr.Add(field, CodeInvalid, "attribute %q is read-only", name)
+		}
+	}
+	return verr.Err()
+}
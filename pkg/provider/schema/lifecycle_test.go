@@ -0,0 +1,62 @@
+package schema_test
+
+import (
+	"testing"
+
+	"github.com/mutablelogic/go-server/pkg/provider/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_LifecycleOf_001(t *testing.T) {
+	assert := assert.New(t)
+	// Without the meta-attribute the state is returned unchanged
+	state := schema.State{"port": 1}
+	attrs, lifecycle, err := schema.LifecycleOf(state)
+	assert.NoError(err)
+	assert.Nil(lifecycle)
+	assert.Equal(state, attrs)
+}
+
+func Test_LifecycleOf_002(t *testing.T) {
+	assert := assert.New(t)
+	// The meta-attribute is decoded and removed from a copy of the state
+	state := schema.State{"port": 1, "lifecycle": map[string]any{
+		"prevent_destroy": true,
+		"ignore_changes":  []any{"port"},
+	}}
+	attrs, lifecycle, err := schema.LifecycleOf(state)
+	assert.NoError(err)
+	assert.Equal(schema.State{"port": 1}, attrs)
+	assert.Equal(&schema.Lifecycle{PreventDestroy: true, IgnoreChanges: []string{"port"}}, lifecycle)
+	assert.Contains(state, "lifecycle")
+}
+
+func Test_LifecycleOf_003(t *testing.T) {
+	assert := assert.New(t)
+	// A meta-attribute which is not an object is a validation error
+	_, _, err := schema.LifecycleOf(schema.State{"lifecycle": "yes"})
+	assert.Error(err)
+	var verr *schema.ValidationError
+	assert.ErrorAs(err, &verr)
+}
+
+func Test_Lifecycle_Validate_001(t *testing.T) {
+	assert := assert.New(t)
+	attrs := []schema.Attribute{{Name: "port"}, {Name: "id", ReadOnly: true}}
+	// Ignored attributes must be known and writable
+	assert.NoError(schema.Lifecycle{IgnoreChanges: []string{"port"}}.Validate(attrs))
+	err := schema.Lifecycle{IgnoreChanges: []string{"port", "id", "missing"}}.Validate(attrs)
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "lifecycle.ignore_changes[1]")
+		assert.Contains(err.Error(), "lifecycle.ignore_changes[2]")
+	}
+}
+
+func Test_Lifecycle_Equal_001(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(schema.Lifecycle{}.IsZero())
+	assert.True(schema.Lifecycle{}.Equal(schema.Lifecycle{IgnoreChanges: []string{}}))
+	assert.False(schema.Lifecycle{PreventDestroy: true}.Equal(schema.Lifecycle{}))
+	assert.True(schema.Lifecycle{IgnoreChanges: []string{"port"}}.Ignores("port"))
+	assert.False(schema.Lifecycle{IgnoreChanges: []string{"port"}}.Ignores("id"))
+}
@@ -0,0 +1,32 @@
+package schema
+
+import (
+	// Packages
+	types "github.com/mutablelogic/go-server/pkg/types"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// LIST PROVIDERS
+
+// ListProvidersResponse contains the providers, such as plugins, whose
+// resource types have been registered with the manager.
+type ListProvidersResponse struct {
+	Providers []ProviderMeta `json:"providers"`
+}
+
+// ProviderMeta describes a registered provider. Resources are the names
+// of its resource types as registered, which are prefixed with the name
+// of the provider.
+type ProviderMeta struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Version     string   `json:"version,omitempty"`
+	Resources   []string `json:"resources"`
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (r ListProvidersResponse) String() string {
+	return types.Stringify(r)
+}
@@ -1,7 +1,10 @@
 package schema
 
 import (
+	"fmt"
 	"net/url"
+	"slices"
+	"strconv"
 	"strings"
 
 	// Packages
@@ -33,11 +36,13 @@ type ResourceMeta struct {
 
 // InstanceMeta describes a resource instance without exposing the full interface.
 type InstanceMeta struct {
-	Name       string   `json:"name"`
-	Resource   string   `json:"resource"`
-	ReadOnly   bool     `json:"readonly,omitempty"`
-	State      State    `json:"state,omitempty"`
-	References []string `json:"references,omitempty"`
+	Name       string     `json:"name"`
+	Resource   string     `json:"resource"`
+	Generation uint64     `json:"generation"` // bumped on every apply, zero if never applied
+	ReadOnly   bool       `json:"readonly,omitempty"`
+	State      State      `json:"state,omitempty"`
+	References []string   `json:"references,omitempty"`
+	Lifecycle  *Lifecycle `json:"lifecycle,omitempty"` // lifecycle options, nil if none are set
 }
 
 ///////////////////////////////////////////////////////////////////////////////
@@ -67,26 +72,56 @@ type GetResourceInstanceResponse struct {
 // UpdateResourceInstanceRequest is the unified request for plan or apply.
 // When Apply is false (the default), only a plan is computed. When true,
 // the planned changes are applied. Attributes contains the desired attribute
-// values keyed by attribute name.
+// values keyed by attribute name. When Generation is set, the request fails
+// unless the instance is still at that generation; over HTTP it is sent as
+// an If-Match header. When IfMatch is set, the request fails unless the
+// instance exists and matches it.
+//
+// To apply exactly a plan which was reviewed earlier, set PlanID to the ID
+// returned with the plan and Apply to true, without Attributes. The request
+// fails if the instance or the resolved configuration has changed since.
+//
+// When Replace is true, a new instance is created with the desired
+// attributes in place of the existing one, and the instances which depend
+// on it are re-applied so that they reference the new instance. The old
+// instance is destroyed first, unless its lifecycle sets
+// CreateBeforeDestroy. A replacement plan has no ID.
+//
+// When Type is set, the request fails unless the instance is of that
+// resource type. It selects the schema of the attributes in the OpenAPI
+// specification.
 type UpdateResourceInstanceRequest struct {
-	Attributes State `json:"attributes,omitempty"` // desired attribute values
-	Apply      bool  `json:"apply"`                // false = plan only, true = apply changes
+	Type       string     `json:"type,omitempty"`       // resource type of the instance, checked when set
+	Attributes State      `json:"attributes,omitempty"` // desired attribute values
+	Lifecycle  *Lifecycle `json:"lifecycle,omitempty"`  // lifecycle options, nil to keep the current options
+	Apply      bool       `json:"apply"`                // false = plan only, true = apply changes
+	Replace    bool       `json:"replace,omitempty"`    // replace the instance rather than update it
+	PlanID     string     `json:"plan_id,omitempty"`    // apply a saved plan
+	Generation *uint64    `json:"-"`                    // expected generation
+	IfMatch    *IfMatch   `json:"-"`                    // If-Match precondition
 }
 
 // UpdateResourceInstanceResponse contains the instance metadata, the computed
-// plan, and (when apply was requested) the resulting state.
+// plan, and (when apply was requested) the resulting state. PlanID is an
+// opaque identifier for the plan, which can be used to apply it later.
 type UpdateResourceInstanceResponse struct {
 	Instance InstanceMeta `json:"instance"`
 	Plan     Plan         `json:"plan"`
+	PlanID   string       `json:"plan_id,omitempty"`
 }
 
 ///////////////////////////////////////////////////////////////////////////////
 // DESTROY RESOURCE INSTANCE
 
 // DestroyResourceInstanceRequest asks the manager to tear down an instance.
+// When Generation is set, the request fails unless the instance is still at
+// that generation; over HTTP it is sent as an If-Match header. When IfMatch
+// is set, the request fails unless the instance exists and matches it.
 type DestroyResourceInstanceRequest struct {
-	Name    string `json:"name"`              // instance name
-	Cascade bool   `json:"cascade,omitempty"` // also destroy dependents in topological order
+	Name       string   `json:"name"`              // instance name
+	Cascade    bool     `json:"cascade,omitempty"` // also destroy dependents in topological order
+	Generation *uint64  `json:"-"`                 // expected generation
+	IfMatch    *IfMatch `json:"-"`                 // If-Match precondition
 }
 
 // DestroyResourceInstanceResponse confirms destruction and returns the
@@ -95,6 +130,79 @@ type DestroyResourceInstanceResponse struct {
 	Instances []InstanceMeta `json:"instances"`
 }
 
+// IfMatch is the precondition of an If-Match header (RFC 9110 section
+// 13.1.1). The instance must exist and, unless Any is set, be at one of
+// Generations.
+type IfMatch struct {
+	Any         bool     // "*" matches any generation
+	Generations []uint64 // generations of the strong entity tags
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// IMPORT RESOURCE INSTANCE
+
+// ImportResourceInstanceRequest asks the manager to create an instance which
+// adopts an existing resource. The format of ID is defined by the resource
+// type.
+type ImportResourceInstanceRequest struct {
+	ID string `json:"id" arg:"" help:"Identifier of the existing resource, as understood by the resource type"`
+}
+
+// ImportResourceInstanceResponse contains the metadata of the imported
+// instance.
+type ImportResourceInstanceResponse struct {
+	Instance InstanceMeta `json:"instance"`
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// APPLY CONFIG
+
+// ApplyConfigRequest is a complete desired set of instances. When Apply is
+// false (the default), only a combined plan is computed. When Prune is true,
+// instances which are not in the document are destroyed.
+type ApplyConfigRequest struct {
+	Instances []InstanceConfig `json:"instances"`       // desired instances
+	Prune     bool             `json:"prune,omitempty"` // destroy instances absent from the document
+	Apply     bool             `json:"apply"`           // false = plan only, true = apply changes
+}
+
+// InstanceConfig is the desired configuration of a single instance within
+// an [ApplyConfigRequest]. Attributes is the complete desired state: unlike
+// [UpdateResourceInstanceRequest], it is not merged with the current state.
+type InstanceConfig struct {
+	Name       string     `json:"name"`                 // instance name as resource.label
+	Attributes State      `json:"attributes,omitempty"` // desired attribute values
+	Lifecycle  *Lifecycle `json:"lifecycle,omitempty"`  // lifecycle options, nil to keep the current options
+}
+
+// ApplyConfigResponse contains the combined plan in execution order and,
+// when apply was requested, the applied and destroyed instances.
+type ApplyConfigResponse struct {
+	Plan      []InstancePlan `json:"plan"`
+	Instances []InstanceMeta `json:"instances,omitempty"`
+	Destroyed []InstanceMeta `json:"destroyed,omitempty"`
+}
+
+// InstancePlan is the plan for a single instance within an
+// [ApplyConfigResponse].
+type InstancePlan struct {
+	Name string `json:"name"`
+	Plan Plan   `json:"plan"`
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// RESOURCE INSTANCE DRIFT
+
+// GetResourceInstanceDriftResponse reports the differences between the live
+// state of an instance and the state it was last applied with. The plan is
+// the update which would restore the applied state: for each change, Old is
+// the live value and New is the applied value. Its action is noop when the
+// instance has not drifted.
+type GetResourceInstanceDriftResponse struct {
+	Name string `json:"name"`
+	Plan Plan   `json:"plan"`
+}
+
 ///////////////////////////////////////////////////////////////////////////////
 // STRINGIFY
 
@@ -118,9 +226,88 @@ func (r DestroyResourceInstanceResponse) String() string {
 	return types.Stringify(r)
 }
 
+func (r ImportResourceInstanceResponse) String() string {
+	return types.Stringify(r)
+}
+
+func (r ApplyConfigResponse) String() string {
+	return types.Stringify(r)
+}
+
+func (r GetResourceInstanceDriftResponse) String() string {
+	return types.Stringify(r)
+}
+
 ///////////////////////////////////////////////////////////////////////////////
 // PUBLIC METHODS
 
+// ETag returns the entity tag for an instance generation, for use in the
+// ETag and If-Match headers.
+func ETag(generation uint64) string {
+	return strconv.Quote(strconv.FormatUint(generation, 10))
+}
+
+// ParseETag returns the instance generation from an entity tag returned by
+// [ETag]. Weak entity tags are rejected, since If-Match requires a strong
+// comparison.
+func ParseETag(etag string) (uint64, error) {
+	etag = strings.TrimSpace(etag)
+	if strings.HasPrefix(etag, "W/") {
+		return 0, fmt.Errorf("weak entity tag %s cannot be matched", etag)
+	}
+	value, err := strconv.Unquote(etag)
+	if err != nil || !strings.HasPrefix(etag, `"`) {
+		return 0, fmt.Errorf("invalid entity tag %s", etag)
+	}
+	generation, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid entity tag %s", etag)
+	}
+	return generation, nil
+}
+
+// ParseIfMatch returns the precondition of If-Match header values, which
+// are "*" or comma-separated lists of entity tags, or nil when there are no
+// values. Weak or invalid entity tags are kept out of Generations, so that
+// they never match.
+func ParseIfMatch(values ...string) *IfMatch {
+	var result *IfMatch
+	for _, value := range values {
+		for _, etag := range strings.Split(value, ",") {
+			if etag = strings.TrimSpace(etag); etag == "" {
+				continue
+			}
+			if result == nil {
+				result = new(IfMatch)
+			}
+			if etag == "*" {
+				result.Any = true
+			} else if generation, err := ParseETag(etag); err == nil {
+				result.Generations = append(result.Generations, generation)
+			}
+		}
+	}
+	return result
+}
+
+// Match returns true if an existing instance at the generation meets the
+// precondition.
+func (m IfMatch) Match(generation uint64) bool {
+	return m.Any || slices.Contains(m.Generations, generation)
+}
+
+// String returns the precondition as an If-Match header value.
+func (m IfMatch) String() string {
+	if m.Any {
+		return "*"
+	}
+	etags := make([]string, 0, len(m.Generations))
+	for _, generation := range m.Generations {
+		etags = append(etags, ETag(generation))
+	}
+	return strings.Join(etags, ", ")
+}
+
 func (r ListResourcesRequest) Query() url.Values {
 	v := url.Values{}
 	if t := strings.TrimSpace(types.Value(r.Type)); t != "" {
@@ -0,0 +1,60 @@
+package schema_test
+
+import (
+	"testing"
+
+	"github.com/mutablelogic/go-server/pkg/provider/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ETag_001(t *testing.T) {
+	assert := assert.New(t)
+	// Entity tags round-trip
+	for _, generation := range []uint64{0, 1, 42, 1<<64 - 1} {
+		etag := schema.ETag(generation)
+		parsed, err := schema.ParseETag(etag)
+		assert.NoError(err)
+		assert.Equal(generation, parsed)
+	}
+	assert.Equal(`"7"`, schema.ETag(7))
+}
+
+func Test_ETag_002(t *testing.T) {
+	assert := assert.New(t)
+	// Weak, unquoted and non-numeric tags are rejected
+	for _, etag := range []string{`W/"1"`, `1`, `"abc"`, `""`, `"-1"`} {
+		_, err := schema.ParseETag(etag)
+		assert.Error(err, etag)
+	}
+}
+
+func Test_IfMatch_001(t *testing.T) {
+	assert := assert.New(t)
+
+	// No values is no precondition
+	assert.Nil(schema.ParseIfMatch())
+	assert.Nil(schema.ParseIfMatch("", " , "))
+
+	// Lists of entity tags over several values, skipping weak and invalid tags
+	ifMatch := schema.ParseIfMatch(`"1", W/"2"`, `"3", abc`)
+	if assert.NotNil(ifMatch) {
+		assert.False(ifMatch.Any)
+		assert.Equal([]uint64{1, 3}, ifMatch.Generations)
+		assert.True(ifMatch.Match(3))
+		assert.False(ifMatch.Match(2))
+		assert.Equal(`"1", "3"`, ifMatch.String())
+	}
+
+	// Only weak tags never match
+	ifMatch = schema.ParseIfMatch(`W/"1"`)
+	if assert.NotNil(ifMatch) {
+		assert.False(ifMatch.Match(1))
+	}
+
+	// "*" matches any generation
+	ifMatch = schema.ParseIfMatch("*")
+	if assert.NotNil(ifMatch) {
+		assert.True(ifMatch.Match(0))
+		assert.Equal("*", ifMatch.String())
+	}
+}
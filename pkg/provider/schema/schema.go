@@ -78,6 +78,16 @@ type ResourceInstance interface {
 	References() []string
 }
 
+// Importable is optionally satisfied by resource instances which can adopt
+// an existing resource that was created outside the provider.
+type Importable interface {
+	// Import adopts the existing resource identified by id, so that the
+	// instance manages it from now on, and returns its live state as
+	// [ResourceInstance.Read] would. The format of id is defined by the
+	// resource type.
+	Import(context.Context, string) (State, error)
+}
+
 ///////////////////////////////////////////////////////////////////////////////
 // TYPES
 
@@ -88,12 +98,14 @@ const (
 	ActionCreate  Action = "create"
 	ActionUpdate  Action = "update"
 	ActionDestroy Action = "destroy"
+	ActionReplace Action = "replace"
 	ActionNoop    Action = "noop"
 )
 
 // Plan describes the changes that [Resource.Apply] would make.
 type Plan struct {
-	// Action is the high-level operation (create, update, destroy, noop).
+	// Action is the high-level operation (create, update, replace,
+	// destroy, noop).
 	Action Action
 
 	// Changes lists the individual field-level diffs. It is empty when
@@ -3,6 +3,7 @@ package schema
 import (
 	"fmt"
 	"reflect"
+	"slices"
 	"strconv"
 	"time"
 )
@@ -17,6 +18,14 @@ type State map[string]any
 // live [ResourceInstance], or returns nil if it does not exist.
 type Resolver func(name string) ResourceInstance
 
+// Configuration is implemented by validated configurations which are not
+// structs, such as those of resource instances in another process, so that
+// [StateOf] and [WritableStateOf] can return their state.
+type Configuration interface {
+	State() State
+	WritableState() State
+}
+
 ///////////////////////////////////////////////////////////////////////////////
 // GLOBALS
 
@@ -42,22 +51,30 @@ var (
 // [Resolver]. When the resolver is nil, any interface field whose key is
 // present in the state will cause an error. When a resolver returns nil
 // for a field marked required:"", an error is returned.
+//
+// Every field is decoded even when an earlier field fails, and the
+// failures are returned together as a [ValidationError].
 func (s State) Decode(v any, resolve Resolver) error {
 	rv := reflect.ValueOf(v)
 	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
 		return fmt.Errorf("Decode: expected pointer to struct, got %T", v)
 	}
-	if err := decodeStruct(s, rv.Elem(), "", resolve); err != nil {
-		return err
-	}
-	// Reject unknown keys
+	verr := new(ValidationError)
+	decodeStruct(s, rv.Elem(), "", resolve, verr)
+
+	// Reject unknown keys, in name order
 	known := knownFields(rv.Elem().Type(), "")
+	unknown := make([]string, 0, len(s))
 	for key := range s {
 		if !known[key] {
-			return fmt.Errorf("Decode: unknown attribute %q", key)
+			unknown = append(unknown, key)
 		}
 	}
-	return nil
+	slices.Sort(unknown)
+	for _, key := range unknown {
+		verr.Add(key, CodeUnknown, "unknown attribute")
+	}
+	return verr.Err()
 }
 
 // knownFields collects all valid state-map keys for a struct type,
@@ -95,7 +112,12 @@ func knownFields(t reflect.Type, prefix string) map[string]bool {
 // skipped.
 //
 // Duration values are stored as their string representation (e.g. "5m0s").
+// Block fields are stored as a []State, one for each element.
+// A [Configuration] returns its own state.
 func StateOf(resource any) State {
+	if c, ok := resource.(Configuration); ok {
+		return c.State()
+	}
 	rv := reflect.ValueOf(resource)
 	if rv.Kind() == reflect.Ptr {
 		rv = rv.Elem()
@@ -111,6 +133,9 @@ func StateOf(resource any) State {
 // WritableStateOf is like [StateOf] but excludes readonly fields.
 // It is intended for plan diffs where computed values should not appear.
 func WritableStateOf(resource any) State {
+	if c, ok := resource.(Configuration); ok {
+		return c.WritableState()
+	}
 	rv := reflect.ValueOf(resource)
 	if rv.Kind() == reflect.Ptr {
 		rv = rv.Elem()
@@ -214,6 +239,12 @@ func collectState(rv reflect.Value, prefix string, s State, skipReadOnly bool) {
 			continue
 		}
 
+		// Block fields: store the state of each element
+		if isBlock(field.Type) {
+			s[prefix+name] = blockState(rv.Field(i), skipReadOnly)
+			continue
+		}
+
 		// Prepend the prefix to the key
 		name = prefix + name
 
@@ -248,7 +279,7 @@ func stateValue(v reflect.Value) any {
 	return v.Interface()
 }
 
-func decodeStruct(s State, rv reflect.Value, prefix string, resolve Resolver) error {
+func decodeStruct(s State, rv reflect.Value, prefix string, resolve Resolver, verr *ValidationError) {
 	t := rv.Type()
 	for i := range t.NumField() {
 		field := t.Field(i)
@@ -261,9 +292,7 @@ func decodeStruct(s State, rv reflect.Value, prefix string, resolve Resolver) er
 		// Handle structs with embed:"" tag — recurse with prefix
 		if field.Type.Kind() == reflect.Struct && hasTag(field.Tag, "embed") {
 			childPrefix := prefix + field.Tag.Get("prefix")
-			if err := decodeStruct(s, rv.Field(i), childPrefix, resolve); err != nil {
-				return err
-			}
+			decodeStruct(s, rv.Field(i), childPrefix, resolve, verr)
 			continue
 		}
 
@@ -284,17 +313,18 @@ func decodeStruct(s State, rv reflect.Value, prefix string, resolve Resolver) er
 			refName, _ := s[name].(string)
 			if refName == "" {
 				if hasTag(field.Tag, "required") {
-					return fmt.Errorf("Decode: field %q: required reference not set", name)
+					verr.Add(name, CodeRequired, "required reference not set")
 				}
 				continue
 			}
 			if resolve == nil {
-				return fmt.Errorf("Decode: field %q: no resolver for reference %q", name, refName)
+				verr.Add(name, CodeReference, "no resolver for reference %q", refName)
+				continue
 			}
 			inst := resolve(refName)
 			if inst == nil {
 				if hasTag(field.Tag, "required") {
-					return fmt.Errorf("Decode: field %q: reference %q not found", name, refName)
+					verr.Add(name, CodeReference, "reference %q not found", refName)
 				}
 				continue
 			}
@@ -319,20 +349,35 @@ func decodeStruct(s State, rv reflect.Value, prefix string, resolve Resolver) er
 					}
 				}
 			default:
-				return fmt.Errorf("Decode: field %q: expected []string, got %T", name, raw)
+				verr.Add(name, CodeType, "expected []string, got %T", raw)
+				continue
 			}
 			if resolve == nil && len(names) > 0 {
-				return fmt.Errorf("Decode: field %q: no resolver for references", name)
+				verr.Add(name, CodeReference, "no resolver for references")
+				continue
 			}
 			result := reflect.MakeSlice(field.Type, 0, len(names))
+			resolved := true
 			for _, refName := range names {
 				inst := resolve(refName)
 				if inst == nil {
-					return fmt.Errorf("Decode: field %q: reference %q not found", name, refName)
+					verr.Add(name, CodeReference, "reference %q not found", refName)
+					resolved = false
+					continue
 				}
 				result = reflect.Append(result, reflect.ValueOf(inst))
 			}
-			rv.Field(i).Set(result)
+			if resolved {
+				rv.Field(i).Set(result)
+			}
+			continue
+		}
+
+		// Block fields — decode each element from its own state
+		if isBlock(field.Type) {
+			if raw, exists := s[name]; exists {
+				decodeBlocks(name, raw, rv.Field(i), resolve, verr)
+			}
 			continue
 		}
 
@@ -342,7 +387,7 @@ func decodeStruct(s State, rv reflect.Value, prefix string, resolve Resolver) er
 		if !exists {
 			if def, hasDef := field.Tag.Lookup("default"); hasDef {
 				if err := setField(rv.Field(i), def); err != nil {
-					return fmt.Errorf("Decode: field %q: default %q: %w", name, def, err)
+					verr.Add(name, CodeInvalid, "default %q: %v", def, err)
 				}
 			}
 			continue
@@ -350,10 +395,9 @@ func decodeStruct(s State, rv reflect.Value, prefix string, resolve Resolver) er
 
 		// Set the field value
 		if err := setField(rv.Field(i), val); err != nil {
-			return fmt.Errorf("Decode: field %q: %w", name, err)
+			verr.Add(name, CodeType, "%v", err)
 		}
 	}
-	return nil
 }
 
 // setField converts val to the type of dst and sets it.
@@ -0,0 +1,36 @@
+package schema
+
+import "context"
+
+///////////////////////////////////////////////////////////////////////////////
+// INTERFACES
+
+// StateStore persists the applied configuration of resource instances, so
+// that they can be re-created after a restart.
+type StateStore interface {
+	// List returns every stored instance.
+	List(context.Context) ([]StoredInstance, error)
+
+	// Put stores the instance, replacing any stored instance with the
+	// same name.
+	Put(context.Context, StoredInstance) error
+
+	// Delete removes the named instance. It is not an error if the
+	// instance is not stored.
+	Delete(context.Context, string) error
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// StoredInstance is the persisted form of a resource instance: its name,
+// resource type, writable state and lifecycle options. Sensitive attribute
+// values are not stored in State but sealed in Encrypted, keyed by
+// attribute name.
+type StoredInstance struct {
+	Name      string            `json:"name"`
+	Resource  string            `json:"resource"`
+	State     State             `json:"state,omitempty"`
+	Encrypted map[string]string `json:"encrypted,omitempty"`
+	Lifecycle *Lifecycle        `json:"lifecycle,omitempty"`
+}
@@ -0,0 +1,122 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	// Packages
+	httpresponse "github.com/mutablelogic/go-server/pkg/httpresponse"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// ValidationCode identifies the kind of failure reported by a [FieldError].
+type ValidationCode string
+
+const (
+	CodeRequired  ValidationCode = "required"  // a required attribute is not set
+	CodeUnknown   ValidationCode = "unknown"   // the attribute is not in the schema
+	CodeType      ValidationCode = "type"      // the value cannot be converted to the attribute type
+	CodeReference ValidationCode = "reference" // a reference cannot be resolved, or is of the wrong type
+	CodeEnum      ValidationCode = "enum"      // the value is not one of the permitted values
+	CodeRange     ValidationCode = "range"     // the value, length or number of elements is out of bounds
+	CodePattern   ValidationCode = "pattern"   // the value does not match the pattern
+	CodeInvalid   ValidationCode = "invalid"   // the value is otherwise invalid
+)
+
+// FieldError is a validation failure of a single attribute.
+type FieldError struct {
+	Attribute string         `json:"attribute"`
+	Code      ValidationCode `json:"code"`
+	Message   string         `json:"message"`
+}
+
+// ValidationError is a list of validation failures, one for each attribute
+// which failed, so that a client can report every failure at once. It is a
+// bad request error, and is returned as the detail of the error response.
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// LIFECYCLE
+
+// NewValidationError returns a validation error with a single failure.
+func NewValidationError(attribute string, code ValidationCode, format string, args ...any) *ValidationError {
+	verr := new(ValidationError)
+	verr.Add(attribute, code, format, args...)
+	return verr
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Add appends a failure for the attribute.
+func (e *ValidationError) Add(attribute string, code ValidationCode, format string, args ...any) {
+	e.Errors = append(e.Errors, FieldError{
+		Attribute: attribute,
+		Code:      code,
+		Message:   fmt.Sprintf(format, args...),
+	})
+}
+
+// Join appends the failures of err, which may be a [ValidationError] or
+// wrap one, skipping those already reported for the same attribute and
+// code. Other errors are appended as a failure of the attribute with code
+// [CodeInvalid]. A nil err is ignored.
+func (e *ValidationError) Join(attribute string, err error) {
+	if err == nil {
+		return
+	}
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		e.Add(attribute, CodeInvalid, "%v", err)
+		return
+	}
+	for _, fe := range verr.Errors {
+		if !slices.ContainsFunc(e.Errors, func(other FieldError) bool {
+			return other.Attribute == fe.Attribute && other.Code == fe.Code
+		}) {
+			e.Errors = append(e.Errors, fe)
+		}
+	}
+}
+
+// Err returns the validation error, or nil if there were no failures.
+func (e *ValidationError) Err() error {
+	if e == nil || len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Detail returns the validation error for the detail of an error response.
+func (e *ValidationError) Detail() any {
+	return e
+}
+
+// Unwrap returns [httpresponse.ErrBadRequest], so that a validation error
+// is reported with the bad request status code.
+func (e *ValidationError) Unwrap() error {
+	return httpresponse.ErrBadRequest
+}
+
+// Error returns the failures separated by semicolons.
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		msgs = append(msgs, fe.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Error returns the failure as "attribute: message".
+func (e FieldError) Error() string {
+	if e.Attribute == "" {
+		return e.Message
+	}
+	return e.Attribute + ": " + e.Message
+}
@@ -0,0 +1,71 @@
+package schema_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/mutablelogic/go-server/pkg/httpresponse"
+	"github.com/mutablelogic/go-server/pkg/provider/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ValidationError_001(t *testing.T) {
+	assert := assert.New(t)
+
+	// Decode reports every failing attribute, not just the first
+	resolver := func(name string) schema.ResourceInstance {
+		return nil
+	}
+	state := schema.State{"write_timeout": 5, "read_timeout": true, "bogus": 1}
+	var v httpserverResource
+	err := state.Decode(&v, resolver)
+	var verr *schema.ValidationError
+	if !assert.ErrorAs(err, &verr) {
+		return
+	}
+	codes := make(map[string]schema.ValidationCode)
+	for _, fe := range verr.Errors {
+		codes[fe.Attribute] = fe.Code
+	}
+	assert.Equal(map[string]schema.ValidationCode{
+		"write_timeout": schema.CodeType,
+		"read_timeout":  schema.CodeType,
+		"router":        schema.CodeRequired,
+		"bogus":         schema.CodeUnknown,
+	}, codes)
+}
+
+func Test_ValidationError_002(t *testing.T) {
+	assert := assert.New(t)
+
+	// A validation error is a bad request, and its message names each attribute
+	verr := schema.NewValidationError("a", schema.CodeRequired, "required")
+	verr.Add("b", schema.CodeInvalid, "must be %d or more", 1)
+	err := fmt.Errorf("instance %q: validate: %w", "x.y", verr.Err())
+	assert.ErrorIs(err, httpresponse.ErrBadRequest)
+	assert.Equal(`instance "x.y": validate: a: required; b: must be 1 or more`, err.Error())
+
+	// It serialises as a list of failures
+	data, err := json.Marshal(verr)
+	assert.NoError(err)
+	assert.JSONEq(`{"errors":[{"attribute":"a","code":"required","message":"required"},{"attribute":"b","code":"invalid","message":"must be 1 or more"}]}`, string(data))
+}
+
+func Test_ValidationError_003(t *testing.T) {
+	assert := assert.New(t)
+
+	// Join merges failures, skipping duplicates, and wraps other errors
+	verr := schema.NewValidationError("a", schema.CodeRequired, "required reference not set")
+	verr.Join("", schema.NewValidationError("a", schema.CodeRequired, "required"))
+	verr.Join("c", errors.New("other"))
+	verr.Join("d", nil)
+	if assert.Len(verr.Errors, 2) {
+		assert.Equal("required reference not set", verr.Errors[0].Message)
+		assert.Equal(schema.FieldError{Attribute: "c", Code: schema.CodeInvalid, Message: "other"}, verr.Errors[1])
+	}
+
+	// An empty validation error is not an error
+	assert.NoError(new(schema.ValidationError).Err())
+}
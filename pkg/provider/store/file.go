@@ -0,0 +1,139 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	// Packages
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// File is a [schema.StateStore] backed by a JSON file on disk. Instances
+// are held in memory and the whole file is rewritten on every change.
+type File struct {
+	Memory
+	path string
+}
+
+// file is the on-disk format of a [File] store.
+type file struct {
+	Instances []schema.StoredInstance `json:"instances"`
+}
+
+var _ schema.StateStore = (*File)(nil)
+
+///////////////////////////////////////////////////////////////////////////////
+// LIFECYCLE
+
+// NewFile returns a state store backed by the JSON file at path. If the
+// file exists its contents are loaded; otherwise the store starts empty and
+// the file is created on the first change. A file which cannot be decoded
+// is an error rather than discarded, since it holds the only copy of the
+// instances.
+func NewFile(path string) (*File, error) {
+	self := &File{
+		Memory: Memory{instances: make(map[string]schema.StoredInstance)},
+		path:   path,
+	}
+
+	// Load existing file (ignore if it doesn't exist)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return self, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var contents file
+	if err := json.Unmarshal(data, &contents); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, instance := range contents.Instances {
+		self.instances[instance.Name] = instance
+	}
+
+	// Return success
+	return self, nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Path returns the path of the JSON file.
+func (f *File) Path() string {
+	return f.path
+}
+
+// Put stores the instance and writes the file.
+func (f *File) Put(ctx context.Context, instance schema.StoredInstance) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	prev, exists := f.instances[instance.Name]
+	f.instances[instance.Name] = clone(instance)
+	if err := f.save(); err != nil {
+		if exists {
+			f.instances[instance.Name] = prev
+		} else {
+			delete(f.instances, instance.Name)
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete removes the named instance and writes the file.
+func (f *File) Delete(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	prev, exists := f.instances[name]
+	if !exists {
+		return nil
+	}
+	delete(f.instances, name)
+	if err := f.save(); err != nil {
+		f.instances[name] = prev
+		return err
+	}
+	return nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// save writes the store to disk as indented JSON, creating parent
+// directories as needed. The file is written to a temporary file and
+// renamed, so that a failed write does not corrupt the existing file. The
+// caller must hold f.mu.Lock().
+func (f *File) save() error {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(file{Instances: f.list()}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
@@ -0,0 +1,102 @@
+// Package store provides implementations of [schema.StateStore], which
+// persist the applied configuration of resource instances so that a
+// [provider.Manager] can restore them after a restart.
+package store
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	// Packages
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Memory is a [schema.StateStore] which holds instances in memory. It does
+// not survive a restart, and is intended for tests and for embedding in
+// other stores.
+type Memory struct {
+	mu        sync.RWMutex
+	instances map[string]schema.StoredInstance
+}
+
+var _ schema.StateStore = (*Memory)(nil)
+
+///////////////////////////////////////////////////////////////////////////////
+// LIFECYCLE
+
+// NewMemory returns an empty in-memory state store.
+func NewMemory() *Memory {
+	return &Memory{
+		instances: make(map[string]schema.StoredInstance),
+	}
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// List returns every stored instance, sorted by name.
+func (m *Memory) List(ctx context.Context) ([]schema.StoredInstance, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.list(), nil
+}
+
+// Put stores the instance, replacing any stored instance with the same name.
+func (m *Memory) Put(ctx context.Context, instance schema.StoredInstance) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.instances[instance.Name] = clone(instance)
+	return nil
+}
+
+// Delete removes the named instance.
+func (m *Memory) Delete(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.instances, name)
+	return nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// list returns a copy of every stored instance, sorted by name. The caller
+// must hold at least m.mu.RLock().
+func (m *Memory) list() []schema.StoredInstance {
+	result := make([]schema.StoredInstance, 0, len(m.instances))
+	for _, instance := range m.instances {
+		result = append(result, clone(instance))
+	}
+	slices.SortFunc(result, func(a, b schema.StoredInstance) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return result
+}
+
+// clone returns a copy of the instance which shares no maps or lifecycle
+// with it, so that callers cannot modify stored instances.
+func clone(instance schema.StoredInstance) schema.StoredInstance {
+	instance.State = maps.Clone(instance.State)
+	instance.Encrypted = maps.Clone(instance.Encrypted)
+	if instance.Lifecycle != nil {
+		lifecycle := *instance.Lifecycle
+		lifecycle.IgnoreChanges = slices.Clone(lifecycle.IgnoreChanges)
+		instance.Lifecycle = &lifecycle
+	}
+	return instance
+}
@@ -0,0 +1,88 @@
+package store_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	// Packages
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+	store "github.com/mutablelogic/go-server/pkg/provider/store"
+	assert "github.com/stretchr/testify/assert"
+)
+
+func Test_Memory_001(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	st := store.NewMemory()
+
+	// Put, replace, list and delete
+	assert.NoError(st.Put(ctx, schema.StoredInstance{Name: "b.main", Resource: "b", State: schema.State{"x": 1}}))
+	assert.NoError(st.Put(ctx, schema.StoredInstance{Name: "a.main", Resource: "a"}))
+	assert.NoError(st.Put(ctx, schema.StoredInstance{Name: "b.main", Resource: "b", State: schema.State{"x": 2}}))
+	list, err := st.List(ctx)
+	if assert.NoError(err) && assert.Len(list, 2) {
+		assert.Equal("a.main", list[0].Name)
+		assert.Equal(2, list[1].State["x"])
+	}
+
+	// Listed instances are copies
+	list[1].State["x"] = 3
+	list, _ = st.List(ctx)
+	assert.Equal(2, list[1].State["x"])
+
+	assert.NoError(st.Delete(ctx, "b.main"))
+	assert.NoError(st.Delete(ctx, "b.main"))
+	list, err = st.List(ctx)
+	assert.NoError(err)
+	assert.Len(list, 1)
+}
+
+func Test_File_001(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state", "instances.json")
+
+	// A missing file is an empty store
+	st, err := store.NewFile(path)
+	if !assert.NoError(err) {
+		return
+	}
+	list, err := st.List(ctx)
+	assert.NoError(err)
+	assert.Empty(list)
+
+	// Changes are written to the file
+	assert.NoError(st.Put(ctx, schema.StoredInstance{Name: "a.main", Resource: "a", State: schema.State{"x": "y"}, Encrypted: map[string]string{"k": "v"}}))
+	assert.NoError(st.Put(ctx, schema.StoredInstance{Name: "b.main", Resource: "b"}))
+	assert.NoError(st.Delete(ctx, "b.main"))
+	info, err := os.Stat(path)
+	if assert.NoError(err) {
+		assert.Equal(os.FileMode(0600), info.Mode().Perm())
+	}
+
+	// The file is loaded by a new store
+	st, err = store.NewFile(path)
+	if !assert.NoError(err) {
+		return
+	}
+	list, err = st.List(ctx)
+	if assert.NoError(err) && assert.Len(list, 1) {
+		assert.Equal("a.main", list[0].Name)
+		assert.Equal("y", list[0].State["x"])
+		assert.Equal("v", list[0].Encrypted["k"])
+	}
+}
+
+func Test_File_002(t *testing.T) {
+	assert := assert.New(t)
+
+	// A corrupt file is an error, and is not removed
+	path := filepath.Join(t.TempDir(), "instances.json")
+	assert.NoError(os.WriteFile(path, []byte("not json {{"), 0600))
+	_, err := store.NewFile(path)
+	assert.Error(err)
+	_, err = os.Stat(path)
+	assert.NoError(err)
+}
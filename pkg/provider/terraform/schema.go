@@ -0,0 +1,254 @@
+// Package terraform converts provider resource schemas into Terraform
+// provider schemas, in the format written by
+// "terraform providers schema -json", so that a Terraform provider for a
+// running server can be generated rather than maintained by hand.
+package terraform
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	// Packages
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// ProviderSchemas is the document written by "terraform providers schema
+// -json", keyed by provider source address.
+type ProviderSchemas struct {
+	FormatVersion   string                     `json:"format_version"`
+	ProviderSchemas map[string]*ProviderSchema `json:"provider_schemas"`
+}
+
+// ProviderSchema is the schema of the provider configuration and of each
+// resource type, keyed by Terraform resource type name.
+type ProviderSchema struct {
+	Provider        *Schema            `json:"provider"`
+	ResourceSchemas map[string]*Schema `json:"resource_schemas,omitempty"`
+}
+
+// Schema is a versioned block schema.
+type Schema struct {
+	Version int64  `json:"version"`
+	Block   *Block `json:"block"`
+}
+
+// Block is a configuration block, with attributes and nested blocks.
+type Block struct {
+	Attributes      map[string]*Attribute `json:"attributes,omitempty"`
+	BlockTypes      map[string]*BlockType `json:"block_types,omitempty"`
+	Description     string                `json:"description,omitempty"`
+	DescriptionKind string                `json:"description_kind,omitempty"`
+}
+
+// Attribute is a single attribute of a block. Type is a cty type in its
+// JSON form, such as "string" or ["list","string"].
+type Attribute struct {
+	Type            any    `json:"type"`
+	Description     string `json:"description,omitempty"`
+	DescriptionKind string `json:"description_kind,omitempty"`
+	Required        bool   `json:"required,omitempty"`
+	Optional        bool   `json:"optional,omitempty"`
+	Computed        bool   `json:"computed,omitempty"`
+	Sensitive       bool   `json:"sensitive,omitempty"`
+}
+
+// BlockType is a nested block, repeated according to its nesting mode.
+type BlockType struct {
+	NestingMode string `json:"nesting_mode"`
+	Block       *Block `json:"block"`
+	MinItems    int    `json:"min_items,omitempty"`
+	MaxItems    int    `json:"max_items,omitempty"`
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+const (
+	// FormatVersion is the version of the schema document format.
+	FormatVersion = "1.0"
+
+	// descriptionKind is the kind of every description.
+	descriptionKind = "plain"
+
+	// labelAttribute and idAttribute are added to every resource type for
+	// the instance label and the instance name.
+	labelAttribute = "name"
+	idAttribute    = "id"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// LIFECYCLE
+
+// New returns the Terraform provider schema for the resource types in resp,
+// for the provider with the given source address (for example
+// "registry.terraform.io/mutablelogic/kaiak"). Each resource type is named
+// with the last element of the source address as a prefix (for example
+// "kaiak_httpserver"), and has a required "name" attribute for the
+// instance label and a computed "id" attribute for the instance name, in
+// addition to its own attributes.
+func New(source string, resp *schema.ListResourcesResponse) (*ProviderSchemas, error) {
+	prefix := path.Base(source) + "_"
+	provider := &ProviderSchema{
+		Provider: &Schema{Block: &Block{
+			Attributes: map[string]*Attribute{
+				"endpoint": {
+					Type:            "string",
+					Description:     "Base URL of the server API",
+					DescriptionKind: descriptionKind,
+					Optional:        true,
+				},
+			},
+			Description:     resp.Description,
+			DescriptionKind: descriptionKind,
+		}},
+		ResourceSchemas: make(map[string]*Schema, len(resp.Resources)),
+	}
+	for _, r := range resp.Resources {
+		block, err := resourceBlock(prefix, r.Attributes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", r.Name, err)
+		}
+		provider.ResourceSchemas[typeName(prefix, r.Name)] = &Schema{Block: block}
+	}
+	return &ProviderSchemas{
+		FormatVersion:   FormatVersion,
+		ProviderSchemas: map[string]*ProviderSchema{source: provider},
+	}, nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// typeName returns the Terraform name of a resource type. Hyphens are not
+// allowed in resource type names, and are replaced with underscores.
+func typeName(prefix, name string) string {
+	return prefix + strings.ReplaceAll(name, "-", "_")
+}
+
+// resourceBlock returns the block of a resource type, with the label and
+// id attributes.
+func resourceBlock(prefix string, attrs []schema.Attribute) (*Block, error) {
+	block, err := attributesBlock(prefix, attrs)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range []string{labelAttribute, idAttribute} {
+		if _, exists := block.Attributes[name]; exists {
+			return nil, fmt.Errorf("attribute %q clashes with the instance %s", name, name)
+		}
+		if _, exists := block.BlockTypes[name]; exists {
+			return nil, fmt.Errorf("block %q clashes with the instance %s", name, name)
+		}
+	}
+	block.Attributes[labelAttribute] = &Attribute{
+		Type:            "string",
+		Description:     "Instance label",
+		DescriptionKind: descriptionKind,
+		Required:        true,
+	}
+	block.Attributes[idAttribute] = &Attribute{
+		Type:            "string",
+		Description:     "Instance name, as <type>.<label>",
+		DescriptionKind: descriptionKind,
+		Computed:        true,
+	}
+	return block, nil
+}
+
+// attributesBlock returns a block with the given attributes. Blocks of
+// nested objects become nested blocks in list mode.
+func attributesBlock(prefix string, attrs []schema.Attribute) (*Block, error) {
+	block := &Block{
+		Attributes:      make(map[string]*Attribute, len(attrs)),
+		DescriptionKind: descriptionKind,
+	}
+	for _, attr := range attrs {
+		if len(attr.Attributes) > 0 {
+			nested, err := attributesBlock(prefix, attr.Attributes)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", attr.Name, err)
+			}
+			nested.Description = attr.Description
+			bt := &BlockType{NestingMode: "list", Block: nested}
+			if attr.MinItems != nil {
+				bt.MinItems = *attr.MinItems
+			} else if attr.Required {
+				bt.MinItems = 1
+			}
+			if attr.MaxItems != nil {
+				bt.MaxItems = *attr.MaxItems
+			}
+			if block.BlockTypes == nil {
+				block.BlockTypes = make(map[string]*BlockType)
+			}
+			block.BlockTypes[attr.Name] = bt
+			continue
+		}
+		block.Attributes[attr.Name] = attribute(prefix, attr)
+	}
+	return block, nil
+}
+
+// attribute returns a single attribute. Read-only attributes are computed,
+// and attributes with a default are optional and computed, since the
+// server sets them when they are not configured.
+func attribute(prefix string, attr schema.Attribute) *Attribute {
+	result := &Attribute{
+		Description:     attr.Description,
+		DescriptionKind: descriptionKind,
+		Sensitive:       attr.Sensitive,
+	}
+	switch {
+	case attr.ReadOnly:
+		result.Computed = true
+	case attr.Required:
+		result.Required = true
+	default:
+		result.Optional = true
+		result.Computed = attr.Default != nil
+	}
+
+	// A reference is the name of an instance, or a list of names
+	if attr.Reference {
+		ref, list := strings.CutPrefix(attr.Type, "[]")
+		result.Type = "string"
+		if list {
+			result.Type = []any{"list", "string"}
+		}
+		if ref != "ref" {
+			result.Description = strings.TrimSpace(result.Description + fmt.Sprintf(" (the id of a %s)", typeName(prefix, ref)))
+		}
+		return result
+	}
+
+	// Return the attribute
+	result.Type = ctyType(attr.Type)
+	return result
+}
+
+// ctyType returns the cty type of an attribute type string. Types which
+// are not known are dynamic.
+func ctyType(t string) any {
+	if elem, ok := strings.CutPrefix(t, "[]"); ok {
+		return []any{"list", ctyType(elem)}
+	}
+	if rest, ok := strings.CutPrefix(t, "map["); ok {
+		if _, elem, ok := strings.Cut(rest, "]"); ok {
+			return []any{"map", ctyType(elem)}
+		}
+	}
+	switch t {
+	case "string", "duration", "time":
+		return "string"
+	case "int", "uint", "float":
+		return "number"
+	case "bool":
+		return "bool"
+	default:
+		return "dynamic"
+	}
+}
@@ -0,0 +1,119 @@
+package terraform_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	// Packages
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+	terraform "github.com/mutablelogic/go-server/pkg/provider/terraform"
+	assert "github.com/stretchr/testify/assert"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// MOCK TYPES
+
+type ruleBlock struct {
+	Path    string   `name:"path" required:""`
+	Methods []string `name:"methods"`
+}
+
+type routerConfig struct {
+	Prefix    string                    `name:"prefix" default:"/api" help:"Path prefix"`
+	Server    schema.ResourceInstance   `name:"server" type:"httpserver" required:""`
+	Handlers  []schema.ResourceInstance `name:"handlers"`
+	Token     string                    `name:"token" sensitive:""`
+	Port      uint                      `name:"port"`
+	Endpoints []string                  `name:"endpoints" readonly:""`
+	Headers   map[string]string         `name:"headers"`
+	Rules     []ruleBlock               `name:"rule" max:"4"`
+}
+
+func providerSchema(t *testing.T, attrs ...schema.Attribute) *terraform.ProviderSchema {
+	t.Helper()
+	schemas, err := terraform.New("registry.terraform.io/mutablelogic/kaiak", &schema.ListResourcesResponse{
+		Provider:  "test",
+		Resources: []schema.ResourceMeta{{Name: "http-router", Attributes: attrs}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schemas.ProviderSchemas["registry.terraform.io/mutablelogic/kaiak"]
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// TESTS
+
+func Test_Terraform_001(t *testing.T) {
+	assert := assert.New(t)
+
+	// Resource types are prefixed, with the label and id attributes
+	provider := providerSchema(t, schema.AttributesOf(routerConfig{})...)
+	if !assert.NotNil(provider) {
+		return
+	}
+	assert.NotNil(provider.Provider.Block.Attributes["endpoint"])
+	router := provider.ResourceSchemas["kaiak_http_router"]
+	if !assert.NotNil(router) {
+		return
+	}
+	attrs := router.Block.Attributes
+	assert.True(attrs["name"].Required)
+	assert.True(attrs["id"].Computed)
+
+	// Attributes are mapped onto HCL types
+	assert.Equal("string", attrs["prefix"].Type)
+	assert.True(attrs["prefix"].Optional)
+	assert.True(attrs["prefix"].Computed)
+	assert.Equal("number", attrs["port"].Type)
+	assert.False(attrs["port"].Computed)
+	assert.True(attrs["token"].Sensitive)
+	assert.Equal([]any{"list", "string"}, attrs["endpoints"].Type)
+	assert.True(attrs["endpoints"].Computed)
+	assert.False(attrs["endpoints"].Optional)
+	assert.Equal([]any{"map", "string"}, attrs["headers"].Type)
+
+	// References are the ids of other instances
+	assert.Equal("string", attrs["server"].Type)
+	assert.True(attrs["server"].Required)
+	assert.Contains(attrs["server"].Description, "kaiak_httpserver")
+	assert.Equal([]any{"list", "string"}, attrs["handlers"].Type)
+
+	// Blocks are nested blocks
+	if rule := router.Block.BlockTypes["rule"]; assert.NotNil(rule) {
+		assert.Equal("list", rule.NestingMode)
+		assert.Equal(4, rule.MaxItems)
+		assert.True(rule.Block.Attributes["path"].Required)
+	}
+}
+
+func Test_Terraform_002(t *testing.T) {
+	assert := assert.New(t)
+
+	// An attribute which clashes with the label is rejected
+	_, err := terraform.New("kaiak", &schema.ListResourcesResponse{
+		Resources: []schema.ResourceMeta{{Name: "logger", Attributes: []schema.Attribute{{Name: "name", Type: "string"}}}},
+	})
+	assert.Error(err)
+}
+
+func Test_Terraform_003(t *testing.T) {
+	assert := assert.New(t)
+
+	// The document has the format of "terraform providers schema -json"
+	provider := providerSchema(t, schema.Attribute{Name: "debug", Type: "bool"})
+	data, err := json.Marshal(provider.ResourceSchemas["kaiak_http_router"])
+	if assert.NoError(err) {
+		assert.JSONEq(`{
+			"version": 0,
+			"block": {
+				"attributes": {
+					"debug": {"type": "bool", "description_kind": "plain", "optional": true},
+					"id": {"type": "string", "description": "Instance name, as <type>.<label>", "description_kind": "plain", "computed": true},
+					"name": {"type": "string", "description": "Instance label", "description_kind": "plain", "required": true}
+				},
+				"description_kind": "plain"
+			}
+		}`, string(data))
+	}
+}
@@ -0,0 +1,213 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	// Packages
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Tx is a transaction which applies several instance updates as a single
+// operation. Updates are staged with [Tx.Update] and applied in order by
+// [Tx.Commit]; if any update fails, the instances already updated are
+// restored to their previous state. A Tx is not safe for concurrent use.
+type Tx struct {
+	manager *Manager
+	updates []txUpdate
+	done    bool
+}
+
+// txUpdate is an update staged in a [Tx].
+type txUpdate struct {
+	name  string
+	attrs schema.State
+}
+
+// step is a validated and planned change to an instance, with the state
+// needed to revert it.
+type step struct {
+	instance  instance
+	config    any
+	plan      schema.Plan
+	attrs     schema.State     // validated state
+	previous  schema.State     // state before the step, nil if never applied
+	lifecycle schema.Lifecycle // lifecycle options before the step
+	created   bool             // the instance is created by the step
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// LIFECYCLE
+
+// Begin starts a transaction. Nothing is locked or applied until
+// [Tx.Commit] is called.
+func (m *Manager) Begin() *Tx {
+	return &Tx{manager: m}
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Update stages an update of the named instance. As with
+// [Manager.UpdateResourceInstance], attrs are merged on top of the
+// instance's state at the time the update is applied, so an update may
+// reference an instance updated earlier in the same transaction.
+func (tx *Tx) Update(name string, attrs schema.State) error {
+	if tx.done {
+		return ErrConflict.With("transaction is already committed")
+	}
+	tx.updates = append(tx.updates, txUpdate{name: name, attrs: attrs})
+	return nil
+}
+
+// Commit validates, plans and applies each staged update in the order it
+// was staged, with every instance locked. If an update fails, each instance
+// already updated is restored by re-applying its previous state, in reverse
+// order, and the error is returned joined with any errors from the
+// restore. An update which is applied but cannot be saved to the state
+// store is kept, and the responses are returned together with a
+// [PersistError]. A transaction can only be committed once.
+func (tx *Tx) Commit(ctx context.Context) ([]schema.UpdateResourceInstanceResponse, error) {
+	m := tx.manager
+	m.graph.Lock()
+	defer m.graph.Unlock()
+
+	// Check the transaction
+	if tx.done {
+		return nil, ErrConflict.With("transaction is already committed")
+	}
+	tx.done = true
+
+	// Check context
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Plan and apply each update in turn, so that each is validated
+	// against the instances updated before it. An instance which was
+	// applied but not persisted is kept.
+	var perr error
+	applied := make([]step, 0, len(tx.updates))
+	result := make([]schema.UpdateResourceInstanceResponse, 0, len(tx.updates))
+	for _, update := range tx.updates {
+		step, err := m.planUpdate(ctx, update.name, update.attrs, nil)
+		if err == nil {
+			err = m.applyInstance(ctx, step.instance, step.config)
+		}
+		if isPersistError(err) {
+			perr = errors.Join(perr, err)
+		} else if err != nil {
+			return nil, errors.Join(err, m.revertSteps(ctx, applied))
+		}
+		applied = append(applied, step)
+		inst, _ := m.get(update.name)
+		result = append(result, schema.UpdateResourceInstanceResponse{
+			Instance: m.instanceMeta(ctx, inst),
+			Plan:     step.plan,
+		})
+	}
+
+	// Return the responses, with any persist errors
+	return result, perr
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// applySteps applies the steps in layers, skipping no-op updates which do
+// not change the lifecycle options, so that each step is applied after the
+// steps for the instances it references, and steps which do not depend on
+// each other are applied concurrently. If a step fails, the rest of its
+// layer completes and then the steps already applied are reverted.
+// The caller must hold m.graph.Lock().
+func (m *Manager) applySteps(ctx context.Context, steps []step) error {
+	byName := make(map[string]step, len(steps))
+	names := make(map[string]bool, len(steps))
+	for _, step := range steps {
+		if !step.created && step.plan.Action == schema.ActionNoop && step.lifecycle.Equal(step.instance.lifecycle) {
+			continue
+		}
+		name := step.instance.instance.Name()
+		byName[name] = step
+		names[name] = true
+	}
+
+	// Each step waits for the steps of the instances it references
+	order := layers(names, func(name string) []string {
+		s := byName[name]
+		return schema.ReferencesFromState(s.instance.instance.Resource().Schema(), s.attrs)
+	})
+
+	// Apply the layers, and revert the steps applied if any fails
+	done, err := m.runLayers(ctx, order, false, func(ctx context.Context, name string) error {
+		step := byName[name]
+		if step.created {
+			m.publishNew(step.instance.instance)
+		}
+		return m.applyInstance(ctx, step.instance, step.config)
+	})
+	if err != nil {
+		applied := make([]step, 0, len(done))
+		for _, name := range done {
+			applied = append(applied, byName[name])
+		}
+		return errors.Join(err, m.revertSteps(ctx, applied))
+	}
+	return nil
+}
+
+// revertSteps restores the instances changed by the applied steps, in
+// reverse order, returning all errors encountered but continuing with the
+// remaining steps. Instances created by a step are destroyed and removed,
+// instances which had never been applied are destroyed, and others are
+// re-applied with their previous state.
+// The caller must hold m.graph.Lock().
+func (m *Manager) revertSteps(ctx context.Context, applied []step) error {
+	var result error
+	for i := len(applied) - 1; i >= 0; i-- {
+		if err := m.revertStep(ctx, applied[i]); err != nil {
+			result = errors.Join(result, fmt.Errorf("instance %q: revert: %w", applied[i].instance.instance.Name(), err))
+		}
+	}
+	return result
+}
+
+// revertStep restores the instance changed by a single applied step.
+// The caller must hold m.graph.Lock().
+func (m *Manager) revertStep(ctx context.Context, s step) error {
+	inst := s.instance
+
+	// Created instances are removed again
+	if s.created {
+		_, err := m.destroyInstance(ctx, inst)
+		return err
+	}
+
+	// Instances which had never been applied are torn down, but kept
+	if s.previous == nil {
+		m.notifyRemovals(inst.instance)
+		m.unwireObservers(inst.instance)
+		if err := inst.instance.Destroy(ctx); err != nil {
+			return err
+		}
+		if current, exists := m.get(inst.instance.Name()); exists {
+			current.applied = nil
+			current.lifecycle = s.lifecycle
+			m.set(current)
+		}
+		return m.unpersist(ctx, inst.instance.Name())
+	}
+
+	// Other instances are re-applied with their previous state and
+	// lifecycle options
+	inst.lifecycle = s.lifecycle
+	config, err := inst.instance.Validate(ctx, s.previous, m.resolver())
+	if err != nil {
+		return fmt.Errorf("validate: %w", err)
+	}
+	return m.applyInstance(ctx, inst, config)
+}
@@ -0,0 +1,141 @@
+package provider_test
+
+import (
+	"context"
+	"testing"
+
+	// Packages
+	provider "github.com/mutablelogic/go-server/pkg/provider"
+	schema "github.com/mutablelogic/go-server/pkg/provider/schema"
+	store "github.com/mutablelogic/go-server/pkg/provider/store"
+	assert "github.com/stretchr/testify/assert"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TESTS - TRANSACTIONS
+
+func Test_Manager_Tx_001(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	mgr := newPersistManager(t)
+	assert.NoError(applySecret(t, mgr, "secret.a", schema.State{"port": 1}))
+	assert.NoError(applySecret(t, mgr, "secret.b", schema.State{"port": 1}))
+
+	// Staged updates are applied in order on commit
+	tx := mgr.Begin()
+	assert.NoError(tx.Update("secret.a", schema.State{"port": 2}))
+	assert.NoError(tx.Update("secret.b", schema.State{"dep": "secret.a"}))
+	a, _ := mgr.GetResourceInstance(ctx, "secret.a")
+	assert.Equal(1, a.Instance.State["port"])
+
+	resp, err := tx.Commit(ctx)
+	if !assert.NoError(err) || !assert.Len(resp, 2) {
+		return
+	}
+	assert.Equal(schema.ActionUpdate, resp[0].Plan.Action)
+	assert.Equal(2, resp[0].Instance.State["port"])
+	assert.Equal([]string{"secret.a"}, resp[1].Instance.References)
+
+	// A transaction can only be committed once
+	_, err = tx.Commit(ctx)
+	assert.Error(err)
+	assert.Error(tx.Update("secret.a", schema.State{"port": 3}))
+}
+
+func Test_Manager_Tx_002(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	st := store.NewMemory()
+	mgr := newPersistManager(t, provider.WithStateStore(st))
+	assert.NoError(applySecret(t, mgr, "secret.a", schema.State{"port": 1}))
+	assert.NoError(applySecret(t, mgr, "secret.b", schema.State{"port": 1}))
+	assert.NoError(applySecret(t, mgr, "secret.c", schema.State{"port": 1}))
+
+	// When an update fails, earlier updates are reverted
+	tx := mgr.Begin()
+	assert.NoError(tx.Update("secret.a", schema.State{"port": 2}))
+	assert.NoError(tx.Update("secret.b", schema.State{"dep": "secret.a", "port": 2}))
+	assert.NoError(tx.Update("secret.c", schema.State{"port": -1}))
+	_, err := tx.Commit(ctx)
+	assert.ErrorContains(err, "invalid port")
+
+	for _, name := range []string{"secret.a", "secret.b", "secret.c"} {
+		resp, err := mgr.GetResourceInstance(ctx, name)
+		if assert.NoError(err) {
+			assert.Equal(1, resp.Instance.State["port"], name)
+			assert.Empty(resp.Instance.References, name)
+		}
+	}
+
+	// The state store holds the reverted state
+	stored, err := st.List(ctx)
+	if assert.NoError(err) && assert.Len(stored, 3) {
+		for _, rec := range stored {
+			assert.Equal(1, rec.State["port"], rec.Name)
+		}
+	}
+
+	// Validation failures also revert earlier updates
+	tx = mgr.Begin()
+	assert.NoError(tx.Update("secret.a", schema.State{"port": 2}))
+	assert.NoError(tx.Update("secret.missing", schema.State{"port": 2}))
+	_, err = tx.Commit(ctx)
+	assert.ErrorIs(err, provider.ErrNotFound)
+	a, _ := mgr.GetResourceInstance(ctx, "secret.a")
+	assert.Equal(1, a.Instance.State["port"])
+}
+
+func Test_Manager_Tx_003(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	mgr := newPersistManager(t)
+	assert.NoError(applySecret(t, mgr, "secret.a", schema.State{"port": 1}))
+
+	// A failed ApplyConfig reverts updates and removes created instances
+	_, err := mgr.ApplyConfig(ctx, schema.ApplyConfigRequest{
+		Instances: []schema.InstanceConfig{
+			{Name: "secret.a", Attributes: schema.State{"port": 2}},
+			{Name: "secret.b", Attributes: schema.State{"dep": "secret.a"}},
+			{Name: "secret.c", Attributes: schema.State{"dep": "secret.b", "port": -1}},
+		},
+		Apply: true,
+	})
+	assert.ErrorContains(err, "invalid port")
+
+	a, err := mgr.GetResourceInstance(ctx, "secret.a")
+	if assert.NoError(err) {
+		assert.Equal(1, a.Instance.State["port"])
+	}
+	_, err = mgr.GetResourceInstance(ctx, "secret.b")
+	assert.ErrorIs(err, provider.ErrNotFound)
+	_, err = mgr.GetResourceInstance(ctx, "secret.c")
+	assert.ErrorIs(err, provider.ErrNotFound)
+}
+
+func Test_Manager_Tx_004(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	st := &failStore{Memory: store.NewMemory()}
+	mgr := newPersistManager(t, provider.WithStateStore(st))
+	assert.NoError(applySecret(t, mgr, "secret.a", schema.State{"port": 1}))
+	assert.NoError(applySecret(t, mgr, "secret.b", schema.State{"port": 1}))
+
+	// When the applied instances cannot be persisted, they are kept and
+	// returned with the error
+	st.fail = true
+	tx := mgr.Begin()
+	assert.NoError(tx.Update("secret.a", schema.State{"port": 2}))
+	assert.NoError(tx.Update("secret.b", schema.State{"port": 2}))
+	resp, err := tx.Commit(ctx)
+	var perr *provider.PersistError
+	if assert.ErrorAs(err, &perr) && assert.Len(resp, 2) {
+		assert.Equal(2, resp[0].Instance.State["port"])
+		assert.Equal(2, resp[1].Instance.State["port"])
+	}
+	for _, name := range []string{"secret.a", "secret.b"} {
+		get, err := mgr.GetResourceInstance(ctx, name)
+		if assert.NoError(err) {
+			assert.Equal(2, get.Instance.State["port"], name)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package tui
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	// Packages
+	lipgloss "github.com/charmbracelet/lipgloss"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// DiffOp is the operation on a value in a diff.
+type DiffOp rune
+
+type diff struct {
+	op    DiffOp
+	title string
+	lines []diffLine
+}
+
+type diffLine struct {
+	op       DiffOp
+	field    string
+	old, new any
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+const (
+	DiffNone   DiffOp = ' '
+	DiffAdd    DiffOp = '+'
+	DiffChange DiffOp = '~'
+	DiffRemove DiffOp = '-'
+)
+
+// diffIndent is the indent of each field under the title.
+const diffIndent = "    "
+
+///////////////////////////////////////////////////////////////////////////////
+// LIFECYCLE
+
+// Diff returns a diff with a title line, which is marked with op.
+func Diff(op DiffOp, title string) *diff {
+	return &diff{
+		op:    op,
+		title: strings.TrimSpace(title),
+	}
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// RENDER
+
+// Append adds a field to the diff. A field without an old value is added,
+// a field without a new value is removed, and otherwise it is changed.
+func (d *diff) Append(field string, old, new any) *diff {
+	op := DiffChange
+	switch {
+	case old == nil:
+		op = DiffAdd
+	case new == nil:
+		op = DiffRemove
+	}
+	d.lines = append(d.lines, diffLine{op: op, field: field, old: old, new: new})
+	return d
+}
+
+// Write renders the diff. Colors are only used when w is a terminal.
+func (d *diff) Write(w io.Writer) (int, error) {
+	renderer := lipgloss.NewRenderer(w)
+	styles := map[DiffOp]lipgloss.Style{
+		DiffNone:   renderer.NewStyle(),
+		DiffAdd:    renderer.NewStyle().Foreground(lipgloss.Color("10")),
+		DiffChange: renderer.NewStyle().Foreground(lipgloss.Color("11")),
+		DiffRemove: renderer.NewStyle().Foreground(lipgloss.Color("9")),
+	}
+	style := func(op DiffOp) lipgloss.Style {
+		if s, exists := styles[op]; exists {
+			return s
+		}
+		return styles[DiffNone]
+	}
+
+	var b strings.Builder
+	b.WriteString(style(d.op).Render(string(d.op)) + " " + renderer.NewStyle().Bold(true).Render(d.title) + "\n")
+	for _, line := range d.lines {
+		var value string
+		switch line.op {
+		case DiffAdd:
+			value = diffValue(line.new)
+		case DiffRemove:
+			value = diffValue(line.old)
+		default:
+			value = diffValue(line.old) + " -> " + diffValue(line.new)
+		}
+		b.WriteString(diffIndent + style(line.op).Render(string(line.op)+" "+line.field) + " = " + value + "\n")
+	}
+	return io.WriteString(w, b.String())
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// diffValue formats a value as compact JSON, or with fmt when it cannot be
+// marshalled.
+func diffValue(v any) string {
+	if data, err := json.Marshal(v); err == nil {
+		return string(data)
+	}
+	return fmt.Sprint(v)
+}
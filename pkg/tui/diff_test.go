@@ -0,0 +1,45 @@
+package tui
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffWriteTitleOnly(t *testing.T) {
+	var buffer bytes.Buffer
+
+	n, err := Diff(DiffNone, "httpserver.main").Write(&buffer)
+	require.NoError(t, err)
+	assert.Equal(t, len(buffer.String()), n)
+	assert.Equal(t, "  httpserver.main\n", buffer.String())
+}
+
+func TestDiffWriteChanges(t *testing.T) {
+	var buffer bytes.Buffer
+
+	_, err := Diff(DiffChange, "httpserver.main").
+		Append("router", nil, "httprouter.main").
+		Append("listen", "localhost:8080", "localhost:9090").
+		Append("timeout", 5, nil).
+		Write(&buffer)
+	require.NoError(t, err)
+	assert.Equal(t, "~ httpserver.main\n"+
+		"    + router = \"httprouter.main\"\n"+
+		"    ~ listen = \"localhost:8080\" -> \"localhost:9090\"\n"+
+		"    - timeout = 5\n", buffer.String())
+}
+
+func TestDiffWriteValues(t *testing.T) {
+	var buffer bytes.Buffer
+
+	_, err := Diff(DiffAdd, "logger.main").
+		Append("tags", nil, []string{"a", "b"}).
+		Append("fn", nil, func() {}).
+		Write(&buffer)
+	require.NoError(t, err)
+	assert.Contains(t, buffer.String(), "    + tags = [\"a\",\"b\"]\n")
+	assert.Contains(t, buffer.String(), "    + fn = 0x")
+}